@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"payment_service/domain/model"
+	"payment_service/internal/service"
+	"payment_service/internal/token"
+)
+
+// APIKeyHeader names the request header carrying the caller's API key
+const APIKeyHeader = "X-API-Key"
+
+// Gin context keys of the request's authenticated caller
+const (
+	apiKeyContextKey      = "apiKey"
+	tokenClaimsContextKey = "tokenClaims"
+)
+
+// AuthController authenticates API requests
+type AuthController struct {
+	apiKeySvc   *service.APIKeyService
+	tokenSecret []byte
+}
+
+// NewAuthController creates a new auth controller. End-user access tokens
+// are verified with tokenSecret; an empty secret rejects them all.
+func NewAuthController(apiKeySvc *service.APIKeyService, tokenSecret string) *AuthController {
+	return &AuthController{
+		apiKeySvc:   apiKeySvc,
+		tokenSecret: []byte(tokenSecret),
+	}
+}
+
+// RequireScope returns middleware admitting only requests whose API key
+// grants scope. Keys act for their own tenant; admin keys may select any
+// tenant with the tenant header.
+func (c *AuthController) RequireScope(scope model.APIKeyScope) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		rawKey := ctx.GetHeader(APIKeyHeader)
+		if rawKey == "" {
+			abortWithError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "missing API key in the "+APIKeyHeader+" header")
+			return
+		}
+
+		key, err := c.apiKeySvc.Authenticate(ctx, rawKey)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidAPIKey) {
+				abortWithError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "invalid API key")
+				return
+			}
+			abortWithError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+			return
+		}
+
+		if !key.HasScope(scope) {
+			abortWithError(ctx, http.StatusForbidden, ErrCodeForbidden, "API key lacks the "+string(scope)+" scope")
+			return
+		}
+		if tenant := ctx.GetHeader(TenantHeader); tenant != "" && tenant != key.TenantID && !key.HasScope(model.ScopeAdmin) {
+			abortWithError(ctx, http.StatusForbidden, ErrCodeForbidden, "API key does not belong to tenant "+tenant)
+			return
+		}
+
+		ctx.Set(apiKeyContextKey, key)
+		ctx.Next()
+	}
+}
+
+// RequireScopeOrCustomer returns middleware admitting requests whose API key
+// grants scope, and end users presenting an access token as a bearer token.
+// Handlers limit end users to their own invoices, see customerOnly.
+func (c *AuthController) RequireScopeOrCustomer(scope model.APIKeyScope) gin.HandlerFunc {
+	requireScope := c.RequireScope(scope)
+	return func(ctx *gin.Context) {
+		rawToken, isBearer := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if ctx.GetHeader(APIKeyHeader) != "" || !isBearer {
+			requireScope(ctx)
+			return
+		}
+
+		claims, err := token.Verify(c.tokenSecret, strings.TrimSpace(rawToken), time.Now())
+		if err != nil {
+			abortWithError(ctx, http.StatusUnauthorized, ErrCodeUnauthorized, "invalid access token")
+			return
+		}
+		if claims.TenantID == "" {
+			claims.TenantID = model.DefaultTenantID
+		}
+		if tenant := ctx.GetHeader(TenantHeader); tenant != "" && tenant != claims.TenantID {
+			abortWithError(ctx, http.StatusForbidden, ErrCodeForbidden, "access token does not belong to tenant "+tenant)
+			return
+		}
+
+		ctx.Set(tokenClaimsContextKey, claims)
+		ctx.Next()
+	}
+}
+
+// customerOnly returns the customer a request is limited to: the subject of
+// an end user's access token. Requests made with an API key or an admin
+// token may read every customer's invoices.
+func customerOnly(ctx *gin.Context) (string, bool) {
+	value, ok := ctx.Get(tokenClaimsContextKey)
+	if !ok {
+		return "", false
+	}
+	claims, ok := value.(token.Claims)
+	if !ok || claims.Admin() {
+		return "", false
+	}
+	return claims.Subject, true
+}
+
+// canReadInvoice reports whether the request may read an invoice. End users
+// may only read their own; callers should answer as if other invoices did
+// not exist.
+func canReadInvoice(ctx *gin.Context, invoice model.Invoice) bool {
+	customerID, limited := customerOnly(ctx)
+	return !limited || invoice.CustomerID == customerID
+}
+
+// apiKey returns the API key the request was authenticated with
+func apiKey(ctx *gin.Context) (model.APIKey, bool) {
+	value, ok := ctx.Get(apiKeyContextKey)
+	if !ok {
+		return model.APIKey{}, false
+	}
+	key, ok := value.(model.APIKey)
+	return key, ok
+}
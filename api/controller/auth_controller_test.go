@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"payment_service/config"
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+	"payment_service/internal/service"
+	"payment_service/internal/token"
+)
+
+const testTokenSecret = "test-token-secret-of-at-least-32-chars"
+
+func TestCustomerInvoiceAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	invoices := repository.NewMemoryInvoiceStore()
+	invoiceSvc := service.NewInvoiceService(repository.NewMemoryStore(invoices))
+	apiKeySvc := service.NewAPIKeyService(repository.NewMemoryAPIKeyStore())
+	vnpayController := NewVNPayController(nil, invoiceSvc, config.NewVNPayStore(config.VNPayConfig{}))
+	merchantSvc := service.NewMerchantService(repository.NewMemoryMerchantStore(model.Merchant{
+		TenantID: model.DefaultTenantID, Name: "Default", TmnCode: "DEFAULT1", HashSecret: "secret", Active: true,
+	}), config.NewVNPayStore(config.VNPayConfig{}), model.Seller{})
+	invoiceController := NewInvoiceController(invoiceSvc, nil, service.NewReceiptService(invoiceSvc, merchantSvc))
+	authController := NewAuthController(apiKeySvc, testTokenSecret)
+
+	r := gin.New()
+	readOwn := authController.RequireScopeOrCustomer(model.ScopeInvoicesRead)
+	r.GET("/api/invoices/:id", readOwn, vnpayController.GetInvoice)
+	r.GET("/api/invoices/customer/:customerId", readOwn, vnpayController.GetInvoicesByCustomer)
+	r.GET("/api/invoices/:id/receipt.pdf", readOwn, invoiceController.GetReceipt)
+
+	alice, err := invoices.CreateInvoice(ctx, model.Invoice{CustomerID: "alice", TotalAmount: 1000, FinalAmount: 1000})
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+	bob, err := invoices.CreateInvoice(ctx, model.Invoice{CustomerID: "bob", TotalAmount: 2000, FinalAmount: 2000})
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+	_, rawKey, err := apiKeySvc.CreateAPIKey(ctx, model.DefaultTenantID, "backoffice", []model.APIKeyScope{model.ScopeInvoicesRead}, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	sign := func(secret string, claims token.Claims) string {
+		if claims.ExpiresAt == 0 {
+			claims.ExpiresAt = time.Now().Add(time.Hour).Unix()
+		}
+		signed, err := token.Sign([]byte(secret), claims)
+		if err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+		return "Bearer " + signed
+	}
+	aliceToken := sign(testTokenSecret, token.Claims{Subject: "alice"})
+
+	for _, tt := range []struct {
+		name    string
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{"own invoice", "/api/invoices/" + alice.InvoiceID.String(), map[string]string{"Authorization": aliceToken}, http.StatusOK},
+		{"other customer's invoice", "/api/invoices/" + bob.InvoiceID.String(), map[string]string{"Authorization": aliceToken}, http.StatusNotFound},
+		{"own invoices", "/api/invoices/customer/alice", map[string]string{"Authorization": aliceToken}, http.StatusOK},
+		{"other customer's invoices", "/api/invoices/customer/bob", map[string]string{"Authorization": aliceToken}, http.StatusNotFound},
+		{"receipt of own unpaid invoice", "/api/invoices/" + alice.InvoiceID.String() + "/receipt.pdf", map[string]string{"Authorization": aliceToken}, http.StatusConflict},
+		{"receipt of other customer's unpaid invoice", "/api/invoices/" + bob.InvoiceID.String() + "/receipt.pdf", map[string]string{"Authorization": aliceToken}, http.StatusNotFound},
+		{"admin token", "/api/invoices/" + bob.InvoiceID.String(), map[string]string{"Authorization": sign(testTokenSecret, token.Claims{Subject: "staff-1", Scope: "admin"})}, http.StatusOK},
+		{"API key", "/api/invoices/" + bob.InvoiceID.String(), map[string]string{APIKeyHeader: rawKey}, http.StatusOK},
+		{"expired token", "/api/invoices/" + alice.InvoiceID.String(), map[string]string{"Authorization": sign(testTokenSecret, token.Claims{Subject: "alice", ExpiresAt: time.Now().Add(-time.Minute).Unix()})}, http.StatusUnauthorized},
+		{"token signed with another secret", "/api/invoices/" + alice.InvoiceID.String(), map[string]string{"Authorization": sign("another-secret-of-at-least-32-characters", token.Claims{Subject: "alice"})}, http.StatusUnauthorized},
+		{"other tenant", "/api/invoices/" + alice.InvoiceID.String(), map[string]string{"Authorization": aliceToken, TenantHeader: "tenant-b"}, http.StatusForbidden},
+		{"no credentials", "/api/invoices/" + alice.InvoiceID.String(), nil, http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
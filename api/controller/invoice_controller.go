@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/einvoice"
+	"payment_service/internal/repository"
+	"payment_service/internal/service"
+)
+
+// InvoiceController handles invoice document endpoints
+type InvoiceController struct {
+	invoiceSvc  *service.InvoiceService
+	einvoiceSvc *service.EInvoiceService
+	receiptSvc  *service.ReceiptService
+}
+
+// NewInvoiceController creates a new invoice controller
+func NewInvoiceController(invoiceSvc *service.InvoiceService, einvoiceSvc *service.EInvoiceService, receiptSvc *service.ReceiptService) *InvoiceController {
+	return &InvoiceController{
+		invoiceSvc:  invoiceSvc,
+		einvoiceSvc: einvoiceSvc,
+		receiptSvc:  receiptSvc,
+	}
+}
+
+// receiptMaxAge is how long clients may reuse a receipt without revalidating it
+const receiptMaxAge = time.Hour
+
+// IssueEInvoice issues the e-invoice of a paid invoice and returns the
+// invoice with its e-invoice number. Issuing it again returns the same number.
+func (c *InvoiceController) IssueEInvoice(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid invoice ID")
+		return
+	}
+
+	invoice, err := c.einvoiceSvc.Issue(ctx, tenantID(ctx), id)
+	if err != nil {
+		respondEInvoiceError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, invoice)
+}
+
+// GetEInvoice returns the e-invoice XML of an issued invoice
+func (c *InvoiceController) GetEInvoice(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid invoice ID")
+		return
+	}
+
+	invoice, body, err := c.einvoiceSvc.Export(ctx, tenantID(ctx), id)
+	if err != nil {
+		respondEInvoiceError(ctx, err)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%08d.xml", invoice.EInvoiceSeries, invoice.EInvoiceNumber)
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	ctx.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+}
+
+// respondEInvoiceError writes the error envelope for a failed e-invoice request
+func respondEInvoiceError(ctx *gin.Context, err error) {
+	var invalid *einvoice.ValidationError
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		respondError(ctx, http.StatusNotFound, ErrCodeNotFound, "Invoice not found")
+	case errors.Is(err, service.ErrUnknownMerchant):
+		respondError(ctx, http.StatusBadRequest, ErrCodeUnknownMerchant, err.Error())
+	case errors.Is(err, service.ErrInvoiceNotPaid):
+		respondError(ctx, http.StatusConflict, ErrCodeInvoiceNotPaid, err.Error())
+	case errors.Is(err, service.ErrEInvoiceNotIssued):
+		respondError(ctx, http.StatusConflict, ErrCodeEInvoiceNotIssued, err.Error())
+	case errors.Is(err, service.ErrSellerNotConfigured):
+		respondError(ctx, http.StatusUnprocessableEntity, ErrCodeEInvoiceInvalid, err.Error())
+	case errors.As(err, &invalid):
+		fields := make([]FieldError, 0, len(invalid.Problems))
+		for _, problem := range invalid.Problems {
+			fields = append(fields, FieldError{Field: "einvoice", Message: problem})
+		}
+		ctx.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+			Code:   ErrCodeEInvoiceInvalid,
+			Error:  "E-invoice failed validation",
+			Fields: fields,
+		})
+	default:
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+	}
+}
+
+// GetReceipt returns the PDF receipt of a paid invoice. Receipts carry an ETag,
+// and a request whose If-None-Match matches it gets 304 Not Modified.
+func (c *InvoiceController) GetReceipt(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid invoice ID")
+		return
+	}
+
+	// End users learn nothing of other customers' invoices, paid or not
+	invoice, err := c.invoiceSvc.GetInvoiceByID(ctx, tenantID(ctx), id)
+	if err == nil && !canReadInvoice(ctx, invoice) {
+		err = repository.ErrNotFound
+	}
+	var receipt *service.Receipt
+	if err == nil {
+		receipt, err = c.receiptSvc.GetReceipt(ctx, tenantID(ctx), id)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			respondError(ctx, http.StatusNotFound, ErrCodeNotFound, "Invoice not found")
+		case errors.Is(err, service.ErrUnknownMerchant):
+			respondError(ctx, http.StatusBadRequest, ErrCodeUnknownMerchant, err.Error())
+		case errors.Is(err, service.ErrInvoiceNotPaid):
+			respondError(ctx, http.StatusConflict, ErrCodeInvoiceNotPaid, err.Error())
+		default:
+			respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		}
+		return
+	}
+
+	// Receipts differ per tenant and customer, so only private caches may keep them
+	ctx.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(receiptMaxAge.Seconds())))
+	ctx.Header("ETag", receipt.ETag)
+	if etagMatches(ctx.GetHeader("If-None-Match"), receipt.ETag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+
+	body, err := receipt.PDF()
+	if err != nil {
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+
+	filename := "receipt-" + receipt.Invoice.InvoiceNumber + ".pdf"
+	ctx.Header("Content-Disposition", `inline; filename="`+filename+`"`)
+	ctx.Data(http.StatusOK, "application/pdf", body)
+}
+
+// ExportInvoices streams the invoices created in a date range as a CSV or XLSX
+// attachment. Once rows are being sent the status can no longer change, so a
+// failure part way through aborts the response instead of completing it.
+func (c *InvoiceController) ExportInvoices(ctx *gin.Context) {
+	var exportRequest model.InvoiceExportRequest
+
+	if err := ctx.ShouldBindQuery(&exportRequest); err != nil {
+		respondBindingError(ctx, err)
+		return
+	}
+
+	filter, format, fields := exportFilter(exportRequest, tenantID(ctx))
+	if len(fields) > 0 {
+		respondValidationError(ctx, fields)
+		return
+	}
+
+	// A month of invoices can take longer to send than the server's write timeout
+	if err := http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear write deadline of invoice export: %v", err)
+	}
+
+	filename := fmt.Sprintf("invoices-%s-%s.%s", exportRequest.From, exportRequest.To, format)
+	ctx.Header("Content-Type", format.ContentType())
+	ctx.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	count, err := c.invoiceSvc.ExportInvoices(ctx, filter, format, ctx.Writer)
+	if err != nil {
+		if !ctx.Writer.Written() {
+			ctx.Header("Content-Type", "")
+			ctx.Header("Content-Disposition", "")
+			if errors.Is(err, service.ErrExportTooLarge) {
+				respondError(ctx, http.StatusUnprocessableEntity, ErrCodeExportTooLarge, err.Error())
+				return
+			}
+			respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+			return
+		}
+		log.Printf("Invoice export failed after %d invoices: %v", count, err)
+		abortStream(ctx)
+	}
+}
+
+// GetFeeReport totals the VNPay fees of the tenant's paid invoices created in
+// a date range, per bank code and card type
+func (c *InvoiceController) GetFeeReport(ctx *gin.Context) {
+	var reportRequest model.FeeReportRequest
+
+	if err := ctx.ShouldBindQuery(&reportRequest); err != nil {
+		respondBindingError(ctx, err)
+		return
+	}
+
+	filter, fields := feeReportFilter(reportRequest, tenantID(ctx))
+	if len(fields) > 0 {
+		respondValidationError(ctx, fields)
+		return
+	}
+
+	report, err := c.invoiceSvc.FeeReport(ctx, filter)
+	if err != nil {
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// abortStream closes the connection of a response that failed part way, so
+// the client sees a broken download rather than a complete but truncated file
+func abortStream(ctx *gin.Context) {
+	conn, _, err := ctx.Writer.Hijack()
+	if err != nil {
+		log.Printf("Failed to abort response: %v", err)
+		return
+	}
+	conn.Close()
+}
+
+// CancelInvoice cancels an unpaid invoice so its tickets can be released
+func (c *InvoiceController) CancelInvoice(ctx *gin.Context) {
+	c.closeInvoice(ctx, c.invoiceSvc.CancelInvoice)
+}
+
+// VoidInvoice voids an erroneous invoice, paid or not
+func (c *InvoiceController) VoidInvoice(ctx *gin.Context) {
+	c.closeInvoice(ctx, c.invoiceSvc.VoidInvoice)
+}
+
+// closeInvoice handles a cancel or void request with the given service method
+func (c *InvoiceController) closeInvoice(ctx *gin.Context, closeFn func(context.Context, string, uuid.UUID, string) (model.Invoice, error)) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid invoice ID")
+		return
+	}
+
+	var cancelRequest model.InvoiceCancelRequest
+	if err := ctx.ShouldBindJSON(&cancelRequest); err != nil {
+		respondBindingError(ctx, err)
+		return
+	}
+	reason := strings.TrimSpace(cancelRequest.Reason)
+	if reason == "" {
+		respondValidationError(ctx, []FieldError{{Field: "reason", Message: "is required"}})
+		return
+	}
+
+	invoice, err := closeFn(ctx, tenantID(ctx), id, reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			respondError(ctx, http.StatusNotFound, ErrCodeNotFound, "Invoice not found")
+		case errors.Is(err, service.ErrInvoicePaid):
+			respondError(ctx, http.StatusConflict, ErrCodeInvoicePaid, err.Error())
+		case errors.Is(err, service.ErrInvoiceClosed):
+			respondError(ctx, http.StatusConflict, ErrCodeInvoiceClosed, err.Error())
+		default:
+			respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, invoice)
+}
+
+// GetInvoiceHistory lists the payment status changes of an invoice, oldest first
+func (c *InvoiceController) GetInvoiceHistory(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid invoice ID")
+		return
+	}
+
+	history, err := c.invoiceSvc.GetInvoiceHistory(ctx, tenantID(ctx), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			respondError(ctx, http.StatusNotFound, ErrCodeNotFound, "Invoice not found")
+			return
+		}
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, history)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"payment_service/domain/model"
+	"payment_service/internal/service"
+)
+
+// LedgerController handles ledger endpoints
+type LedgerController struct {
+	ledgerSvc *service.LedgerService
+}
+
+// NewLedgerController creates a new ledger controller
+func NewLedgerController(ledgerSvc *service.LedgerService) *LedgerController {
+	return &LedgerController{
+		ledgerSvc: ledgerSvc,
+	}
+}
+
+// GetBalances returns the balance of every ledger account as of a date or time
+func (c *LedgerController) GetBalances(ctx *gin.Context) {
+	var balanceRequest model.LedgerBalanceRequest
+	if err := ctx.ShouldBindQuery(&balanceRequest); err != nil {
+		respondBindingError(ctx, err)
+		return
+	}
+
+	asOf, fields := ledgerAsOf(balanceRequest.AsOf, time.Now())
+	if len(fields) > 0 {
+		respondValidationError(ctx, fields)
+		return
+	}
+
+	balances, err := c.ledgerSvc.GetBalances(ctx, tenantID(ctx), asOf)
+	if err != nil {
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, balances)
+}
+
+// PostSettlement records a VNPay settlement into the tenant's bank account
+func (c *LedgerController) PostSettlement(ctx *gin.Context) {
+	var settlementRequest model.LedgerSettlementRequest
+	if err := ctx.ShouldBindJSON(&settlementRequest); err != nil {
+		respondBindingError(ctx, err)
+		return
+	}
+
+	reference := strings.TrimSpace(settlementRequest.Reference)
+	settledAt, fields := settlementTime(settlementRequest.SettledAt, time.Now())
+	if reference == "" {
+		fields = append(fields, FieldError{Field: "reference", Message: "is required"})
+	}
+	if settlementRequest.Fee > settlementRequest.Amount {
+		fields = append(fields, FieldError{Field: "fee", Message: "must not exceed amount"})
+	}
+	if len(fields) > 0 {
+		respondValidationError(ctx, fields)
+		return
+	}
+
+	txn, err := c.ledgerSvc.PostSettlement(ctx, tenantID(ctx), reference, settlementRequest.Amount, settlementRequest.Fee, settledAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSettlementExists):
+			respondError(ctx, http.StatusConflict, ErrCodeSettlementExists, err.Error())
+		case errors.Is(err, service.ErrInvalidSettlement):
+			respondValidationError(ctx, []FieldError{{Field: "fee", Message: "must not exceed amount"}})
+		default:
+			respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, txn)
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"payment_service/domain/model"
+	"payment_service/internal/ratelimit"
+	"payment_service/internal/repository"
+	"payment_service/internal/service"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	apiKeySvc := service.NewAPIKeyService(repository.NewMemoryAPIKeyStore())
+	auth := NewAuthController(apiKeySvc, "")
+	limits := NewRateLimitController(ratelimit.NewMemoryLimiter(), map[string]RouteRateLimits{
+		RouteCreatePayment: {
+			PerKey:      ratelimit.Rate{Limit: 3, Period: time.Minute},
+			PerCustomer: ratelimit.Rate{Limit: 2, Period: time.Minute},
+		},
+	})
+
+	r := gin.New()
+	r.POST("/api/vnpay/create-payment", auth.RequireScope(model.ScopePaymentsCreate), limits.Limit(RouteCreatePayment), func(ctx *gin.Context) {
+		// The handler still reads the body the limiter peeked at
+		body, _ := io.ReadAll(ctx.Request.Body)
+		ctx.String(http.StatusOK, string(body))
+	})
+
+	newKey := func() string {
+		_, rawKey, err := apiKeySvc.CreateAPIKey(ctx, model.DefaultTenantID, "booking", []model.APIKeyScope{model.ScopePaymentsCreate}, time.Time{})
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		return rawKey
+	}
+	post := func(rawKey, customerID string) *httptest.ResponseRecorder {
+		body := `{"customer_id":"` + customerID + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/vnpay/create-payment", strings.NewReader(body))
+		req.Header.Set(APIKeyHeader, rawKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code == http.StatusOK && w.Body.String() != body {
+			t.Fatalf("handler read body %q, want %q", w.Body.String(), body)
+		}
+		return w
+	}
+
+	// Each customer may create two payments a minute
+	key := newKey()
+	for _, customerID := range []string{"alice", "alice", "bob"} {
+		if w := post(key, customerID); w.Code != http.StatusOK {
+			t.Fatalf("payment for %s: status %d, want 200: %s", customerID, w.Code, w.Body.String())
+		}
+	}
+	w := post(newKey(), "alice")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("third payment for alice: status %d, Retry-After %q, want 429 after 30s", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Each key may create three payments a minute, whoever they are for
+	w = post(key, "carol")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "20" || !strings.Contains(w.Body.String(), ErrCodeRateLimited) {
+		t.Errorf("fourth payment with a key: status %d, Retry-After %q, body %s, want 429 after 20s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+	if w := post(newKey(), "carol"); w.Code != http.StatusOK {
+		t.Errorf("payment with another key: status %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"payment_service/internal/service"
+)
+
+// Error codes returned in the error envelope
+const (
+	ErrCodeInvalidRequest    = "INVALID_REQUEST"
+	ErrCodeValidationFailed  = "VALIDATION_FAILED"
+	ErrCodeNotFound          = "NOT_FOUND"
+	ErrCodeInvalidCursor     = "INVALID_CURSOR"
+	ErrCodeUnknownMerchant   = "UNKNOWN_MERCHANT"
+	ErrCodeInvoiceNotPaid    = "INVOICE_NOT_PAID"
+	ErrCodeEInvoiceInvalid   = "EINVOICE_INVALID"
+	ErrCodeEInvoiceNotIssued = "EINVOICE_NOT_ISSUED"
+	ErrCodeExportTooLarge    = "EXPORT_TOO_LARGE"
+	ErrCodeInvoicePaid       = "INVOICE_PAID"
+	ErrCodeInvoiceClosed     = "INVOICE_CLOSED"
+	ErrCodeSettlementExists  = "SETTLEMENT_EXISTS"
+	ErrCodeUnauthorized      = "UNAUTHORIZED"
+	ErrCodeForbidden         = "FORBIDDEN"
+	ErrCodeInvalidSignature  = "INVALID_SIGNATURE"
+	ErrCodeBodyTooLarge      = "BODY_TOO_LARGE"
+	ErrCodeRateLimited       = "RATE_LIMITED"
+	ErrCodeInternal          = "INTERNAL_ERROR"
+)
+
+// ErrorResponse is the error envelope returned by every API endpoint
+type ErrorResponse struct {
+	Code   string       `json:"code"`
+	Error  string       `json:"error"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func init() {
+	// Report binding errors using JSON field names rather than Go struct field names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				name := strings.Split(field.Tag.Get(tag), ",")[0]
+				if name != "" && name != "-" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
+}
+
+// respondError writes the error envelope with the given status and code
+func respondError(ctx *gin.Context, status int, code string, message string) {
+	ctx.JSON(status, ErrorResponse{
+		Code:  code,
+		Error: message,
+	})
+}
+
+// abortWithError writes the error envelope and stops the remaining handlers
+func abortWithError(ctx *gin.Context, status int, code string, message string) {
+	ctx.AbortWithStatusJSON(status, ErrorResponse{
+		Code:  code,
+		Error: message,
+	})
+}
+
+// respondValidationError writes the error envelope listing the rejected fields
+func respondValidationError(ctx *gin.Context, fields []FieldError) {
+	ctx.JSON(http.StatusBadRequest, ErrorResponse{
+		Code:   ErrCodeValidationFailed,
+		Error:  "Request validation failed",
+		Fields: fields,
+	})
+}
+
+// respondInvoiceValidationError writes the error envelope for an invoice the service rejected
+func respondInvoiceValidationError(ctx *gin.Context, err *service.InvoiceValidationError) {
+	fields := make([]FieldError, 0, len(err.Violations))
+	for _, v := range err.Violations {
+		fields = append(fields, FieldError{Field: v.Field, Message: v.Message})
+	}
+	respondValidationError(ctx, fields)
+}
+
+// respondBindingError converts a request binding error into the error envelope
+func respondBindingError(ctx *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:   fieldPath(fe),
+				Message: validationMessage(fe),
+			})
+		}
+		respondValidationError(ctx, fields)
+		return
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		respondValidationError(ctx, []FieldError{{
+			Field:   typeErr.Field,
+			Message: "must be of type " + typeErr.Type.String(),
+		}})
+		return
+	}
+
+	respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+}
+
+// fieldPath returns the JSON path of a rejected field, e.g. items[0].quantity
+func fieldPath(fe validator.FieldError) string {
+	// The namespace starts with the request struct's name
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
+
+// validationMessage describes a failed validation rule
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return "is required unless " + strings.ToLower(fe.Param()) + " are given"
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be greater than or equal to " + fe.Param()
+	case "lte":
+		return "must be less than or equal to " + fe.Param()
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	case "email":
+		return "must be a valid email address"
+	case "max":
+		return "must be at most " + fe.Param() + " characters long"
+	default:
+		return "failed " + fe.Tag() + " validation"
+	}
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"payment_service/internal/repository"
+	"payment_service/pkg/signing"
+)
+
+const testSigningSecret = "booking-service-signing-secret-0123456789"
+
+func TestVerifySignature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newServer := func(required bool) *httptest.Server {
+		verifier := signing.NewVerifier(map[string]string{"booking": testSigningSecret}, 5*time.Minute)
+		signatures := NewSignatureController(verifier, repository.NewMemoryNonceStore(), required)
+
+		r := gin.New()
+		r.POST("/api/vnpay/create-payment", signatures.VerifySignature(), func(ctx *gin.Context) {
+			body, _ := io.ReadAll(ctx.Request.Body)
+			ctx.String(http.StatusOK, string(body))
+		})
+		srv := httptest.NewServer(r)
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	srv := newServer(false)
+	signer := signing.NewSigner("booking", testSigningSecret)
+
+	post := func(srv *httptest.Server, client *http.Client, body string, edit func(*http.Request)) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/vnpay/create-payment?lang=vn", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		req.Header.Set(APIKeyHeader, "psk_test")
+		if edit != nil {
+			edit(req)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Do: %v", err)
+		}
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return resp, string(respBody)
+	}
+	signed := &http.Client{Transport: &signing.Transport{Signer: signer}}
+
+	// A signed request reaches the handler with its body intact
+	if resp, body := post(srv, signed, `{"amount":100000}`, nil); resp.StatusCode != http.StatusOK || body != `{"amount":100000}` {
+		t.Fatalf("signed request: status %d, body %q", resp.StatusCode, body)
+	}
+
+	// Unsigned requests pass unless signing is required
+	if resp, _ := post(srv, http.DefaultClient, `{}`, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("unsigned request: status %d, want 200", resp.StatusCode)
+	}
+	if resp, _ := post(newServer(true), http.DefaultClient, `{}`, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unsigned request when required: status %d, want 401", resp.StatusCode)
+	}
+
+	sign := func(now time.Time, body string) func(*http.Request) {
+		return func(req *http.Request) {
+			(&signing.Signer{KeyID: "booking", Secret: []byte(testSigningSecret), Now: func() time.Time { return now }}).Sign(req)
+			req.Body = io.NopCloser(strings.NewReader(body))
+			req.ContentLength = int64(len(body))
+		}
+	}
+	for _, tt := range []struct {
+		name string
+		edit func(*http.Request)
+	}{
+		{"tampered body", sign(time.Now(), `{"amount":1}`)},
+		{"stale timestamp", sign(time.Now().Add(-10*time.Minute), `{"amount":100000}`)},
+		{"future timestamp", sign(time.Now().Add(10*time.Minute), `{"amount":100000}`)},
+		{"unknown key", func(req *http.Request) {
+			signing.NewSigner("other", testSigningSecret).Sign(req)
+		}},
+		{"tampered query", func(req *http.Request) {
+			signer.Sign(req)
+			req.URL.RawQuery = "lang=en"
+		}},
+		{"tampered timestamp", func(req *http.Request) {
+			signer.Sign(req)
+			req.Header.Set(signing.HeaderTimestamp, strconv.FormatInt(time.Now().Unix()+1, 10))
+		}},
+	} {
+		if resp, body := post(srv, http.DefaultClient, `{"amount":100000}`, tt.edit); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401: %s", tt.name, resp.StatusCode, body)
+		}
+	}
+
+	// Replaying a signed request is rejected
+	var replay http.Header
+	capture := func(req *http.Request) {
+		signer.Sign(req)
+		replay = req.Header.Clone()
+	}
+	if resp, _ := post(srv, http.DefaultClient, `{"amount":100000}`, capture); resp.StatusCode != http.StatusOK {
+		t.Fatalf("original request: status %d, want 200", resp.StatusCode)
+	}
+	resp, body := post(srv, http.DefaultClient, `{"amount":100000}`, func(req *http.Request) { req.Header = replay })
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(body, "already used") {
+		t.Errorf("replayed request: status %d, body %s, want 401 for a used nonce", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"payment_service/domain/model"
+	"payment_service/internal/export"
+)
+
+// validatePaymentRequest checks a payment request against the values VNPay
+// accepts and normalizes locale, bank code and order type in place
+func validatePaymentRequest(req *model.VNPayPaymentRequest) []FieldError {
+	var fields []FieldError
+
+	if len(req.Items) == 0 && req.Amount <= 0 {
+		fields = append(fields, FieldError{Field: "amount", Message: "must be greater than 0"})
+	}
+	if req.DiscountAmount < 0 {
+		fields = append(fields, FieldError{Field: "discount_amount", Message: "must not be negative"})
+	}
+	if req.TaxAmount < 0 {
+		fields = append(fields, FieldError{Field: "tax_amount", Message: "must not be negative"})
+	}
+
+	req.Language = strings.ToLower(strings.TrimSpace(req.Language))
+	if _, ok := model.VNPayLocales[req.Language]; !ok {
+		fields = append(fields, FieldError{Field: "language", Message: "must be one of: " + codeList(model.VNPayLocales)})
+	}
+
+	req.BankCode = strings.ToUpper(strings.TrimSpace(req.BankCode))
+	if _, ok := model.VNPayBankCodes[req.BankCode]; req.BankCode != "" && !ok {
+		fields = append(fields, FieldError{Field: "bank_code", Message: "is not a bank code supported by VNPay"})
+	}
+
+	req.OrderType = strings.TrimSpace(req.OrderType)
+	if req.OrderType == "" {
+		req.OrderType = model.DefaultVNPayOrderType
+	}
+	if _, ok := model.VNPayOrderTypes[req.OrderType]; !ok {
+		fields = append(fields, FieldError{Field: "order_type", Message: "is not a VNPay order category code"})
+	}
+
+	return fields
+}
+
+// paymentStatuses lists the payment statuses invoices can be searched by
+var paymentStatuses = map[string]string{
+	string(model.PaymentStatusPending):   "Pending",
+	string(model.PaymentStatusCompleted): "Completed",
+	string(model.PaymentStatusFailed):    "Failed",
+	string(model.PaymentStatusRefunded):  "Refunded",
+	string(model.PaymentStatusCancelled): "Cancelled",
+	string(model.PaymentStatusVoided):    "Voided",
+}
+
+// invoiceFilter converts search query parameters into a filter, newest first by default
+func invoiceFilter(req model.InvoiceSearchRequest, tenantID string) (model.InvoiceFilter, []FieldError) {
+	var fields []FieldError
+
+	filter := model.InvoiceFilter{
+		TenantID:    tenantID,
+		CustomerID:  strings.TrimSpace(req.CustomerID),
+		TicketID:    strings.TrimSpace(req.TicketID),
+		BankCode:    strings.ToUpper(strings.TrimSpace(req.BankCode)),
+		InvoiceType: strings.TrimSpace(req.InvoiceType),
+		CreatedFrom: req.CreatedFrom,
+		CreatedTo:   req.CreatedTo,
+		MinAmount:   req.MinAmount,
+		MaxAmount:   req.MaxAmount,
+		SortBy:      model.InvoiceSortCreatedAt,
+		SortDesc:    true,
+		Limit:       req.Limit,
+	}
+
+	for _, status := range splitParam(req.Status) {
+		status = strings.ToUpper(status)
+		if _, ok := paymentStatuses[status]; !ok {
+			fields = append(fields, FieldError{Field: "status", Message: "must be one of: " + codeList(paymentStatuses)})
+			break
+		}
+		filter.Statuses = append(filter.Statuses, model.PaymentStatus(status))
+	}
+
+	if req.Sort != "" {
+		filter.SortDesc = strings.HasPrefix(req.Sort, "-")
+		filter.SortBy = model.InvoiceSortField(strings.TrimPrefix(req.Sort, "-"))
+	}
+
+	if req.CreatedFrom != nil && req.CreatedTo != nil && !req.CreatedFrom.Before(*req.CreatedTo) {
+		fields = append(fields, FieldError{Field: "created_to", Message: "must be after created_from"})
+	}
+	if req.MinAmount != nil && req.MaxAmount != nil && *req.MinAmount > *req.MaxAmount {
+		fields = append(fields, FieldError{Field: "max_amount", Message: "must not be less than min_amount"})
+	}
+
+	return filter, fields
+}
+
+// exportFilter converts export query parameters into a filter and format.
+// The date range covers whole days in Vietnam time, both ends included.
+func exportFilter(req model.InvoiceExportRequest, tenantID string) (model.InvoiceFilter, export.Format, []FieldError) {
+	var fields []FieldError
+
+	format := export.FormatCSV
+	if req.Format != "" {
+		format = export.Format(req.Format)
+	}
+
+	filter := model.InvoiceFilter{TenantID: tenantID}
+	fields = append(fields, createdRange(req.From, req.To, &filter)...)
+
+	for _, status := range splitParam(req.Status) {
+		status = strings.ToUpper(status)
+		if _, ok := paymentStatuses[status]; !ok {
+			fields = append(fields, FieldError{Field: "status", Message: "must be one of: " + codeList(paymentStatuses)})
+			break
+		}
+		filter.Statuses = append(filter.Statuses, model.PaymentStatus(status))
+	}
+
+	return filter, format, fields
+}
+
+// feeReportFilter converts fee report query parameters into a filter. The
+// date range covers whole days in Vietnam time, both ends included.
+func feeReportFilter(req model.FeeReportRequest, tenantID string) (model.InvoiceFilter, []FieldError) {
+	filter := model.InvoiceFilter{TenantID: tenantID}
+	return filter, createdRange(req.From, req.To, &filter)
+}
+
+// createdRange sets the filter's creation time bounds to whole days from
+// and to in Vietnam time, both ends included
+func createdRange(from, to string, filter *model.InvoiceFilter) []FieldError {
+	var fields []FieldError
+
+	start, err := export.ParseDate(from)
+	if err != nil {
+		fields = append(fields, FieldError{Field: "from", Message: "must be a date in YYYY-MM-DD format"})
+	}
+	last, err := export.ParseDate(to)
+	if err != nil {
+		fields = append(fields, FieldError{Field: "to", Message: "must be a date in YYYY-MM-DD format"})
+	}
+	if len(fields) == 0 {
+		if last.Before(start) {
+			fields = append(fields, FieldError{Field: "to", Message: "must not be before from"})
+		}
+		end := last.AddDate(0, 0, 1)
+		filter.CreatedFrom = &start
+		filter.CreatedTo = &end
+	}
+
+	return fields
+}
+
+// ledgerAsOf parses the asOf parameter of a balance request. A date means the
+// end of that day in Vietnam time; an empty value means now.
+func ledgerAsOf(value string, now time.Time) (time.Time, []FieldError) {
+	if value == "" {
+		return now, nil
+	}
+	if day, err := export.ParseDate(value); err == nil {
+		return day.AddDate(0, 0, 1), nil
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	return time.Time{}, []FieldError{{Field: "asOf", Message: "must be a date in YYYY-MM-DD format or an RFC 3339 timestamp"}}
+}
+
+// settlementTime parses the settledAt field of a settlement; an empty value means now
+func settlementTime(value string, now time.Time) (time.Time, []FieldError) {
+	if value == "" {
+		return now, nil
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, []FieldError{{Field: "settledAt", Message: "must be an RFC 3339 timestamp"}}
+	}
+	return at, nil
+}
+
+// splitParam splits a comma-separated query parameter, dropping empty items
+func splitParam(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// codeList returns the sorted keys of a code table as a comma-separated list
+func codeList(codes map[string]string) string {
+	keys := make([]string, 0, len(codes))
+	for k := range codes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"payment_service/domain/model"
+)
+
+func TestValidatePaymentRequest(t *testing.T) {
+	valid := func() model.VNPayPaymentRequest {
+		return model.VNPayPaymentRequest{CustomerID: "customer-1", TicketID: "ticket-1", Amount: 100000, Language: "vn"}
+	}
+
+	tests := []struct {
+		name       string
+		modify     func(req *model.VNPayPaymentRequest)
+		wantFields []string
+		want       func(req model.VNPayPaymentRequest) bool
+	}{
+		{
+			name: "valid with defaults",
+			want: func(req model.VNPayPaymentRequest) bool { return req.OrderType == model.DefaultVNPayOrderType },
+		},
+		{
+			name: "normalized codes",
+			modify: func(req *model.VNPayPaymentRequest) {
+				req.Language, req.BankCode, req.OrderType = " EN ", " ncb", " 250007 "
+			},
+			want: func(req model.VNPayPaymentRequest) bool {
+				return req.Language == "en" && req.BankCode == "NCB" && req.OrderType == "250007"
+			},
+		},
+		{
+			name: "items instead of an amount",
+			modify: func(req *model.VNPayPaymentRequest) {
+				req.Amount, req.Items = 0, []model.InvoiceItemRequest{{Description: "Ticket", Quantity: 1}}
+			},
+		},
+		{
+			name:       "missing amount",
+			modify:     func(req *model.VNPayPaymentRequest) { req.Amount = 0 },
+			wantFields: []string{"amount"},
+		},
+		{
+			name:       "negative adjustments",
+			modify:     func(req *model.VNPayPaymentRequest) { req.DiscountAmount, req.TaxAmount = -1, -1 },
+			wantFields: []string{"discount_amount", "tax_amount"},
+		},
+		{
+			name:       "unsupported language",
+			modify:     func(req *model.VNPayPaymentRequest) { req.Language = "fr" },
+			wantFields: []string{"language"},
+		},
+		{
+			name:       "unknown bank code",
+			modify:     func(req *model.VNPayPaymentRequest) { req.BankCode = "NOBANK" },
+			wantFields: []string{"bank_code"},
+		},
+		{
+			name:       "unknown order type",
+			modify:     func(req *model.VNPayPaymentRequest) { req.OrderType = "tickets" },
+			wantFields: []string{"order_type"},
+		},
+		{
+			name: "every field reported",
+			modify: func(req *model.VNPayPaymentRequest) {
+				req.Amount, req.Language, req.BankCode, req.OrderType = -5, "", "?", "?"
+			},
+			wantFields: []string{"amount", "language", "bank_code", "order_type"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			if tt.modify != nil {
+				tt.modify(&req)
+			}
+
+			var got []string
+			for _, field := range validatePaymentRequest(&req) {
+				if field.Message == "" {
+					t.Errorf("field %s has no message", field.Field)
+				}
+				got = append(got, field.Field)
+			}
+			if !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("rejected fields = %v, want %v", got, tt.wantFields)
+			}
+			if tt.want != nil && !tt.want(req) {
+				t.Errorf("request not normalized: %+v", req)
+			}
+		})
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/payments", func(ctx *gin.Context) {
+		var req model.VNPayPaymentRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			respondBindingError(ctx, err)
+			return
+		}
+		if fields := validatePaymentRequest(&req); len(fields) > 0 {
+			respondValidationError(ctx, fields)
+			return
+		}
+		ctx.Status(http.StatusCreated)
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantFields []FieldError
+	}{
+		{
+			name:       "malformed JSON",
+			body:       `{"customer_id":`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   ErrCodeInvalidRequest,
+		},
+		{
+			name:       "binding rules",
+			body:       `{"language":"vn","items":[{"description":"Ticket","quantity":0}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   ErrCodeValidationFailed,
+			wantFields: []FieldError{
+				{Field: "customer_id", Message: "is required"},
+				{Field: "items[0].quantity", Message: "is required"},
+			},
+		},
+		{
+			name:       "wrong type",
+			body:       `{"customer_id":"c1","ticket_id":"t1","amount":"many","language":"vn"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   ErrCodeValidationFailed,
+			wantFields: []FieldError{{Field: "amount", Message: "must be of type float64"}},
+		},
+		{
+			name:       "VNPay codes",
+			body:       `{"customer_id":"c1","ticket_id":"t1","amount":1000,"language":"fr"}`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   ErrCodeValidationFailed,
+			wantFields: []FieldError{{Field: "language", Message: "must be one of: en, vn"}},
+		},
+		{
+			name:       "valid",
+			body:       `{"customer_id":"c1","ticket_id":"t1","amount":1000,"language":"vn"}`,
+			wantStatus: http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantCode == "" {
+				return
+			}
+
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("body is not the error envelope: %v", err)
+			}
+			if resp.Code != tt.wantCode || resp.Error == "" {
+				t.Errorf("envelope = %+v, want code %s with a message", resp, tt.wantCode)
+			}
+			if !reflect.DeepEqual(resp.Fields, tt.wantFields) {
+				t.Errorf("fields = %+v, want %+v", resp.Fields, tt.wantFields)
+			}
+			// Without rejected fields, the fields key is left out
+			if tt.wantFields == nil && strings.Contains(w.Body.String(), `"fields"`) {
+				t.Errorf("body = %s, want no fields", w.Body)
+			}
+		})
+	}
+}
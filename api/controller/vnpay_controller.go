@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,17 +10,22 @@ import (
 	"payment_service/config"
 	"payment_service/domain/model"
 	"payment_service/internal/service"
+	"payment_service/internal/token"
 )
 
+// TenantHeader names the request header selecting the tenant (brand) whose
+// merchant and invoices a request operates on
+const TenantHeader = "X-Tenant-ID"
+
 // VNPayController handles VNPay payment API endpoints
 type VNPayController struct {
 	vnpaySvc   *service.VNPayService
 	invoiceSvc *service.InvoiceService
-	config     *config.VNPayConfig
+	config     *config.VNPayStore
 }
 
 // NewVNPayController creates a new VNPay controller
-func NewVNPayController(vnpaySvc *service.VNPayService, invoiceSvc *service.InvoiceService, cfg *config.VNPayConfig) *VNPayController {
+func NewVNPayController(vnpaySvc *service.VNPayService, invoiceSvc *service.InvoiceService, cfg *config.VNPayStore) *VNPayController {
 	return &VNPayController{
 		vnpaySvc:   vnpaySvc,
 		invoiceSvc: invoiceSvc,
@@ -32,13 +38,28 @@ func (c *VNPayController) CreatePayment(ctx *gin.Context) {
 	var paymentRequest model.VNPayPaymentRequest
 
 	if err := ctx.ShouldBindJSON(&paymentRequest); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindingError(ctx, err)
+		return
+	}
+
+	if fields := validatePaymentRequest(&paymentRequest); len(fields) > 0 {
+		respondValidationError(ctx, fields)
 		return
 	}
 
-	response, err := c.vnpaySvc.CreatePayment(ctx, paymentRequest)
+	// ClientIP honours X-Forwarded-For only from the configured trusted proxies
+	response, err := c.vnpaySvc.CreatePayment(ctx, tenantID(ctx), paymentRequest, ctx.ClientIP())
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, service.ErrUnknownMerchant) {
+			respondError(ctx, http.StatusBadRequest, ErrCodeUnknownMerchant, err.Error())
+			return
+		}
+		var invalid *service.InvoiceValidationError
+		if errors.As(err, &invalid) {
+			respondInvoiceValidationError(ctx, invalid)
+			return
+		}
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
 		return
 	}
 
@@ -52,7 +73,7 @@ func (c *VNPayController) HandleReturn(ctx *gin.Context) {
 
 	response, err := c.vnpaySvc.ProcessReturn(ctx, queryParams)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
 		return
 	}
 
@@ -66,7 +87,7 @@ func (c *VNPayController) HandleIPN(ctx *gin.Context) {
 
 	response, err := c.vnpaySvc.ProcessIPN(ctx, queryParams)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
 		return
 	}
 
@@ -78,13 +99,13 @@ func (c *VNPayController) QueryTransaction(ctx *gin.Context) {
 	var queryRequest model.VNPayQueryRequest
 
 	if err := ctx.ShouldBindJSON(&queryRequest); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindingError(ctx, err)
 		return
 	}
 
-	dataRequest, err := c.vnpaySvc.QueryTransaction(ctx, queryRequest, ctx.ClientIP())
+	dataRequest, err := c.vnpaySvc.QueryTransaction(ctx, tenantID(ctx), queryRequest, ctx.ClientIP())
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
 		return
 	}
 
@@ -92,7 +113,7 @@ func (c *VNPayController) QueryTransaction(ctx *gin.Context) {
 		"code":     "00",
 		"message":  "Request prepared successfully",
 		"data":     dataRequest,
-		"endpoint": c.config.TransactionAPI,
+		"endpoint": c.config.Load().TransactionAPI,
 		"note":     "In a real implementation, you would make an HTTP POST request to the VNPAY API with this data",
 	})
 }
@@ -102,13 +123,20 @@ func (c *VNPayController) RefundTransaction(ctx *gin.Context) {
 	var refundRequest model.VNPayRefundRequest
 
 	if err := ctx.ShouldBindJSON(&refundRequest); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindingError(ctx, err)
 		return
 	}
 
-	refundData, err := c.vnpaySvc.RefundTransaction(ctx, refundRequest, ctx.ClientIP())
+	refundData, err := c.vnpaySvc.RefundTransaction(ctx, tenantID(ctx), refundRequest, ctx.ClientIP())
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, service.ErrInvoiceNotPaid):
+			respondError(ctx, http.StatusConflict, ErrCodeInvoiceNotPaid, err.Error())
+		case errors.Is(err, service.ErrInvalidRefundAmount):
+			respondValidationError(ctx, []FieldError{{Field: "amount", Message: "must be positive and at most what is left of the invoice's payment"}})
+		default:
+			respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		}
 		return
 	}
 
@@ -116,7 +144,7 @@ func (c *VNPayController) RefundTransaction(ctx *gin.Context) {
 		"code":     "00",
 		"message":  "Refund request prepared successfully",
 		"data":     refundData,
-		"endpoint": c.config.TransactionAPI,
+		"endpoint": c.config.Load().TransactionAPI,
 		"note":     "In a real implementation, you would make an HTTP POST request to the VNPAY API with this data",
 	})
 }
@@ -126,32 +154,79 @@ func (c *VNPayController) GetInvoice(ctx *gin.Context) {
 	idStr := ctx.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		respondError(ctx, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid invoice ID")
 		return
 	}
 
-	invoice, err := c.invoiceSvc.GetInvoiceByID(ctx, id)
-	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Invoice not found"})
+	invoice, err := c.invoiceSvc.GetInvoiceByID(ctx, tenantID(ctx), id)
+	if err != nil || !canReadInvoice(ctx, invoice) {
+		respondError(ctx, http.StatusNotFound, ErrCodeNotFound, "Invoice not found")
 		return
 	}
 
 	ctx.JSON(http.StatusOK, invoice)
 }
 
+// SearchInvoices lists a page of invoices matching the query filters
+func (c *VNPayController) SearchInvoices(ctx *gin.Context) {
+	var searchRequest model.InvoiceSearchRequest
+
+	if err := ctx.ShouldBindQuery(&searchRequest); err != nil {
+		respondBindingError(ctx, err)
+		return
+	}
+
+	filter, fields := invoiceFilter(searchRequest, tenantID(ctx))
+	if len(fields) > 0 {
+		respondValidationError(ctx, fields)
+		return
+	}
+
+	page, err := c.invoiceSvc.SearchInvoices(ctx, filter, searchRequest.Cursor)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			respondError(ctx, http.StatusBadRequest, ErrCodeInvalidCursor, err.Error())
+			return
+		}
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
 // GetInvoicesByCustomer retrieves all invoices for a customer
 func (c *VNPayController) GetInvoicesByCustomer(ctx *gin.Context) {
 	customerID := ctx.Param("customerId")
 	if customerID == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Customer ID is required"})
+		respondValidationError(ctx, []FieldError{{Field: "customerId", Message: "is required"}})
+		return
+	}
+	if onlyCustomer, limited := customerOnly(ctx); limited && customerID != onlyCustomer {
+		respondError(ctx, http.StatusNotFound, ErrCodeNotFound, "Customer not found")
 		return
 	}
 
-	invoices, err := c.invoiceSvc.GetInvoicesByCustomerID(ctx, customerID)
+	invoices, err := c.invoiceSvc.GetInvoicesByCustomerID(ctx, tenantID(ctx), customerID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(ctx, http.StatusInternalServerError, ErrCodeInternal, err.Error())
 		return
 	}
 
 	ctx.JSON(http.StatusOK, invoices)
 }
+
+// tenantID returns the tenant selected by the request, defaulting to the
+// tenant of its API key or access token and then to the default tenant
+func tenantID(ctx *gin.Context) string {
+	if tenant := ctx.GetHeader(TenantHeader); tenant != "" {
+		return tenant
+	}
+	if key, ok := apiKey(ctx); ok {
+		return key.TenantID
+	}
+	if value, ok := ctx.Get(tokenClaimsContextKey); ok {
+		return value.(token.Claims).TenantID
+	}
+	return model.DefaultTenantID
+}
@@ -0,0 +1,87 @@
+package route
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"payment_service/config"
+)
+
+// corsMiddleware applies a CORS policy to a route group. Requests from
+// origins the policy allows get the CORS headers; preflight requests are
+// answered here, and rejected when their origin is not allowed.
+func corsMiddleware(policy config.CORSPolicy) gin.HandlerFunc {
+	allowMethods := strings.Join(policy.AllowedMethods, ", ")
+	allowHeaders := strings.Join(policy.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(policy.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(policy.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		// The response depends on the origin, so caches must key on it
+		c.Writer.Header().Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if !originAllowed(policy.AllowedOrigins, origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if policy.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", allowMethods)
+			c.Header("Access-Control-Allow-Headers", allowHeaders)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if exposeHeaders != "" {
+			c.Header("Access-Control-Expose-Headers", exposeHeaders)
+		}
+		c.Next()
+	}
+}
+
+// originAllowed reports whether an origin matches one of the allowed
+// origins. A pattern such as https://*.example.com matches the subdomains of
+// example.com, at any depth, with the same scheme and port.
+func originAllowed(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "/"))
+		switch {
+		case pattern == "*", pattern == origin:
+			return true
+		case strings.Contains(pattern, "://*."):
+			scheme, domain, _ := strings.Cut(pattern, "://*")
+			if rest, ok := strings.CutPrefix(origin, scheme+"://"); ok && strings.HasSuffix(rest, domain) && len(rest) > len(domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowPreflight registers the paths of a group for OPTIONS, so its CORS
+// middleware can answer preflight requests for them
+func allowPreflight(group *gin.RouterGroup, paths ...string) {
+	for _, path := range paths {
+		group.OPTIONS(path, func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"payment_service/api/controller"
+	"payment_service/config"
+	"payment_service/domain/model"
+	"payment_service/internal/ratelimit"
+	"payment_service/internal/repository"
+	"payment_service/internal/service"
+	"payment_service/pkg/signing"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	policy := config.CORSPolicy{
+		AllowedOrigins: []string{"https://checkout.example.com", "https://*.example.vn"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "X-API-Key"},
+		ExposedHeaders: []string{"Retry-After"},
+		MaxAge:         10 * time.Minute,
+	}
+	ledgerPolicy := policy
+	ledgerPolicy.AllowedOrigins = []string{"https://admin.example.com"}
+
+	vnpayConfig := config.NewVNPayStore(config.VNPayConfig{TmnCode: "DEFAULT1", HashSecret: "default-secret"})
+	invoiceSvc := service.NewInvoiceService(repository.NewMemoryStore(repository.NewMemoryInvoiceStore()))
+	merchantSvc := service.NewMerchantService(repository.NewMemoryMerchantStore(), vnpayConfig, model.Seller{})
+
+	r := gin.New()
+	SetupRoutes(r, config.CORSConfig{Payments: policy, Invoices: policy, Ledger: ledgerPolicy},
+		controller.NewVNPayController(service.NewVNPayService(vnpayConfig, invoiceSvc, merchantSvc), invoiceSvc, vnpayConfig),
+		controller.NewInvoiceController(nil, nil, nil),
+		controller.NewLedgerController(nil),
+		controller.NewAuthController(service.NewAPIKeyService(repository.NewMemoryAPIKeyStore()), ""),
+		controller.NewSignatureController(signing.NewVerifier(nil, time.Minute), repository.NewMemoryNonceStore(), false),
+		controller.NewRateLimitController(ratelimit.NewMemoryLimiter(), nil),
+	)
+
+	for _, tt := range []struct {
+		name       string
+		method     string
+		path       string
+		origin     string
+		wantStatus int
+		wantOrigin string
+	}{
+		{"preflight from an allowed origin", http.MethodOptions, "/api/vnpay/create-payment", "https://checkout.example.com", http.StatusNoContent, "https://checkout.example.com"},
+		{"preflight from a wildcard subdomain", http.MethodOptions, "/api/invoices/123", "https://app.shop.example.vn", http.StatusNoContent, "https://app.shop.example.vn"},
+		{"preflight for the invoice search", http.MethodOptions, "/api/invoices", "https://checkout.example.com", http.StatusNoContent, "https://checkout.example.com"},
+		{"preflight from the bare wildcard domain", http.MethodOptions, "/api/invoices/123", "https://example.vn", http.StatusForbidden, ""},
+		{"preflight from a lookalike domain", http.MethodOptions, "/api/invoices/123", "https://evilexample.vn", http.StatusForbidden, ""},
+		{"preflight with another scheme", http.MethodOptions, "/api/invoices/123", "http://checkout.example.com", http.StatusForbidden, ""},
+		{"preflight from an unknown origin", http.MethodOptions, "/api/vnpay/create-payment", "https://evil.com", http.StatusForbidden, ""},
+		{"ledger preflight from the checkout", http.MethodOptions, "/api/ledger/balances", "https://checkout.example.com", http.StatusForbidden, ""},
+		{"ledger preflight from the admin", http.MethodOptions, "/api/ledger/balances", "https://admin.example.com", http.StatusNoContent, "https://admin.example.com"},
+		{"request from an allowed origin", http.MethodGet, "/api/invoices", "https://checkout.example.com", http.StatusUnauthorized, "https://checkout.example.com"},
+		{"request from an unknown origin", http.MethodGet, "/api/invoices", "https://evil.com", http.StatusUnauthorized, ""},
+		{"IPN preflight", http.MethodOptions, "/api/vnpay/ipn", "https://checkout.example.com", http.StatusNotFound, ""},
+		{"IPN from an allowed origin", http.MethodPost, "/api/vnpay/ipn", "https://checkout.example.com", http.StatusOK, ""},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Origin", tt.origin)
+		if tt.method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin %q, want %q", tt.name, got, tt.wantOrigin)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("%s: Access-Control-Allow-Credentials %q, want none", tt.name, got)
+		}
+		if tt.method == http.MethodOptions && tt.wantOrigin != "" && w.Header().Get("Access-Control-Max-Age") != "600" {
+			t.Errorf("%s: Access-Control-Max-Age %q, want 600", tt.name, w.Header().Get("Access-Control-Max-Age"))
+		}
+	}
+}
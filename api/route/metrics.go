@@ -0,0 +1,28 @@
+package route
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"payment_service/internal/metrics"
+)
+
+// requestMetrics observes the latency of every request by its route
+// template, so /api/invoices/:id is one series however many invoices exist.
+// Requests matching no route are grouped under "unmatched".
+func requestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
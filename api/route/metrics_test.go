@@ -0,0 +1,42 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"payment_service/internal/metrics"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(requestMetrics())
+	r.GET("/api/invoices/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	for _, path := range []string{"/api/invoices/1", "/api/invoices/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+
+	// Requests are labelled by route template, never by the raw path
+	for _, want := range []string{
+		`payment_service_http_request_duration_seconds_count{method="GET",route="/api/invoices/:id",status="200"} 2`,
+		`payment_service_http_request_duration_seconds_count{method="GET",route="unmatched",status="404"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+	if strings.Contains(body, `route="/api/invoices/1"`) || strings.Contains(body, `route="/missing"`) {
+		t.Error("metrics are labelled with a raw path")
+	}
+}
@@ -4,27 +4,70 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"payment_service/api/controller"
+	"payment_service/config"
+	"payment_service/domain/model"
 )
 
-// SetupRoutes configures all the API routes for the application
-func SetupRoutes(r *gin.Engine, vnpayController *controller.VNPayController) {
+// SetupRoutes configures all the API routes for the application. Every route
+// requires an API key with the scope it names, except the VNPay callbacks,
+// which VNPay calls and which are authenticated by their signature. End users
+// may also read their own invoices and receipts with an access token. Signed
+// requests have their signature verified on every route, and payments and
+// refunds are rate limited. Each route group browsers may call has its own
+// CORS policy; the VNPay callbacks have none. The latency of every request
+// is recorded for /metrics, and every request is traced; handlers see the
+// request's span through the gin context, which falls back to the request's.
+func SetupRoutes(r *gin.Engine, cors config.CORSConfig, vnpayController *controller.VNPayController, invoiceController *controller.InvoiceController, ledgerController *controller.LedgerController, authController *controller.AuthController, signatureController *controller.SignatureController, rateLimitController *controller.RateLimitController) {
+	createPayments := authController.RequireScope(model.ScopePaymentsCreate)
+	refundPayments := authController.RequireScope(model.ScopePaymentsRefund)
+	readInvoices := authController.RequireScope(model.ScopeInvoicesRead)
+	readOwnInvoices := authController.RequireScopeOrCustomer(model.ScopeInvoicesRead)
+	admin := authController.RequireScope(model.ScopeAdmin)
+
+	r.ContextWithFallback = true
+	r.Use(requestMetrics(), requestTracing())
+
 	// API group
-	api := r.Group("/api")
+	api := r.Group("/api", signatureController.VerifySignature())
+
+	// VNPay callbacks, which VNPay calls directly rather than from a browser
+	callbacks := api.Group("/vnpay")
+	{
+		callbacks.GET("/return", vnpayController.HandleReturn)
+		callbacks.POST("/ipn", vnpayController.HandleIPN)
+	}
 
-	// VNPay routes
-	vnpay := api.Group("/vnpay")
+	// Payment routes
+	payments := api.Group("/vnpay", corsMiddleware(cors.Payments))
 	{
-		vnpay.POST("/create-payment", vnpayController.CreatePayment)
-		vnpay.GET("/return", vnpayController.HandleReturn)
-		vnpay.POST("/ipn", vnpayController.HandleIPN)
-		vnpay.POST("/query", vnpayController.QueryTransaction)
-		vnpay.POST("/refund", vnpayController.RefundTransaction)
+		allowPreflight(payments, "/create-payment", "/query", "/refund")
+		payments.POST("/create-payment", createPayments, rateLimitController.Limit(controller.RouteCreatePayment), vnpayController.CreatePayment)
+		payments.POST("/query", createPayments, vnpayController.QueryTransaction)
+		payments.POST("/refund", refundPayments, rateLimitController.Limit(controller.RouteRefund), vnpayController.RefundTransaction)
 	}
 
 	// Invoice routes
-	invoices := api.Group("/invoices")
+	invoices := api.Group("/invoices", corsMiddleware(cors.Invoices))
+	{
+		allowPreflight(invoices, "", "/*path")
+		invoices.GET("", readInvoices, vnpayController.SearchInvoices)
+		invoices.GET("/export", readInvoices, invoiceController.ExportInvoices)
+		invoices.GET("/fees", readInvoices, invoiceController.GetFeeReport)
+		invoices.GET("/:id", readOwnInvoices, vnpayController.GetInvoice)
+		invoices.POST("/:id/einvoice", createPayments, invoiceController.IssueEInvoice)
+		invoices.GET("/:id/einvoice.xml", readInvoices, invoiceController.GetEInvoice)
+		invoices.GET("/:id/receipt.pdf", readOwnInvoices, invoiceController.GetReceipt)
+		invoices.POST("/:id/cancel", createPayments, invoiceController.CancelInvoice)
+		invoices.POST("/:id/void", admin, invoiceController.VoidInvoice)
+		invoices.GET("/:id/history", readInvoices, invoiceController.GetInvoiceHistory)
+		invoices.GET("/customer/:customerId", readOwnInvoices, vnpayController.GetInvoicesByCustomer)
+	}
+
+	// Ledger routes
+	ledger := api.Group("/ledger", corsMiddleware(cors.Ledger), admin)
 	{
-		invoices.GET("/:id", vnpayController.GetInvoice)
-		invoices.GET("/customer/:customerId", vnpayController.GetInvoicesByCustomer)
+		allowPreflight(ledger, "/*path")
+		ledger.GET("/balances", ledgerController.GetBalances)
+		ledger.POST("/settlements", ledgerController.PostSettlement)
 	}
 }
@@ -0,0 +1,64 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRequestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	var handled trace.SpanContext
+	r := gin.New()
+	r.ContextWithFallback = true
+	r.Use(requestTracing())
+	r.GET("/api/invoices/:id", func(c *gin.Context) {
+		// Handlers pass the gin context on to services
+		handled = trace.SpanContextFromContext(c)
+		c.Status(http.StatusOK)
+	})
+	r.POST("/api/vnpay/refund", func(c *gin.Context) { c.Status(http.StatusBadGateway) })
+
+	req := httptest.NewRequest(http.MethodGet, "/api/invoices/8a4b7c1e?customer=42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/vnpay/refund", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans ended, want 2", len(spans))
+	}
+
+	// The span continues the caller's trace and reaches the handler
+	span := spans[0]
+	if span.Name() != "GET /api/invoices/:id" || span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span = %s (%v), want the server span of the route template", span.Name(), span.SpanKind())
+	}
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span does not continue the caller's trace: parent %v", span.Parent())
+	}
+	if handled.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("handler saw span %v, want %v", handled.SpanID(), span.SpanContext().SpanID())
+	}
+
+	// Only the route template is recorded, never the path or query
+	for _, attr := range span.Attributes() {
+		if value := attr.Value.Emit(); value == "/api/invoices/8a4b7c1e" || value == "customer=42" {
+			t.Errorf("span records %s = %s", attr.Key, value)
+		}
+	}
+
+	if spans[1].Status().Code != codes.Error {
+		t.Errorf("span of a 502 response status = %v, want error", spans[1].Status())
+	}
+}
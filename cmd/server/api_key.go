@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+	"payment_service/internal/service"
+)
+
+// runAPIKey implements the "api-key" subcommand
+func runAPIKey(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing api-key action\n\n%s", usage)
+	}
+	action, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("api-key "+action, flag.ContinueOnError)
+	tenant := flags.String("tenant", model.DefaultTenantID, "tenant the key acts for")
+	name := flags.String("name", "", "name of the service using the key")
+	scopes := flags.String("scopes", "", "comma-separated scopes: "+joinScopes(model.APIKeyScopes))
+	expires := flags.Duration("expires", 0, "how long until the key expires (default never)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := mustLoadConfig()
+	db, err := ConnectToDatabase(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	apiKeyService := service.NewAPIKeyService(repository.NewAPIKeyRepository(db))
+	ctx := context.Background()
+
+	switch action {
+	case "create":
+		if *name == "" {
+			return fmt.Errorf("-name is required")
+		}
+		var keyScopes []model.APIKeyScope
+		for _, scope := range strings.Split(*scopes, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				keyScopes = append(keyScopes, model.APIKeyScope(scope))
+			}
+		}
+		var expiresAt time.Time
+		if *expires > 0 {
+			expiresAt = time.Now().Add(*expires)
+		}
+
+		key, rawKey, err := apiKeyService.CreateAPIKey(ctx, *tenant, *name, keyScopes, expiresAt)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created API key %s (%s) for tenant %s\n", key.KeyID, key.Prefix, key.TenantID)
+		fmt.Println("Store it now, it cannot be shown again:")
+		fmt.Println(rawKey)
+		return nil
+
+	case "list":
+		keys, err := apiKeyService.ListAPIKeys(ctx, *tenant)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			state := "active"
+			switch {
+			case key.RevokedAt != nil:
+				state = "revoked " + key.RevokedAt.Format("2006-01-02 15:04:05")
+			case !key.Active(time.Now()):
+				state = "expired " + key.ExpiresAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%s %-12s %-30s %-50s %s\n", key.KeyID, key.Prefix, key.Name, joinScopes(key.Scopes), state)
+		}
+		return nil
+
+	case "revoke":
+		if flags.NArg() != 1 {
+			return fmt.Errorf("usage: api-key revoke KEY_ID")
+		}
+		keyID, err := uuid.Parse(flags.Arg(0))
+		if err != nil {
+			return fmt.Errorf("invalid key ID %q: %w", flags.Arg(0), err)
+		}
+		if err := apiKeyService.RevokeAPIKey(ctx, keyID); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked API key %s\n", keyID)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown api-key action %q\n\n%s", action, usage)
+	}
+}
+
+// joinScopes joins scopes with commas
+func joinScopes(scopes []model.APIKeyScope) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = string(scope)
+	}
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// usage describes the subcommands accepted by the binary
+const usage = `Usage: payment_service [command]
+
+Commands:
+  serve                  Start the HTTP server (default)
+  migrate up             Apply all pending database migrations
+  migrate down [N]       Roll back the last N migrations (default 1)
+  migrate status         List migrations and whether they are applied
+  export [flags]         Write invoices created in a date range as CSV or XLSX
+                         (-from, -to YYYY-MM-DD; -status, -format, -output, -tenant)
+  ledger-check [-tenant] Verify the ledger balances and matches the invoices;
+                         exits with status 1 when it finds problems
+  api-key create [flags] Issue an API key and print it once
+                         (-name, -scopes; -tenant, -expires)
+  api-key list [-tenant] List a tenant's API keys
+  api-key revoke KEY_ID  Revoke an API key
+  reencrypt-invoices [-batch N]
+                         Encrypt invoice columns under the current field
+                         encryption key and fill in blind indexes; run after
+                         rotating keys or changing FIELD_ENCRYPTION_COLUMNS
+`
+
+// runCommand runs the named subcommand and exits on failure
+func runCommand(name string, args []string) {
+	var err error
+	switch name {
+	case "migrate":
+		err = runMigrate(args)
+	case "export":
+		err = runExport(args)
+	case "ledger-check":
+		err = runLedgerCheck(args)
+	case "api-key":
+		err = runAPIKey(args)
+	case "reencrypt-invoices":
+		err = runReencrypt(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		err = fmt.Errorf("unknown command %q\n\n%s", name, usage)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
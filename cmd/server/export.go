@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"payment_service/domain/model"
+	"payment_service/internal/export"
+	"payment_service/internal/repository"
+	"payment_service/internal/service"
+)
+
+// runExport implements the "export" subcommand
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	tenant := flags.String("tenant", model.DefaultTenantID, "tenant whose invoices are exported")
+	from := flags.String("from", "", "first creation date to export, YYYY-MM-DD in Vietnam time (required)")
+	to := flags.String("to", "", "last creation date to export, YYYY-MM-DD in Vietnam time (required)")
+	statuses := flags.String("status", "", "comma-separated payment statuses to export (default all)")
+	formatName := flags.String("format", string(export.FormatCSV), "file format, csv or xlsx")
+	output := flags.String("output", "", "file to write (default standard output)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	filter := model.InvoiceFilter{TenantID: *tenant}
+	start, err := export.ParseDate(*from)
+	if err != nil {
+		return fmt.Errorf("invalid -from date %q: must be YYYY-MM-DD", *from)
+	}
+	end, err := export.ParseDate(*to)
+	if err != nil {
+		return fmt.Errorf("invalid -to date %q: must be YYYY-MM-DD", *to)
+	}
+	if end.Before(start) {
+		return fmt.Errorf("-to date %s is before -from date %s", *to, *from)
+	}
+	end = end.AddDate(0, 0, 1)
+	filter.CreatedFrom = &start
+	filter.CreatedTo = &end
+
+	for _, status := range strings.Split(*statuses, ",") {
+		status = strings.ToUpper(strings.TrimSpace(status))
+		switch model.PaymentStatus(status) {
+		case "":
+		case model.PaymentStatusPending, model.PaymentStatusCompleted, model.PaymentStatusFailed,
+			model.PaymentStatusRefunded, model.PaymentStatusCancelled, model.PaymentStatusVoided:
+			filter.Statuses = append(filter.Statuses, model.PaymentStatus(status))
+		default:
+			return fmt.Errorf("invalid -status %q: must be PENDING, COMPLETED, FAILED, REFUNDED, CANCELLED or VOIDED", status)
+		}
+	}
+
+	cfg := mustLoadConfig()
+	db, err := ConnectToDatabase(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	fieldEncryption, err := loadFieldEncryption(cfg.Encryption)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	buffered := bufio.NewWriter(w)
+
+	invoiceService := service.NewInvoiceService(repository.NewPostgresStore(db, fieldEncryption))
+	count, err := invoiceService.ExportInvoices(context.Background(), filter, format, buffered)
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+
+	log.Printf("Exported %d invoices", count)
+	return nil
+}
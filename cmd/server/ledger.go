@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+	"payment_service/internal/service"
+)
+
+// runLedgerCheck implements the "ledger-check" subcommand
+func runLedgerCheck(args []string) error {
+	flags := flag.NewFlagSet("ledger-check", flag.ContinueOnError)
+	tenant := flags.String("tenant", model.DefaultTenantID, "tenant whose ledger is checked")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := mustLoadConfig()
+	db, err := ConnectToDatabase(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	fieldEncryption, err := loadFieldEncryption(cfg.Encryption)
+	if err != nil {
+		return err
+	}
+
+	ledgerService := service.NewLedgerService(repository.NewPostgresStore(db, fieldEncryption))
+	problems, err := ledgerService.CheckLedger(context.Background(), *tenant)
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range problems {
+		log.Println(problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("ledger check failed with %d problems", len(problems))
+	}
+
+	log.Printf("Ledger of tenant %s is consistent", *tenant)
+	return nil
+}
@@ -11,18 +11,54 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"github.com/jackc/pgx/v4/pgxpool"
 
 	"payment_service/api/controller"
 	"payment_service/api/route"
 	"payment_service/config"
+	"payment_service/domain/model"
+	"payment_service/internal/fieldcrypt"
+	"payment_service/internal/kafka"
+	"payment_service/internal/metrics"
+	"payment_service/internal/migration"
+	"payment_service/internal/ratelimit"
 	"payment_service/internal/repository"
 	"payment_service/internal/service"
+	"payment_service/internal/tracing"
+	"payment_service/pkg/signing"
+	"payment_service/pkg/utils"
 )
 
 func main() {
+	// Run a subcommand such as "migrate" when one is given
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
+	runServer()
+}
+
+// runServer starts the HTTP API and blocks until it is shut down
+func runServer() {
 	// Load configuration
-	cfg := config.LoadConfig()
+	cfg := mustLoadConfig()
+	gin.SetMode(cfg.Server.Mode)
+
+	// Trace requests through the database and Kafka when an exporter is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		// Flush the spans of the last requests before exiting
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Failed to flush traces: %v", err)
+		}
+	}()
 
 	// Initialize database
 	db, err := ConnectToDatabase(cfg.Database)
@@ -31,29 +67,105 @@ func main() {
 	}
 	defer db.Close()
 
+	// Bring the schema up to date when configured to do so
+	if cfg.Database.AutoMigrate {
+		migrator, err := migration.NewMigrator(db)
+		if err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+		if err := migrateUp(context.Background(), migrator); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
+
+	// Share request nonces and rate limits between instances through Redis
+	// when configured. Both fall back to memory while Redis is down, whether
+	// at startup or later, and go back to Redis once it answers.
+	var nonceStore repository.NonceStore = repository.NewMemoryNonceStore()
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+	if cfg.Redis.Addr != "" {
+		redisClient, err := ConnectToRedis(cfg.Redis)
+		if err != nil {
+			log.Printf("Redis is unavailable, starting degraded: %v", err)
+		}
+		defer redisClient.Close()
+		nonceStore = repository.NewFallbackNonceStore(repository.NewRedisNonceStore(redisClient), nonceStore, utils.NewDefaultLogger())
+		limiter = ratelimit.NewFallbackLimiter(ratelimit.NewRedisLimiter(redisClient), limiter, utils.NewDefaultLogger())
+	} else {
+		log.Println("REDIS_ADDR is not set; request nonces and rate limits are kept per instance")
+	}
+
+	// Hold the VNPay settings in a store so they can be reloaded at runtime
+	vnpayConfig := config.NewVNPayStore(cfg.VNPay)
+
+	// Encrypt sensitive invoice columns at rest when keys are configured
+	fieldEncryption, err := loadFieldEncryption(cfg.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to initialize field encryption: %v", err)
+	}
+	if fieldEncryption == nil {
+		log.Println("FIELD_ENCRYPTION_KEYS is not set; sensitive invoice columns are stored in plaintext")
+	}
+
 	// Initialize repositories
-	invoiceRepo := repository.NewInvoiceRepository(db)
+	store := repository.NewPostgresStore(db, fieldEncryption)
+	merchantRepo := repository.NewMerchantRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
 
 	// Initialize services
-	invoiceService := service.NewInvoiceService(invoiceRepo)
-	vnpayService := service.NewVNPayService(&cfg.VNPay, invoiceService)
+	invoiceService := service.NewInvoiceService(store)
+	merchantService := service.NewMerchantService(merchantRepo, vnpayConfig, model.Seller{
+		LegalName:        cfg.Seller.LegalName,
+		TaxCode:          cfg.Seller.TaxCode,
+		Address:          cfg.Seller.Address,
+		Phone:            cfg.Seller.Phone,
+		Email:            cfg.Seller.Email,
+		EInvoiceTemplate: cfg.Seller.EInvoiceTemplate,
+		EInvoiceSeries:   cfg.Seller.EInvoiceSeries,
+	})
+	vnpayService := service.NewVNPayService(vnpayConfig, invoiceService, merchantService)
+	einvoiceService := service.NewEInvoiceService(invoiceService, merchantService)
+	receiptService := service.NewReceiptService(invoiceService, merchantService)
+	ledgerService := service.NewLedgerService(store)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo)
 
 	// Initialize controllers
-	vnpayController := controller.NewVNPayController(vnpayService, invoiceService, &cfg.VNPay)
+	vnpayController := controller.NewVNPayController(vnpayService, invoiceService, vnpayConfig)
+	invoiceController := controller.NewInvoiceController(invoiceService, einvoiceService, receiptService)
+	ledgerController := controller.NewLedgerController(ledgerService)
+	authController := controller.NewAuthController(apiKeyService, cfg.Auth.TokenSecret)
+	signatureController := controller.NewSignatureController(signing.NewVerifier(cfg.Signing.Keys, cfg.Signing.MaxSkew), nonceStore, cfg.Signing.Required)
+	rateLimitController := controller.NewRateLimitController(limiter, map[string]controller.RouteRateLimits{
+		controller.RouteCreatePayment: {
+			PerKey:      rate(cfg.RateLimit.CreatePaymentPerKey),
+			PerCustomer: rate(cfg.RateLimit.CreatePaymentPerCustomer),
+		},
+		controller.RouteRefund: {
+			PerKey: rate(cfg.RateLimit.RefundPerKey),
+		},
+	})
 
 	// Initialize Gin router
 	r := gin.Default()
 
-	// Setup CORS middleware if needed
-	r.Use(corsMiddleware())
+	// Only trust X-Forwarded-For from known proxies so ClientIP is the customer's IP
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
 
 	// Setup routes
-	route.SetupRoutes(r, vnpayController)
+	route.SetupRoutes(r, cfg.CORS, vnpayController, invoiceController, ledgerController, authController, signatureController, rateLimitController)
+
+	// Expose Prometheus metrics, including the database pool's statistics
+	metrics.Registry.MustRegister(metrics.NewPoolCollector(db))
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 
 	// Configure server
 	srv := &http.Server{
-		Addr:    ":" + cfg.Server.Port,
-		Handler: r,
+		Addr:         ":" + cfg.Server.Port,
+		Handler:      r,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
 	// Start server in a goroutine
@@ -64,14 +176,47 @@ func main() {
 		}
 	}()
 
+	// Reload VNPay settings on SIGHUP or config file change
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	reloader := config.NewReloader(vnpayConfig, utils.NewDefaultLogger(), cfg.Server.ConfigWatchInterval)
+	go reloader.Run(backgroundCtx)
+
+	// Fail invoices left pending after the payment window closed
+	expirer := service.NewInvoiceExpirer(invoiceService, utils.NewDefaultLogger(), cfg.Invoice.PendingTimeout, cfg.Invoice.ExpiryInterval)
+	go expirer.Run(backgroundCtx)
+
+	// Publish invoice events from the outbox; without brokers they wait there
+	if cfg.Kafka.Brokers != "" {
+		producer, err := kafka.NewKafkaProducer(cfg.Kafka.Brokers, cfg.Kafka.InvoiceTopic)
+		if err != nil {
+			log.Printf("Invoice events will not be published: %v", err)
+		} else {
+			publisher := kafka.NewInvoiceEventPublisher(producer, cfg.Kafka.InvoiceTopic)
+			relay := service.NewInvoiceEventRelay(invoiceService, publisher, utils.NewDefaultLogger(), cfg.Kafka.RelayInterval)
+			relayDone := make(chan struct{})
+			go func() {
+				relay.Run(backgroundCtx)
+				close(relayDone)
+			}()
+
+			// The producer must outlive the relay, so stop the relay before closing it
+			defer func() {
+				stopBackground()
+				<-relayDone
+				producer.Close()
+			}()
+		}
+	}
+
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutting down server...")
 
-	// Give the server 5 seconds to finish in-flight requests
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Give the server time to finish in-flight requests
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
@@ -80,34 +225,66 @@ func main() {
 	log.Println("Server exiting")
 }
 
-// corsMiddleware handles CORS headers
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
+// mustLoadConfig loads and validates the configuration or exits
+func mustLoadConfig() *config.Config {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	return cfg
 }
+
+// ConnectToDatabase creates a connection pool using the database configuration
 func ConnectToDatabase(cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
-	connString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		cfg.User,
-		cfg.Password,
-		cfg.Host,
-		cfg.Port,
-		cfg.DBName,
-		cfg.SSLMode,
-	)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	poolConfig, err := pgxpool.ParseConfig(cfg.GetDatabaseDSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+	poolConfig.MaxConns = int32(cfg.MaxConnections)
+	poolConfig.MinConns = int32(cfg.MinConnections)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+
+	return pgxpool.ConnectConfig(ctx, poolConfig)
+}
+
+// ConnectToRedis creates a Redis client using the Redis configuration and
+// checks that the server is reachable. The client is returned even when it
+// is not, as it reconnects once the server answers.
+func ConnectToRedis(cfg config.RedisConfig) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return client, fmt.Errorf("failed to connect to Redis at %s: %w", cfg.Addr, err)
+	}
+	return client, nil
+}
+
+// loadFieldEncryption creates the encryption of sensitive invoice columns from
+// the configuration, or returns nil when no keys are configured
+func loadFieldEncryption(cfg config.EncryptionConfig) (*repository.FieldEncryption, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, nil
+	}
+
+	keyring, err := fieldcrypt.ParseKeyring(cfg.Keys, cfg.CurrentKeyID, cfg.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load field encryption keys: %w", err)
+	}
+	return repository.NewFieldEncryption(keyring, cfg.Columns)
+}
 
-	return pgxpool.Connect(ctx, connString)
+// rate converts a configured rate limit to a token bucket rate
+func rate(limit config.RateLimit) ratelimit.Rate {
+	return ratelimit.Rate{Limit: limit.Requests, Period: limit.Period}
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"payment_service/internal/migration"
+)
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(args []string) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	cfg := mustLoadConfig()
+	db, err := ConnectToDatabase(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	migrator, err := migration.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch action {
+	case "up":
+		return migrateUp(ctx, migrator)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations to roll back: %q", args[1])
+			}
+		}
+		rolledBack, err := migrator.Down(ctx, steps)
+		for _, m := range rolledBack {
+			log.Printf("Rolled back migration %04d_%s", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate action %q\n\n%s", action, usage)
+	}
+}
+
+// migrateUp applies all pending migrations
+func migrateUp(ctx context.Context, migrator *migration.Migrator) error {
+	applied, err := migrator.Up(ctx)
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+	if err == nil && len(applied) == 0 {
+		log.Println("Database schema is up to date")
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"payment_service/internal/repository"
+)
+
+// runReencrypt implements the "reencrypt-invoices" subcommand
+func runReencrypt(args []string) error {
+	flags := flag.NewFlagSet("reencrypt-invoices", flag.ContinueOnError)
+	batchSize := flags.Int("batch", 500, "invoices re-encrypted per transaction")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("invalid -batch %d: must be positive", *batchSize)
+	}
+
+	cfg := mustLoadConfig()
+	fieldEncryption, err := loadFieldEncryption(cfg.Encryption)
+	if err != nil {
+		return err
+	}
+	if fieldEncryption == nil {
+		return fmt.Errorf("FIELD_ENCRYPTION_KEYS is not set; there is nothing to re-encrypt with")
+	}
+
+	db, err := ConnectToDatabase(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var scanned, updated int
+	store := repository.NewPostgresStore(db, fieldEncryption)
+	err = store.ReencryptInvoices(context.Background(), *batchSize, func(s, u int) {
+		scanned, updated = s, u
+		log.Printf("Scanned %d invoices, updated %d", scanned, updated)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Re-encrypted invoices with key %s: %d of %d updated", cfg.Encryption.CurrentKeyID, updated, scanned)
+	return nil
+}
@@ -1,66 +1,329 @@
 package config
 
 import (
-	"os"
-	"strconv"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	VNPay    VNPayConfig
+	Server     ServerConfig
+	Database   DatabaseConfig
+	VNPay      VNPayConfig
+	Invoice    InvoiceConfig
+	Seller     SellerConfig
+	Kafka      KafkaConfig
+	Auth       AuthConfig
+	Signing    SigningConfig
+	Redis      RedisConfig
+	RateLimit  RateLimitConfig
+	CORS       CORSConfig
+	Encryption EncryptionConfig
+	Tracing    TracingConfig
 }
 
 // ServerConfig holds the server configuration
 type ServerConfig struct {
-	Port string
+	Port            string
+	Mode            string
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	ShutdownTimeout time.Duration
+	// ConfigWatchInterval is how often config files are checked for changes
+	ConfigWatchInterval time.Duration
+	// TrustedProxies are the proxy IPs/CIDRs allowed to set X-Forwarded-For
+	TrustedProxies []string
 }
 
 // DatabaseConfig holds the database configuration
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
+	Host           string
+	Port           string
+	User           string
+	Password       string
+	DBName         string
+	SSLMode        string
+	MaxConnections int
+	MinConnections int
+	ConnectTimeout time.Duration
+	// AutoMigrate applies pending migrations when the server starts
+	AutoMigrate bool
 }
 
 // VNPayConfig holds the configuration for VNPAY integration
 type VNPayConfig struct {
-	TmnCode        string
-	HashSecret     string
-	VNPayURL       string
-	ReturnURL      string
-	APIUrl         string
-	MerchantAPI    string
-	TransactionAPI string
-}
-
-// LoadConfig loads configuration from environment variables
-func LoadConfig() *Config {
-	return &Config{
+	TmnCode    string
+	HashSecret string
+	// SecondaryHashSecrets are previous secrets still accepted on callbacks
+	// until SecondarySecretsExpireAt (zero means until removed)
+	SecondaryHashSecrets     []string
+	SecondarySecretsExpireAt time.Time
+	VNPayURL                 string
+	ReturnURL                string
+	APIUrl                   string
+	MerchantAPI              string
+	TransactionAPI           string
+	// FeeRatePercent, FeeFixed and FeeMin are the merchant fee VNPay charges
+	// on payments that no tenant fee rule matches
+	FeeRatePercent float64
+	FeeFixed       float64
+	FeeMin         float64
+}
+
+// InvoiceConfig holds the invoice lifecycle configuration
+type InvoiceConfig struct {
+	// PendingTimeout is how long an invoice may stay pending before it is
+	// marked failed; it should comfortably exceed the 15 minute payment window
+	PendingTimeout time.Duration
+	// ExpiryInterval is how often pending invoices are checked for expiry;
+	// zero disables the check
+	ExpiryInterval time.Duration
+}
+
+// SellerConfig holds the default tenant's seller details printed on e-invoices
+type SellerConfig struct {
+	LegalName string
+	TaxCode   string
+	Address   string
+	Phone     string
+	Email     string
+	// EInvoiceTemplate and EInvoiceSeries are the invoice template number
+	// (KHMSHDon) and series (KHHDon) registered with the tax authority
+	EInvoiceTemplate string
+	EInvoiceSeries   string
+}
+
+// AuthConfig holds the configuration for authenticating end users
+type AuthConfig struct {
+	// TokenSecret signs the HS256 access tokens of end users; empty rejects
+	// every access token, leaving API keys as the only way in
+	TokenSecret string
+}
+
+// SigningConfig holds the configuration for verifying HMAC-signed requests
+type SigningConfig struct {
+	// Keys maps signing key IDs to their secrets
+	Keys map[string]string
+	// MaxSkew is how far a request's timestamp may be from the server's clock
+	MaxSkew time.Duration
+	// Required rejects requests made with an API key that are not signed;
+	// otherwise only the signatures of signed requests are checked
+	Required bool
+}
+
+// EncryptionConfig holds the keys encrypting sensitive invoice columns at rest
+type EncryptionConfig struct {
+	// Keys maps key IDs to base64-encoded 256-bit keys; empty stores every
+	// column in plaintext. Keep retired keys until invoices are re-encrypted.
+	Keys map[string]string
+	// CurrentKeyID is the key new values are encrypted with
+	CurrentKeyID string
+	// IndexKey is the base64-encoded key of the blind indexes used to look
+	// up encrypted columns; it cannot be rotated without rebuilding them
+	IndexKey string
+	// Columns are the invoice columns to encrypt
+	Columns []string
+}
+
+// TracingConfig holds the configuration for exporting OpenTelemetry traces
+type TracingConfig struct {
+	// Exporter is where spans go: "otlp", "stdout" or "none"
+	Exporter string
+	// OTLPEndpoint is the URL of the OTLP/HTTP collector, e.g.
+	// http://otel-collector:4318; empty uses OTEL_EXPORTER_OTLP_ENDPOINT or
+	// the exporter's default
+	OTLPEndpoint string
+	// ServiceName is the service.name traces are reported under
+	ServiceName string
+	// SampleRatio is the share of traces started here that are recorded;
+	// traces continued from a caller follow the caller's decision
+	SampleRatio float64
+}
+
+// RedisConfig holds the Redis connection configuration
+type RedisConfig struct {
+	// Addr is the host:port of the Redis server; empty keeps state such as
+	// request nonces in memory, which only suits a single instance
+	Addr     string
+	Password string
+	DB       int
+}
+
+// RateLimit allows Requests requests per Period, in bursts of up to Requests;
+// zero requests is unlimited
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// RateLimitConfig holds the rate limits of the routes creating payments and
+// refunds, per API key and per customer
+type RateLimitConfig struct {
+	CreatePaymentPerKey      RateLimit
+	CreatePaymentPerCustomer RateLimit
+	RefundPerKey             RateLimit
+}
+
+// CORSConfig holds the CORS policies of the route groups browsers may call.
+// The VNPay callbacks are never called from browsers and have no policy.
+type CORSConfig struct {
+	Payments CORSPolicy
+	Invoices CORSPolicy
+	Ledger   CORSPolicy
+}
+
+// CORSPolicy is the CORS policy of a route group
+type CORSPolicy struct {
+	// AllowedOrigins are origins such as https://app.example.com, where
+	// https://*.example.com matches any subdomain and * any origin; empty
+	// allows no cross-origin requests
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// withOrigins returns a copy of the policy allowing other origins
+func (p CORSPolicy) withOrigins(origins []string) CORSPolicy {
+	p.AllowedOrigins = origins
+	return p
+}
+
+// KafkaConfig holds the configuration for publishing events to Kafka
+type KafkaConfig struct {
+	// Brokers is a comma-separated list of bootstrap servers; empty disables
+	// publishing, and events wait in the outbox until it is configured
+	Brokers string
+	// InvoiceTopic receives invoice events such as cancellations
+	InvoiceTopic string
+	// RelayInterval is how often unpublished events are sent
+	RelayInterval time.Duration
+}
+
+// LoadConfig loads configuration from the optional config file and environment variables.
+//
+// The config file is read from CONFIG_FILE (YAML or TOML, chosen by extension).
+// If APP_ENV is set, an overlay file next to it (e.g. config.production.yaml) is
+// applied on top. Environment variables always take precedence over file values.
+func LoadConfig() (*Config, error) {
+	src, err := newSource(getEnv("CONFIG_FILE", ""), getEnv("APP_ENV", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	cors := CORSPolicy{
+		AllowedOrigins: src.getEnvAsList("CORS_ALLOWED_ORIGINS", nil),
+		AllowedMethods: src.getEnvAsList("CORS_ALLOWED_METHODS", []string{"GET", "POST"}),
+		AllowedHeaders: src.getEnvAsList("CORS_ALLOWED_HEADERS", []string{
+			"Content-Type", "Authorization", "X-API-Key", "X-Tenant-ID", "If-None-Match",
+		}),
+		ExposedHeaders:   src.getEnvAsList("CORS_EXPOSED_HEADERS", []string{"Content-Disposition", "ETag", "Retry-After"}),
+		AllowCredentials: src.getEnvAsBool("CORS_ALLOW_CREDENTIALS", false),
+		MaxAge:           src.getEnvAsDuration("CORS_MAX_AGE", 10*time.Minute),
+	}
+
+	cfg := &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
+			Port:                src.getEnv("SERVER_PORT", "8080"),
+			Mode:                src.getEnv("GIN_MODE", "debug"),
+			ReadTimeout:         src.getEnvAsDuration("SERVER_READ_TIMEOUT", 30*time.Second),
+			WriteTimeout:        src.getEnvAsDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+			ShutdownTimeout:     src.getEnvAsDuration("SERVER_SHUTDOWN_TIMEOUT", 5*time.Second),
+			ConfigWatchInterval: src.getEnvAsDuration("CONFIG_WATCH_INTERVAL", 10*time.Second),
+			TrustedProxies:      src.getEnvAsList("SERVER_TRUSTED_PROXIES", nil),
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "postgres"),
-			DBName:   getEnv("DB_NAME", "payment_service"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Host:           src.getEnv("DB_HOST", "localhost"),
+			Port:           src.getEnv("DB_PORT", "5432"),
+			User:           src.getEnv("DB_USER", "postgres"),
+			Password:       src.getSecret("DB_PASSWORD", "postgres"),
+			DBName:         src.getEnv("DB_NAME", "payment_service"),
+			SSLMode:        src.getEnv("DB_SSLMODE", "disable"),
+			MaxConnections: src.getEnvAsInt("DB_MAX_CONNECTIONS", 10),
+			MinConnections: src.getEnvAsInt("DB_MIN_CONNECTIONS", 2),
+			ConnectTimeout: src.getEnvAsDuration("DB_CONNECT_TIMEOUT", 10*time.Second),
+			AutoMigrate:    src.getEnvAsBool("DB_AUTO_MIGRATE", false),
 		},
 		VNPay: VNPayConfig{
-			TmnCode:        getEnv("VNPAY_TMN_CODE", ""),
-			HashSecret:     getEnv("VNPAY_HASH_SECRET", ""),
-			VNPayURL:       getEnv("VNPAY_URL", "https://sandbox.vnpayment.vn/paymentv2/vpcpay.html"),
-			ReturnURL:      getEnv("VNPAY_RETURN_URL", "http://localhost:8080/api/vnpay/return"),
-			APIUrl:         getEnv("VNPAY_API_URL", "http://sandbox.vnpayment.vn/merchant_webapi/merchant.html"),
-			TransactionAPI: getEnv("VNPAY_TRANSACTION_API", "https://sandbox.vnpayment.vn/merchant_webapi/api/transaction"),
+			TmnCode:                  src.getEnv("VNPAY_TMN_CODE", ""),
+			HashSecret:               src.getSecret("VNPAY_HASH_SECRET", ""),
+			SecondaryHashSecrets:     src.getSecretAsList("VNPAY_SECONDARY_HASH_SECRETS", nil),
+			SecondarySecretsExpireAt: src.getEnvAsTime("VNPAY_SECONDARY_SECRETS_EXPIRE_AT", time.Time{}),
+			VNPayURL:                 src.getEnv("VNPAY_URL", "https://sandbox.vnpayment.vn/paymentv2/vpcpay.html"),
+			ReturnURL:                src.getEnv("VNPAY_RETURN_URL", "http://localhost:8080/api/vnpay/return"),
+			APIUrl:                   src.getEnv("VNPAY_API_URL", "http://sandbox.vnpayment.vn/merchant_webapi/merchant.html"),
+			TransactionAPI:           src.getEnv("VNPAY_TRANSACTION_API", "https://sandbox.vnpayment.vn/merchant_webapi/api/transaction"),
+			FeeRatePercent:           src.getEnvAsFloat("VNPAY_FEE_RATE_PERCENT", 0),
+			FeeFixed:                 src.getEnvAsFloat("VNPAY_FEE_FIXED", 0),
+			FeeMin:                   src.getEnvAsFloat("VNPAY_FEE_MIN", 0),
+		},
+		Invoice: InvoiceConfig{
+			PendingTimeout: src.getEnvAsDuration("INVOICE_PENDING_TIMEOUT", time.Hour),
+			ExpiryInterval: src.getEnvAsDuration("INVOICE_EXPIRY_INTERVAL", time.Minute),
+		},
+		Seller: SellerConfig{
+			LegalName:        src.getEnv("SELLER_LEGAL_NAME", ""),
+			TaxCode:          src.getEnv("SELLER_TAX_CODE", ""),
+			Address:          src.getEnv("SELLER_ADDRESS", ""),
+			Phone:            src.getEnv("SELLER_PHONE", ""),
+			Email:            src.getEnv("SELLER_EMAIL", ""),
+			EInvoiceTemplate: src.getEnv("EINVOICE_TEMPLATE", "1"),
+			EInvoiceSeries:   src.getEnv("EINVOICE_SERIES", ""),
+		},
+		Kafka: KafkaConfig{
+			Brokers:       src.getEnv("KAFKA_BROKERS", ""),
+			InvoiceTopic:  src.getEnv("KAFKA_INVOICE_TOPIC", "invoice-events"),
+			RelayInterval: src.getEnvAsDuration("KAFKA_RELAY_INTERVAL", 5*time.Second),
+		},
+		Auth: AuthConfig{
+			TokenSecret: src.getSecret("API_SECRET_KEY", ""),
+		},
+		Signing: SigningConfig{
+			Keys:     src.getSecretAsMap("REQUEST_SIGNING_KEYS"),
+			MaxSkew:  src.getEnvAsDuration("REQUEST_SIGNING_MAX_SKEW", 5*time.Minute),
+			Required: src.getEnvAsBool("REQUEST_SIGNING_REQUIRED", false),
+		},
+		Redis: RedisConfig{
+			Addr:     src.getEnv("REDIS_ADDR", ""),
+			Password: src.getSecret("REDIS_PASSWORD", ""),
+			DB:       src.getEnvAsInt("REDIS_DB", 0),
+		},
+		RateLimit: RateLimitConfig{
+			CreatePaymentPerKey:      src.getEnvAsRateLimit("RATE_LIMIT_CREATE_PAYMENT_PER_KEY", RateLimit{Requests: 120, Period: time.Minute}),
+			CreatePaymentPerCustomer: src.getEnvAsRateLimit("RATE_LIMIT_CREATE_PAYMENT_PER_CUSTOMER", RateLimit{Requests: 10, Period: time.Minute}),
+			RefundPerKey:             src.getEnvAsRateLimit("RATE_LIMIT_REFUND_PER_KEY", RateLimit{Requests: 30, Period: time.Minute}),
+		},
+		CORS: CORSConfig{
+			Payments: cors.withOrigins(src.getEnvAsList("CORS_PAYMENTS_ALLOWED_ORIGINS", cors.AllowedOrigins)),
+			Invoices: cors.withOrigins(src.getEnvAsList("CORS_INVOICES_ALLOWED_ORIGINS", cors.AllowedOrigins)),
+			Ledger:   cors.withOrigins(src.getEnvAsList("CORS_LEDGER_ALLOWED_ORIGINS", cors.AllowedOrigins)),
+		},
+		Encryption: EncryptionConfig{
+			Keys:         src.getSecretAsMap("FIELD_ENCRYPTION_KEYS"),
+			CurrentKeyID: src.getEnv("FIELD_ENCRYPTION_CURRENT_KEY", ""),
+			IndexKey:     src.getSecret("FIELD_ENCRYPTION_INDEX_KEY", ""),
+			Columns: src.getEnvAsList("FIELD_ENCRYPTION_COLUMNS", []string{
+				"customer_id", "notes", "vnpay_bank_code", "vnpay_txn_no", "vnpay_pay_date", "vnpay_card_type",
+			}),
+		},
+		Tracing: TracingConfig{
+			Exporter:     src.getEnv("TRACING_EXPORTER", "none"),
+			OTLPEndpoint: src.getEnv("TRACING_OTLP_ENDPOINT", ""),
+			ServiceName:  src.getEnv("TRACING_SERVICE_NAME", "payment_service"),
+			SampleRatio:  src.getEnvAsFloat("TRACING_SAMPLE_RATIO", 1),
 		},
 	}
+
+	if err := src.err(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
 }
 
 // GetDatabaseDSN returns the database connection string
@@ -68,20 +331,79 @@ func (c *DatabaseConfig) GetDatabaseDSN() string {
 	return "postgres://" + c.User + ":" + c.Password + "@" + c.Host + ":" + c.Port + "/" + c.DBName + "?sslmode=" + c.SSLMode
 }
 
-// Helper function to get environment variable with a default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// Validate checks the configuration for values the service cannot run without
+func (c *Config) Validate() error {
+	if c.Database.MinConnections > c.Database.MaxConnections {
+		return fmt.Errorf("DB_MIN_CONNECTIONS (%d) must not exceed DB_MAX_CONNECTIONS (%d)",
+			c.Database.MinConnections, c.Database.MaxConnections)
+	}
+	if c.Invoice.PendingTimeout < 15*time.Minute {
+		return fmt.Errorf("INVOICE_PENDING_TIMEOUT (%s) must be at least the 15m VNPay payment window", c.Invoice.PendingTimeout)
+	}
+	if c.Auth.TokenSecret != "" && len(c.Auth.TokenSecret) < 32 {
+		return fmt.Errorf("API_SECRET_KEY must be at least 32 characters long")
+	}
+	if c.Signing.Required && len(c.Signing.Keys) == 0 {
+		return fmt.Errorf("REQUEST_SIGNING_REQUIRED needs at least one key in REQUEST_SIGNING_KEYS")
+	}
+	for keyID, secret := range c.Signing.Keys {
+		if len(secret) < 32 {
+			return fmt.Errorf("REQUEST_SIGNING_KEYS secret of %q must be at least 32 characters long", keyID)
+		}
+	}
+	if c.Signing.MaxSkew <= 0 {
+		return fmt.Errorf("REQUEST_SIGNING_MAX_SKEW (%s) must be positive", c.Signing.MaxSkew)
+	}
+	if len(c.Encryption.Keys) > 0 {
+		if _, ok := c.Encryption.Keys[c.Encryption.CurrentKeyID]; !ok {
+			return fmt.Errorf("FIELD_ENCRYPTION_CURRENT_KEY (%q) must name a key in FIELD_ENCRYPTION_KEYS", c.Encryption.CurrentKeyID)
+		}
+		if c.Encryption.IndexKey == "" {
+			return fmt.Errorf("FIELD_ENCRYPTION_KEYS needs FIELD_ENCRYPTION_INDEX_KEY for blind indexes")
+		}
+	}
+	for _, group := range []struct {
+		name   string
+		policy CORSPolicy
+	}{{"PAYMENTS", c.CORS.Payments}, {"INVOICES", c.CORS.Invoices}, {"LEDGER", c.CORS.Ledger}} {
+		if err := group.policy.validate(); err != nil {
+			return fmt.Errorf("CORS_%s_ALLOWED_ORIGINS: %w", group.name, err)
+		}
+	}
+	switch c.Tracing.Exporter {
+	case "otlp", "stdout", "none":
+	default:
+		return fmt.Errorf("TRACING_EXPORTER (%q) must be otlp, stdout or none", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("TRACING_SAMPLE_RATIO (%g) must be between 0 and 1", c.Tracing.SampleRatio)
+	}
+	if c.VNPay.FeeRatePercent < 0 || c.VNPay.FeeRatePercent > 100 {
+		return fmt.Errorf("VNPAY_FEE_RATE_PERCENT (%g) must be between 0 and 100", c.VNPay.FeeRatePercent)
+	}
+	if c.VNPay.FeeFixed < 0 || c.VNPay.FeeMin < 0 {
+		return fmt.Errorf("VNPAY_FEE_FIXED (%g) and VNPAY_FEE_MIN (%g) must not be negative", c.VNPay.FeeFixed, c.VNPay.FeeMin)
 	}
-	return value
+	return nil
 }
 
-// Helper function to get integer environment variable with a default value
-func getEnvAsInt(key string, defaultValue int) int {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
+// validate checks that the policy's origins are well formed, and that it
+// does not let any origin make credentialed requests
+func (p CORSPolicy) validate() error {
+	for _, origin := range p.AllowedOrigins {
+		if origin == "*" {
+			if p.AllowCredentials {
+				return fmt.Errorf("origin * cannot be combined with CORS_ALLOW_CREDENTIALS")
+			}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return fmt.Errorf("invalid origin %q, want scheme://host[:port]", origin)
+		}
+		if strings.Contains(strings.TrimPrefix(u.Host, "*."), "*") {
+			return fmt.Errorf("invalid origin %q, wildcards are only allowed as the first label", origin)
+		}
 	}
-	return defaultValue
+	return nil
 }
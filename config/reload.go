@@ -0,0 +1,135 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	"payment_service/pkg/utils"
+)
+
+// Reloader reloads the VNPay settings on SIGHUP or when the config file
+// changes, and writes an audit log entry for every reload
+type Reloader struct {
+	store    *VNPayStore
+	logger   utils.Logger
+	interval time.Duration
+	modTimes map[string]time.Time
+}
+
+// NewReloader creates a reloader updating store. Config files are polled for
+// changes every interval; a zero interval disables polling.
+func NewReloader(store *VNPayStore, logger utils.Logger, interval time.Duration) *Reloader {
+	r := &Reloader{
+		store:    store,
+		logger:   logger,
+		interval: interval,
+		modTimes: make(map[string]time.Time),
+	}
+	r.filesChanged()
+	return r
+}
+
+// Run watches for reload triggers until the context is cancelled
+func (r *Reloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if r.interval > 0 {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.reload("SIGHUP")
+		case <-tick:
+			if r.filesChanged() {
+				r.reload("file change")
+			}
+		}
+	}
+}
+
+// Reload loads the configuration again and swaps in the new VNPay settings
+func (r *Reloader) Reload(trigger string) error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	old := r.store.Load()
+	r.store.Store(cfg.VNPay)
+
+	changes := diffVNPayConfig(old, &cfg.VNPay)
+	if len(changes) == 0 {
+		r.logger.Info("AUDIT config reload: trigger=%q result=unchanged", trigger)
+		return nil
+	}
+	r.logger.Info("AUDIT config reload: trigger=%q result=applied changes=[%s]", trigger, strings.Join(changes, ", "))
+	return nil
+}
+
+// reload reloads the configuration and audits failures
+func (r *Reloader) reload(trigger string) {
+	if err := r.Reload(trigger); err != nil {
+		r.logger.Error("AUDIT config reload: trigger=%q result=rejected error=%q", trigger, err.Error())
+	}
+}
+
+// filesChanged reports whether any config file was modified since the last check
+func (r *Reloader) filesChanged() bool {
+	changed := false
+	for _, path := range configFiles(getEnv("CONFIG_FILE", ""), getEnv("APP_ENV", "")) {
+		var modTime time.Time
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+		if last, ok := r.modTimes[path]; !ok || !last.Equal(modTime) {
+			r.modTimes[path] = modTime
+			changed = changed || ok
+		}
+	}
+	return changed
+}
+
+// secretVNPayFields are the VNPay settings whose values are never logged
+var secretVNPayFields = map[string]bool{
+	"HashSecret":           true,
+	"SecondaryHashSecrets": true,
+}
+
+// diffVNPayConfig describes the fields that differ between two VNPay settings.
+// Secret values are never logged.
+func diffVNPayConfig(old, updated *VNPayConfig) []string {
+	var changes []string
+	oldValue := reflect.ValueOf(*old)
+	newValue := reflect.ValueOf(*updated)
+	for i := 0; i < oldValue.NumField(); i++ {
+		name := oldValue.Type().Field(i).Name
+		before, after := oldValue.Field(i).Interface(), newValue.Field(i).Interface()
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+		if secretVNPayFields[name] {
+			changes = append(changes, name+": (secret changed)")
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, before, after))
+	}
+	return changes
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// recordingLogger keeps the messages logged by a reloader
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Info(format string, args ...interface{}) {
+	l.record("INFO: "+format, args...)
+}
+
+func (l *recordingLogger) Error(format string, args ...interface{}) {
+	l.record("ERROR: "+format, args...)
+}
+
+func (l *recordingLogger) Debug(format string, args ...interface{}) {
+	l.record("DEBUG: "+format, args...)
+}
+
+func (l *recordingLogger) record(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.messages, "\n")
+}
+
+// vnpayConfigFile returns a config file setting the VNPay terminal and secret
+func vnpayConfigFile(tmnCode, secret string) string {
+	return fmt.Sprintf("vnpay:\n  tmn_code: %s\n  hash_secret: %s\n", tmnCode, secret)
+}
+
+// newTestReloader writes a config file, points CONFIG_FILE at it and returns a
+// reloader for a store holding its settings
+func newTestReloader(t *testing.T, interval time.Duration) (*Reloader, *VNPayStore, *recordingLogger, string) {
+	t.Helper()
+	clearEnv(t, "APP_ENV", "VNPAY_TMN_CODE", "VNPAY_HASH_SECRET", "VNPAY_HASH_SECRET_FILE",
+		"VNPAY_SECONDARY_HASH_SECRETS", "VNPAY_FEE_RATE_PERCENT", "DB_MIN_CONNECTIONS", "DB_MAX_CONNECTIONS")
+	path := writeFile(t, t.TempDir(), "config.yaml", vnpayConfigFile("TERM0001", "old-secret"))
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	store := NewVNPayStore(cfg.VNPay)
+	logger := &recordingLogger{}
+	return NewReloader(store, logger, interval), store, logger, path
+}
+
+// rewrite replaces a config file and moves its modification time forward, so
+// the change is seen even on file systems with coarse timestamps
+func rewrite(t *testing.T, path, content string) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	modTime := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+}
+
+// waitFor polls until cond holds, failing the test after a few seconds
+func waitFor(t *testing.T, cond func() bool, trigger func()) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the reload")
+		}
+		if trigger != nil {
+			trigger()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReloaderFileChange(t *testing.T) {
+	reloader, store, logger, path := newTestReloader(t, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Run(ctx)
+
+	rewrite(t, path, vnpayConfigFile("TERM0002", "new-secret"))
+	waitFor(t, func() bool { return store.Load().TmnCode == "TERM0002" }, nil)
+
+	if got := store.Load().HashSecret; got != "new-secret" {
+		t.Errorf("HashSecret = %s, want the reloaded secret", got)
+	}
+	waitFor(t, func() bool { return strings.Contains(logger.String(), "result=applied") }, nil)
+	if log := logger.String(); !strings.Contains(log, `trigger="file change"`) || !strings.Contains(log, "TmnCode: TERM0001 -> TERM0002") {
+		t.Errorf("audit log = %q, want the file change and the new terminal", log)
+	}
+}
+
+func TestReloaderSIGHUP(t *testing.T) {
+	// Keep SIGHUP from terminating the test binary before Run listens for it
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	reloader, store, logger, path := newTestReloader(t, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Run(ctx)
+
+	// Without polling, only the signal picks up the change
+	rewrite(t, path, vnpayConfigFile("TERM0002", "old-secret"))
+	waitFor(t, func() bool { return store.Load().TmnCode == "TERM0002" }, func() {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatalf("Kill: %v", err)
+		}
+	})
+	waitFor(t, func() bool { return strings.Contains(logger.String(), "result=applied") }, nil)
+	if log := logger.String(); !strings.Contains(log, `trigger="SIGHUP"`) {
+		t.Errorf("audit log = %q, want the SIGHUP trigger", log)
+	}
+}
+
+func TestReloaderRejectsInvalidConfig(t *testing.T) {
+	reloader, store, logger, path := newTestReloader(t, 0)
+
+	rewrite(t, path, vnpayConfigFile("TERM0002", "new-secret")+"  fee_rate_percent: 150\n")
+	if err := reloader.Reload("test"); err == nil {
+		t.Fatal("Reload accepted an invalid configuration")
+	}
+	if got := store.Load(); got.TmnCode != "TERM0001" || got.HashSecret != "old-secret" {
+		t.Errorf("store = %s/%s, want the previous settings kept", got.TmnCode, got.HashSecret)
+	}
+
+	reloader.reload("test")
+	if log := logger.String(); !strings.Contains(log, "ERROR: AUDIT config reload") || !strings.Contains(log, "result=rejected") {
+		t.Errorf("audit log = %q, want the rejection", log)
+	}
+}
+
+func TestDiffVNPayConfig(t *testing.T) {
+	expiresAt := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	old := VNPayConfig{TmnCode: "TERM0001", HashSecret: "old-secret", FeeRatePercent: 1.1}
+	updated := VNPayConfig{
+		TmnCode:                  "TERM0001",
+		HashSecret:               "new-secret",
+		SecondaryHashSecrets:     []string{"old-secret"},
+		SecondarySecretsExpireAt: expiresAt,
+		FeeRatePercent:           1.5,
+	}
+
+	changes := diffVNPayConfig(&old, &updated)
+	want := []string{
+		"HashSecret: (secret changed)",
+		"SecondaryHashSecrets: (secret changed)",
+		fmt.Sprintf("SecondarySecretsExpireAt: %v -> %v", time.Time{}, expiresAt),
+		"FeeRatePercent: 1.1 -> 1.5",
+	}
+	if strings.Join(changes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes = %q, want %q", changes, want)
+	}
+	for _, change := range changes {
+		if strings.Contains(change, "new-secret") || strings.Contains(change, "old-secret") {
+			t.Errorf("change %q logs a secret", change)
+		}
+	}
+
+	if changes := diffVNPayConfig(&old, &old); len(changes) != 0 {
+		t.Errorf("changes between equal settings = %q", changes)
+	}
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// source resolves configuration values from environment variables and
+// config files. File keys are flattened into the same names as the
+// environment variables, so `db: {host: x}` in a file is read as DB_HOST.
+type source struct {
+	fileValues map[string]string
+	errs       []error
+}
+
+// newSource loads the base config file and its environment overlay, if any
+func newSource(path, env string) (*source, error) {
+	s := &source{fileValues: make(map[string]string)}
+	for i, file := range configFiles(path, env) {
+		// Only the base file is required; the overlay is optional
+		if err := s.loadFile(file, i == 0); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// configFiles returns the base config file and its environment overlay
+func configFiles(path, env string) []string {
+	if path == "" {
+		return nil
+	}
+	files := []string{path}
+	if env != "" {
+		ext := filepath.Ext(path)
+		files = append(files, strings.TrimSuffix(path, ext)+"."+env+ext)
+	}
+	return files
+}
+
+// loadFile parses a YAML or TOML file and merges its values into the source
+func (s *source) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return fmt.Errorf("unsupported config file format: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	flatten("", tree, s.fileValues)
+	return nil
+}
+
+// flatten converts a nested config tree into upper-case, underscore-joined keys
+func flatten(prefix string, value interface{}, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			key := strings.ToUpper(k)
+			if prefix != "" {
+				key = prefix + "_" + key
+			}
+			flatten(key, child, out)
+		}
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		out[prefix] = strings.Join(items, ",")
+	case nil:
+		out[prefix] = ""
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+}
+
+// lookup returns the value for key, preferring the environment over the config file
+func (s *source) lookup(key string) (string, bool) {
+	if value := os.Getenv(key); value != "" {
+		return value, true
+	}
+	if value, ok := s.fileValues[key]; ok && value != "" {
+		return value, true
+	}
+	return "", false
+}
+
+// getEnv returns the value for key or the default value
+func (s *source) getEnv(key, defaultValue string) string {
+	if value, ok := s.lookup(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvAsInt returns the integer value for key or the default value
+func (s *source) getEnvAsInt(key string, defaultValue int) int {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("invalid integer for %s: %q", key, valueStr))
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsFloat returns the decimal value for key or the default value
+func (s *source) getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("invalid number for %s: %q", key, valueStr))
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsBool returns the boolean value for key or the default value
+func (s *source) getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("invalid boolean for %s: %q", key, valueStr))
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsDuration returns the duration value for key (e.g. "30s") or the default value
+func (s *source) getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("invalid duration for %s: %q", key, valueStr))
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsRateLimit returns the rate limit for key, written as requests per
+// period (e.g. "10/1m" or "10/m"), or the default value. "0" is unlimited.
+func (s *source) getEnvAsRateLimit(key string, defaultValue RateLimit) RateLimit {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	if valueStr == "0" {
+		return RateLimit{}
+	}
+
+	requestsStr, periodStr, _ := strings.Cut(valueStr, "/")
+	requests, err := strconv.Atoi(requestsStr)
+	if err != nil || requests < 0 {
+		s.errs = append(s.errs, fmt.Errorf("invalid rate limit for %s: %q", key, valueStr))
+		return defaultValue
+	}
+	period, err := time.ParseDuration(periodStr)
+	if err != nil {
+		period, err = time.ParseDuration("1" + periodStr)
+	}
+	if err != nil || period <= 0 {
+		s.errs = append(s.errs, fmt.Errorf("invalid rate limit for %s: %q", key, valueStr))
+		return defaultValue
+	}
+	return RateLimit{Requests: requests, Period: period}
+}
+
+// getEnvAsList returns the comma-separated values for key or the default value
+func (s *source) getEnvAsList(key string, defaultValue []string) []string {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	return splitList(valueStr)
+}
+
+// getEnvAsTime returns the RFC 3339 time value for key or the default value
+func (s *source) getEnvAsTime(key string, defaultValue time.Time) time.Time {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	value, err := time.Parse(time.RFC3339, valueStr)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("invalid RFC 3339 time for %s: %q", key, valueStr))
+		return defaultValue
+	}
+	return value
+}
+
+// getSecret returns the value for key, reading it from the file named by
+// KEY_FILE when set. This supports Docker and Kubernetes mounted secrets.
+// The environment takes precedence over the config file as usual: KEY and
+// KEY_FILE are looked up in the environment before either is read from the file.
+func (s *source) getSecret(key, defaultValue string) string {
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		return s.readSecretFile(key, path, defaultValue)
+	}
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	if path, ok := s.fileValues[key+"_FILE"]; ok && path != "" {
+		return s.readSecretFile(key, path, defaultValue)
+	}
+	if value, ok := s.fileValues[key]; ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// readSecretFile returns the secret for key held in the file at path
+func (s *source) readSecretFile(key, path, defaultValue string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("failed to read %s_FILE: %w", key, err))
+		return defaultValue
+	}
+	return strings.TrimRight(string(data), "\r\n")
+}
+
+// getSecretAsList returns the comma-separated secrets for key, honouring KEY_FILE
+func (s *source) getSecretAsList(key string, defaultValue []string) []string {
+	valueStr := s.getSecret(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	return splitList(valueStr)
+}
+
+// getSecretAsMap returns the comma-separated name=secret pairs for key,
+// honouring KEY_FILE
+func (s *source) getSecretAsMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range s.getSecretAsList(key, nil) {
+		name, secret, ok := strings.Cut(pair, "=")
+		if name, secret = strings.TrimSpace(name), strings.TrimSpace(secret); !ok || name == "" || secret == "" {
+			s.errs = append(s.errs, fmt.Errorf("invalid name=secret pair in %s", key))
+			continue
+		}
+		values[name] = secret
+	}
+	return values
+}
+
+// splitList splits a comma-separated value, dropping empty items
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// err returns all parse errors collected while loading values
+func (s *source) err() error {
+	if len(s.errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(s.errs))
+	for _, err := range s.errs {
+		msgs = append(msgs, err.Error())
+	}
+	sort.Strings(msgs)
+	return fmt.Errorf("invalid configuration: %s", strings.Join(msgs, "; "))
+}
+
+// getEnv returns the environment variable for key or the default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
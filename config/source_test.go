@@ -0,0 +1,183 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a file in dir and returns its path
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+// clearEnv unsets the variables a test reads, so the caller's environment
+// cannot change its outcome
+func clearEnv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+	}
+}
+
+func TestSourcePrecedence(t *testing.T) {
+	clearEnv(t, "DB_HOST", "DB_MAX_CONNECTIONS", "DB_NAME", "SERVER_READ_TIMEOUT", "CORS_ALLOWED_ORIGINS")
+	dir := t.TempDir()
+	base := writeFile(t, dir, "config.yaml", `
+server:
+  port: 9000
+  read_timeout: 10s
+db:
+  host: db.internal
+  max_connections: 20
+cors:
+  allowed_origins:
+    - https://a.example.com
+    - https://b.example.com
+`)
+	writeFile(t, dir, "config.production.yaml", `
+db:
+  host: db.production
+`)
+
+	t.Setenv("SERVER_PORT", "8081")
+	src, err := newSource(base, "production")
+	if err != nil {
+		t.Fatalf("newSource: %v", err)
+	}
+
+	// The environment beats the overlay, which beats the base file
+	if got := src.getEnv("SERVER_PORT", "8080"); got != "8081" {
+		t.Errorf("SERVER_PORT = %s, want the environment's 8081", got)
+	}
+	if got := src.getEnv("DB_HOST", "localhost"); got != "db.production" {
+		t.Errorf("DB_HOST = %s, want the overlay's db.production", got)
+	}
+	if got := src.getEnvAsInt("DB_MAX_CONNECTIONS", 10); got != 20 {
+		t.Errorf("DB_MAX_CONNECTIONS = %d, want the base file's 20", got)
+	}
+	if got := src.getEnvAsDuration("SERVER_READ_TIMEOUT", time.Second); got != 10*time.Second {
+		t.Errorf("SERVER_READ_TIMEOUT = %s, want 10s", got)
+	}
+	if got := src.getEnvAsList("CORS_ALLOWED_ORIGINS", nil); strings.Join(got, ",") != "https://a.example.com,https://b.example.com" {
+		t.Errorf("CORS_ALLOWED_ORIGINS = %v, want both origins of the list", got)
+	}
+	if got := src.getEnv("DB_NAME", "payment_service"); got != "payment_service" {
+		t.Errorf("DB_NAME = %s, want the default", got)
+	}
+	if err := src.err(); err != nil {
+		t.Errorf("err = %v", err)
+	}
+
+	// A missing overlay is fine, a missing base file is not
+	if _, err := newSource(base, "staging"); err != nil {
+		t.Errorf("newSource without an overlay: %v", err)
+	}
+	if _, err := newSource(filepath.Join(dir, "missing.yaml"), ""); err == nil {
+		t.Error("newSource accepted a missing config file")
+	}
+}
+
+func TestSourceInvalidValues(t *testing.T) {
+	t.Setenv("DB_MAX_CONNECTIONS", "many")
+	t.Setenv("SERVER_READ_TIMEOUT", "soon")
+	src, err := newSource("", "")
+	if err != nil {
+		t.Fatalf("newSource: %v", err)
+	}
+
+	if got := src.getEnvAsInt("DB_MAX_CONNECTIONS", 10); got != 10 {
+		t.Errorf("DB_MAX_CONNECTIONS = %d, want the default", got)
+	}
+	src.getEnvAsDuration("SERVER_READ_TIMEOUT", time.Second)
+	err = src.err()
+	if err == nil || !strings.Contains(err.Error(), "DB_MAX_CONNECTIONS") || !strings.Contains(err.Error(), "SERVER_READ_TIMEOUT") {
+		t.Errorf("err = %v, want both invalid values reported", err)
+	}
+}
+
+func TestSourceSecrets(t *testing.T) {
+	clearEnv(t, "DB_PASSWORD", "DB_PASSWORD_FILE", "VNPAY_HASH_SECRET", "VNPAY_HASH_SECRET_FILE", "REQUEST_SIGNING_KEYS", "REQUEST_SIGNING_KEYS_FILE")
+	dir := t.TempDir()
+	envSecret := writeFile(t, dir, "env_secret", "from-env-file\n")
+	fileSecret := writeFile(t, dir, "file_secret", "from-config-file\n")
+	base := writeFile(t, dir, "config.yaml", `
+db:
+  password_file: `+fileSecret+`
+vnpay:
+  hash_secret: from-config
+`)
+
+	load := func(t *testing.T) *source {
+		t.Helper()
+		src, err := newSource(base, "")
+		if err != nil {
+			t.Fatalf("newSource: %v", err)
+		}
+		return src
+	}
+
+	t.Run("config file", func(t *testing.T) {
+		src := load(t)
+		if got := src.getSecret("DB_PASSWORD", ""); got != "from-config-file" {
+			t.Errorf("DB_PASSWORD = %q, want the secret file named in the config file, without its newline", got)
+		}
+		if got := src.getSecret("VNPAY_HASH_SECRET", ""); got != "from-config" {
+			t.Errorf("VNPAY_HASH_SECRET = %q, want the config file's value", got)
+		}
+	})
+
+	t.Run("environment beats a secret file in the config file", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD", "from-env")
+		if got := load(t).getSecret("DB_PASSWORD", ""); got != "from-env" {
+			t.Errorf("DB_PASSWORD = %q, want the environment's value", got)
+		}
+	})
+
+	t.Run("secret file in the environment", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD", "from-env")
+		t.Setenv("DB_PASSWORD_FILE", envSecret)
+		t.Setenv("VNPAY_HASH_SECRET_FILE", envSecret)
+		src := load(t)
+		if got := src.getSecret("DB_PASSWORD", ""); got != "from-env-file" {
+			t.Errorf("DB_PASSWORD = %q, want the secret file named in the environment", got)
+		}
+		if got := src.getSecret("VNPAY_HASH_SECRET", ""); got != "from-env-file" {
+			t.Errorf("VNPAY_HASH_SECRET = %q, want the secret file named in the environment", got)
+		}
+	})
+
+	t.Run("missing secret file", func(t *testing.T) {
+		t.Setenv("DB_PASSWORD_FILE", filepath.Join(dir, "missing"))
+		src := load(t)
+		if got := src.getSecret("DB_PASSWORD", "default"); got != "default" {
+			t.Errorf("DB_PASSWORD = %q, want the default", got)
+		}
+		if err := src.err(); err == nil || !strings.Contains(err.Error(), "DB_PASSWORD_FILE") {
+			t.Errorf("err = %v, want the unreadable file reported", err)
+		}
+	})
+
+	t.Run("name=secret pairs", func(t *testing.T) {
+		t.Setenv("REQUEST_SIGNING_KEYS", "booking = secret-1, ticketing=secret-2")
+		src := load(t)
+		keys := src.getSecretAsMap("REQUEST_SIGNING_KEYS")
+		if len(keys) != 2 || keys["booking"] != "secret-1" || keys["ticketing"] != "secret-2" {
+			t.Errorf("REQUEST_SIGNING_KEYS = %v", keys)
+		}
+
+		t.Setenv("REQUEST_SIGNING_KEYS", "booking")
+		src = load(t)
+		src.getSecretAsMap("REQUEST_SIGNING_KEYS")
+		if src.err() == nil {
+			t.Error("a pair without a secret was accepted")
+		}
+	})
+}
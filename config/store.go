@@ -0,0 +1,26 @@
+package config
+
+import "sync/atomic"
+
+// VNPayStore holds the current VNPay settings and allows them to be swapped
+// atomically while requests are being served
+type VNPayStore struct {
+	current atomic.Pointer[VNPayConfig]
+}
+
+// NewVNPayStore creates a store holding a copy of cfg
+func NewVNPayStore(cfg VNPayConfig) *VNPayStore {
+	store := &VNPayStore{}
+	store.Store(cfg)
+	return store
+}
+
+// Load returns the current VNPay settings. Callers must not modify the result.
+func (s *VNPayStore) Load() *VNPayConfig {
+	return s.current.Load()
+}
+
+// Store replaces the current VNPay settings with a copy of cfg
+func (s *VNPayStore) Store(cfg VNPayConfig) {
+	s.current.Store(&cfg)
+}
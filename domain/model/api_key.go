@@ -0,0 +1,69 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKeyScope is a permission granted to an API key
+type APIKeyScope string
+
+// API key scopes
+const (
+	// ScopePaymentsCreate allows creating payments, querying their status and
+	// cancelling unpaid invoices
+	ScopePaymentsCreate APIKeyScope = "payments:create"
+	// ScopePaymentsRefund allows refunding payments
+	ScopePaymentsRefund APIKeyScope = "payments:refund"
+	// ScopeInvoicesRead allows reading, searching and exporting invoices
+	ScopeInvoicesRead APIKeyScope = "invoices:read"
+	// ScopeAdmin allows everything, including voiding invoices, the ledger,
+	// and acting for other tenants
+	ScopeAdmin APIKeyScope = "admin"
+)
+
+// APIKeyScopes lists every API key scope
+var APIKeyScopes = []APIKeyScope{ScopePaymentsCreate, ScopePaymentsRefund, ScopeInvoicesRead, ScopeAdmin}
+
+// Valid reports whether the scope is a known scope
+func (s APIKeyScope) Valid() bool {
+	for _, scope := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey is a key a service authenticates with. Only a hash of the key is
+// stored; the key itself is shown once, when it is created.
+type APIKey struct {
+	KeyID    uuid.UUID `json:"key_id"`
+	TenantID string    `json:"tenant_id"`
+	Name     string    `json:"name"`
+	// Prefix is the start of the key, to recognise it without revealing it
+	Prefix    string        `json:"prefix"`
+	Scopes    []APIKeyScope `json:"scopes"`
+	ExpiresAt *time.Time    `json:"expires_at,omitempty"`
+	RevokedAt *time.Time    `json:"revoked_at,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// HasScope reports whether the key grants a scope; admin keys grant every scope
+func (k APIKey) HasScope(scope APIKeyScope) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the key is neither revoked nor expired at now
+func (k APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
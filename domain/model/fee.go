@@ -0,0 +1,97 @@
+package model
+
+import (
+	"math"
+	"strings"
+)
+
+// VNPayFeeRule is the merchant discount rate (MDR) VNPay charges a tenant on
+// payments through a bank and card type. An empty bank code or card type
+// matches any.
+type VNPayFeeRule struct {
+	TenantID string `json:"tenant_id"`
+	BankCode string `json:"bank_code,omitempty"`
+	CardType string `json:"card_type,omitempty"`
+	// RatePercent is charged on the amount paid, plus FixedFee; the total is
+	// at least MinFee
+	RatePercent float64 `json:"rate_percent"`
+	FixedFee    float64 `json:"fixed_fee"`
+	MinFee      float64 `json:"min_fee"`
+}
+
+// Fee returns the fee charged on a payment of amount, never more than the amount
+func (r VNPayFeeRule) Fee(amount float64) float64 {
+	if amount <= 0 {
+		return 0
+	}
+	fee := math.Max(amount*r.RatePercent/100+r.FixedFee, r.MinFee)
+	return RoundAmount(math.Min(fee, amount))
+}
+
+// specificity ranks how closely the rule matches a bank code and card type:
+// both beat the bank code alone, which beats the card type alone, which
+// beats a catch-all rule. It is negative when the rule does not match.
+func (r VNPayFeeRule) specificity(bankCode, cardType string) int {
+	score := 0
+	if r.BankCode != "" {
+		if !strings.EqualFold(r.BankCode, bankCode) {
+			return -1
+		}
+		score += 2
+	}
+	if r.CardType != "" {
+		if !strings.EqualFold(r.CardType, cardType) {
+			return -1
+		}
+		score++
+	}
+	return score
+}
+
+// VNPayFeeSchedule is the set of fee rules of a tenant, with the fee charged
+// on payments none of them matches
+type VNPayFeeSchedule struct {
+	Rules   []VNPayFeeRule
+	Default VNPayFeeRule
+}
+
+// Rule returns the most specific rule matching a bank code and card type, or
+// the default rule
+func (s VNPayFeeSchedule) Rule(bankCode, cardType string) VNPayFeeRule {
+	rule, best := s.Default, -1
+	for _, candidate := range s.Rules {
+		if score := candidate.specificity(bankCode, cardType); score > best {
+			rule, best = candidate, score
+		}
+	}
+	return rule
+}
+
+// Fee returns the fee charged on a payment of amount through a bank and card type
+func (s VNPayFeeSchedule) Fee(bankCode, cardType string, amount float64) float64 {
+	return s.Rule(bankCode, cardType).Fee(amount)
+}
+
+// FeeReportRequest holds the query parameters of a fee report
+type FeeReportRequest struct {
+	// From and To are YYYY-MM-DD dates in Vietnam time bounding, inclusively,
+	// when the invoices were created
+	From string `form:"from" binding:"required"`
+	To   string `form:"to" binding:"required"`
+}
+
+// FeeReportLine totals the invoices paid through one bank and card type
+type FeeReportLine struct {
+	BankCode     string  `json:"bank_code"`
+	CardType     string  `json:"card_type"`
+	InvoiceCount int     `json:"invoice_count"`
+	GrossAmount  float64 `json:"gross_amount"`
+	FeeAmount    float64 `json:"fee_amount"`
+	NetAmount    float64 `json:"net_amount"`
+}
+
+// FeeReport totals the VNPay fees on a tenant's paid invoices, per bank and card type
+type FeeReport struct {
+	Lines []FeeReportLine `json:"lines"`
+	Total FeeReportLine   `json:"total"`
+}
@@ -15,8 +15,21 @@ const (
 	PaymentStatusCompleted PaymentStatus = "COMPLETED"
 	PaymentStatusFailed    PaymentStatus = "FAILED"
 	PaymentStatusRefunded  PaymentStatus = "REFUNDED"
+	PaymentStatusCancelled PaymentStatus = "CANCELLED"
+	PaymentStatusVoided    PaymentStatus = "VOIDED"
 )
 
+// Closed reports whether the invoice was cancelled or voided. Closed invoices
+// are final: payment callbacks and refunds no longer change their status.
+func (s PaymentStatus) Closed() bool {
+	return s == PaymentStatusCancelled || s == PaymentStatusVoided
+}
+
+// Paid reports whether the customer paid the invoice, even if it was refunded since
+func (s PaymentStatus) Paid() bool {
+	return s == PaymentStatusCompleted || s == PaymentStatusRefunded
+}
+
 // PaymentMethod represents the method used for payment
 type PaymentMethod string
 
@@ -28,6 +41,7 @@ const (
 // Invoice represents an invoice in the system
 type Invoice struct {
 	InvoiceID      uuid.UUID     `json:"invoice_id"`
+	TenantID       string        `json:"tenant_id"`
 	InvoiceNumber  string        `json:"invoice_number"`
 	InvoiceType    string        `json:"invoice_type"`
 	CustomerID     string        `json:"customer_id"`
@@ -44,22 +58,64 @@ type Invoice struct {
 	UpdatedAt      time.Time     `json:"updated_at"`
 
 	// VNPay specific fields
+	VNPayTmnCode  string `json:"vnpay_tmn_code,omitempty"`
 	VNPayTxnRef   string `json:"vnpay_txn_ref,omitempty"`
 	VNPayBankCode string `json:"vnpay_bank_code,omitempty"`
 	VNPayTxnNo    string `json:"vnpay_txn_no,omitempty"`
 	VNPayPayDate  string `json:"vnpay_pay_date,omitempty"`
+	VNPayCardType string `json:"vnpay_card_type,omitempty"`
+	// VNPayFee is the merchant fee VNPay charged on the payment, recorded
+	// when the invoice completes
+	VNPayFee float64 `json:"vnpay_fee,omitempty"`
+	// RefundedAmount is how much of the payment has been refunded so far
+	RefundedAmount float64 `json:"refunded_amount,omitempty"`
+
+	// Buyer details printed on the e-invoice
+	Buyer InvoiceBuyer `json:"buyer"`
+
+	// E-invoice number, assigned when the e-invoice is first issued
+	EInvoiceSeries   string     `json:"einvoice_series,omitempty"`
+	EInvoiceNumber   int        `json:"einvoice_number,omitempty"`
+	EInvoiceIssuedAt *time.Time `json:"einvoice_issued_at,omitempty"`
+
+	// When and why the invoice was cancelled or voided
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	CancelReason string     `json:"cancel_reason,omitempty"`
+
+	// Items are the invoice lines; invoices created from a single amount have none
+	Items        []InvoiceItem    `json:"items,omitempty"`
+	TaxBreakdown []InvoiceTaxLine `json:"tax_breakdown,omitempty"`
+}
+
+// NetAmount returns what the tenant keeps of the invoice's final amount after VNPay's fee
+func (i Invoice) NetAmount() float64 {
+	return RoundAmount(i.FinalAmount - i.VNPayFee)
+}
+
+// InvoiceBuyer identifies the buyer on an e-invoice. Organizations give a tax
+// code, name and address; individuals may leave all of them empty.
+type InvoiceBuyer struct {
+	Name    string `json:"name,omitempty"`
+	TaxCode string `json:"tax_code,omitempty"`
+	Address string `json:"address,omitempty"`
+	Email   string `json:"email,omitempty" binding:"omitempty,email"`
 }
 
-// VNPayPaymentRequest holds the request data for creating a new VNPay payment
+// VNPayPaymentRequest holds the request data for creating a new VNPay payment.
+// An order is described either by Items, from which the amounts are computed,
+// or by a single ticket and its amounts.
 type VNPayPaymentRequest struct {
-	CustomerID     string  `json:"customer_id" binding:"required"`
-	TicketID       string  `json:"ticket_id" binding:"required"`
-	Amount         float64 `json:"amount" binding:"required"`
-	Language       string  `json:"language" binding:"required"`
-	BankCode       string  `json:"bank_code"`
-	InvoiceType    string  `json:"invoice_type"`
-	DiscountAmount float64 `json:"discount_amount"`
-	TaxAmount      float64 `json:"tax_amount"`
+	CustomerID     string               `json:"customer_id" binding:"required"`
+	TicketID       string               `json:"ticket_id" binding:"required_without=Items"`
+	Amount         float64              `json:"amount" binding:"required_without=Items"`
+	Language       string               `json:"language" binding:"required"`
+	BankCode       string               `json:"bank_code"`
+	OrderType      string               `json:"order_type"`
+	InvoiceType    string               `json:"invoice_type"`
+	DiscountAmount float64              `json:"discount_amount"`
+	TaxAmount      float64              `json:"tax_amount"`
+	Items          []InvoiceItemRequest `json:"items" binding:"omitempty,dive"`
+	Buyer          InvoiceBuyer         `json:"buyer"`
 }
 
 // VNPayPaymentResponse represents the response from the payment creation request
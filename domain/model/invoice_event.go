@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InvoiceEventType identifies what happened to an invoice
+type InvoiceEventType string
+
+// Invoice event types
+const (
+	// InvoiceEventCancelled is published when an unpaid invoice is cancelled
+	InvoiceEventCancelled InvoiceEventType = "invoice.cancelled"
+	// InvoiceEventVoided is published when an erroneous invoice is voided
+	InvoiceEventVoided InvoiceEventType = "invoice.voided"
+)
+
+// InvoiceEvent tells downstream services about a change to an invoice, such
+// as a cancellation after which its tickets can be released. Events are
+// recorded in the transaction that changes the invoice and published to Kafka
+// afterwards, at least once and keyed by invoice ID.
+type InvoiceEvent struct {
+	EventID       uuid.UUID        `json:"event_id"`
+	Type          InvoiceEventType `json:"type"`
+	TenantID      string           `json:"tenant_id"`
+	InvoiceID     uuid.UUID        `json:"invoice_id"`
+	InvoiceNumber string           `json:"invoice_number"`
+	CustomerID    string           `json:"customer_id"`
+	// TicketIDs lists the tickets of the invoice and its items
+	TicketIDs []string `json:"ticket_ids"`
+	// PreviousStatus is the invoice's payment status before the change
+	PreviousStatus PaymentStatus `json:"previous_status"`
+	PaymentStatus  PaymentStatus `json:"payment_status"`
+	Reason         string        `json:"reason,omitempty"`
+	OccurredAt     time.Time     `json:"occurred_at"`
+	// TraceContext is the trace context of the request that caused the
+	// event, which its publication continues. It travels in the Kafka
+	// message's headers rather than its payload.
+	TraceContext map[string]string `json:"-"`
+}
+
+// InvoiceCancelRequest holds the reason an invoice is cancelled or voided
+type InvoiceCancelRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
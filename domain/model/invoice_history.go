@@ -0,0 +1,48 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InvoiceActor identifies who or what changed an invoice's payment status
+type InvoiceActor string
+
+// Invoice actors
+const (
+	// InvoiceActorAPI created the invoice through the payment API
+	InvoiceActorAPI InvoiceActor = "api"
+	// InvoiceActorIPN is VNPay's server-to-server payment notification
+	InvoiceActorIPN InvoiceActor = "ipn"
+	// InvoiceActorReturn is the customer's redirect back from VNPay
+	InvoiceActorReturn InvoiceActor = "return"
+	// InvoiceActorReconciler is a background job, such as the expiry sweep
+	InvoiceActorReconciler InvoiceActor = "reconciler"
+	// InvoiceActorAdmin is a refund, cancellation or void requested by staff
+	InvoiceActorAdmin InvoiceActor = "admin"
+)
+
+// InvoiceChange describes who or what is changing an invoice and why
+type InvoiceChange struct {
+	Actor InvoiceActor
+	// SourceID identifies the callback or request behind the change, such as
+	// VNPay's transaction number
+	SourceID string
+	Reason   string
+}
+
+// InvoiceHistoryEntry records one payment status change of an invoice.
+// History entries are append-only.
+type InvoiceHistoryEntry struct {
+	EventID   int64     `json:"event_id"`
+	TenantID  string    `json:"-"`
+	InvoiceID uuid.UUID `json:"invoice_id"`
+	// OldStatus is empty for the entry recording the invoice's creation
+	OldStatus PaymentStatus `json:"old_status,omitempty"`
+	NewStatus PaymentStatus `json:"new_status"`
+	Actor     InvoiceActor  `json:"actor"`
+	SourceID  string        `json:"source_id,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+}
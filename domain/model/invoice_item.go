@@ -0,0 +1,80 @@
+package model
+
+import (
+	"math"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// VATRates lists the VAT rates, in percent, that invoice items may carry
+var VATRates = []float64{0, 5, 8, 10}
+
+// InvoiceItem is a line of an invoice. Amounts are in VND.
+type InvoiceItem struct {
+	ItemID         uuid.UUID `json:"item_id"`
+	InvoiceID      uuid.UUID `json:"invoice_id"`
+	LineNumber     int       `json:"line_number"`
+	TicketID       string    `json:"ticket_id,omitempty"`
+	Description    string    `json:"description"`
+	Quantity       int       `json:"quantity"`
+	UnitPrice      float64   `json:"unit_price"`
+	DiscountAmount float64   `json:"discount_amount"`
+	// VATRate is a percentage, e.g. 8 for 8%
+	VATRate float64 `json:"vat_rate"`
+
+	// Subtotal is the line amount after discount and before VAT
+	Subtotal    float64 `json:"subtotal"`
+	TaxAmount   float64 `json:"tax_amount"`
+	TotalAmount float64 `json:"total_amount"`
+}
+
+// InvoiceTaxLine totals the items of an invoice sharing a VAT rate
+type InvoiceTaxLine struct {
+	VATRate       float64 `json:"vat_rate"`
+	TaxableAmount float64 `json:"taxable_amount"`
+	TaxAmount     float64 `json:"tax_amount"`
+}
+
+// InvoiceItemRequest holds one line of a payment request
+type InvoiceItemRequest struct {
+	TicketID       string  `json:"ticket_id"`
+	Description    string  `json:"description" binding:"required"`
+	Quantity       int     `json:"quantity" binding:"required,gt=0"`
+	UnitPrice      float64 `json:"unit_price" binding:"gte=0"`
+	DiscountAmount float64 `json:"discount_amount" binding:"gte=0"`
+	VATRate        float64 `json:"vat_rate" binding:"gte=0"`
+}
+
+// RoundAmount rounds an amount to the 2 decimal places stored by the database
+func RoundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// GrossAmount returns the line amount before discount and VAT
+func (i InvoiceItem) GrossAmount() float64 {
+	return RoundAmount(float64(i.Quantity) * i.UnitPrice)
+}
+
+// TaxBreakdown totals items by VAT rate, lowest rate first
+func TaxBreakdown(items []InvoiceItem) []InvoiceTaxLine {
+	byRate := make(map[float64]*InvoiceTaxLine)
+	var lines []InvoiceTaxLine
+	for _, item := range items {
+		line, ok := byRate[item.VATRate]
+		if !ok {
+			line = &InvoiceTaxLine{VATRate: item.VATRate}
+			byRate[item.VATRate] = line
+		}
+		line.TaxableAmount = RoundAmount(line.TaxableAmount + item.Subtotal)
+		line.TaxAmount = RoundAmount(line.TaxAmount + item.TaxAmount)
+	}
+
+	for _, line := range byRate {
+		lines = append(lines, *line)
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].VATRate < lines[j].VATRate
+	})
+	return lines
+}
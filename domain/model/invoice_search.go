@@ -0,0 +1,106 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InvoiceSortField names a column invoice searches can be ordered by
+type InvoiceSortField string
+
+// Invoice sort fields
+const (
+	InvoiceSortCreatedAt   InvoiceSortField = "created_at"
+	InvoiceSortFinalAmount InvoiceSortField = "final_amount"
+)
+
+// Invoice search page size limits
+const (
+	DefaultInvoicePageSize = 20
+	MaxInvoicePageSize     = 100
+)
+
+// InvoiceFilter selects and orders a page of a tenant's invoices. Zero-valued
+// fields do not filter. Invoices are ordered by SortBy and then by invoice ID,
+// both in the same direction, which keeps keyset pagination stable.
+type InvoiceFilter struct {
+	TenantID    string
+	Statuses    []PaymentStatus
+	CustomerID  string
+	TicketID    string
+	BankCode    string
+	InvoiceType string
+
+	// CreatedFrom is inclusive and CreatedTo exclusive
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+
+	// MinAmount and MaxAmount bound the final amount, inclusive
+	MinAmount *float64
+	MaxAmount *float64
+
+	SortBy   InvoiceSortField
+	SortDesc bool
+	Limit    int
+
+	// After continues a search from the last invoice of the previous page
+	After *InvoiceCursor
+}
+
+// InvoiceCursor is the position of an invoice in a search ordering
+type InvoiceCursor struct {
+	SortBy      InvoiceSortField `json:"s"`
+	SortDesc    bool             `json:"d,omitempty"`
+	CreatedAt   time.Time        `json:"c"`
+	FinalAmount float64          `json:"a"`
+	InvoiceID   uuid.UUID        `json:"i"`
+}
+
+// CursorFor returns the cursor positioned after invoice in the filter's ordering
+func (f InvoiceFilter) CursorFor(invoice Invoice) InvoiceCursor {
+	return InvoiceCursor{
+		SortBy:      f.SortBy,
+		SortDesc:    f.SortDesc,
+		CreatedAt:   invoice.CreatedAt,
+		FinalAmount: invoice.FinalAmount,
+		InvoiceID:   invoice.InvoiceID,
+	}
+}
+
+// InvoicePage is one page of invoice search results
+type InvoicePage struct {
+	Invoices []Invoice `json:"data"`
+	// Total counts every invoice matching the filter, across all pages
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// InvoiceSearchRequest holds the query parameters of an invoice search
+type InvoiceSearchRequest struct {
+	// Status is a comma-separated list of payment statuses
+	Status      string     `form:"status"`
+	CustomerID  string     `form:"customer_id"`
+	TicketID    string     `form:"ticket_id"`
+	BankCode    string     `form:"bank_code"`
+	InvoiceType string     `form:"invoice_type"`
+	CreatedFrom *time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo   *time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	MinAmount   *float64   `form:"min_amount" binding:"omitempty,gte=0"`
+	MaxAmount   *float64   `form:"max_amount" binding:"omitempty,gte=0"`
+	// Sort is a sort field, prefixed with "-" for descending order
+	Sort   string `form:"sort" binding:"omitempty,oneof=created_at -created_at final_amount -final_amount"`
+	Limit  int    `form:"limit" binding:"omitempty,gte=1,lte=100"`
+	Cursor string `form:"cursor"`
+}
+
+// InvoiceExportRequest holds the query parameters of an invoice export
+type InvoiceExportRequest struct {
+	// Format is csv (the default) or xlsx
+	Format string `form:"format" binding:"omitempty,oneof=csv xlsx"`
+	// From and To are inclusive YYYY-MM-DD creation dates in Vietnam time
+	From string `form:"from" binding:"required"`
+	To   string `form:"to" binding:"required"`
+	// Status is a comma-separated list of payment statuses
+	Status string `form:"status"`
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LedgerAccount names an account of a tenant's ledger
+type LedgerAccount string
+
+// Ledger accounts
+const (
+	// LedgerAccountReceivable holds what customers owe for completed invoices
+	LedgerAccountReceivable LedgerAccount = "customer_receivable"
+	// LedgerAccountVNPayClearing holds what VNPay collected for us and has not settled yet
+	LedgerAccountVNPayClearing LedgerAccount = "vnpay_clearing"
+	// LedgerAccountRevenue holds the revenue of completed invoices, less refunds
+	LedgerAccountRevenue LedgerAccount = "revenue"
+	// LedgerAccountRefundsPayable holds refunds owed to customers until VNPay pays them out
+	LedgerAccountRefundsPayable LedgerAccount = "refunds_payable"
+	// LedgerAccountFees holds the fees VNPay charged on payments or deducted from settlements
+	LedgerAccountFees LedgerAccount = "fees"
+	// LedgerAccountBank holds the settlements VNPay paid into the tenant's bank account
+	LedgerAccountBank LedgerAccount = "bank"
+)
+
+// LedgerAccounts lists every ledger account, in chart-of-accounts order
+var LedgerAccounts = []LedgerAccount{
+	LedgerAccountReceivable,
+	LedgerAccountVNPayClearing,
+	LedgerAccountBank,
+	LedgerAccountRefundsPayable,
+	LedgerAccountRevenue,
+	LedgerAccountFees,
+}
+
+// DebitNormal reports whether debits increase the account's balance, as they
+// do for assets and expenses. Credits increase liabilities and revenue.
+func (a LedgerAccount) DebitNormal() bool {
+	switch a {
+	case LedgerAccountRefundsPayable, LedgerAccountRevenue:
+		return false
+	default:
+		return true
+	}
+}
+
+// LedgerTransactionKind identifies the business event a ledger transaction records
+type LedgerTransactionKind string
+
+// Ledger transaction kinds
+const (
+	// LedgerPayment records a completed invoice paid through VNPay
+	LedgerPayment LedgerTransactionKind = "payment"
+	// LedgerRefund records a refund of a paid invoice, paid out by VNPay
+	LedgerRefund LedgerTransactionKind = "refund"
+	// LedgerFee records the merchant fee VNPay charged on a completed invoice's payment
+	LedgerFee LedgerTransactionKind = "fee"
+	// LedgerSettlement records VNPay paying collected money into the bank account
+	LedgerSettlement LedgerTransactionKind = "settlement"
+)
+
+// LedgerEntry debits or credits one account. Exactly one of Debit and Credit is positive.
+type LedgerEntry struct {
+	Account LedgerAccount `json:"account"`
+	Debit   float64       `json:"debit"`
+	Credit  float64       `json:"credit"`
+}
+
+// LedgerTransaction is a balanced set of ledger entries recording one
+// business event. A tenant has at most one transaction per kind and reference.
+type LedgerTransaction struct {
+	TransactionID uuid.UUID             `json:"transaction_id"`
+	TenantID      string                `json:"tenant_id"`
+	Kind          LedgerTransactionKind `json:"kind"`
+	// Reference is the invoice ID of payments, refunds and fees, and the
+	// VNPay reference of settlements
+	Reference   string        `json:"reference"`
+	InvoiceID   *uuid.UUID    `json:"invoice_id,omitempty"`
+	Description string        `json:"description,omitempty"`
+	PostedAt    time.Time     `json:"posted_at"`
+	Entries     []LedgerEntry `json:"entries"`
+}
+
+// Balanced reports whether the transaction's debits equal its credits
+func (t LedgerTransaction) Balanced() bool {
+	var debits, credits float64
+	for _, entry := range t.Entries {
+		debits += entry.Debit
+		credits += entry.Credit
+	}
+	return RoundAmount(debits) == RoundAmount(credits)
+}
+
+// LedgerBalance is the total of an account's entries up to a point in time
+type LedgerBalance struct {
+	Account LedgerAccount `json:"account"`
+	Debit   float64       `json:"debit"`
+	Credit  float64       `json:"credit"`
+	// Balance is the account's balance on its normal side: debits less
+	// credits for debit-normal accounts, credits less debits otherwise
+	Balance float64 `json:"balance"`
+}
+
+// LedgerBalances lists the balances of every ledger account of a tenant
+type LedgerBalances struct {
+	AsOf     time.Time       `json:"as_of"`
+	Accounts []LedgerBalance `json:"accounts"`
+}
+
+// LedgerBalanceRequest holds the query parameters of a balance request
+type LedgerBalanceRequest struct {
+	// AsOf is a YYYY-MM-DD date, whose end in Vietnam time bounds the balance,
+	// or an RFC 3339 timestamp. It defaults to now.
+	AsOf string `form:"asOf"`
+}
+
+// LedgerSettlementRequest records a VNPay settlement into the bank account
+type LedgerSettlementRequest struct {
+	// Reference is VNPay's settlement reference; each is posted once
+	Reference string `json:"reference" binding:"required,max=100"`
+	// Amount is the gross amount VNPay settled, before fees
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+	// Fee is the part of Amount VNPay kept as fees, other than the fees
+	// already charged on each payment
+	Fee float64 `json:"fee" binding:"gte=0"`
+	// SettledAt is when the money reached the bank account, RFC 3339; it defaults to now
+	SettledAt string `json:"settledAt"`
+}
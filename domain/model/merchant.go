@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// DefaultTenantID is the tenant used when a request does not name one. Its
+// merchant falls back to the VNPay terminal configured in the environment.
+const DefaultTenantID = "default"
+
+// Merchant represents a VNPay terminal owned by a tenant (brand)
+type Merchant struct {
+	TenantID   string `json:"tenant_id"`
+	Name       string `json:"name"`
+	TmnCode    string `json:"tmn_code"`
+	HashSecret string `json:"-"`
+
+	// Previous secrets still accepted on callbacks during a rotation window
+	SecondaryHashSecrets     []string   `json:"-"`
+	SecondarySecretsExpireAt *time.Time `json:"secondary_secrets_expire_at,omitempty"`
+
+	ReturnURL string    `json:"return_url,omitempty"`
+	Seller    Seller    `json:"seller"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Seller identifies the legal entity issuing a tenant's e-invoices
+type Seller struct {
+	LegalName string `json:"legal_name,omitempty"`
+	TaxCode   string `json:"tax_code,omitempty"`
+	Address   string `json:"address,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	Email     string `json:"email,omitempty"`
+
+	// EInvoiceTemplate (ký hiệu mẫu số, e.g. "1" for VAT invoices) and
+	// EInvoiceSeries (ký hiệu hóa đơn, e.g. "C26TAA") are registered with the
+	// tax authority
+	EInvoiceTemplate string `json:"einvoice_template,omitempty"`
+	EInvoiceSeries   string `json:"einvoice_series,omitempty"`
+}
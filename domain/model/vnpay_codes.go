@@ -0,0 +1,77 @@
+package model
+
+// VNPayLocales lists the values accepted by vnp_Locale
+var VNPayLocales = map[string]string{
+	"vn": "Tiếng Việt",
+	"en": "English",
+}
+
+// VNPayBankCodes lists the vnp_BankCode values accepted by the VNPay payment
+// page: the payment method codes followed by the supported banks and schemes
+var VNPayBankCodes = map[string]string{
+	"VNPAYQR":         "Thanh toán quét mã QR",
+	"VNBANK":          "Thẻ ATM - Tài khoản ngân hàng nội địa",
+	"INTCARD":         "Thẻ thanh toán quốc tế",
+	"NCB":             "Ngân hàng NCB",
+	"AGRIBANK":        "Ngân hàng Agribank",
+	"SCB":             "Ngân hàng SCB",
+	"SACOMBANK":       "Ngân hàng Sacombank",
+	"EXIMBANK":        "Ngân hàng Eximbank",
+	"MSBANK":          "Ngân hàng MSBANK",
+	"NAMABANK":        "Ngân hàng Nam A Bank",
+	"VNMART":          "Ví điện tử VnMart",
+	"VIETINBANK":      "Ngân hàng Vietinbank",
+	"VIETCOMBANK":     "Ngân hàng Vietcombank",
+	"HDBANK":          "Ngân hàng HDBank",
+	"DONGABANK":       "Ngân hàng Đông Á",
+	"TPBANK":          "Ngân hàng TPBank",
+	"OJB":             "Ngân hàng OceanBank",
+	"BIDV":            "Ngân hàng BIDV",
+	"TECHCOMBANK":     "Ngân hàng Techcombank",
+	"VPBANK":          "Ngân hàng VPBank",
+	"MBBANK":          "Ngân hàng MBBank",
+	"ACB":             "Ngân hàng ACB",
+	"OCB":             "Ngân hàng OCB",
+	"IVB":             "Ngân hàng IVB",
+	"VIB":             "Ngân hàng VIB",
+	"SHB":             "Ngân hàng SHB",
+	"ABBANK":          "Ngân hàng ABBank",
+	"BACABANK":        "Ngân hàng Bắc Á",
+	"PVCOMBANK":       "Ngân hàng PVcomBank",
+	"SEABANK":         "Ngân hàng SeABank",
+	"VIETCAPITALBANK": "Ngân hàng Bản Việt",
+	"VISA":            "Thẻ quốc tế Visa",
+	"MASTERCARD":      "Thẻ quốc tế MasterCard",
+	"JCB":             "Thẻ quốc tế JCB",
+	"UPI":             "UnionPay International",
+}
+
+// VNPayOrderTypes lists the vnp_OrderType category codes defined by VNPay
+var VNPayOrderTypes = map[string]string{
+	"topup":       "Nạp tiền điện thoại",
+	"billpayment": "Thanh toán hóa đơn",
+	"fashion":     "Thời trang",
+	"other":       "Khác",
+	"100000":      "Thực phẩm - Tiêu dùng",
+	"110000":      "Điện thoại - Máy tính bảng",
+	"120000":      "Điện gia dụng",
+	"130000":      "Máy tính - Thiết bị văn phòng",
+	"140000":      "Điện tử - Âm thanh",
+	"150000":      "Sách/Báo/Tạp chí",
+	"160000":      "Thể thao, dã ngoại",
+	"170000":      "Khách sạn & Du lịch",
+	"180000":      "Ẩm thực",
+	"190000":      "Giải trí & Đào tạo",
+	"200000":      "Thời trang",
+	"210000":      "Sức khỏe - Làm đẹp",
+	"220000":      "Mẹ & Bé",
+	"230000":      "Vật dụng nhà bếp",
+	"240000":      "Xe cộ - Phương tiện",
+	"250000":      "Thanh toán",
+	"250007":      "Vé máy bay",
+	"260000":      "Mua mã thẻ",
+	"270000":      "Dược phẩm - Dịch vụ y tế",
+}
+
+// DefaultVNPayOrderType is used when a payment request does not set an order type
+const DefaultVNPayOrderType = "other"
@@ -0,0 +1,308 @@
+// Package einvoice renders invoices as Vietnamese electronic invoices in the
+// XML format of Decree 123/2020/ND-CP and Circular 78/2021/TT-BTC.
+//
+// Documents are built unsigned: the DSCKS element is left for the seller's
+// signing service to fill in with its digital signature over DLHDon before
+// the invoice is sent to the tax authority.
+package einvoice
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"payment_service/domain/model"
+)
+
+// Version is the version of the tax authority's XML format the documents follow
+const Version = "2.0.1"
+
+// VAT invoices use template number 1 (Hóa đơn giá trị gia tăng)
+const (
+	vatInvoiceTemplate = "1"
+	vatInvoiceTitle    = "HÓA ĐƠN GIÁ TRỊ GIA TĂNG"
+)
+
+// vietnamTime is Vietnam's time zone, which has no daylight saving time, so
+// invoice dates do not depend on the tz database being installed
+var vietnamTime = time.FixedZone("ICT", 7*60*60)
+
+// ErrNotIssued is returned when building a document for an invoice that has
+// no e-invoice number yet
+var ErrNotIssued = errors.New("invoice has no e-invoice number")
+
+// Document is the HDon root element of an e-invoice
+type Document struct {
+	XMLName    xml.Name   `xml:"HDon"`
+	Data       Data       `xml:"DLHDon"`
+	Signatures Signatures `xml:"DSCKS"`
+}
+
+// Data is the signed part of an e-invoice (DLHDon)
+type Data struct {
+	ID      string      `xml:"Id,attr"`
+	General GeneralInfo `xml:"TTChung"`
+	Content Content     `xml:"NDHDon"`
+}
+
+// GeneralInfo holds the invoice identification (TTChung)
+type GeneralInfo struct {
+	Version       string `xml:"PBan"`
+	Title         string `xml:"THDon"`
+	Template      string `xml:"KHMSHDon"`
+	Series        string `xml:"KHHDon"`
+	Number        int    `xml:"SHDon"`
+	Date          string `xml:"NLap"`
+	Currency      string `xml:"DVTTe"`
+	ExchangeRate  int    `xml:"TGia"`
+	PaymentMethod string `xml:"HTTToan,omitempty"`
+}
+
+// Content holds the parties, lines and totals of an e-invoice (NDHDon)
+type Content struct {
+	Seller Seller `xml:"NBan"`
+	Buyer  Buyer  `xml:"NMua"`
+	Lines  []Line `xml:"DSHHDVu>HHDVu"`
+	Totals Totals `xml:"TToan"`
+}
+
+// Seller is the NBan element
+type Seller struct {
+	Name    string `xml:"Ten"`
+	TaxCode string `xml:"MST"`
+	Address string `xml:"DChi"`
+	Phone   string `xml:"SDThoai,omitempty"`
+	Email   string `xml:"DCTDTu,omitempty"`
+}
+
+// Buyer is the NMua element. Organizations give Name, TaxCode and Address;
+// individuals may be named by FullName alone.
+type Buyer struct {
+	Name       string `xml:"Ten,omitempty"`
+	TaxCode    string `xml:"MST,omitempty"`
+	Address    string `xml:"DChi,omitempty"`
+	CustomerID string `xml:"MKHang,omitempty"`
+	FullName   string `xml:"HVTNMHang,omitempty"`
+	Email      string `xml:"DCTDTu,omitempty"`
+}
+
+// Line is an HHDVu element
+type Line struct {
+	// Kind is 1 for goods and services (TChat)
+	Kind        int    `xml:"TChat"`
+	Number      int    `xml:"STT"`
+	Code        string `xml:"MHHDVu,omitempty"`
+	Description string `xml:"THHDVu"`
+	Quantity    int    `xml:"SLuong"`
+	UnitPrice   Amount `xml:"DGia"`
+	Discount    Amount `xml:"STCKhau,omitempty"`
+	// Amount is the line amount after discount and before VAT (ThTien)
+	Amount  Amount `xml:"ThTien"`
+	VATRate string `xml:"TSuat"`
+}
+
+// Totals is the TToan element
+type Totals struct {
+	ByRate      []RateTotal `xml:"THTTLTSuat>LTSuat"`
+	Subtotal    Amount      `xml:"TgTCThue"`
+	Tax         Amount      `xml:"TgTThue"`
+	Discount    Amount      `xml:"TTCKTMai"`
+	Total       Amount      `xml:"TgTTTBSo"`
+	TotalInText string      `xml:"TgTTTBChu"`
+}
+
+// RateTotal totals the lines sharing a VAT rate (LTSuat)
+type RateTotal struct {
+	VATRate string `xml:"TSuat"`
+	Amount  Amount `xml:"ThTien"`
+	Tax     Amount `xml:"TThue"`
+}
+
+// Signatures is the DSCKS element holding the digital signatures
+type Signatures struct {
+	Seller *Signature `xml:"NBan"`
+}
+
+// Signature holds an XML digital signature
+type Signature struct {
+	InnerXML string `xml:",innerxml"`
+}
+
+// Amount is a VND amount, written without exponent or trailing zeros
+type Amount float64
+
+// MarshalText implements encoding.TextMarshaler
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatFloat(model.RoundAmount(float64(a)), 'f', -1, 64)), nil
+}
+
+// New builds the e-invoice of an issued invoice. Invoices without items are
+// written as a single line at the VAT rate implied by their amounts.
+func New(invoice model.Invoice, seller model.Seller) (*Document, error) {
+	if invoice.EInvoiceNumber == 0 || invoice.EInvoiceIssuedAt == nil {
+		return nil, fmt.Errorf("invoice %s: %w", invoice.InvoiceID, ErrNotIssued)
+	}
+
+	lines, byRate := invoiceLines(invoice)
+
+	var subtotal float64
+	for _, rate := range byRate {
+		subtotal = model.RoundAmount(subtotal + float64(rate.Amount))
+	}
+
+	doc := &Document{
+		Data: Data{
+			ID: "data",
+			General: GeneralInfo{
+				Version:       Version,
+				Title:         vatInvoiceTitle,
+				Template:      seller.EInvoiceTemplate,
+				Series:        invoice.EInvoiceSeries,
+				Number:        invoice.EInvoiceNumber,
+				Date:          invoice.EInvoiceIssuedAt.In(vietnamTime).Format("2006-01-02"),
+				Currency:      "VND",
+				ExchangeRate:  1,
+				PaymentMethod: paymentMethod(invoice.PaymentMethod),
+			},
+			Content: Content{
+				Seller: Seller{
+					Name:    seller.LegalName,
+					TaxCode: seller.TaxCode,
+					Address: seller.Address,
+					Phone:   seller.Phone,
+					Email:   seller.Email,
+				},
+				Buyer: buyer(invoice),
+				Lines: lines,
+				Totals: Totals{
+					ByRate:      byRate,
+					Subtotal:    Amount(subtotal),
+					Tax:         Amount(invoice.TaxAmount),
+					Discount:    Amount(invoice.DiscountAmount),
+					Total:       Amount(invoice.FinalAmount),
+					TotalInText: AmountInWords(int64(math.Round(invoice.FinalAmount))),
+				},
+			},
+		},
+	}
+
+	return doc, nil
+}
+
+// Marshal encodes the document with an XML declaration
+func (d *Document) Marshal() ([]byte, error) {
+	body, err := xml.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal e-invoice: %w", err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// invoiceLines converts the invoice items into e-invoice lines and totals them by VAT rate
+func invoiceLines(invoice model.Invoice) ([]Line, []RateTotal) {
+	items := invoice.Items
+	if len(items) == 0 {
+		items = []model.InvoiceItem{singleItem(invoice)}
+	}
+
+	lines := make([]Line, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, Line{
+			Kind:        1,
+			Number:      item.LineNumber,
+			Code:        item.TicketID,
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitPrice:   Amount(item.UnitPrice),
+			Discount:    Amount(item.DiscountAmount),
+			Amount:      Amount(item.Subtotal),
+			VATRate:     vatRate(item.VATRate),
+		})
+	}
+
+	breakdown := model.TaxBreakdown(items)
+	byRate := make([]RateTotal, 0, len(breakdown))
+	for _, line := range breakdown {
+		byRate = append(byRate, RateTotal{
+			VATRate: vatRate(line.VATRate),
+			Amount:  Amount(line.TaxableAmount),
+			Tax:     Amount(line.TaxAmount),
+		})
+	}
+
+	return lines, byRate
+}
+
+// singleItem describes an invoice created from a single amount as one item
+func singleItem(invoice model.Invoice) model.InvoiceItem {
+	subtotal := model.RoundAmount(invoice.TotalAmount - invoice.DiscountAmount)
+
+	// Use the standard rate the tax amount corresponds to, if any
+	rate := 0.0
+	if subtotal != 0 {
+		rate = model.RoundAmount(invoice.TaxAmount / subtotal * 100)
+		for _, standard := range model.VATRates {
+			if math.Abs(model.RoundAmount(subtotal*standard/100)-invoice.TaxAmount) < 0.005 {
+				rate = standard
+				break
+			}
+		}
+	}
+
+	description := invoice.InvoiceType
+	if invoice.TicketID != "" {
+		description += " " + invoice.TicketID
+	}
+
+	return model.InvoiceItem{
+		LineNumber:     1,
+		TicketID:       invoice.TicketID,
+		Description:    description,
+		Quantity:       1,
+		UnitPrice:      invoice.TotalAmount,
+		DiscountAmount: invoice.DiscountAmount,
+		VATRate:        rate,
+		Subtotal:       subtotal,
+		TaxAmount:      invoice.TaxAmount,
+		TotalAmount:    model.RoundAmount(subtotal + invoice.TaxAmount),
+	}
+}
+
+// vatRate formats a VAT rate as a TSuat value. Rates other than the standard
+// ones are written as KHAC:AB.CD%, as Decree 123 requires.
+func vatRate(rate float64) string {
+	for _, standard := range model.VATRates {
+		if rate == standard {
+			return strconv.FormatFloat(rate, 'f', -1, 64) + "%"
+		}
+	}
+	return fmt.Sprintf("KHAC:%.2f%%", rate)
+}
+
+// buyer builds the NMua element. A buyer with a tax code is an organization;
+// otherwise the name is the individual buyer's full name.
+func buyer(invoice model.Invoice) Buyer {
+	b := Buyer{
+		TaxCode:    invoice.Buyer.TaxCode,
+		Address:    invoice.Buyer.Address,
+		CustomerID: invoice.CustomerID,
+		Email:      invoice.Buyer.Email,
+	}
+	if b.TaxCode != "" {
+		b.Name = invoice.Buyer.Name
+	} else {
+		b.FullName = invoice.Buyer.Name
+	}
+	return b
+}
+
+// paymentMethod returns the HTTToan text for a payment method
+func paymentMethod(method model.PaymentMethod) string {
+	if method == model.PaymentMethodVNPay {
+		return "Chuyển khoản"
+	}
+	return "TM/CK"
+}
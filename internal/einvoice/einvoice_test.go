@@ -0,0 +1,197 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+)
+
+func TestAmountInWords(t *testing.T) {
+	tests := []struct {
+		amount int64
+		want   string
+	}{
+		{0, "Không đồng"},
+		{5, "Năm đồng"},
+		{11, "Mười một đồng"},
+		{15, "Mười lăm đồng"},
+		{21, "Hai mươi mốt đồng"},
+		{24, "Hai mươi tư đồng"},
+		{105, "Một trăm linh năm đồng"},
+		{110, "Một trăm mười đồng"},
+		{1005, "Một nghìn không trăm linh năm đồng"},
+		{108000, "Một trăm linh tám nghìn đồng"},
+		{1250000, "Một triệu hai trăm năm mươi nghìn đồng"},
+		{1000005, "Một triệu không trăm linh năm đồng"},
+		{2000000000, "Hai tỷ đồng"},
+		{3000500000, "Ba tỷ năm trăm nghìn đồng"},
+		{1200000000000, "Một nghìn hai trăm tỷ đồng"},
+	}
+
+	for _, tt := range tests {
+		if got := AmountInWords(tt.amount); got != tt.want {
+			t.Errorf("AmountInWords(%d) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+// issuedInvoice returns a paid, numbered invoice with two lines at different VAT rates
+func issuedInvoice() model.Invoice {
+	issuedAt := time.Date(2026, 3, 31, 20, 0, 0, 0, time.UTC)
+	items := []model.InvoiceItem{
+		{LineNumber: 1, TicketID: "T-1", Description: "Vé người lớn", Quantity: 2, UnitPrice: 100000,
+			DiscountAmount: 20000, VATRate: 8, Subtotal: 180000, TaxAmount: 14400, TotalAmount: 194400},
+		{LineNumber: 2, Description: "Bắp rang", Quantity: 1, UnitPrice: 50000,
+			VATRate: 10, Subtotal: 50000, TaxAmount: 5000, TotalAmount: 55000},
+	}
+	return model.Invoice{
+		InvoiceID:        uuid.New(),
+		CustomerID:       "customer-1",
+		TotalAmount:      250000,
+		DiscountAmount:   20000,
+		TaxAmount:        19400,
+		FinalAmount:      249400,
+		PaymentStatus:    model.PaymentStatusCompleted,
+		PaymentMethod:    model.PaymentMethodVNPay,
+		Buyer:            model.InvoiceBuyer{Name: "Công ty ABC", TaxCode: "0312345678", Address: "1 Lê Lợi, Quận 1, TP.HCM"},
+		EInvoiceSeries:   "C26TAA",
+		EInvoiceNumber:   42,
+		EInvoiceIssuedAt: &issuedAt,
+		Items:            items,
+	}
+}
+
+func testSeller() model.Seller {
+	return model.Seller{
+		LegalName:        "Công ty TNHH Rạp Chiếu Phim",
+		TaxCode:          "0100109106",
+		Address:          "1 Tràng Tiền, Hoàn Kiếm, Hà Nội",
+		EInvoiceTemplate: "1",
+		EInvoiceSeries:   "C26TAA",
+	}
+}
+
+func TestNew(t *testing.T) {
+	doc, err := New(issuedInvoice(), testSeller())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := doc.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	out, err := doc.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	body := string(out)
+
+	for _, want := range []string{
+		xml.Header,
+		`<DLHDon Id="data">`,
+		`<KHHDon>C26TAA</KHHDon>`,
+		`<SHDon>42</SHDon>`,
+		// Issued at 20:00 UTC, which is the next day in Vietnam
+		`<NLap>2026-04-01</NLap>`,
+		`<STCKhau>20000</STCKhau>`,
+		`<TSuat>8%</TSuat>`,
+		`<TSuat>10%</TSuat>`,
+		`<TgTCThue>230000</TgTCThue>`,
+		`<TgTThue>19400</TgTThue>`,
+		`<TgTTTBSo>249400</TgTTTBSo>`,
+		`<TgTTTBChu>Hai trăm bốn mươi chín nghìn bốn trăm đồng</TgTTTBChu>`,
+		`<Ten>Công ty ABC</Ten>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("document does not contain %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestNewSingleAmountInvoice(t *testing.T) {
+	invoice := issuedInvoice()
+	invoice.Items = nil
+	invoice.InvoiceType = "TICKET"
+	invoice.TicketID = "T-9"
+	invoice.TotalAmount, invoice.DiscountAmount, invoice.TaxAmount, invoice.FinalAmount = 100000, 10000, 7200, 97200
+	invoice.Buyer = model.InvoiceBuyer{Name: "Nguyễn Văn A"}
+
+	doc, err := New(invoice, testSeller())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := doc.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	content := doc.Data.Content
+	if len(content.Lines) != 1 || content.Lines[0].VATRate != "8%" || content.Lines[0].Amount != 90000 {
+		t.Errorf("lines = %+v, want one 90000 line at 8%%", content.Lines)
+	}
+	if content.Buyer.FullName != "Nguyễn Văn A" || content.Buyer.Name != "" {
+		t.Errorf("individual buyer = %+v, want the name as HVTNMHang", content.Buyer)
+	}
+
+	// Tax that matches no standard rate is written as another rate
+	invoice.TaxAmount, invoice.FinalAmount = 1000, 91000
+	doc, err = New(invoice, testSeller())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if got := doc.Data.Content.Lines[0].VATRate; got != "KHAC:1.11%" {
+		t.Errorf("VATRate = %q, want KHAC:1.11%%", got)
+	}
+}
+
+func TestNewRequiresNumber(t *testing.T) {
+	invoice := issuedInvoice()
+	invoice.EInvoiceNumber = 0
+	if _, err := New(invoice, testSeller()); !errors.Is(err, ErrNotIssued) {
+		t.Errorf("New error = %v, want ErrNotIssued", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(invoice *model.Invoice, seller *model.Seller)
+		want   string
+	}{
+		{"seller tax code", func(_ *model.Invoice, s *model.Seller) { s.TaxCode = "12345" }, "NBan/MST"},
+		{"seller name", func(_ *model.Invoice, s *model.Seller) { s.LegalName = "" }, "NBan/Ten is required"},
+		{"template", func(_ *model.Invoice, s *model.Seller) { s.EInvoiceTemplate = "2" }, "TTChung/KHMSHDon"},
+		{"series", func(i *model.Invoice, _ *model.Seller) { i.EInvoiceSeries = "AA/26E" }, "TTChung/KHHDon"},
+		{"series year", func(i *model.Invoice, _ *model.Seller) { i.EInvoiceSeries = "C25TAA" }, "does not match"},
+		{"buyer tax code", func(i *model.Invoice, _ *model.Seller) { i.Buyer.TaxCode = "03123" }, "NMua/MST"},
+		{"organization address", func(i *model.Invoice, _ *model.Seller) { i.Buyer.Address = "" }, "NMua/DChi is required"},
+		{"line amount", func(i *model.Invoice, _ *model.Seller) { i.Items[1].Subtotal = 40000 }, "HHDVu[2]/ThTien"},
+		{"total", func(i *model.Invoice, _ *model.Seller) { i.FinalAmount = 250000 }, "TToan/TgTTTBSo"},
+		{"VAT rate", func(i *model.Invoice, _ *model.Seller) { i.Items[0].VATRate = 100 }, "HHDVu[1]/TSuat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice, seller := issuedInvoice(), testSeller()
+			tt.modify(&invoice, &seller)
+
+			doc, err := New(invoice, seller)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			err = doc.Validate()
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("Validate error = %v, want a ValidationError", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate error = %v, want a problem with %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package einvoice
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"payment_service/domain/model"
+)
+
+// schemaPath is the XSD the documents are checked against
+const schemaPath = "schema/HDon.xsd"
+
+// validateSchema checks a document against the XSD with xmllint and returns
+// its complaints, if any
+func validateSchema(t *testing.T, doc *Document) (string, bool) {
+	t.Helper()
+	body, err := doc.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "einvoice.xml")
+	if err := os.WriteFile(path, body, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// xmllint exits with 3 for a document the schema rejects; anything else,
+	// such as a schema that does not compile, fails the test
+	out, err := exec.Command("xmllint", "--noout", "--schema", schemaPath, path).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 3 {
+		return string(out), false
+	}
+	if err != nil {
+		t.Fatalf("xmllint: %v\n%s", err, out)
+	}
+	return string(out), true
+}
+
+func TestSchema(t *testing.T) {
+	if _, err := exec.LookPath("xmllint"); err != nil {
+		t.Skip("xmllint is not installed")
+	}
+
+	individual := issuedInvoice()
+	individual.Items = nil
+	individual.TicketID = "T-9"
+	individual.TotalAmount, individual.DiscountAmount, individual.TaxAmount, individual.FinalAmount = 100000, 10000, 1000, 91000
+	individual.Buyer = model.InvoiceBuyer{Name: "Nguyễn Văn A", Email: "a@example.com"}
+
+	// Documents that pass Validate also pass the schema
+	for name, invoice := range map[string]model.Invoice{
+		"organization buyer":           issuedInvoice(),
+		"individual buyer, other rate": individual,
+	} {
+		t.Run(name, func(t *testing.T) {
+			doc, err := New(invoice, testSeller())
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if err := doc.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if out, ok := validateSchema(t, doc); !ok {
+				t.Errorf("document fails the schema:\n%s", out)
+			}
+		})
+	}
+
+	// Format problems Validate reports are schema violations as well
+	for _, tt := range []struct {
+		name   string
+		modify func(invoice *model.Invoice, seller *model.Seller)
+	}{
+		{"seller tax code", func(_ *model.Invoice, s *model.Seller) { s.TaxCode = "12345" }},
+		{"seller name", func(_ *model.Invoice, s *model.Seller) { s.LegalName = "" }},
+		{"series", func(i *model.Invoice, _ *model.Seller) { i.EInvoiceSeries = "AA/26E" }},
+		{"buyer tax code", func(i *model.Invoice, _ *model.Seller) { i.Buyer.TaxCode = "03123" }},
+		{"VAT rate", func(i *model.Invoice, _ *model.Seller) { i.Items[0].VATRate = 100 }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice, seller := issuedInvoice(), testSeller()
+			tt.modify(&invoice, &seller)
+
+			doc, err := New(invoice, seller)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if doc.Validate() == nil {
+				t.Fatal("Validate accepted the document")
+			}
+			if _, ok := validateSchema(t, doc); ok {
+				t.Error("the schema accepted the document")
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package einvoice
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"payment_service/domain/model"
+)
+
+// Go has no XSD validator, so Validate checks the constraints of the schema
+// in schema/HDon.xsd in code: required elements, formats, lengths and value
+// sets, plus the arithmetic the tax authority checks on receipt. TestSchema
+// keeps the two in step by running the documents through xmllint.
+
+var (
+	// taxCodePattern matches a 10 digit tax code, or a 13 digit branch code
+	// written as 10 digits, a hyphen and 3 digits
+	taxCodePattern = regexp.MustCompile(`^\d{10}(-\d{3})?$`)
+
+	// seriesPattern matches a KHHDon series: C (with tax authority code) or K
+	// (without), the 2 digit year, the invoice type letter and 2 letters
+	// chosen by the seller
+	seriesPattern = regexp.MustCompile(`^[CK]\d{2}[TDLMNBGH][A-Z]{2}$`)
+
+	// ratePattern matches the TSuat values of Decree 123
+	ratePattern = regexp.MustCompile(`^(0%|5%|8%|10%|KCT|KKKNT|KHAC:\d{1,2}\.\d{2}%)$`)
+)
+
+// Field length limits of the schema
+const (
+	maxNameLength        = 400
+	maxAddressLength     = 400
+	maxPhoneLength       = 20
+	maxEmailLength       = 50
+	maxCustomerIDLength  = 50
+	maxCodeLength        = 50
+	maxDescriptionLength = 500
+	maxInvoiceNumber     = 99999999
+)
+
+// ValidationError lists the problems found in an e-invoice document
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid e-invoice: " + strings.Join(e.Problems, "; ")
+}
+
+// ValidTaxCode reports whether code is a well-formed Vietnamese tax code
+func ValidTaxCode(code string) bool {
+	return taxCodePattern.MatchString(code)
+}
+
+// ValidSeries reports whether series is a well-formed invoice series (KHHDon)
+func ValidSeries(series string) bool {
+	return seriesPattern.MatchString(series)
+}
+
+// Validate checks the document against the e-invoice schema constraints and
+// returns a *ValidationError listing every problem found
+func (d *Document) Validate() error {
+	v := &validator{}
+
+	general := d.Data.General
+	v.check(general.Version == Version, "TTChung/PBan must be %s", Version)
+	v.check(general.Title != "", "TTChung/THDon is required")
+	v.check(general.Template == vatInvoiceTemplate, "TTChung/KHMSHDon must be %s for VAT invoices", vatInvoiceTemplate)
+	v.check(ValidSeries(general.Series), "TTChung/KHHDon %q is not a valid invoice series", general.Series)
+	v.check(general.Number >= 1 && general.Number <= maxInvoiceNumber, "TTChung/SHDon must be between 1 and %d", maxInvoiceNumber)
+	if _, err := time.Parse("2006-01-02", general.Date); err != nil {
+		v.add("TTChung/NLap %q is not a date", general.Date)
+	} else if len(general.Series) == len("C26TAA") && general.Series[1:3] != general.Date[2:4] {
+		v.add("TTChung/KHHDon year %s does not match TTChung/NLap %s", general.Series[1:3], general.Date)
+	}
+	v.check(general.Currency == "VND" && general.ExchangeRate == 1, "TTChung/DVTTe must be VND with TGia 1")
+
+	seller := d.Data.Content.Seller
+	v.text("NBan/Ten", seller.Name, true, maxNameLength)
+	v.check(ValidTaxCode(seller.TaxCode), "NBan/MST %q is not a valid tax code", seller.TaxCode)
+	v.text("NBan/DChi", seller.Address, true, maxAddressLength)
+	v.text("NBan/SDThoai", seller.Phone, false, maxPhoneLength)
+	v.text("NBan/DCTDTu", seller.Email, false, maxEmailLength)
+
+	buyer := d.Data.Content.Buyer
+	if buyer.TaxCode != "" {
+		// An organization buyer is identified by its tax code, name and address
+		v.check(ValidTaxCode(buyer.TaxCode), "NMua/MST %q is not a valid tax code", buyer.TaxCode)
+		v.text("NMua/Ten", buyer.Name, true, maxNameLength)
+		v.text("NMua/DChi", buyer.Address, true, maxAddressLength)
+	} else {
+		v.text("NMua/HVTNMHang", buyer.FullName, false, maxNameLength)
+		v.text("NMua/DChi", buyer.Address, false, maxAddressLength)
+	}
+	v.text("NMua/MKHang", buyer.CustomerID, false, maxCustomerIDLength)
+	v.text("NMua/DCTDTu", buyer.Email, false, maxEmailLength)
+
+	d.validateLines(v)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// validateLines checks the invoice lines and that the totals add up
+func (d *Document) validateLines(v *validator) {
+	content := d.Data.Content
+	v.check(len(content.Lines) > 0, "DSHHDVu must have at least one HHDVu")
+
+	subtotals := make(map[string]float64)
+	for i, line := range content.Lines {
+		field := fmt.Sprintf("HHDVu[%d]", i+1)
+		v.check(line.Kind == 1, "%s/TChat must be 1", field)
+		v.check(line.Number == i+1, "%s/STT must be %d", field, i+1)
+		v.text(field+"/MHHDVu", line.Code, false, maxCodeLength)
+		v.text(field+"/THHDVu", line.Description, true, maxDescriptionLength)
+		v.check(line.Quantity > 0, "%s/SLuong must be positive", field)
+		v.check(line.UnitPrice >= 0 && line.Discount >= 0, "%s amounts must not be negative", field)
+		v.check(ratePattern.MatchString(line.VATRate), "%s/TSuat %q is not a valid VAT rate", field, line.VATRate)
+
+		gross := model.RoundAmount(float64(line.Quantity) * float64(line.UnitPrice))
+		v.equal(field+"/ThTien", float64(line.Amount), gross-float64(line.Discount))
+		subtotals[line.VATRate] = model.RoundAmount(subtotals[line.VATRate] + float64(line.Amount))
+	}
+
+	totals := content.Totals
+	var subtotal, tax float64
+	for _, rate := range totals.ByRate {
+		field := "LTSuat[" + rate.VATRate + "]"
+		v.equal(field+"/ThTien", float64(rate.Amount), subtotals[rate.VATRate])
+		delete(subtotals, rate.VATRate)
+		subtotal = model.RoundAmount(subtotal + float64(rate.Amount))
+		tax = model.RoundAmount(tax + float64(rate.Tax))
+	}
+	for rate := range subtotals {
+		v.add("THTTLTSuat has no LTSuat for the %s lines", rate)
+	}
+
+	v.equal("TToan/TgTCThue", float64(totals.Subtotal), subtotal)
+	v.equal("TToan/TgTThue", float64(totals.Tax), tax)
+	v.equal("TToan/TgTTTBSo", float64(totals.Total), float64(totals.Subtotal)+float64(totals.Tax))
+	v.check(totals.TotalInText != "", "TToan/TgTTTBChu is required")
+}
+
+// validator collects validation problems
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) check(ok bool, format string, args ...interface{}) {
+	if !ok {
+		v.add(format, args...)
+	}
+}
+
+// text checks a text element's presence and length
+func (v *validator) text(field, value string, required bool, maxLength int) {
+	switch {
+	case required && strings.TrimSpace(value) == "":
+		v.add("%s is required", field)
+	case utf8.RuneCountInString(value) > maxLength:
+		v.add("%s must be at most %d characters", field, maxLength)
+	}
+}
+
+// equal checks that an amount matches the amount computed from other elements
+func (v *validator) equal(field string, got, want float64) {
+	if math.Abs(got-model.RoundAmount(want)) >= 0.005 {
+		v.add("%s is %v, want %v", field, got, model.RoundAmount(want))
+	}
+}
@@ -0,0 +1,93 @@
+package einvoice
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var digitWords = [10]string{"không", "một", "hai", "ba", "bốn", "năm", "sáu", "bảy", "tám", "chín"}
+
+// AmountInWords spells out a VND amount in Vietnamese, as printed in the
+// TgTTTBChu element, e.g. 1250000 is "Một triệu hai trăm năm mươi nghìn đồng"
+func AmountInWords(amount int64) string {
+	var words []string
+	switch {
+	case amount == 0:
+		words = []string{digitWords[0]}
+	case amount < 0:
+		words = append([]string{"âm"}, numberWords(-amount, false)...)
+	default:
+		words = numberWords(amount, false)
+	}
+
+	text := strings.Join(append(words, "đồng"), " ")
+	first, size := utf8.DecodeRuneInString(text)
+	return string(unicode.ToUpper(first)) + text[size:]
+}
+
+// numberWords spells out n. When full is set, n follows a higher group, so
+// empty hundreds are read as "không trăm" (1005 is "một nghìn không trăm linh năm").
+func numberWords(n int64, full bool) []string {
+	var words []string
+
+	// Groups above a billion are counted in billions (2e12 is "hai nghìn tỷ")
+	if n >= 1e9 {
+		words = append(words, numberWords(n/1e9, full)...)
+		words = append(words, "tỷ")
+		n %= 1e9
+		full = true
+	}
+
+	for _, scale := range []struct {
+		size int64
+		name string
+	}{{1e6, "triệu"}, {1e3, "nghìn"}, {1, ""}} {
+		group := n / scale.size
+		n %= scale.size
+		if group == 0 {
+			continue
+		}
+
+		words = append(words, groupWords(int(group), full)...)
+		if scale.name != "" {
+			words = append(words, scale.name)
+		}
+		full = true
+	}
+
+	return words
+}
+
+// groupWords spells out a group of three digits
+func groupWords(n int, full bool) []string {
+	hundreds, tens, units := n/100, n/10%10, n%10
+
+	var words []string
+	if hundreds > 0 || full {
+		words = append(words, digitWords[hundreds], "trăm")
+	}
+
+	switch {
+	case tens == 0 && units > 0 && len(words) > 0:
+		words = append(words, "linh")
+	case tens == 1:
+		words = append(words, "mười")
+	case tens > 1:
+		words = append(words, digitWords[tens], "mươi")
+	}
+
+	switch {
+	case units == 0:
+	case units == 1 && tens > 1:
+		words = append(words, "mốt")
+	case units == 4 && tens > 1:
+		words = append(words, "tư")
+	case units == 5 && tens > 0:
+		words = append(words, "lăm")
+	default:
+		words = append(words, digitWords[units])
+	}
+
+	return words
+}
@@ -0,0 +1,91 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"payment_service/domain/model"
+)
+
+// utf8BOM lets Excel detect that a CSV file is UTF-8, so Vietnamese text
+// is not garbled when finance opens it
+const utf8BOM = "\ufeff"
+
+// csvWriter writes invoices as UTF-8 CSV. Amounts are whole VND without
+// separators and times are Vietnam time, so the file stays machine-readable.
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return nil, fmt.Errorf("failed to write CSV export: %w", err)
+	}
+
+	cw := &csvWriter{
+		w:      csv.NewWriter(w),
+		record: make([]string, len(Columns)),
+	}
+	for i, column := range Columns {
+		cw.record[i] = column.Name
+	}
+	if err := cw.w.Write(cw.record); err != nil {
+		return nil, fmt.Errorf("failed to write CSV export: %w", err)
+	}
+	return cw, nil
+}
+
+// WriteInvoice writes an invoice as the next row
+func (cw *csvWriter) WriteInvoice(invoice model.Invoice) error {
+	for i, column := range Columns {
+		cw.record[i] = csvValue(column, invoice)
+	}
+	if err := cw.w.Write(cw.record); err != nil {
+		return fmt.Errorf("failed to write CSV export: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the rows still buffered
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	if err := cw.w.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV export: %w", err)
+	}
+	return nil
+}
+
+// csvValue formats an invoice's value in a column
+func csvValue(column Column, invoice model.Invoice) string {
+	value := column.value(invoice)
+	switch column.Kind {
+	case KindAmount:
+		return strconv.FormatInt(amount(value.(float64)), 10)
+	case KindInteger:
+		if n := value.(int); n != 0 {
+			return strconv.Itoa(n)
+		}
+		return ""
+	case KindTime:
+		if t := value.(time.Time); !t.IsZero() {
+			return t.In(vietnamTime).Format(timeLayout)
+		}
+		return ""
+	default:
+		return escapeFormula(value.(string))
+	}
+}
+
+// escapeFormula prefixes text that spreadsheets would evaluate as a formula
+// with a quote, so values such as a buyer name cannot inject formulas
+func escapeFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
@@ -0,0 +1,154 @@
+// Package export writes invoices as CSV or XLSX spreadsheets for finance.
+//
+// Both formats share the column schema in Columns and are written one row at
+// a time, so exports of any size use constant memory.
+package export
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"payment_service/domain/model"
+)
+
+// Format is a spreadsheet file format
+type Format string
+
+// Export formats
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case FormatCSV, FormatXLSX:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported export format %q: must be csv or xlsx", name)
+	}
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	if f == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Kind is the type of the values in a column
+type Kind int
+
+// Column kinds
+const (
+	// KindText columns hold strings
+	KindText Kind = iota
+	// KindAmount columns hold VND amounts, rounded to whole đồng
+	KindAmount
+	// KindInteger columns hold whole numbers; zero is written as empty
+	KindInteger
+	// KindTime columns hold times in Vietnam time; the zero time is written as empty
+	KindTime
+)
+
+// Column is a column of the export schema
+type Column struct {
+	Name string
+	Kind Kind
+	// value returns a string, float64, int or time.Time according to Kind
+	value func(invoice model.Invoice) interface{}
+}
+
+// Columns is the export schema. Finance imports rely on it: append new
+// columns at the end, and never rename, reorder or remove existing ones.
+var Columns = []Column{
+	{"invoice_id", KindText, func(i model.Invoice) interface{} { return i.InvoiceID.String() }},
+	{"invoice_number", KindText, func(i model.Invoice) interface{} { return i.InvoiceNumber }},
+	{"invoice_type", KindText, func(i model.Invoice) interface{} { return i.InvoiceType }},
+	{"customer_id", KindText, func(i model.Invoice) interface{} { return i.CustomerID }},
+	{"ticket_id", KindText, func(i model.Invoice) interface{} { return i.TicketID }},
+	{"payment_status", KindText, func(i model.Invoice) interface{} { return string(i.PaymentStatus) }},
+	{"payment_method", KindText, func(i model.Invoice) interface{} { return string(i.PaymentMethod) }},
+	{"issue_date", KindTime, func(i model.Invoice) interface{} { return i.IssueDate }},
+	{"created_at", KindTime, func(i model.Invoice) interface{} { return i.CreatedAt }},
+	{"updated_at", KindTime, func(i model.Invoice) interface{} { return i.UpdatedAt }},
+	{"total_amount", KindAmount, func(i model.Invoice) interface{} { return i.TotalAmount }},
+	{"discount_amount", KindAmount, func(i model.Invoice) interface{} { return i.DiscountAmount }},
+	{"tax_amount", KindAmount, func(i model.Invoice) interface{} { return i.TaxAmount }},
+	{"final_amount", KindAmount, func(i model.Invoice) interface{} { return i.FinalAmount }},
+	{"vnpay_txn_ref", KindText, func(i model.Invoice) interface{} { return i.VNPayTxnRef }},
+	{"vnpay_txn_no", KindText, func(i model.Invoice) interface{} { return i.VNPayTxnNo }},
+	{"vnpay_bank_code", KindText, func(i model.Invoice) interface{} { return i.VNPayBankCode }},
+	{"vnpay_pay_date", KindTime, func(i model.Invoice) interface{} { return vnpayPayDate(i.VNPayPayDate) }},
+	{"buyer_name", KindText, func(i model.Invoice) interface{} { return i.Buyer.Name }},
+	{"buyer_tax_code", KindText, func(i model.Invoice) interface{} { return i.Buyer.TaxCode }},
+	{"einvoice_series", KindText, func(i model.Invoice) interface{} { return i.EInvoiceSeries }},
+	{"einvoice_number", KindInteger, func(i model.Invoice) interface{} { return i.EInvoiceNumber }},
+	{"einvoice_issued_at", KindTime, func(i model.Invoice) interface{} { return optionalTime(i.EInvoiceIssuedAt) }},
+	{"cancelled_at", KindTime, func(i model.Invoice) interface{} { return optionalTime(i.CancelledAt) }},
+	{"cancel_reason", KindText, func(i model.Invoice) interface{} { return i.CancelReason }},
+	{"vnpay_card_type", KindText, func(i model.Invoice) interface{} { return i.VNPayCardType }},
+	{"vnpay_fee", KindAmount, func(i model.Invoice) interface{} { return i.VNPayFee }},
+	{"net_amount", KindAmount, func(i model.Invoice) interface{} { return i.NetAmount() }},
+}
+
+// Writer writes invoices as rows of a spreadsheet
+type Writer interface {
+	// WriteInvoice writes an invoice as the next row
+	WriteInvoice(invoice model.Invoice) error
+	// Close finishes the spreadsheet; it does not close the underlying writer
+	Close() error
+}
+
+// NewWriter returns a writer of the given format that writes the header row
+// and then one row per invoice to w
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// vietnamTime is Vietnam's time zone, which has no daylight saving time
+var vietnamTime = time.FixedZone("ICT", 7*60*60)
+
+// timeLayout is the layout of times in CSV exports
+const timeLayout = "2006-01-02 15:04:05"
+
+// DateLayout is the layout of the dates bounding an export
+const DateLayout = "2006-01-02"
+
+// ParseDate parses a YYYY-MM-DD date as the start of that day in Vietnam time
+func ParseDate(value string) (time.Time, error) {
+	return time.ParseInLocation(DateLayout, value, vietnamTime)
+}
+
+// amount rounds a VND amount to whole đồng
+func amount(value float64) int64 {
+	return int64(math.Round(value))
+}
+
+// vnpayPayDate parses a VNPay pay date (yyyyMMddHHmmss, Vietnam time)
+func vnpayPayDate(value string) time.Time {
+	t, err := time.ParseInLocation("20060102150405", value, vietnamTime)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// optionalTime dereferences an optional time
+func optionalTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
@@ -0,0 +1,245 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+)
+
+func exportInvoices() []model.Invoice {
+	createdAt := time.Date(2026, 9, 30, 18, 30, 0, 0, time.UTC)
+	issuedAt := createdAt.Add(time.Hour)
+	return []model.Invoice{
+		{
+			InvoiceID:        uuid.MustParse("7d9f3c1e-1b2a-4c5d-8e9f-0a1b2c3d4e5f"),
+			InvoiceNumber:    "INV-20261001-000001",
+			InvoiceType:      "TICKET",
+			CustomerID:       "customer-1",
+			TicketID:         "ticket-1",
+			PaymentStatus:    model.PaymentStatusCompleted,
+			PaymentMethod:    model.PaymentMethodVNPay,
+			IssueDate:        createdAt,
+			CreatedAt:        createdAt,
+			UpdatedAt:        createdAt,
+			TotalAmount:      1250000,
+			DiscountAmount:   50000.4,
+			TaxAmount:        96000,
+			FinalAmount:      1295999.6,
+			VNPayTxnRef:      "1000001",
+			VNPayTxnNo:       "14123456",
+			VNPayBankCode:    "NCB",
+			VNPayPayDate:     "20261001013500",
+			VNPayCardType:    "ATM",
+			VNPayFee:         14256,
+			Buyer:            model.InvoiceBuyer{Name: "=Công ty Ánh Dương", TaxCode: "0100109106"},
+			EInvoiceSeries:   "C26TAA",
+			EInvoiceNumber:   7,
+			EInvoiceIssuedAt: &issuedAt,
+		},
+		{
+			InvoiceID:     uuid.MustParse("00000000-0000-4000-8000-000000000002"),
+			InvoiceNumber: "INV-20261001-000002",
+			PaymentStatus: model.PaymentStatusPending,
+			IssueDate:     createdAt,
+			CreatedAt:     createdAt,
+			UpdatedAt:     createdAt,
+		},
+	}
+}
+
+func writeExport(t *testing.T, format Format) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, invoice := range exportInvoices() {
+		if err := w.WriteInvoice(invoice); err != nil {
+			t.Fatalf("WriteInvoice: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestCSV(t *testing.T) {
+	out := writeExport(t, FormatCSV)
+	if !bytes.HasPrefix(out, []byte(utf8BOM)) {
+		t.Error("CSV export does not start with a UTF-8 byte order mark")
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(out[len(utf8BOM):])).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want a header and 2 rows", len(records))
+	}
+
+	row := make(map[string]string)
+	for i, name := range records[0] {
+		row[name] = records[1][i]
+	}
+	for column, want := range map[string]string{
+		"invoice_id":         "7d9f3c1e-1b2a-4c5d-8e9f-0a1b2c3d4e5f",
+		"created_at":         "2026-10-01 01:30:00",
+		"total_amount":       "1250000",
+		"discount_amount":    "50000",
+		"final_amount":       "1296000",
+		"vnpay_pay_date":     "2026-10-01 01:35:00",
+		"buyer_name":         "'=Công ty Ánh Dương",
+		"einvoice_number":    "7",
+		"einvoice_issued_at": "2026-10-01 02:30:00",
+		"vnpay_card_type":    "ATM",
+		"vnpay_fee":          "14256",
+		"net_amount":         "1281744",
+	} {
+		if row[column] != want {
+			t.Errorf("%s = %q, want %q", column, row[column], want)
+		}
+	}
+
+	// Missing optional values are empty rather than zero
+	for i, name := range records[0] {
+		switch name {
+		case "vnpay_pay_date", "einvoice_number", "einvoice_issued_at", "buyer_name":
+			if records[2][i] != "" {
+				t.Errorf("%s of a pending invoice = %q, want empty", name, records[2][i])
+			}
+		}
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	out := writeExport(t, FormatXLSX)
+
+	archive, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatalf("open XLSX: %v", err)
+	}
+
+	parts := make(map[string][]byte)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+
+		// Every part must be well-formed XML
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well-formed XML: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = content
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("XLSX export has no %s", name)
+		}
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Number int `xml:"r,attr"`
+			Cells  []struct {
+				Ref   string `xml:"r,attr"`
+				Style int    `xml:"s,attr"`
+				Value string `xml:"v"`
+				Text  string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatalf("parse sheet: %v", err)
+	}
+	if len(sheet.Rows) != 3 {
+		t.Fatalf("got %d rows, want a header and 2 rows", len(sheet.Rows))
+	}
+
+	cells := make(map[string]string)
+	styles := make(map[string]int)
+	for _, row := range sheet.Rows {
+		for _, cell := range row.Cells {
+			cells[cell.Ref] = cell.Value + cell.Text
+			styles[cell.Ref] = cell.Style
+		}
+	}
+
+	for ref, want := range map[string]string{
+		"A1": "invoice_id",
+		"N1": "final_amount",
+		"W1": "einvoice_issued_at",
+		"A2": "7d9f3c1e-1b2a-4c5d-8e9f-0a1b2c3d4e5f",
+		// 2026-10-01 01:30:00 in Vietnam time
+		"I2": "46296.0625",
+		"N2": "1296000",
+		// Inline strings are not evaluated, so formulas need no escaping
+		"S2": "=Công ty Ánh Dương",
+		"V2": "7",
+	} {
+		if cells[ref] != want {
+			t.Errorf("%s = %q, want %q", ref, cells[ref], want)
+		}
+	}
+	if styles["N2"] != styleAmount || styles["I2"] != styleTime || styles["A1"] != styleHeader {
+		t.Errorf("styles = N2 %d, I2 %d, A1 %d, want amount, time and header styles", styles["N2"], styles["I2"], styles["A1"])
+	}
+	if _, ok := cells["V3"]; ok {
+		t.Error("pending invoice has an e-invoice number cell")
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for index, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(index); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", index, got, want)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"csv", "xlsx"} {
+		if _, err := ParseFormat(name); err != nil {
+			t.Errorf("ParseFormat(%q): %v", name, err)
+		}
+	}
+	if _, err := ParseFormat("xls"); err == nil || !strings.Contains(err.Error(), "csv or xlsx") {
+		t.Errorf("ParseFormat(xls) error = %v", err)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	day, err := ParseDate("2026-10-01")
+	if err != nil {
+		t.Fatalf("ParseDate: %v", err)
+	}
+	if want := time.Date(2026, 9, 30, 17, 0, 0, 0, time.UTC); !day.Equal(want) {
+		t.Errorf("ParseDate = %v, want %v", day.UTC(), want)
+	}
+	if _, err := ParseDate("01/10/2026"); err == nil {
+		t.Error("ParseDate accepted a date in the wrong layout")
+	}
+}
@@ -0,0 +1,212 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"payment_service/domain/model"
+)
+
+// MaxXLSXRows is the number of invoices that fit an XLSX sheet: Excel's
+// 1,048,576 row limit less the header row
+const MaxXLSXRows = 1048575
+
+// ErrTooManyRows is returned when an export exceeds MaxXLSXRows
+var ErrTooManyRows = errors.New("too many invoices for an XLSX sheet")
+
+// Cell styles, indexes into cellXfs of xlsxStyles
+const (
+	styleDefault = 0
+	styleHeader  = 1
+	styleAmount  = 2
+	styleTime    = 3
+	styleInteger = 4
+)
+
+// The fixed parts of the workbook. The sheet is written last so its rows can
+// be streamed into the zip archive.
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Invoices" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+	// xlsxStyles shows amounts as VND with thousands separators (1,250,000 ₫)
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="#,##0&quot; ₫&quot;"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="5">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="1" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
+
+	// xlsxSheetStart freezes the header row
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>
+<sheetData>`
+
+	xlsxSheetEnd = `</sheetData>
+</worksheet>`
+)
+
+// excelEpoch is day zero of Excel's date serial numbers
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxWriter writes invoices as a single-sheet XLSX workbook. Strings are
+// written inline, so no shared string table has to be kept in memory.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	} {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write XLSX export: %w", err)
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, fmt.Errorf("failed to write XLSX export: %w", err)
+		}
+	}
+
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write XLSX export: %w", err)
+	}
+
+	xw := &xlsxWriter{zip: archive, sheet: bufio.NewWriter(sheet)}
+	xw.sheet.WriteString(xlsxSheetStart)
+
+	xw.startRow()
+	for i, column := range Columns {
+		xw.writeString(i, column.Name, styleHeader)
+	}
+	xw.sheet.WriteString("</row>")
+
+	return xw, nil
+}
+
+// WriteInvoice writes an invoice as the next row
+func (xw *xlsxWriter) WriteInvoice(invoice model.Invoice) error {
+	if xw.rows > MaxXLSXRows {
+		return ErrTooManyRows
+	}
+
+	xw.startRow()
+	for i, column := range Columns {
+		value := column.value(invoice)
+		switch column.Kind {
+		case KindAmount:
+			xw.writeNumber(i, strconv.FormatInt(amount(value.(float64)), 10), styleAmount)
+		case KindInteger:
+			if n := value.(int); n != 0 {
+				xw.writeNumber(i, strconv.Itoa(n), styleInteger)
+			}
+		case KindTime:
+			if t := value.(time.Time); !t.IsZero() {
+				xw.writeNumber(i, strconv.FormatFloat(excelTime(t), 'f', -1, 64), styleTime)
+			}
+		default:
+			if s := value.(string); s != "" {
+				xw.writeString(i, s, styleDefault)
+			}
+		}
+	}
+	if _, err := xw.sheet.WriteString("</row>"); err != nil {
+		return fmt.Errorf("failed to write XLSX export: %w", err)
+	}
+	return nil
+}
+
+// Close ends the sheet and writes the zip directory
+func (xw *xlsxWriter) Close() error {
+	xw.sheet.WriteString(xlsxSheetEnd)
+	if err := xw.sheet.Flush(); err != nil {
+		return fmt.Errorf("failed to write XLSX export: %w", err)
+	}
+	if err := xw.zip.Close(); err != nil {
+		return fmt.Errorf("failed to write XLSX export: %w", err)
+	}
+	return nil
+}
+
+// startRow opens the next row
+func (xw *xlsxWriter) startRow() {
+	xw.rows++
+	fmt.Fprintf(xw.sheet, `<row r="%d">`, xw.rows)
+}
+
+// writeString writes an inline string cell
+func (xw *xlsxWriter) writeString(column int, value string, style int) {
+	fmt.Fprintf(xw.sheet, `<c r="%s%d" s="%d" t="inlineStr"><is><t xml:space="preserve">`, columnName(column), xw.rows, style)
+	xml.EscapeText(xw.sheet, []byte(value))
+	xw.sheet.WriteString(`</t></is></c>`)
+}
+
+// writeNumber writes a numeric cell
+func (xw *xlsxWriter) writeNumber(column int, value string, style int) {
+	fmt.Fprintf(xw.sheet, `<c r="%s%d" s="%d"><v>%s</v></c>`, columnName(column), xw.rows, style, value)
+}
+
+// columnName returns the spreadsheet name of a zero-based column index (A, B, ..., AA)
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// excelTime converts a time to an Excel date serial number in Vietnam time,
+// rounded to the second
+func excelTime(t time.Time) float64 {
+	local := t.In(vietnamTime)
+	wall := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), 0, time.UTC)
+	seconds := wall.Sub(excelEpoch) / time.Second
+	return float64(seconds) / (24 * 60 * 60)
+}
@@ -0,0 +1,271 @@
+// Package fieldcrypt encrypts individual database fields with envelope
+// encryption. Each value is encrypted with its own random data key using
+// AES-256-GCM, and the data key is wrapped with a key-encryption key from a
+// local keyring. The ID of the key-encryption key is stored alongside the
+// ciphertext, so keys can be rotated by re-wrapping data keys without
+// touching the data itself.
+//
+// An encrypted value looks like
+//
+//	enc:v1:<key ID>:<wrapped data key>:<ciphertext>
+//
+// with both binary parts base64url encoded with the GCM nonce prepended.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix starts every encrypted value, telling it apart from plaintext
+const prefix = "enc:v1:"
+
+// KeySize is the size of key-encryption keys and data keys: AES-256
+const KeySize = 32
+
+var (
+	// ErrUnknownKey is returned when a value was encrypted with a key the
+	// keyring does not hold
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrMalformed is returned when a value is not a well-formed encrypted
+	// value, or fails authentication
+	ErrMalformed = errors.New("malformed encrypted value")
+)
+
+// Keyring holds the key-encryption keys by ID, the ID of the key new values
+// are encrypted with, and the key of blind indexes
+type Keyring struct {
+	keys     map[string]cipher.AEAD
+	current  string
+	indexKey []byte
+}
+
+// NewKeyring creates a keyring from 256-bit keys by ID. New values are
+// encrypted with the current key; the others are kept to decrypt old values.
+func NewKeyring(keys map[string][]byte, current string, indexKey []byte) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current key %q is not in the keyring", current)
+	}
+	if len(indexKey) < KeySize {
+		return nil, fmt.Errorf("blind index key must be at least %d bytes", KeySize)
+	}
+
+	ring := &Keyring{
+		keys:     make(map[string]cipher.AEAD, len(keys)),
+		current:  current,
+		indexKey: indexKey,
+	}
+	for keyID, key := range keys {
+		if keyID == "" || strings.Contains(keyID, ":") {
+			return nil, fmt.Errorf("invalid key ID %q", keyID)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key %q must be %d bytes, got %d", keyID, KeySize, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", keyID, err)
+		}
+		ring.keys[keyID] = aead
+	}
+	return ring, nil
+}
+
+// ParseKeyring creates a keyring from base64-encoded keys
+func ParseKeyring(keys map[string]string, current string, indexKey string) (*Keyring, error) {
+	decoded := make(map[string][]byte, len(keys))
+	for keyID, key := range keys {
+		raw, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64: %w", keyID, err)
+		}
+		decoded[keyID] = raw
+	}
+	rawIndexKey, err := base64.StdEncoding.DecodeString(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("blind index key is not valid base64: %w", err)
+	}
+	return NewKeyring(decoded, current, rawIndexKey)
+}
+
+// CurrentKeyID returns the ID of the key new values are encrypted with
+func (k *Keyring) CurrentKeyID() string {
+	return k.current
+}
+
+// IsEncrypted reports whether a value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the ID of the key an encrypted value's data key is wrapped with
+func KeyID(value string) (string, error) {
+	keyID, _, _, err := split(value)
+	return keyID, err
+}
+
+// Encrypt encrypts plaintext under a new data key wrapped with the current
+// key. The value only decrypts with the same associated data, which binds
+// it to where it is stored.
+func (k *Keyring) Encrypt(plaintext string, associatedData string) (string, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataAEAD, []byte(plaintext), []byte(associatedData))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.keys[k.current], dataKey, []byte(k.current))
+	if err != nil {
+		return "", err
+	}
+	return join(k.current, wrapped, ciphertext), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt with the same associated
+// data. Values that are not encrypted are returned unchanged, so columns can
+// hold plaintext written before encryption was enabled.
+func (k *Keyring) Decrypt(value string, associatedData string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	keyID, wrapped, ciphertext, err := split(value)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAEAD, ciphertext, []byte(associatedData))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap re-wraps the data key of an encrypted value with the current key,
+// leaving its ciphertext as it is. Values already wrapped with the current
+// key are returned unchanged.
+func (k *Keyring) Rewrap(value string) (string, error) {
+	keyID, wrapped, ciphertext, err := split(value)
+	if err != nil {
+		return "", err
+	}
+	if keyID == k.current {
+		return value, nil
+	}
+
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	dataKey, err := open(aead, wrapped, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	rewrapped, err := seal(k.keys[k.current], dataKey, []byte(k.current))
+	if err != nil {
+		return "", err
+	}
+	return join(k.current, rewrapped, ciphertext), nil
+}
+
+// BlindIndex returns a keyed hash of a value for equality lookups on an
+// encrypted column. The context, such as the column and tenant, keeps equal
+// values in different contexts from sharing an index.
+func (k *Keyring) BlindIndex(context string, value string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(context))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// unwrap returns the cipher of a data key wrapped with a key of the keyring
+func (k *Keyring) unwrap(keyID string, wrapped []byte) (cipher.AEAD, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	dataKey, err := open(aead, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(dataKey)
+}
+
+// newAEAD returns an AES-GCM cipher for a key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+// seal encrypts plaintext under a random nonce, which it prepends
+func seal(aead cipher.AEAD, plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// open decrypts the output of seal
+func open(aead cipher.AEAD, sealed, associatedData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], associatedData)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
+
+// join encodes the parts of an encrypted value
+func join(keyID string, wrapped, ciphertext []byte) string {
+	return prefix + keyID + ":" + base64.RawURLEncoding.EncodeToString(wrapped) + ":" + base64.RawURLEncoding.EncodeToString(ciphertext)
+}
+
+// split decodes the parts of an encrypted value
+func split(value string) (string, []byte, []byte, error) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return "", nil, nil, ErrMalformed
+	}
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", nil, nil, ErrMalformed
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[0], wrapped, ciphertext, nil
+}
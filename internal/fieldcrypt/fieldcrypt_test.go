@@ -0,0 +1,122 @@
+package fieldcrypt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestKeyring(t *testing.T, current string) *Keyring {
+	t.Helper()
+
+	ring, err := NewKeyring(map[string][]byte{
+		"2025": bytes.Repeat([]byte{1}, KeySize),
+		"2026": bytes.Repeat([]byte{2}, KeySize),
+	}, current, bytes.Repeat([]byte{3}, KeySize))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return ring
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	old := newTestKeyring(t, "2025")
+
+	value, err := old.Encrypt("customer-42", "customer_id:invoice-1")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !IsEncrypted(value) || strings.Contains(value, "customer-42") {
+		t.Fatalf("Encrypt = %q, want an encrypted value", value)
+	}
+	if keyID, err := KeyID(value); err != nil || keyID != "2025" {
+		t.Errorf("KeyID = %q, %v, want 2025", keyID, err)
+	}
+	if again, _ := old.Encrypt("customer-42", "customer_id:invoice-1"); again == value {
+		t.Error("encrypting a value twice gave the same ciphertext")
+	}
+
+	if plaintext, err := old.Decrypt(value, "customer_id:invoice-1"); err != nil || plaintext != "customer-42" {
+		t.Errorf("Decrypt = %q, %v, want customer-42", plaintext, err)
+	}
+	// Values are bound to their associated data
+	if _, err := old.Decrypt(value, "customer_id:invoice-2"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Decrypt with other associated data = %v, want ErrMalformed", err)
+	}
+	// Plaintext written before encryption passes through
+	if plaintext, err := old.Decrypt("customer-7", "customer_id:invoice-1"); err != nil || plaintext != "customer-7" {
+		t.Errorf("Decrypt of plaintext = %q, %v, want it unchanged", plaintext, err)
+	}
+	if _, err := old.Decrypt(value[:len(value)-4], "customer_id:invoice-1"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Decrypt of a truncated value = %v, want ErrMalformed", err)
+	}
+
+	// After rotation, old values still decrypt and are re-wrapped with the new key
+	rotated := newTestKeyring(t, "2026")
+	if plaintext, err := rotated.Decrypt(value, "customer_id:invoice-1"); err != nil || plaintext != "customer-42" {
+		t.Errorf("Decrypt after rotation = %q, %v, want customer-42", plaintext, err)
+	}
+	rewrapped, err := rotated.Rewrap(value)
+	if err != nil {
+		t.Fatalf("Rewrap: %v", err)
+	}
+	if keyID, _ := KeyID(rewrapped); keyID != "2026" {
+		t.Errorf("KeyID after Rewrap = %q, want 2026", keyID)
+	}
+	if rewrapped[strings.LastIndex(rewrapped, ":"):] != value[strings.LastIndex(value, ":"):] {
+		t.Error("Rewrap changed the ciphertext, want only the data key re-wrapped")
+	}
+	if plaintext, err := rotated.Decrypt(rewrapped, "customer_id:invoice-1"); err != nil || plaintext != "customer-42" {
+		t.Errorf("Decrypt after Rewrap = %q, %v, want customer-42", plaintext, err)
+	}
+	if again, _ := rotated.Rewrap(rewrapped); again != rewrapped {
+		t.Error("Rewrap of a value wrapped with the current key changed it")
+	}
+
+	// Once the old key is dropped, values still wrapped with it cannot be read
+	newOnly, err := NewKeyring(map[string][]byte{"2026": bytes.Repeat([]byte{2}, KeySize)}, "2026", bytes.Repeat([]byte{3}, KeySize))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	if _, err := newOnly.Decrypt(value, "customer_id:invoice-1"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with a dropped key = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	ring := newTestKeyring(t, "2026")
+
+	index := ring.BlindIndex("customer_id:tenant-a", "customer-42")
+	if index != newTestKeyring(t, "2025").BlindIndex("customer_id:tenant-a", "customer-42") {
+		t.Error("blind index depends on the current key, want it stable across rotations")
+	}
+	for _, other := range []string{
+		ring.BlindIndex("customer_id:tenant-b", "customer-42"),
+		ring.BlindIndex("customer_id:tenant-a", "customer-43"),
+	} {
+		if other == index {
+			t.Errorf("blind index %s collides with a different tenant or value", other)
+		}
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+	indexKey := bytes.Repeat([]byte{3}, KeySize)
+	for _, tt := range []struct {
+		name     string
+		keys     map[string][]byte
+		current  string
+		indexKey []byte
+	}{
+		{"missing current key", map[string][]byte{"a": key}, "b", indexKey},
+		{"short key", map[string][]byte{"a": key[:16]}, "a", indexKey},
+		{"key ID with a colon", map[string][]byte{"a:b": key}, "a:b", indexKey},
+		{"short index key", map[string][]byte{"a": key}, "a", indexKey[:8]},
+	} {
+		if _, err := NewKeyring(tt.keys, tt.current, tt.indexKey); err == nil {
+			t.Errorf("%s: NewKeyring succeeded, want an error", tt.name)
+		}
+	}
+}
@@ -9,10 +9,15 @@ import (
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"payment_service/internal/tracing"
 )
 
-// MessageHandler is a function that processes Kafka messages
-type MessageHandler func(topic string, key []byte, value []byte) error
+// MessageHandler is a function that processes Kafka messages. ctx continues
+// the trace the message was sent in.
+type MessageHandler func(ctx context.Context, topic string, key []byte, value []byte) error
 
 // Consumer defines the interface for consuming messages from Kafka
 type Consumer interface {
@@ -123,8 +128,17 @@ func (c *KafkaConsumer) consume(ctx context.Context) {
 				continue
 			}
 
-			// Handle the message
-			err = handler(topic, msg.Key, msg.Value)
+			// Handle the message in a span continuing the sender's trace
+			msgCtx, span := tracing.Start(extractTraceContext(ctx, msg), "process "+topic,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					semconv.MessagingSystemKafka,
+					semconv.MessagingOperationTypeProcess,
+					semconv.MessagingDestinationName(topic),
+				),
+			)
+			err = handler(msgCtx, topic, msg.Key, msg.Value)
+			tracing.End(span, err)
 			if err != nil {
 				log.Printf("Error handling message: %v", err)
 			}
@@ -147,7 +161,7 @@ func (c *KafkaConsumer) Close() error {
 }
 
 // HandleNotification is a utility function to handle payment notifications
-func HandleNotification(topic string, key []byte, value []byte) error {
+func HandleNotification(ctx context.Context, topic string, key []byte, value []byte) error {
 	var notification map[string]interface{}
 	err := json.Unmarshal(value, &notification)
 	if err != nil {
@@ -0,0 +1,27 @@
+package kafka
+
+import (
+	"context"
+
+	"payment_service/domain/model"
+)
+
+// InvoiceEventPublisher publishes invoice events to a Kafka topic. Events are
+// keyed by invoice ID, so the events of one invoice stay in order.
+type InvoiceEventPublisher struct {
+	producer Producer
+	topic    string
+}
+
+// NewInvoiceEventPublisher creates a publisher sending invoice events to topic
+func NewInvoiceEventPublisher(producer Producer, topic string) *InvoiceEventPublisher {
+	return &InvoiceEventPublisher{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+// PublishInvoiceEvent sends an event and waits until Kafka acknowledges it
+func (p *InvoiceEventPublisher) PublishInvoiceEvent(ctx context.Context, event model.InvoiceEvent) error {
+	return p.producer.SendSync(ctx, p.topic, event.InvoiceID.String(), event)
+}
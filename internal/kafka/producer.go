@@ -8,11 +8,19 @@ import (
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"payment_service/internal/metrics"
+	"payment_service/internal/tracing"
 )
 
-// Producer defines the interface for sending messages to Kafka
+// Producer defines the interface for sending messages to Kafka. Messages
+// carry the trace context of ctx in their headers.
 type Producer interface {
-	Send(topic string, value interface{}) error
+	Send(ctx context.Context, topic string, value interface{}) error
+	SendSync(ctx context.Context, topic string, key string, value interface{}) error
 	Close()
 }
 
@@ -70,6 +78,7 @@ func NewKafkaProducer(bootstrapServers string, topic string) (Producer, error) {
 			switch ev := e.(type) {
 			case *kafka.Message:
 				if ev.TopicPartition.Error != nil {
+					metrics.KafkaDeliveryErrors.WithLabelValues(topicName(ev.TopicPartition)).Inc()
 					log.Printf("Failed to deliver message: %v", ev.TopicPartition.Error)
 				} else {
 					log.Printf("Successfully delivered message to %v", ev.TopicPartition)
@@ -84,7 +93,10 @@ func NewKafkaProducer(bootstrapServers string, topic string) (Producer, error) {
 }
 
 // Send sends a message to the specified Kafka topic
-func (p *KafkaProducer) Send(topic string, value interface{}) error {
+func (p *KafkaProducer) Send(ctx context.Context, topic string, value interface{}) (err error) {
+	ctx, span := startSend(ctx, topic, "")
+	defer func() { tracing.End(span, err) }()
+
 	// Marshal the value to JSON
 	valueBytes, err := json.Marshal(value)
 	if err != nil {
@@ -96,8 +108,83 @@ func (p *KafkaProducer) Send(topic string, value interface{}) error {
 		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
 		Value:          valueBytes,
 	}
+	injectTraceContext(ctx, message)
+
+	if err := p.producer.Produce(message, nil); err != nil {
+		metrics.KafkaDeliveryErrors.WithLabelValues(topic).Inc()
+		return err
+	}
+	return nil
+}
+
+// SendSync sends a keyed message to the specified Kafka topic and waits until
+// the brokers acknowledge it. Messages with the same key go to the same
+// partition, so consumers see them in order. It returns early with the
+// context's error when ctx is done first.
+func (p *KafkaProducer) SendSync(ctx context.Context, topic string, key string, value interface{}) (err error) {
+	ctx, span := startSend(ctx, topic, key)
+	defer func() { tracing.End(span, err) }()
 
-	return p.producer.Produce(message, nil)
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value to JSON: %w", err)
+	}
+
+	message := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            []byte(key),
+		Value:          valueBytes,
+	}
+	injectTraceContext(ctx, message)
+
+	// Delivery reports go to this channel instead of the Events goroutine
+	delivery := make(chan kafka.Event, 1)
+	if err := p.producer.Produce(message, delivery); err != nil {
+		metrics.KafkaDeliveryErrors.WithLabelValues(topic).Inc()
+		return fmt.Errorf("failed to produce message: %w", err)
+	}
+
+	// Stop waiting when the caller gives up. The report channel is buffered,
+	// so the late report does not block the producer; the message may still
+	// be delivered, which at-least-once consumers tolerate.
+	var event kafka.Event
+	select {
+	case event = <-delivery:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to deliver message: %w", ctx.Err())
+	}
+
+	report, ok := event.(*kafka.Message)
+	if !ok {
+		metrics.KafkaDeliveryErrors.WithLabelValues(topic).Inc()
+		return fmt.Errorf("failed to deliver message: unexpected delivery report")
+	}
+	if report.TopicPartition.Error != nil {
+		metrics.KafkaDeliveryErrors.WithLabelValues(topic).Inc()
+		return fmt.Errorf("failed to deliver message: %w", report.TopicPartition.Error)
+	}
+	return nil
+}
+
+// startSend starts the producer span of a message sent to topic
+func startSend(ctx context.Context, topic string, key string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemKafka,
+		semconv.MessagingOperationTypeSend,
+		semconv.MessagingDestinationName(topic),
+	}
+	if key != "" {
+		attrs = append(attrs, semconv.MessagingKafkaMessageKey(key))
+	}
+	return tracing.Start(ctx, "send "+topic, trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attrs...))
+}
+
+// topicName returns the topic of a delivery report
+func topicName(partition kafka.TopicPartition) string {
+	if partition.Topic == nil {
+		return ""
+	}
+	return *partition.Topic
 }
 
 // Close closes the Kafka producer
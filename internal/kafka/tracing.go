@@ -0,0 +1,53 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"go.opentelemetry.io/otel"
+)
+
+// headerCarrier reads and writes trace context in the headers of a message
+type headerCarrier struct {
+	message *kafka.Message
+}
+
+// Get returns the value of the last header with the key
+func (c headerCarrier) Get(key string) string {
+	for i := len(c.message.Headers) - 1; i >= 0; i-- {
+		if c.message.Headers[i].Key == key {
+			return string(c.message.Headers[i].Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces the headers with the key by one with the value
+func (c headerCarrier) Set(key string, value string) {
+	headers := c.message.Headers[:0]
+	for _, header := range c.message.Headers {
+		if header.Key != key {
+			headers = append(headers, header)
+		}
+	}
+	c.message.Headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// Keys returns the keys of the headers
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.message.Headers))
+	for _, header := range c.message.Headers {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
+
+// injectTraceContext adds the trace context of ctx to the headers of a message
+func injectTraceContext(ctx context.Context, message *kafka.Message) {
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{message: message})
+}
+
+// extractTraceContext returns ctx continuing the trace in the headers of a message
+func extractTraceContext(ctx context.Context, message *kafka.Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, headerCarrier{message: message})
+}
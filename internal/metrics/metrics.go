@@ -0,0 +1,180 @@
+// Package metrics holds the Prometheus metrics of the service, exposed on
+// /metrics. Metrics are registered on Registry rather than the global
+// default registry, so only the service's own collectors are exposed.
+package metrics
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of the service's metrics
+const namespace = "payment_service"
+
+// Registry is the registry every metric of the service is registered on
+var Registry = prometheus.NewRegistry()
+
+var (
+	// PaymentsCreated counts payment URLs created, by the bank the customer chose
+	PaymentsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payments_created_total",
+		Help:      "Payments created, by bank code.",
+	}, []string{"bank_code"})
+
+	// PaymentsCompleted counts invoices marked paid by a VNPay callback
+	PaymentsCompleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payments_completed_total",
+		Help:      "Payments completed, by bank code.",
+	}, []string{"bank_code"})
+
+	// PaymentsFailed counts invoices marked failed by a VNPay callback
+	PaymentsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payments_failed_total",
+		Help:      "Payments failed, by bank code.",
+	}, []string{"bank_code"})
+
+	// IPNResponses counts the RspCode answered to each VNPay IPN
+	IPNResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vnpay_ipn_responses_total",
+		Help:      "VNPay IPN responses, by RspCode.",
+	}, []string{"rsp_code"})
+
+	// SignatureFailures counts requests rejected for their signature: VNPay
+	// callbacks ("vnpay_ipn", "vnpay_return") and HMAC-signed API requests
+	// ("request")
+	SignatureFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signature_failures_total",
+		Help:      "Requests rejected for a missing or invalid signature, by source and reason.",
+	}, []string{"source", "reason"})
+
+	// SignatureVerifications counts VNPay callbacks verified, by terminal and
+	// the ID of the key that matched, so operators can tell when a secondary
+	// secret is no longer in use
+	SignatureVerifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vnpay_signature_verifications_total",
+		Help:      "VNPay callbacks with a valid signature, by terminal and key ID.",
+	}, []string{"terminal", "key"})
+
+	// HTTPRequestDuration observes how long requests take, by route template
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// KafkaDeliveryErrors counts messages the Kafka producer failed to deliver
+	KafkaDeliveryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_delivery_errors_total",
+		Help:      "Kafka messages that failed to be produced or delivered, by topic.",
+	}, []string{"topic"})
+)
+
+func init() {
+	Registry.MustRegister(
+		PaymentsCreated, PaymentsCompleted, PaymentsFailed,
+		IPNResponses, SignatureFailures, SignatureVerifications, HTTPRequestDuration, KafkaDeliveryErrors,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics of Registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// maxBankCodeLength bounds bank code labels; VNPay's codes are far shorter
+const maxBankCodeLength = 20
+
+// BankCode returns the label of a bank code. Codes come from customers and
+// callbacks, so anything that does not look like a bank code is grouped
+// under "OTHER" to keep the number of series bounded.
+func BankCode(code string) string {
+	if code == "" {
+		return "NONE"
+	}
+	if len(code) > maxBankCodeLength {
+		return "OTHER"
+	}
+	code = strings.ToUpper(code)
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
+			return "OTHER"
+		}
+	}
+	return code
+}
+
+// poolCollector exposes the statistics of a pgx connection pool
+type poolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns     *prometheus.Desc
+	idleConns         *prometheus.Desc
+	constructingConns *prometheus.Desc
+	totalConns        *prometheus.Desc
+	maxConns          *prometheus.Desc
+	acquires          *prometheus.Desc
+	acquireDuration   *prometheus.Desc
+	emptyAcquires     *prometheus.Desc
+	canceledAcquires  *prometheus.Desc
+}
+
+// NewPoolCollector creates a collector of the statistics of a connection pool
+func NewPoolCollector(pool *pgxpool.Pool) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &poolCollector{
+		pool:              pool,
+		acquiredConns:     desc("acquired_connections", "Connections currently in use."),
+		idleConns:         desc("idle_connections", "Connections currently idle."),
+		constructingConns: desc("constructing_connections", "Connections currently being opened."),
+		totalConns:        desc("total_connections", "Connections currently open or being opened."),
+		maxConns:          desc("max_connections", "Maximum size of the pool."),
+		acquires:          desc("acquires_total", "Connections acquired from the pool."),
+		acquireDuration:   desc("acquire_duration_seconds_total", "Time spent acquiring connections."),
+		emptyAcquires:     desc("empty_acquires_total", "Acquires that waited for a connection because the pool was empty."),
+		canceledAcquires:  desc("canceled_acquires_total", "Acquires canceled before a connection became available."),
+	}
+}
+
+// Describe sends the descriptors of the pool's metrics
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.constructingConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.acquires
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquires
+	ch <- c.canceledAcquires
+}
+
+// Collect sends the current statistics of the pool
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquires, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
@@ -0,0 +1,18 @@
+package metrics
+
+import "testing"
+
+func TestBankCode(t *testing.T) {
+	for code, want := range map[string]string{
+		"":                          "NONE",
+		"NCB":                       "NCB",
+		"vnpayqr":                   "VNPAYQR",
+		"INTCARD":                   "INTCARD",
+		"NCB'; DROP":                "OTHER",
+		"A_VERY_LONG_BANK_CODE_XYZ": "OTHER",
+	} {
+		if got := BankCode(code); got != want {
+			t.Errorf("BankCode(%q) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// sqlFile returns a map file holding a statement
+func sqlFile(sql string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(sql)}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_notes.up.sql":         sqlFile("ALTER TABLE invoices ADD COLUMN notes TEXT;"),
+		"migrations/0002_add_notes.down.sql":       sqlFile("ALTER TABLE invoices DROP COLUMN notes;"),
+		"migrations/0010_add_index.up.sql":         sqlFile("CREATE INDEX idx ON invoices (notes);"),
+		"migrations/0001_create_invoices.up.sql":   sqlFile("CREATE TABLE invoices ();"),
+		"migrations/0001_create_invoices.down.sql": sqlFile("DROP TABLE invoices;"),
+		"migrations/README.md":                     sqlFile("not a migration"),
+	}
+	for version := 3; version < 10; version++ {
+		fsys[fmt.Sprintf("migrations/%04d_step.up.sql", version)] = sqlFile("SELECT 1;")
+	}
+
+	migrations, err := loadMigrations(fsys, "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+
+	// Migrations are sorted by version
+	if len(migrations) != 10 {
+		t.Fatalf("%d migrations loaded, want 10", len(migrations))
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d", i, m.Version)
+		}
+	}
+
+	// Up and down files of a version are paired; the down file is optional
+	first := migrations[0]
+	if first.Name != "create_invoices" || first.Up != "CREATE TABLE invoices ();" || first.Down != "DROP TABLE invoices;" {
+		t.Errorf("migration 1 = %+v", first)
+	}
+	if last := migrations[9]; last.Name != "add_index" || last.Down != "" {
+		t.Errorf("migration 10 = %+v, want no down SQL", last)
+	}
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		wantErr string
+	}{
+		{"gap", []string{"0001_a.up.sql", "0003_c.up.sql"}, "migration 0002 is missing"},
+		{"not starting at 1", []string{"0002_b.up.sql"}, "migration 0001 is missing"},
+		{"down without up", []string{"0001_a.up.sql", "0002_b.down.sql"}, "has no up file"},
+		{"conflicting names", []string{"0001_a.up.sql", "0001_b.down.sql"}, "conflicting names"},
+		{"no name", []string{"0001.up.sql"}, "invalid migration file name"},
+		{"no version", []string{"first_a.up.sql"}, "invalid migration version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, name := range tt.files {
+				fsys["migrations/"+name] = sqlFile("SELECT 1;")
+			}
+			_, err := loadMigrations(fsys, "migrations")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	for _, m := range migrations {
+		if m.Down == "" {
+			t.Errorf("migration %04d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+// connectTestSchema connects to TEST_DATABASE_URL with an empty schema of its
+// own first on the search path, skipping the test when no database is
+// configured
+func connectTestSchema(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set; skipping Postgres tests")
+	}
+
+	ctx := context.Background()
+	admin, err := pgxpool.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	t.Cleanup(admin.Close)
+
+	schema := fmt.Sprintf("migration_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE") })
+
+	// Extensions installed earlier stay reachable through public
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("parse TEST_DATABASE_URL: %v", err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ",public"
+	db, err := pgxpool.ConnectConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("connect to test schema: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestMigrateDuplicateTxnRefs(t *testing.T) {
+	ctx := context.Background()
+	db := connectTestSchema(t)
+	all, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+
+	// Invoices of the first schema could share a transaction reference
+	if _, err := (&Migrator{db: db, migrations: all[:1]}).Up(ctx); err != nil {
+		t.Fatalf("migrate to version 1: %v", err)
+	}
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, ref := range []string{"1234567", "1234567", "1234567", "7654321"} {
+		_, err := db.Exec(ctx, `
+			INSERT INTO invoices (invoice_number, customer_id, ticket_id, total_amount, final_amount, vnpay_txn_ref, created_at)
+			VALUES ($1, 'customer-1', 'ticket-1', 1000, 1000, $2, $3)
+		`, fmt.Sprintf("INV-%d", i), ref, base.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatalf("insert legacy invoice %d: %v", i, err)
+		}
+	}
+
+	if _, err := (&Migrator{db: db, migrations: all}).Up(ctx); err != nil {
+		t.Fatalf("migrate up with duplicate references: %v", err)
+	}
+
+	// The newest invoice keeps the reference, older ones are numbered back from it
+	want := map[string]string{"INV-0": "1234567-dup2", "INV-1": "1234567-dup1", "INV-2": "1234567", "INV-3": "7654321"}
+	rows, err := db.Query(ctx, `SELECT invoice_number, vnpay_txn_ref FROM invoices`)
+	if err != nil {
+		t.Fatalf("query invoices: %v", err)
+	}
+	defer rows.Close()
+	got := make(map[string]string)
+	for rows.Next() {
+		var number, ref string
+		if err := rows.Scan(&number, &ref); err != nil {
+			t.Fatalf("scan invoice: %v", err)
+		}
+		got[number] = ref
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("read invoices: %v", err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("transaction references = %v, want %v", got, want)
+	}
+
+	// New duplicates are rejected
+	_, err = db.Exec(ctx, `
+		INSERT INTO invoices (invoice_number, customer_id, ticket_id, total_amount, final_amount, vnpay_txn_ref)
+		VALUES ('INV-4', 'customer-1', 'ticket-1', 1000, 1000, '7654321')
+	`)
+	if err == nil || !strings.Contains(err.Error(), "idx_invoices_tenant_vnpay_txn_ref") {
+		t.Errorf("inserting a duplicate reference error = %v, want the unique index violated", err)
+	}
+}
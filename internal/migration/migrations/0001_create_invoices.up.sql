@@ -18,7 +18,7 @@ CREATE TABLE IF NOT EXISTS invoices (
     notes TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    
+
     -- VNPay specific fields
     vnpay_txn_ref VARCHAR(100),
     vnpay_bank_code VARCHAR(50),
@@ -30,4 +30,4 @@ CREATE TABLE IF NOT EXISTS invoices (
 CREATE INDEX IF NOT EXISTS idx_invoices_customer_id ON invoices(customer_id);
 CREATE INDEX IF NOT EXISTS idx_invoices_vnpay_txn_ref ON invoices(vnpay_txn_ref);
 CREATE INDEX IF NOT EXISTS idx_invoices_payment_status ON invoices(payment_status);
-CREATE INDEX IF NOT EXISTS idx_invoices_created_at ON invoices(created_at);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_invoices_created_at ON invoices(created_at);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_invoices_tenant_vnpay_txn_ref;
+DROP INDEX IF EXISTS idx_invoices_tenant_customer_id;
+CREATE INDEX IF NOT EXISTS idx_invoices_vnpay_txn_ref ON invoices(vnpay_txn_ref);
+CREATE INDEX IF NOT EXISTS idx_invoices_customer_id ON invoices(customer_id);
+
+ALTER TABLE invoices DROP COLUMN IF EXISTS vnpay_tmn_code;
+ALTER TABLE invoices DROP COLUMN IF EXISTS tenant_id;
+
+DROP TABLE IF EXISTS merchants;
@@ -0,0 +1,37 @@
+-- Create merchants table (one VNPay terminal per tenant)
+CREATE TABLE IF NOT EXISTS merchants (
+    tenant_id VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    tmn_code VARCHAR(20) UNIQUE NOT NULL,
+    hash_secret VARCHAR(255) NOT NULL,
+    secondary_hash_secrets TEXT[],
+    secondary_secrets_expire_at TIMESTAMP,
+    return_url TEXT,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Record the tenant and terminal of each invoice
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(100) NOT NULL DEFAULT 'default';
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS vnpay_tmn_code VARCHAR(20);
+
+-- Transaction references used to be drawn at random without a uniqueness
+-- check, so older invoices may share one. The newest invoice keeps it, and
+-- the older ones get a "-dupN" suffix (1 for the next newest, and so on) so
+-- the unique index below can be built.
+UPDATE invoices i
+SET vnpay_txn_ref = d.vnpay_txn_ref || '-dup' || d.n
+FROM (
+    SELECT invoice_id, vnpay_txn_ref,
+        ROW_NUMBER() OVER (PARTITION BY tenant_id, vnpay_txn_ref ORDER BY created_at DESC NULLS LAST, invoice_id DESC) - 1 AS n
+    FROM invoices
+    WHERE vnpay_txn_ref IS NOT NULL
+) d
+WHERE i.invoice_id = d.invoice_id AND d.n > 0;
+
+-- Scope customer and transaction lookups by tenant
+DROP INDEX IF EXISTS idx_invoices_customer_id;
+DROP INDEX IF EXISTS idx_invoices_vnpay_txn_ref;
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_customer_id ON invoices(tenant_id, customer_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_tenant_vnpay_txn_ref ON invoices(tenant_id, vnpay_txn_ref);
@@ -0,0 +1,9 @@
+CREATE INDEX IF NOT EXISTS idx_invoices_created_at ON invoices(created_at);
+CREATE INDEX IF NOT EXISTS idx_invoices_payment_status ON invoices(payment_status);
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_customer_id ON invoices(tenant_id, customer_id);
+
+DROP INDEX IF EXISTS idx_invoices_tenant_ticket_id;
+DROP INDEX IF EXISTS idx_invoices_tenant_customer_created_at;
+DROP INDEX IF EXISTS idx_invoices_tenant_status_created_at;
+DROP INDEX IF EXISTS idx_invoices_tenant_final_amount;
+DROP INDEX IF EXISTS idx_invoices_tenant_created_at;
@@ -0,0 +1,14 @@
+-- Support keyset pagination of invoice searches: every ordering is
+-- (sort column, invoice_id) within a tenant, scanned in either direction
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_created_at ON invoices(tenant_id, created_at, invoice_id);
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_final_amount ON invoices(tenant_id, final_amount, invoice_id);
+
+-- Selective filters, ordered by creation time for the default sort
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_status_created_at ON invoices(tenant_id, payment_status, created_at, invoice_id);
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_customer_created_at ON invoices(tenant_id, customer_id, created_at, invoice_id);
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_ticket_id ON invoices(tenant_id, ticket_id);
+
+-- Superseded by the tenant-scoped indexes above
+DROP INDEX IF EXISTS idx_invoices_tenant_customer_id;
+DROP INDEX IF EXISTS idx_invoices_payment_status;
+DROP INDEX IF EXISTS idx_invoices_created_at;
@@ -0,0 +1,18 @@
+-- Create invoice items table (the lines of an invoice and their VAT)
+CREATE TABLE IF NOT EXISTS invoice_items (
+    item_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    invoice_id UUID NOT NULL REFERENCES invoices(invoice_id) ON DELETE CASCADE,
+    line_number INTEGER NOT NULL,
+    ticket_id VARCHAR(100),
+    description TEXT NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(15, 2) NOT NULL CHECK (unit_price >= 0),
+    discount_amount DECIMAL(15, 2) NOT NULL DEFAULT 0.00 CHECK (discount_amount >= 0),
+    vat_rate DECIMAL(5, 2) NOT NULL DEFAULT 0.00 CHECK (vat_rate >= 0),
+    subtotal DECIMAL(15, 2) NOT NULL,
+    tax_amount DECIMAL(15, 2) NOT NULL,
+    total_amount DECIMAL(15, 2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE (invoice_id, line_number)
+);
@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS einvoice_sequences;
+
+DROP INDEX IF EXISTS idx_invoices_tenant_einvoice_number;
+
+ALTER TABLE invoices DROP COLUMN IF EXISTS einvoice_issued_at;
+ALTER TABLE invoices DROP COLUMN IF EXISTS einvoice_number;
+ALTER TABLE invoices DROP COLUMN IF EXISTS einvoice_series;
+ALTER TABLE invoices DROP COLUMN IF EXISTS buyer_email;
+ALTER TABLE invoices DROP COLUMN IF EXISTS buyer_address;
+ALTER TABLE invoices DROP COLUMN IF EXISTS buyer_tax_code;
+ALTER TABLE invoices DROP COLUMN IF EXISTS buyer_name;
+
+ALTER TABLE merchants DROP COLUMN IF EXISTS einvoice_series;
+ALTER TABLE merchants DROP COLUMN IF EXISTS einvoice_template;
+ALTER TABLE merchants DROP COLUMN IF EXISTS email;
+ALTER TABLE merchants DROP COLUMN IF EXISTS phone;
+ALTER TABLE merchants DROP COLUMN IF EXISTS address;
+ALTER TABLE merchants DROP COLUMN IF EXISTS tax_code;
+ALTER TABLE merchants DROP COLUMN IF EXISTS legal_name;
@@ -0,0 +1,29 @@
+-- Seller details printed on each tenant's e-invoices
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS legal_name VARCHAR(400);
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS tax_code VARCHAR(14);
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS address VARCHAR(400);
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS phone VARCHAR(20);
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS email VARCHAR(50);
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS einvoice_template VARCHAR(1);
+ALTER TABLE merchants ADD COLUMN IF NOT EXISTS einvoice_series VARCHAR(6);
+
+-- Buyer details and the e-invoice number assigned when the invoice is issued
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS buyer_name VARCHAR(400);
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS buyer_tax_code VARCHAR(14);
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS buyer_address VARCHAR(400);
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS buyer_email VARCHAR(50);
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS einvoice_series VARCHAR(6);
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS einvoice_number INTEGER;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS einvoice_issued_at TIMESTAMP;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_tenant_einvoice_number
+    ON invoices(tenant_id, einvoice_series, einvoice_number)
+    WHERE einvoice_number IS NOT NULL;
+
+-- E-invoice numbers are consecutive within a tenant's series
+CREATE TABLE IF NOT EXISTS einvoice_sequences (
+    tenant_id VARCHAR(100) NOT NULL,
+    series VARCHAR(6) NOT NULL,
+    last_number INTEGER NOT NULL,
+    PRIMARY KEY (tenant_id, series)
+);
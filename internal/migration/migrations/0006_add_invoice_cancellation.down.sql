@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS invoice_outbox;
+
+ALTER TABLE invoices DROP COLUMN IF EXISTS cancel_reason;
+ALTER TABLE invoices DROP COLUMN IF EXISTS cancelled_at;
@@ -0,0 +1,20 @@
+-- When and why an invoice was cancelled or voided. Invoices are never
+-- deleted; cancelling or voiding them is final.
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMP;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS cancel_reason TEXT;
+
+-- Outbox of invoice events, written in the transaction that changes the
+-- invoice and published to Kafka by the event relay
+CREATE TABLE IF NOT EXISTS invoice_outbox (
+    event_id UUID PRIMARY KEY,
+    tenant_id VARCHAR(100) NOT NULL,
+    invoice_id UUID NOT NULL REFERENCES invoices(invoice_id),
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoice_outbox_unpublished
+    ON invoice_outbox(created_at, event_id)
+    WHERE published_at IS NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS invoice_events;
+DROP FUNCTION IF EXISTS invoice_events_append_only();
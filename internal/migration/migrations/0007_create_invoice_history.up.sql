@@ -0,0 +1,28 @@
+-- Append-only history of invoice payment status changes, written in the
+-- transaction that changes the status. old_status is NULL for the entry
+-- recording the invoice's creation.
+CREATE TABLE IF NOT EXISTS invoice_events (
+    event_id BIGSERIAL PRIMARY KEY,
+    tenant_id VARCHAR(100) NOT NULL,
+    invoice_id UUID NOT NULL REFERENCES invoices(invoice_id),
+    old_status VARCHAR(20),
+    new_status VARCHAR(20) NOT NULL,
+    actor VARCHAR(20) NOT NULL,
+    source_id VARCHAR(100),
+    reason TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoice_events_invoice
+    ON invoice_events(invoice_id, created_at, event_id);
+
+-- History entries are never changed or removed
+CREATE OR REPLACE FUNCTION invoice_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'invoice_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER invoice_events_append_only
+    BEFORE UPDATE OR DELETE ON invoice_events
+    FOR EACH ROW EXECUTE FUNCTION invoice_events_append_only();
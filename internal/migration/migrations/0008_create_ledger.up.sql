@@ -0,0 +1,99 @@
+-- Double-entry ledger. Each transaction records one business event (an
+-- invoice payment or refund, or a VNPay settlement) as entries whose debits
+-- equal their credits. Ledger rows are never changed or removed; corrections
+-- are posted as new transactions.
+CREATE TABLE IF NOT EXISTS ledger_transactions (
+    transaction_id UUID PRIMARY KEY,
+    tenant_id VARCHAR(100) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    reference VARCHAR(100) NOT NULL,
+    invoice_id UUID REFERENCES invoices(invoice_id),
+    description TEXT,
+    posted_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT ledger_transactions_tenant_kind_reference_key UNIQUE (tenant_id, kind, reference)
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    entry_id BIGSERIAL PRIMARY KEY,
+    transaction_id UUID NOT NULL REFERENCES ledger_transactions(transaction_id),
+    tenant_id VARCHAR(100) NOT NULL,
+    account VARCHAR(40) NOT NULL,
+    debit DECIMAL(15, 2) NOT NULL DEFAULT 0.00 CHECK (debit >= 0),
+    credit DECIMAL(15, 2) NOT NULL DEFAULT 0.00 CHECK (credit >= 0),
+    -- Copied from the transaction, so balances need not join it
+    posted_at TIMESTAMP NOT NULL,
+    CHECK ((debit > 0) <> (credit > 0))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_transaction ON ledger_entries(transaction_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_balance ON ledger_entries(tenant_id, account, posted_at);
+
+-- Ledger rows are never updated or deleted
+CREATE OR REPLACE FUNCTION ledger_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_transactions_append_only
+    BEFORE UPDATE OR DELETE ON ledger_transactions
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+CREATE TRIGGER ledger_entries_append_only
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_append_only();
+
+-- A transaction's debits must equal its credits when the database transaction commits
+CREATE OR REPLACE FUNCTION ledger_check_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT SUM(debit) <> SUM(credit) FROM ledger_entries WHERE transaction_id = NEW.transaction_id) THEN
+        RAISE EXCEPTION 'ledger transaction % is not balanced', NEW.transaction_id
+            USING ERRCODE = 'check_violation';
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced
+    AFTER INSERT ON ledger_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_check_balanced();
+
+-- Post the payments of invoices paid before the ledger existed, and full
+-- refunds of those since refunded
+INSERT INTO ledger_transactions (transaction_id, tenant_id, kind, reference, invoice_id, description, posted_at)
+SELECT gen_random_uuid(), tenant_id, 'payment', invoice_id::text, invoice_id, 'Payment of ' || invoice_number, created_at
+FROM invoices
+WHERE payment_status IN ('COMPLETED', 'REFUNDED') AND final_amount > 0;
+
+INSERT INTO ledger_transactions (transaction_id, tenant_id, kind, reference, invoice_id, description, posted_at)
+SELECT gen_random_uuid(), tenant_id, 'refund', invoice_id::text, invoice_id, 'Refund of ' || invoice_number, updated_at
+FROM invoices
+WHERE payment_status = 'REFUNDED' AND final_amount > 0;
+
+INSERT INTO ledger_entries (transaction_id, tenant_id, account, debit, credit, posted_at)
+SELECT t.transaction_id, t.tenant_id, e.account, e.debit, e.credit, t.posted_at
+FROM ledger_transactions t
+JOIN invoices i ON i.invoice_id = t.invoice_id
+CROSS JOIN LATERAL (VALUES
+    (1, 'customer_receivable', i.final_amount, 0),
+    (2, 'revenue', 0, i.final_amount),
+    (3, 'vnpay_clearing', i.final_amount, 0),
+    (4, 'customer_receivable', 0, i.final_amount)
+) AS e(line, account, debit, credit)
+WHERE t.kind = 'payment'
+ORDER BY t.transaction_id, e.line;
+
+INSERT INTO ledger_entries (transaction_id, tenant_id, account, debit, credit, posted_at)
+SELECT t.transaction_id, t.tenant_id, e.account, e.debit, e.credit, t.posted_at
+FROM ledger_transactions t
+JOIN invoices i ON i.invoice_id = t.invoice_id
+CROSS JOIN LATERAL (VALUES
+    (1, 'revenue', i.final_amount, 0),
+    (2, 'refunds_payable', 0, i.final_amount),
+    (3, 'refunds_payable', i.final_amount, 0),
+    (4, 'vnpay_clearing', 0, i.final_amount)
+) AS e(line, account, debit, credit)
+WHERE t.kind = 'refund'
+ORDER BY t.transaction_id, e.line;
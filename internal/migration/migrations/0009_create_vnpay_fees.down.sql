@@ -0,0 +1,3 @@
+ALTER TABLE invoices DROP COLUMN IF EXISTS vnpay_fee;
+ALTER TABLE invoices DROP COLUMN IF EXISTS vnpay_card_type;
+DROP TABLE IF EXISTS vnpay_fee_rules;
@@ -0,0 +1,22 @@
+-- Merchant discount rates (MDR) VNPay charges each tenant. A rule applies to
+-- payments through a bank code and card type; a NULL bank code or card type
+-- matches any. The most specific matching rule wins, and payments no rule
+-- matches are charged the fee configured with VNPAY_FEE_*.
+CREATE TABLE IF NOT EXISTS vnpay_fee_rules (
+    rule_id BIGSERIAL PRIMARY KEY,
+    tenant_id VARCHAR(100) NOT NULL,
+    bank_code VARCHAR(20),
+    card_type VARCHAR(20),
+    rate_percent DECIMAL(7, 4) NOT NULL DEFAULT 0 CHECK (rate_percent >= 0 AND rate_percent <= 100),
+    fixed_fee DECIMAL(15, 2) NOT NULL DEFAULT 0.00 CHECK (fixed_fee >= 0),
+    min_fee DECIMAL(15, 2) NOT NULL DEFAULT 0.00 CHECK (min_fee >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_vnpay_fee_rules_key
+    ON vnpay_fee_rules(tenant_id, COALESCE(bank_code, ''), COALESCE(card_type, ''));
+
+-- The card type VNPay reports for a payment, and the fee it charged
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS vnpay_card_type VARCHAR(20);
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS vnpay_fee DECIMAL(15, 2);
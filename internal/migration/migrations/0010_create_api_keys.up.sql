@@ -0,0 +1,16 @@
+-- API keys of the services calling the payment API. Only a SHA-256 hash of
+-- each key is stored; the key itself is shown once, when it is created.
+CREATE TABLE IF NOT EXISTS api_keys (
+    key_id UUID PRIMARY KEY,
+    tenant_id VARCHAR(100) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    -- The first characters of the key, to recognise it in listings and logs
+    key_prefix VARCHAR(20) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant ON api_keys(tenant_id);
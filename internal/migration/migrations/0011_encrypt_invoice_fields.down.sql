@@ -0,0 +1,17 @@
+-- Decrypt every column first (reencrypt-invoices with FIELD_ENCRYPTION_COLUMNS
+-- empty), or encrypted values will not fit the narrower columns
+DROP INDEX IF EXISTS idx_invoices_tenant_bank_code_bidx;
+DROP INDEX IF EXISTS idx_invoices_tenant_customer_bidx_created_at;
+
+ALTER TABLE invoices DROP COLUMN IF EXISTS vnpay_bank_code_bidx;
+ALTER TABLE invoices DROP COLUMN IF EXISTS customer_id_bidx;
+
+ALTER TABLE invoices ALTER COLUMN buyer_email TYPE VARCHAR(50);
+ALTER TABLE invoices ALTER COLUMN buyer_address TYPE VARCHAR(400);
+ALTER TABLE invoices ALTER COLUMN buyer_tax_code TYPE VARCHAR(14);
+ALTER TABLE invoices ALTER COLUMN buyer_name TYPE VARCHAR(400);
+ALTER TABLE invoices ALTER COLUMN vnpay_card_type TYPE VARCHAR(20);
+ALTER TABLE invoices ALTER COLUMN vnpay_pay_date TYPE VARCHAR(50);
+ALTER TABLE invoices ALTER COLUMN vnpay_txn_no TYPE VARCHAR(100);
+ALTER TABLE invoices ALTER COLUMN vnpay_bank_code TYPE VARCHAR(50);
+ALTER TABLE invoices ALTER COLUMN customer_id TYPE VARCHAR(100);
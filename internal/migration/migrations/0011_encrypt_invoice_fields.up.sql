@@ -0,0 +1,19 @@
+-- Sensitive invoice columns may hold encrypted values, which are longer than
+-- the plaintext they replace
+ALTER TABLE invoices ALTER COLUMN customer_id TYPE TEXT;
+ALTER TABLE invoices ALTER COLUMN vnpay_bank_code TYPE TEXT;
+ALTER TABLE invoices ALTER COLUMN vnpay_txn_no TYPE TEXT;
+ALTER TABLE invoices ALTER COLUMN vnpay_pay_date TYPE TEXT;
+ALTER TABLE invoices ALTER COLUMN vnpay_card_type TYPE TEXT;
+ALTER TABLE invoices ALTER COLUMN buyer_name TYPE TEXT;
+ALTER TABLE invoices ALTER COLUMN buyer_tax_code TYPE TEXT;
+ALTER TABLE invoices ALTER COLUMN buyer_address TYPE TEXT;
+ALTER TABLE invoices ALTER COLUMN buyer_email TYPE TEXT;
+
+-- Blind indexes: keyed hashes of the plaintext, so invoices can still be
+-- looked up by customer and filtered by bank once those are encrypted
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS customer_id_bidx CHAR(64);
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS vnpay_bank_code_bidx CHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_customer_bidx_created_at ON invoices(tenant_id, customer_id_bidx, created_at, invoice_id);
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_bank_code_bidx ON invoices(tenant_id, vnpay_bank_code_bidx);
@@ -0,0 +1 @@
+ALTER TABLE invoice_outbox DROP COLUMN IF EXISTS trace_context;
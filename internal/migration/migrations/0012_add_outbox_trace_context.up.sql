@@ -0,0 +1,3 @@
+-- The trace context of the request that recorded an outbox event, as JSON,
+-- so publishing the event continues the request's trace
+ALTER TABLE invoice_outbox ADD COLUMN IF NOT EXISTS trace_context TEXT;
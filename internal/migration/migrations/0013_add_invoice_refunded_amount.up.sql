@@ -0,0 +1,15 @@
+-- How much of an invoice's payment has been refunded. An invoice is marked
+-- REFUNDED only once its refunds add up to its final amount.
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS refunded_amount DECIMAL(15, 2) NOT NULL DEFAULT 0;
+
+-- Take the amounts of invoices refunded so far from their posted refunds
+UPDATE invoices i
+SET refunded_amount = r.amount
+FROM (
+    SELECT t.invoice_id, SUM(e.debit) AS amount
+    FROM ledger_transactions t
+    JOIN ledger_entries e ON e.transaction_id = t.transaction_id
+    WHERE t.kind = 'refund' AND e.account = 'revenue'
+    GROUP BY t.invoice_id
+) r
+WHERE r.invoice_id = i.invoice_id;
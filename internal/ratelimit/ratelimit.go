@@ -0,0 +1,226 @@
+// Package ratelimit limits how often callers may make requests with token
+// buckets. Buckets live in Redis so every instance of the service shares
+// them, falling back to memory while Redis is unavailable.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"payment_service/pkg/utils"
+)
+
+// Rate is a token bucket holding up to Limit requests, refilled at Limit
+// requests per Period
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Unlimited reports whether the rate allows every request
+func (r Rate) Unlimited() bool {
+	return r.Limit <= 0 || r.Period <= 0
+}
+
+// String returns the rate as requests per period, e.g. "10/1m0s"
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Period)
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// RetryAfter is how long until a token is available when not allowed
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from the bucket of a key
+type Limiter interface {
+	Allow(ctx context.Context, key string, rate Rate) (Result, error)
+}
+
+// bucket is a token bucket held in memory
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// period is how long the bucket takes to refill from empty
+	period time.Duration
+}
+
+// take refills the bucket for the time elapsed since it was last updated and
+// takes a token from it if one is available
+func (b *bucket) take(rate Rate, now time.Time) Result {
+	perToken := rate.Period / time.Duration(rate.Limit)
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(float64(rate.Limit), b.tokens+float64(elapsed)/float64(perToken))
+	}
+	b.updated = now
+	b.period = rate.Period
+
+	if b.tokens < 1 {
+		return Result{RetryAfter: time.Duration((1 - b.tokens) * float64(perToken))}
+	}
+	b.tokens--
+	return Result{Allowed: true, Remaining: int(b.tokens)}
+}
+
+// MemoryLimiter is a Limiter whose buckets are local to the instance
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	pruned  time.Time
+}
+
+// NewMemoryLimiter creates a new in-memory limiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// memoryPruneInterval is how often idle buckets are dropped
+const memoryPruneInterval = time.Minute
+
+// Allow takes a token from the bucket of key, which starts full
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	if rate.Unlimited() {
+		return Result{Allowed: true}, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.pruned) > memoryPruneInterval {
+		// A bucket idle for its period is full again, as good as a new one
+		for k, b := range l.buckets {
+			if now.Sub(b.updated) > b.period {
+				delete(l.buckets, k)
+			}
+		}
+		l.pruned = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Limit), updated: now}
+		l.buckets[key] = b
+	}
+	return b.take(rate, now), nil
+}
+
+// redisKeyPrefix namespaces rate limit buckets in Redis
+const redisKeyPrefix = "payment_service:ratelimit:"
+
+// takeScript refills and takes a token from a bucket stored as a hash of its
+// tokens and last update time, using the Redis clock so instances agree.
+// The bucket expires once it would be full again.
+var takeScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or limit
+local updated = tonumber(bucket[2]) or now
+if now > updated then
+	tokens = math.min(limit, tokens + (now - updated) * limit / period)
+end
+
+local allowed, retry = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * period / limit)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(period / 1000))
+return {allowed, math.floor(tokens), retry}
+`)
+
+// RedisLimiter is a Limiter whose buckets are shared through Redis
+type RedisLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisLimiter creates a new Redis limiter
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{
+		client: client,
+	}
+}
+
+// Allow takes a token from the bucket of key, which starts full
+func (l *RedisLimiter) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	if rate.Unlimited() {
+		return Result{Allowed: true}, nil
+	}
+
+	values, err := takeScript.Run(ctx, l.client, []string{redisKeyPrefix + key}, rate.Limit, rate.Period.Microseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+	if len(values) != 3 {
+		return Result{}, fmt.Errorf("failed to take rate limit token: unexpected reply %v", values)
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+	}, nil
+}
+
+// primaryTimeout bounds how long a request waits on the primary limiter
+// before falling back, so an unreachable Redis does not stall requests
+const primaryTimeout = 250 * time.Millisecond
+
+// FallbackLimiter uses a primary limiter, falling back to another while the
+// primary fails, so requests are still limited when Redis is unavailable
+type FallbackLimiter struct {
+	primary  Limiter
+	fallback Limiter
+	logger   utils.Logger
+	degraded atomic.Bool
+}
+
+// NewFallbackLimiter creates a new limiter using primary, or fallback when
+// primary fails
+func NewFallbackLimiter(primary, fallback Limiter, logger utils.Logger) *FallbackLimiter {
+	return &FallbackLimiter{
+		primary:  primary,
+		fallback: fallback,
+		logger:   logger,
+	}
+}
+
+// Allow takes a token from the primary limiter, or the fallback if it fails
+func (l *FallbackLimiter) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	primaryCtx, cancel := context.WithTimeout(ctx, primaryTimeout)
+	defer cancel()
+
+	result, err := l.primary.Allow(primaryCtx, key, rate)
+	if err == nil {
+		if l.degraded.Swap(false) {
+			l.logger.Info("Rate limiting recovered; buckets are shared again")
+		}
+		return result, nil
+	}
+
+	if !l.degraded.Swap(true) {
+		l.logger.Error("Rate limiting falls back to per-instance buckets: %v", err)
+	}
+	return l.fallback.Allow(ctx, key, rate)
+}
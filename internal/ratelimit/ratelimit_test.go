@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"payment_service/pkg/utils"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	rate := Rate{Limit: 3, Period: time.Minute}
+
+	// The bucket starts full and allows a burst of its limit
+	for i := 2; i >= 0; i-- {
+		result, _ := limiter.Allow(ctx, "key", rate)
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf("request %d = %+v, want allowed with %d remaining", 3-i, result, i)
+		}
+	}
+	result, _ := limiter.Allow(ctx, "key", rate)
+	if result.Allowed || result.RetryAfter != 20*time.Second {
+		t.Fatalf("request over the limit = %+v, want denied for 20s", result)
+	}
+
+	// Other keys have their own buckets
+	if result, _ := limiter.Allow(ctx, "other", rate); !result.Allowed {
+		t.Errorf("other key = %+v, want allowed", result)
+	}
+
+	// A token is refilled every period / limit
+	now = now.Add(15 * time.Second)
+	if result, _ := limiter.Allow(ctx, "key", rate); result.Allowed || result.RetryAfter != 5*time.Second {
+		t.Errorf("after 15s = %+v, want denied for 5s", result)
+	}
+	now = now.Add(5 * time.Second)
+	if result, _ := limiter.Allow(ctx, "key", rate); !result.Allowed {
+		t.Errorf("after 20s = %+v, want allowed", result)
+	}
+
+	// A zero rate is unlimited
+	for i := 0; i < 10; i++ {
+		if result, _ := limiter.Allow(ctx, "unlimited", Rate{}); !result.Allowed {
+			t.Fatalf("unlimited request %d = %+v, want allowed", i, result)
+		}
+	}
+}
+
+// failingLimiter is a Limiter whose backend is down
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func TestFallbackLimiter(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewFallbackLimiter(failingLimiter{}, NewMemoryLimiter(), utils.NewDefaultLogger())
+	rate := Rate{Limit: 2, Period: time.Hour}
+
+	for i := 0; i < 2; i++ {
+		if result, err := limiter.Allow(ctx, "key", rate); err != nil || !result.Allowed {
+			t.Fatalf("request %d = %+v, %v, want allowed by the fallback", i, result, err)
+		}
+	}
+	if result, err := limiter.Allow(ctx, "key", rate); err != nil || result.Allowed {
+		t.Errorf("request over the limit = %+v, %v, want denied by the fallback", result, err)
+	}
+}
@@ -0,0 +1,320 @@
+// Package receipt renders payment receipts for paid invoices as PDF.
+//
+// Receipts are set in DejaVu Sans, embedded in the binary, so Vietnamese
+// text renders without fonts installed on the host. Rendering is
+// deterministic: the same invoice and brand always produce the same bytes.
+package receipt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+
+	"payment_service/domain/model"
+	"payment_service/internal/einvoice"
+)
+
+// layoutVersion changes whenever the receipt layout does, so receipts cached
+// by clients are revalidated
+const layoutVersion = "1"
+
+var (
+	//go:embed fonts/DejaVuSans.ttf
+	regularFont []byte
+	//go:embed fonts/DejaVuSans-Bold.ttf
+	boldFont []byte
+)
+
+// vietnamTime is Vietnam's time zone, which has no daylight saving time
+var vietnamTime = time.FixedZone("ICT", 7*60*60)
+
+// Brand identifies the merchant a receipt is issued by
+type Brand struct {
+	Name    string
+	Address string
+	TaxCode string
+	Phone   string
+	Email   string
+}
+
+// BrandFor returns the brand of a merchant, preferring its legal seller name
+func BrandFor(merchant model.Merchant) Brand {
+	name := merchant.Seller.LegalName
+	if name == "" {
+		name = merchant.Name
+	}
+	return Brand{
+		Name:    name,
+		Address: merchant.Seller.Address,
+		TaxCode: merchant.Seller.TaxCode,
+		Phone:   merchant.Seller.Phone,
+		Email:   merchant.Seller.Email,
+	}
+}
+
+// ETag returns an entity tag that changes whenever the rendered receipt would
+func ETag(invoice model.Invoice, brand Brand) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d\x00%+v",
+		layoutVersion, invoice.InvoiceID, invoice.PaymentStatus, invoice.UpdatedAt.UnixNano(), brand)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// Page layout, in millimetres
+const (
+	pageMargin  = 15.0
+	lineHeight  = 6.0
+	labelWidth  = 70.0
+	pageWidth   = 210.0
+	contentWide = pageWidth - 2*pageMargin
+)
+
+// Brand colours
+var (
+	accent = [3]int{0, 91, 170}
+	muted  = [3]int{110, 110, 110}
+	rule   = [3]int{210, 210, 210}
+)
+
+// Render returns the PDF receipt of a paid invoice
+func Render(invoice model.Invoice, brand Brand) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pageMargin, pageMargin, pageMargin)
+	pdf.SetAutoPageBreak(true, pageMargin)
+	pdf.AddUTF8FontFromBytes("DejaVu", "", regularFont)
+	pdf.AddUTF8FontFromBytes("DejaVu", "B", boldFont)
+
+	// Fix the document dates so identical receipts are byte-identical
+	pdf.SetCreationDate(invoice.UpdatedAt)
+	pdf.SetModificationDate(invoice.UpdatedAt)
+	pdf.SetCatalogSort(true)
+	pdf.SetTitle("Biên nhận thanh toán "+invoice.InvoiceNumber, true)
+	pdf.SetAuthor(brand.Name, true)
+
+	pdf.AddPage()
+	writeHeader(pdf, brand)
+	writeDetails(pdf, invoice)
+	writeLines(pdf, invoice)
+	writeTotals(pdf, invoice)
+	writeFooter(pdf)
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to render receipt: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeHeader writes the brand band and the receipt title
+func writeHeader(pdf *fpdf.Fpdf, brand Brand) {
+	pdf.SetFillColor(accent[0], accent[1], accent[2])
+	pdf.Rect(0, 0, pageWidth, 28, "F")
+
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetFont("DejaVu", "B", 16)
+	pdf.SetXY(pageMargin, 8)
+	pdf.CellFormat(contentWide, 8, brand.Name, "", 1, "L", false, 0, "")
+
+	pdf.SetFont("DejaVu", "", 9)
+	var contact []string
+	for _, part := range []string{brand.Address, taxCodeLabel(brand.TaxCode), brand.Phone, brand.Email} {
+		if part != "" {
+			contact = append(contact, part)
+		}
+	}
+	pdf.CellFormat(contentWide, 5, strings.Join(contact, " · "), "", 1, "L", false, 0, "")
+
+	pdf.SetXY(pageMargin, 36)
+	pdf.SetTextColor(accent[0], accent[1], accent[2])
+	pdf.SetFont("DejaVu", "B", 18)
+	pdf.CellFormat(contentWide, 9, "BIÊN NHẬN THANH TOÁN", "", 1, "C", false, 0, "")
+	pdf.SetTextColor(muted[0], muted[1], muted[2])
+	pdf.SetFont("DejaVu", "", 10)
+	pdf.CellFormat(contentWide, 5, "Payment receipt", "", 1, "C", false, 0, "")
+	pdf.Ln(6)
+}
+
+// writeDetails writes the invoice, buyer and VNPay payment details
+func writeDetails(pdf *fpdf.Fpdf, invoice model.Invoice) {
+	buyer := invoice.Buyer.Name
+	if invoice.Buyer.TaxCode != "" {
+		buyer += " (" + taxCodeLabel(invoice.Buyer.TaxCode) + ")"
+	}
+
+	for _, row := range [][2]string{
+		{"Số hóa đơn / Invoice no.", invoice.InvoiceNumber},
+		{"Ngày lập / Issued", invoice.IssueDate.In(vietnamTime).Format("02/01/2006 15:04")},
+		{"Khách hàng / Customer", invoice.CustomerID},
+		{"Người mua / Buyer", buyer},
+		{"Phương thức / Method", string(invoice.PaymentMethod)},
+		{"Mã giao dịch VNPay / Transaction no.", invoice.VNPayTxnNo},
+		{"Mã tham chiếu / Reference", invoice.VNPayTxnRef},
+		{"Ngân hàng / Bank", invoice.VNPayBankCode},
+		{"Thời gian thanh toán / Paid at", payDate(invoice.VNPayPayDate)},
+	} {
+		if row[1] == "" {
+			continue
+		}
+		pdf.SetTextColor(muted[0], muted[1], muted[2])
+		pdf.SetFont("DejaVu", "", 9)
+		pdf.CellFormat(labelWidth, lineHeight, row[0], "", 0, "L", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetFont("DejaVu", "B", 10)
+		pdf.CellFormat(contentWide-labelWidth, lineHeight, row[1], "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+}
+
+// writeLines writes the table of invoice items
+func writeLines(pdf *fpdf.Fpdf, invoice model.Invoice) {
+	widths := []float64{10, 78, 14, 30, 14, 34}
+	header := []string{"#", "Nội dung / Description", "SL", "Đơn giá", "VAT", "Thành tiền"}
+	align := []string{"C", "L", "R", "R", "R", "R"}
+
+	pdf.SetFillColor(accent[0], accent[1], accent[2])
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetFont("DejaVu", "B", 9)
+	for i, title := range header {
+		pdf.CellFormat(widths[i], 7, title, "", 0, align[i], true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("DejaVu", "", 9)
+	pdf.SetDrawColor(rule[0], rule[1], rule[2])
+	for _, cells := range lineCells(invoice) {
+		for i, cell := range cells {
+			pdf.CellFormat(widths[i], 7, fit(pdf, cell, widths[i]), "B", 0, align[i], false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(3)
+}
+
+// lineCells returns the table cells of the invoice items, with line amounts
+// before discount. An invoice created from a single amount is shown as one
+// line without a VAT rate.
+func lineCells(invoice model.Invoice) [][]string {
+	if len(invoice.Items) == 0 {
+		description := invoice.InvoiceType
+		if invoice.TicketID != "" {
+			description += " " + invoice.TicketID
+		}
+		amount := formatAmount(invoice.TotalAmount)
+		return [][]string{{"1", description, "1", amount, "—", amount}}
+	}
+
+	rows := make([][]string, 0, len(invoice.Items))
+	for _, item := range invoice.Items {
+		description := item.Description
+		if item.TicketID != "" {
+			description += " (" + item.TicketID + ")"
+		}
+		rows = append(rows, []string{
+			strconv.Itoa(item.LineNumber),
+			description,
+			strconv.Itoa(item.Quantity),
+			formatAmount(item.UnitPrice),
+			strconv.FormatFloat(item.VATRate, 'f', -1, 64) + "%",
+			formatAmount(item.GrossAmount()),
+		})
+	}
+	return rows
+}
+
+// writeTotals writes the invoice totals and the amount paid in words
+func writeTotals(pdf *fpdf.Fpdf, invoice model.Invoice) {
+	rows := [][2]string{{"Tổng tiền hàng / Subtotal", formatAmount(invoice.TotalAmount)}}
+	if invoice.DiscountAmount != 0 {
+		rows = append(rows, [2]string{"Chiết khấu / Discount", "-" + formatAmount(invoice.DiscountAmount)})
+	}
+	rows = append(rows, [2]string{"Thuế GTGT / VAT", formatAmount(invoice.TaxAmount)})
+
+	left := pageMargin + contentWide - 100
+	pdf.SetFont("DejaVu", "", 10)
+	for _, row := range rows {
+		pdf.SetX(left)
+		pdf.SetTextColor(muted[0], muted[1], muted[2])
+		pdf.CellFormat(60, lineHeight, row[0], "", 0, "L", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+		pdf.CellFormat(40, lineHeight, row[1], "", 1, "R", false, 0, "")
+	}
+
+	pdf.SetX(left)
+	pdf.SetTextColor(accent[0], accent[1], accent[2])
+	pdf.SetFont("DejaVu", "B", 12)
+	pdf.CellFormat(60, 9, "Đã thanh toán / Paid", "T", 0, "L", false, 0, "")
+	pdf.CellFormat(40, 9, formatAmount(invoice.FinalAmount), "T", 1, "R", false, 0, "")
+
+	pdf.Ln(2)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("DejaVu", "", 9)
+	pdf.MultiCell(contentWide, 5, "Bằng chữ: "+einvoice.AmountInWords(int64(math.Round(invoice.FinalAmount))), "", "L", false)
+	pdf.Ln(8)
+}
+
+// writeFooter writes the closing note
+func writeFooter(pdf *fpdf.Fpdf) {
+	pdf.SetTextColor(muted[0], muted[1], muted[2])
+	pdf.SetFont("DejaVu", "", 8)
+	pdf.MultiCell(contentWide, 4,
+		"Cảm ơn quý khách! Biên nhận này xác nhận thanh toán và không thay thế hóa đơn giá trị gia tăng.\n"+
+			"Thank you! This receipt confirms your payment and is not a VAT invoice.", "", "C", false)
+}
+
+// formatAmount formats a VND amount with dot thousands separators, e.g. 1.250.000 ₫
+func formatAmount(amount float64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	whole := strconv.FormatInt(int64(math.Round(amount)), 10)
+	var out strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			out.WriteByte('.')
+		}
+		out.WriteRune(digit)
+	}
+	return sign + out.String() + " ₫"
+}
+
+// payDate formats a VNPay pay date (yyyyMMddHHmmss, Vietnam time)
+func payDate(value string) string {
+	t, err := time.ParseInLocation("20060102150405", value, vietnamTime)
+	if err != nil {
+		return value
+	}
+	return t.Format("02/01/2006 15:04:05")
+}
+
+// taxCodeLabel prefixes a tax code with its label, or returns "" for none
+func taxCodeLabel(code string) string {
+	if code == "" {
+		return ""
+	}
+	return "MST " + code
+}
+
+// fit shortens text with an ellipsis so it fits a cell of the given width
+func fit(pdf *fpdf.Fpdf, text string, width float64) string {
+	const padding = 2
+	if pdf.GetStringWidth(text) <= width-padding {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"…") > width-padding {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
@@ -0,0 +1,114 @@
+package receipt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+)
+
+func paidInvoice() model.Invoice {
+	updatedAt := time.Date(2026, 5, 4, 3, 0, 0, 0, time.UTC)
+	return model.Invoice{
+		InvoiceID:      uuid.New(),
+		InvoiceNumber:  "INV-20260504-123456",
+		InvoiceType:    "TICKET",
+		CustomerID:     "customer-1",
+		TotalAmount:    250000,
+		DiscountAmount: 20000,
+		TaxAmount:      19400,
+		FinalAmount:    249400,
+		PaymentStatus:  model.PaymentStatusCompleted,
+		PaymentMethod:  model.PaymentMethodVNPay,
+		IssueDate:      updatedAt.Add(-time.Hour),
+		UpdatedAt:      updatedAt,
+		VNPayTxnRef:    "1000001",
+		VNPayTxnNo:     "14123456",
+		VNPayBankCode:  "NCB",
+		VNPayPayDate:   "20260504095959",
+		Buyer:          model.InvoiceBuyer{Name: "Nguyễn Thị Hồng Nhung"},
+		Items: []model.InvoiceItem{
+			{LineNumber: 1, TicketID: "T-1", Description: "Vé người lớn – Phòng chiếu số 3", Quantity: 2, UnitPrice: 100000,
+				DiscountAmount: 20000, VATRate: 8, Subtotal: 180000, TaxAmount: 14400},
+			{LineNumber: 2, Description: "Bắp rang bơ cỡ lớn", Quantity: 1, UnitPrice: 50000, VATRate: 10, Subtotal: 50000, TaxAmount: 5000},
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	invoice := paidInvoice()
+	brand := Brand{Name: "Rạp Chiếu Phim Ánh Dương", Address: "1 Tràng Tiền, Hà Nội", TaxCode: "0100109106"}
+
+	first, err := Render(invoice, brand)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !bytes.HasPrefix(first, []byte("%PDF-")) {
+		t.Fatalf("Render output is not a PDF: %q", first[:16])
+	}
+
+	// Fonts are embedded so diacritics render on any viewer
+	if !bytes.Contains(first, []byte("/FontFile2")) {
+		t.Error("Render did not embed a TrueType font")
+	}
+
+	second, err := Render(invoice, brand)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("rendering the same receipt twice produced different bytes")
+	}
+
+	// Invoices created from a single amount render too
+	invoice.Items = nil
+	if _, err := Render(invoice, brand); err != nil {
+		t.Fatalf("Render without items: %v", err)
+	}
+}
+
+func TestETag(t *testing.T) {
+	invoice := paidInvoice()
+	brand := Brand{Name: "Brand A"}
+	etag := ETag(invoice, brand)
+
+	if ETag(invoice, brand) != etag {
+		t.Error("ETag is not stable")
+	}
+
+	updated := invoice
+	updated.UpdatedAt = updated.UpdatedAt.Add(time.Second)
+	if ETag(updated, brand) == etag {
+		t.Error("ETag did not change when the invoice was updated")
+	}
+	if ETag(invoice, Brand{Name: "Brand B"}) == etag {
+		t.Error("ETag did not change with the brand")
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	for amount, want := range map[float64]string{
+		0:          "0 ₫",
+		999:        "999 ₫",
+		1000:       "1.000 ₫",
+		249400:     "249.400 ₫",
+		1250000.4:  "1.250.000 ₫",
+		-1234567.5: "-1.234.568 ₫",
+	} {
+		if got := formatAmount(amount); got != want {
+			t.Errorf("formatAmount(%v) = %q, want %q", amount, got, want)
+		}
+	}
+}
+
+func TestPayDate(t *testing.T) {
+	if got := payDate("20260504095959"); got != "04/05/2026 09:59:59" {
+		t.Errorf("payDate = %q", got)
+	}
+	if got := payDate("not a date"); got != "not a date" {
+		t.Errorf("payDate of an unparsable value = %q, want it unchanged", got)
+	}
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"payment_service/domain/model"
+)
+
+// APIKeyRepository handles API key database operations
+type APIKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewAPIKeyRepository creates a new API key repository
+func NewAPIKeyRepository(db *pgxpool.Pool) *APIKeyRepository {
+	return &APIKeyRepository{
+		db: db,
+	}
+}
+
+const apiKeyColumns = `key_id, tenant_id, name, key_prefix, scopes, expires_at, revoked_at, created_at`
+
+// CreateAPIKey stores a new API key under the hash of the key
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key model.APIKey, keyHash string) error {
+	query := `
+		INSERT INTO api_keys (key_id, tenant_id, name, key_prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	scopes := make([]string, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	_, err := r.db.Exec(ctx, query,
+		key.KeyID, key.TenantID, key.Name, key.Prefix, keyHash, scopes, key.ExpiresAt, key.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", translateError(err))
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash retrieves the API key with the given hash
+func (r *APIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (model.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	key, err := scanAPIKey(r.db.QueryRow(ctx, query, keyHash))
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to get API key: %w", translateError(err))
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys retrieves a tenant's API keys, oldest first
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context, tenantID string) ([]model.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE tenant_id = $1 ORDER BY created_at, key_id`
+
+	rows, err := r.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []model.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key; revoking it again keeps the first revocation time
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, keyID uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $1) WHERE key_id = $2`
+
+	tag, err := r.db.Exec(ctx, query, revokedAt.UTC(), keyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to revoke API key: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row rowScanner) (model.APIKey, error) {
+	var key model.APIKey
+	var scopes []string
+	err := row.Scan(
+		&key.KeyID, &key.TenantID, &key.Name, &key.Prefix, &scopes,
+		&key.ExpiresAt, &key.RevokedAt, &key.CreatedAt,
+	)
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, model.APIKeyScope(scope))
+	}
+	return key, err
+}
@@ -0,0 +1,299 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/fieldcrypt"
+)
+
+// EncryptableInvoiceColumns lists the invoice columns that may be encrypted at rest
+var EncryptableInvoiceColumns = []string{
+	"customer_id", "notes",
+	"vnpay_bank_code", "vnpay_txn_no", "vnpay_pay_date", "vnpay_card_type",
+	"buyer_name", "buyer_tax_code", "buyer_address", "buyer_email",
+}
+
+// FieldEncryption encrypts the configured invoice columns with a keyring and
+// maintains the blind indexes used to look invoices up by customer and bank.
+// A nil FieldEncryption stores every column in plaintext.
+type FieldEncryption struct {
+	keyring *fieldcrypt.Keyring
+	columns map[string]bool
+}
+
+// NewFieldEncryption creates a field encryption encrypting the given columns,
+// which must be among EncryptableInvoiceColumns
+func NewFieldEncryption(keyring *fieldcrypt.Keyring, columns []string) (*FieldEncryption, error) {
+	encryptable := make(map[string]bool, len(EncryptableInvoiceColumns))
+	for _, column := range EncryptableInvoiceColumns {
+		encryptable[column] = true
+	}
+
+	enc := &FieldEncryption{
+		keyring: keyring,
+		columns: make(map[string]bool, len(columns)),
+	}
+	for _, column := range columns {
+		if !encryptable[column] {
+			return nil, fmt.Errorf("column %q cannot be encrypted", column)
+		}
+		enc.columns[column] = true
+	}
+	return enc, nil
+}
+
+// invoiceFields returns pointers to the encryptable fields of an invoice by column
+func invoiceFields(invoice *model.Invoice) map[string]*string {
+	return map[string]*string{
+		"customer_id":     &invoice.CustomerID,
+		"notes":           &invoice.Notes,
+		"vnpay_bank_code": &invoice.VNPayBankCode,
+		"vnpay_txn_no":    &invoice.VNPayTxnNo,
+		"vnpay_pay_date":  &invoice.VNPayPayDate,
+		"vnpay_card_type": &invoice.VNPayCardType,
+		"buyer_name":      &invoice.Buyer.Name,
+		"buyer_tax_code":  &invoice.Buyer.TaxCode,
+		"buyer_address":   &invoice.Buyer.Address,
+		"buyer_email":     &invoice.Buyer.Email,
+	}
+}
+
+// associatedData binds an encrypted value to its column and invoice, so it
+// cannot be copied to another row or column and still decrypt
+func associatedData(column string, invoiceID uuid.UUID) string {
+	return column + ":" + invoiceID.String()
+}
+
+// encrypt returns the value to store in a column of an invoice. Empty values
+// and columns that are not configured are stored as they are.
+func (e *FieldEncryption) encrypt(column string, invoiceID uuid.UUID, value string) (string, error) {
+	if e == nil || !e.columns[column] || value == "" {
+		return value, nil
+	}
+
+	encrypted, err := e.keyring.Encrypt(value, associatedData(column, invoiceID))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt %s: %w", column, err)
+	}
+	return encrypted, nil
+}
+
+// decrypt returns the plaintext of a value stored in a column of an invoice
+func (e *FieldEncryption) decrypt(column string, invoiceID uuid.UUID, value string) (string, error) {
+	if !fieldcrypt.IsEncrypted(value) {
+		return value, nil
+	}
+	if e == nil {
+		return "", fmt.Errorf("failed to decrypt %s: field encryption is not configured", column)
+	}
+
+	plaintext, err := e.keyring.Decrypt(value, associatedData(column, invoiceID))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", column, err)
+	}
+	return plaintext, nil
+}
+
+// blindIndex returns the blind index of a tenant's value in a column, or nil
+// when there is no keyring or no value
+func (e *FieldEncryption) blindIndex(column string, tenantID string, value string) *string {
+	if e == nil || value == "" {
+		return nil
+	}
+
+	index := e.keyring.BlindIndex(column+":"+tenantID, value)
+	return &index
+}
+
+// sealInvoice returns a copy of an invoice with its configured columns encrypted
+func (e *FieldEncryption) sealInvoice(invoice model.Invoice) (model.Invoice, error) {
+	for column, field := range invoiceFields(&invoice) {
+		value, err := e.encrypt(column, invoice.InvoiceID, *field)
+		if err != nil {
+			return model.Invoice{}, err
+		}
+		*field = value
+	}
+	return invoice, nil
+}
+
+// openInvoice decrypts the encrypted columns of an invoice read from the database
+func (e *FieldEncryption) openInvoice(invoice *model.Invoice) error {
+	for column, field := range invoiceFields(invoice) {
+		value, err := e.decrypt(column, invoice.InvoiceID, *field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+	return nil
+}
+
+// reencrypt returns the value a column should hold under the current
+// configuration: plaintext in configured columns is encrypted, values wrapped
+// with an old key are re-wrapped with the current one, and values in columns
+// no longer configured are decrypted
+func (e *FieldEncryption) reencrypt(column string, invoiceID uuid.UUID, value string) (string, error) {
+	if !fieldcrypt.IsEncrypted(value) {
+		return e.encrypt(column, invoiceID, value)
+	}
+	if !e.columns[column] {
+		return e.decrypt(column, invoiceID, value)
+	}
+
+	rewrapped, err := e.keyring.Rewrap(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to re-wrap %s: %w", column, err)
+	}
+	return rewrapped, nil
+}
+
+// ReencryptInvoices brings every invoice in line with the field encryption,
+// as reencrypt describes, and fills in missing blind indexes. Invoices are
+// processed in batches of batchSize, each in its own transaction, calling
+// progress after each batch with the invoices scanned and updated so far.
+func (s *PostgresStore) ReencryptInvoices(ctx context.Context, batchSize int, progress func(scanned, updated int)) error {
+	if s.invoices.enc == nil {
+		return fmt.Errorf("failed to re-encrypt invoices: field encryption is not configured")
+	}
+
+	var after uuid.UUID
+	var scanned, updated int
+	for {
+		var last uuid.UUID
+		var batchScanned, batchUpdated int
+		err := s.WithTx(ctx, func(tx Store) error {
+			var err error
+			last, batchScanned, batchUpdated, err = tx.(*postgresTxStore).invoices.reencryptBatch(ctx, after, batchSize)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if batchScanned == 0 {
+			return nil
+		}
+
+		after = last
+		scanned += batchScanned
+		updated += batchUpdated
+		if progress != nil {
+			progress(scanned, updated)
+		}
+	}
+}
+
+// reencryptBatch re-encrypts and locks up to limit invoices after the given
+// invoice ID, returning the last invoice ID scanned and the number of
+// invoices scanned and updated
+func (r *InvoiceRepository) reencryptBatch(ctx context.Context, after uuid.UUID, limit int) (uuid.UUID, int, int, error) {
+	query := `
+		SELECT
+			invoice_id, tenant_id, customer_id, COALESCE(notes, ''),
+			COALESCE(vnpay_bank_code, ''), COALESCE(vnpay_txn_no, ''),
+			COALESCE(vnpay_pay_date, ''), COALESCE(vnpay_card_type, ''),
+			COALESCE(buyer_name, ''), COALESCE(buyer_tax_code, ''), COALESCE(buyer_address, ''), COALESCE(buyer_email, ''),
+			COALESCE(customer_id_bidx, ''), COALESCE(vnpay_bank_code_bidx, '')
+		FROM invoices
+		WHERE invoice_id > $1
+		ORDER BY invoice_id
+		LIMIT $2
+		FOR UPDATE
+	`
+
+	type storedInvoice struct {
+		invoice                  model.Invoice
+		customerIndex, bankIndex string
+	}
+
+	rows, err := r.db.Query(ctx, query, after, limit)
+	if err != nil {
+		return uuid.Nil, 0, 0, fmt.Errorf("failed to query invoices to re-encrypt: %w", err)
+	}
+	var stored []storedInvoice
+	for rows.Next() {
+		var s storedInvoice
+		i := &s.invoice
+		if err := rows.Scan(
+			&i.InvoiceID, &i.TenantID, &i.CustomerID, &i.Notes,
+			&i.VNPayBankCode, &i.VNPayTxnNo, &i.VNPayPayDate, &i.VNPayCardType,
+			&i.Buyer.Name, &i.Buyer.TaxCode, &i.Buyer.Address, &i.Buyer.Email,
+			&s.customerIndex, &s.bankIndex,
+		); err != nil {
+			rows.Close()
+			return uuid.Nil, 0, 0, fmt.Errorf("failed to scan invoice: %w", err)
+		}
+		stored = append(stored, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return uuid.Nil, 0, 0, fmt.Errorf("error iterating over invoices: %w", err)
+	}
+	if len(stored) == 0 {
+		return uuid.Nil, 0, 0, nil
+	}
+
+	update := `
+		UPDATE invoices
+		SET
+			customer_id = $1, notes = NULLIF($2, ''),
+			vnpay_bank_code = NULLIF($3, ''), vnpay_txn_no = NULLIF($4, ''),
+			vnpay_pay_date = NULLIF($5, ''), vnpay_card_type = NULLIF($6, ''),
+			buyer_name = NULLIF($7, ''), buyer_tax_code = NULLIF($8, ''),
+			buyer_address = NULLIF($9, ''), buyer_email = NULLIF($10, ''),
+			customer_id_bidx = $11, vnpay_bank_code_bidx = $12
+		WHERE invoice_id = $13
+	`
+
+	updated := 0
+	for _, s := range stored {
+		current := s.invoice
+		plain := s.invoice
+		if err := r.enc.openInvoice(&plain); err != nil {
+			return uuid.Nil, 0, 0, fmt.Errorf("invoice %s: %w", current.InvoiceID, err)
+		}
+
+		next := s.invoice
+		changed := false
+		currentFields := invoiceFields(&current)
+		for column, field := range invoiceFields(&next) {
+			value, err := r.enc.reencrypt(column, next.InvoiceID, *field)
+			if err != nil {
+				return uuid.Nil, 0, 0, fmt.Errorf("invoice %s: %w", current.InvoiceID, err)
+			}
+			*field = value
+			changed = changed || value != *currentFields[column]
+		}
+
+		customerIndex := r.enc.blindIndex("customer_id", plain.TenantID, plain.CustomerID)
+		bankIndex := r.enc.blindIndex("vnpay_bank_code", plain.TenantID, plain.VNPayBankCode)
+		changed = changed || stringOrEmpty(customerIndex) != s.customerIndex || stringOrEmpty(bankIndex) != s.bankIndex
+		if !changed {
+			continue
+		}
+
+		if _, err := r.db.Exec(ctx, update,
+			next.CustomerID, next.Notes,
+			next.VNPayBankCode, next.VNPayTxnNo, next.VNPayPayDate, next.VNPayCardType,
+			next.Buyer.Name, next.Buyer.TaxCode, next.Buyer.Address, next.Buyer.Email,
+			customerIndex, bankIndex, next.InvoiceID,
+		); err != nil {
+			return uuid.Nil, 0, 0, fmt.Errorf("failed to re-encrypt invoice %s: %w", next.InvoiceID, err)
+		}
+		updated++
+	}
+
+	return stored[len(stored)-1].invoice.InvoiceID, len(stored), updated, nil
+}
+
+// stringOrEmpty returns the string s points to, or "" if it is nil
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+)
+
+// AppendInvoiceHistory records a payment status change of an invoice
+func (r *InvoiceRepository) AppendInvoiceHistory(ctx context.Context, entry model.InvoiceHistoryEntry) error {
+	query := `
+		INSERT INTO invoice_events (
+			tenant_id, invoice_id, old_status, new_status, actor, source_id, reason, created_at
+		) VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8)
+	`
+
+	_, err := r.db.Exec(ctx, query,
+		entry.TenantID, entry.InvoiceID, string(entry.OldStatus), entry.NewStatus,
+		entry.Actor, entry.SourceID, entry.Reason, entry.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to append invoice history: %w", translateError(err))
+	}
+
+	return nil
+}
+
+// GetInvoiceHistory retrieves the status history of a tenant's invoice, oldest first
+func (r *InvoiceRepository) GetInvoiceHistory(ctx context.Context, tenantID string, invoiceID uuid.UUID) ([]model.InvoiceHistoryEntry, error) {
+	query := `
+		SELECT event_id, tenant_id, invoice_id, COALESCE(old_status, ''), new_status,
+			actor, COALESCE(source_id, ''), COALESCE(reason, ''), created_at
+		FROM invoice_events
+		WHERE tenant_id = $1 AND invoice_id = $2
+		ORDER BY created_at, event_id
+	`
+
+	rows, err := r.db.Query(ctx, query, tenantID, invoiceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invoice history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []model.InvoiceHistoryEntry{}
+	for rows.Next() {
+		var entry model.InvoiceHistoryEntry
+		err := rows.Scan(
+			&entry.EventID, &entry.TenantID, &entry.InvoiceID, &entry.OldStatus, &entry.NewStatus,
+			&entry.Actor, &entry.SourceID, &entry.Reason, &entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invoice history: %w", err)
+		}
+		history = append(history, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over invoice history: %w", err)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+)
+
+// invoiceItemColumns lists the columns read by scanInvoiceItem
+const invoiceItemColumns = `
+	item_id, invoice_id, line_number, COALESCE(ticket_id, ''), description,
+	quantity, unit_price, discount_amount, vat_rate,
+	subtotal, tax_amount, total_amount
+`
+
+// scanInvoiceItem scans a row selected with invoiceItemColumns
+func scanInvoiceItem(row rowScanner) (model.InvoiceItem, error) {
+	var item model.InvoiceItem
+	err := row.Scan(
+		&item.ItemID, &item.InvoiceID, &item.LineNumber, &item.TicketID, &item.Description,
+		&item.Quantity, &item.UnitPrice, &item.DiscountAmount, &item.VATRate,
+		&item.Subtotal, &item.TaxAmount, &item.TotalAmount,
+	)
+	return item, err
+}
+
+// CreateInvoiceItems stores the lines of an invoice. Run it in the same
+// transaction as CreateInvoice so an invoice is never stored without its items.
+func (r *InvoiceRepository) CreateInvoiceItems(ctx context.Context, invoiceID uuid.UUID, items []model.InvoiceItem) ([]model.InvoiceItem, error) {
+	query := `
+		INSERT INTO invoice_items (
+			item_id, invoice_id, line_number, ticket_id, description,
+			quantity, unit_price, discount_amount, vat_rate,
+			subtotal, tax_amount, total_amount
+		) VALUES (
+			$1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $11, $12
+		)
+	`
+
+	created := make([]model.InvoiceItem, 0, len(items))
+	for _, item := range items {
+		if item.ItemID == uuid.Nil {
+			item.ItemID = uuid.New()
+		}
+		item.InvoiceID = invoiceID
+
+		_, err := r.db.Exec(ctx, query,
+			item.ItemID, item.InvoiceID, item.LineNumber, item.TicketID, item.Description,
+			item.Quantity, item.UnitPrice, item.DiscountAmount, item.VATRate,
+			item.Subtotal, item.TaxAmount, item.TotalAmount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create invoice item %d: %w", item.LineNumber, translateError(err))
+		}
+		created = append(created, item)
+	}
+
+	return created, nil
+}
+
+// GetInvoiceItems retrieves the lines of the given invoices, ordered by line number
+func (r *InvoiceRepository) GetInvoiceItems(ctx context.Context, invoiceIDs []uuid.UUID) (map[uuid.UUID][]model.InvoiceItem, error) {
+	items := make(map[uuid.UUID][]model.InvoiceItem)
+	if len(invoiceIDs) == 0 {
+		return items, nil
+	}
+
+	query := `
+		SELECT ` + invoiceItemColumns + `
+		FROM invoice_items
+		WHERE invoice_id = ANY($1)
+		ORDER BY invoice_id, line_number
+	`
+
+	rows, err := r.db.Query(ctx, query, invoiceIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invoice items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanInvoiceItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invoice item: %w", err)
+		}
+		items[item.InvoiceID] = append(items[item.InvoiceID], item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over invoice items: %w", err)
+	}
+
+	return items, nil
+}
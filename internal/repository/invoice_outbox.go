@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+)
+
+// CreateInvoiceEvent records an invoice event in the outbox, to be published
+// once the surrounding transaction commits
+func (r *InvoiceRepository) CreateInvoiceEvent(ctx context.Context, event model.InvoiceEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode invoice event: %w", err)
+	}
+	var traceContext []byte
+	if len(event.TraceContext) > 0 {
+		if traceContext, err = json.Marshal(event.TraceContext); err != nil {
+			return fmt.Errorf("failed to encode trace context: %w", err)
+		}
+	}
+
+	query := `
+		INSERT INTO invoice_outbox (event_id, tenant_id, invoice_id, event_type, payload, created_at, trace_context)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+	`
+
+	_, err = r.db.Exec(ctx, query, event.EventID, event.TenantID, event.InvoiceID, event.Type, payload, event.OccurredAt.UTC(), string(traceContext))
+	if err != nil {
+		return fmt.Errorf("failed to create invoice event: %w", translateError(err))
+	}
+
+	return nil
+}
+
+// GetUnpublishedInvoiceEvents retrieves and locks up to limit events not yet
+// published, oldest first. Events locked by another relay are skipped.
+func (r *InvoiceRepository) GetUnpublishedInvoiceEvents(ctx context.Context, limit int) ([]model.InvoiceEvent, error) {
+	query := `
+		SELECT payload, COALESCE(trace_context, '')
+		FROM invoice_outbox
+		WHERE published_at IS NULL
+		ORDER BY created_at, event_id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := r.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unpublished invoice events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []model.InvoiceEvent
+	for rows.Next() {
+		var payload []byte
+		var traceContext string
+		if err := rows.Scan(&payload, &traceContext); err != nil {
+			return nil, fmt.Errorf("failed to scan invoice event: %w", err)
+		}
+
+		var event model.InvoiceEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("failed to decode invoice event: %w", err)
+		}
+		// An unreadable trace context only loses the link to the trace
+		if traceContext != "" {
+			_ = json.Unmarshal([]byte(traceContext), &event.TraceContext)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over invoice events: %w", err)
+	}
+
+	return events, nil
+}
+
+// MarkInvoiceEventsPublished records that the events were published
+func (r *InvoiceRepository) MarkInvoiceEventsPublished(ctx context.Context, ids []uuid.UUID, publishedAt time.Time) error {
+	query := `UPDATE invoice_outbox SET published_at = $1 WHERE event_id = ANY($2) AND published_at IS NULL`
+
+	if _, err := r.db.Exec(ctx, query, publishedAt.UTC(), ids); err != nil {
+		return fmt.Errorf("failed to mark invoice events published: %w", err)
+	}
+
+	return nil
+}
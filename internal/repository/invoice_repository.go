@@ -13,26 +13,82 @@ import (
 
 // InvoiceRepository handles invoice database operations
 type InvoiceRepository struct {
-	db *pgxpool.Pool
+	db  querier
+	enc *FieldEncryption
 }
 
-// NewInvoiceRepository creates a new invoice repository
-func NewInvoiceRepository(db *pgxpool.Pool) *InvoiceRepository {
+// NewInvoiceRepository creates a new invoice repository encrypting sensitive
+// columns with enc, or storing them in plaintext if enc is nil. Every
+// statement is traced.
+func NewInvoiceRepository(db *pgxpool.Pool, enc *FieldEncryption) *InvoiceRepository {
 	return &InvoiceRepository{
-		db: db,
+		db:  tracedQuerier{db: db},
+		enc: enc,
 	}
 }
 
+// rowScanner is satisfied by both pgx.Row and pgx.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// invoiceColumns lists the columns read by scanInvoiceRow. Nullable VNPay
+// fields are coalesced so pending invoices scan into plain strings.
+const invoiceColumns = `
+	invoice_id, tenant_id, invoice_number, invoice_type, customer_id, ticket_id,
+	total_amount, discount_amount, tax_amount, final_amount,
+	payment_status, payment_method, issue_date, COALESCE(notes, ''),
+	created_at, updated_at,
+	COALESCE(vnpay_tmn_code, ''), COALESCE(vnpay_txn_ref, ''), COALESCE(vnpay_bank_code, ''),
+	COALESCE(vnpay_txn_no, ''), COALESCE(vnpay_pay_date, ''),
+	COALESCE(vnpay_card_type, ''), COALESCE(vnpay_fee, 0)::float8, refunded_amount::float8,
+	COALESCE(buyer_name, ''), COALESCE(buyer_tax_code, ''), COALESCE(buyer_address, ''), COALESCE(buyer_email, ''),
+	COALESCE(einvoice_series, ''), COALESCE(einvoice_number, 0), einvoice_issued_at,
+	cancelled_at, COALESCE(cancel_reason, '')
+`
+
+// scanInvoiceRow scans a row selected with invoiceColumns
+func scanInvoiceRow(row rowScanner) (model.Invoice, error) {
+	var invoice model.Invoice
+	err := row.Scan(
+		&invoice.InvoiceID, &invoice.TenantID, &invoice.InvoiceNumber, &invoice.InvoiceType, &invoice.CustomerID,
+		&invoice.TicketID, &invoice.TotalAmount, &invoice.DiscountAmount, &invoice.TaxAmount,
+		&invoice.FinalAmount, &invoice.PaymentStatus, &invoice.PaymentMethod, &invoice.IssueDate,
+		&invoice.Notes, &invoice.CreatedAt, &invoice.UpdatedAt,
+		&invoice.VNPayTmnCode, &invoice.VNPayTxnRef, &invoice.VNPayBankCode, &invoice.VNPayTxnNo, &invoice.VNPayPayDate,
+		&invoice.VNPayCardType, &invoice.VNPayFee, &invoice.RefundedAmount,
+		&invoice.Buyer.Name, &invoice.Buyer.TaxCode, &invoice.Buyer.Address, &invoice.Buyer.Email,
+		&invoice.EInvoiceSeries, &invoice.EInvoiceNumber, &invoice.EInvoiceIssuedAt,
+		&invoice.CancelledAt, &invoice.CancelReason,
+	)
+	return invoice, err
+}
+
+// scanInvoice scans a row selected with invoiceColumns and decrypts its
+// encrypted columns
+func (r *InvoiceRepository) scanInvoice(row rowScanner) (model.Invoice, error) {
+	invoice, err := scanInvoiceRow(row)
+	if err != nil {
+		return model.Invoice{}, err
+	}
+	if err := r.enc.openInvoice(&invoice); err != nil {
+		return model.Invoice{}, err
+	}
+	return invoice, nil
+}
+
 // CreateInvoice creates a new invoice in the database
 func (r *InvoiceRepository) CreateInvoice(ctx context.Context, invoice model.Invoice) (model.Invoice, error) {
 	query := `
 		INSERT INTO invoices (
-			invoice_id, invoice_number, invoice_type, customer_id, ticket_id,
+			invoice_id, tenant_id, invoice_number, invoice_type, customer_id, ticket_id,
 			total_amount, discount_amount, tax_amount, final_amount,
-			payment_status, payment_method, issue_date, notes, 
-			vnpay_txn_ref
+			payment_status, payment_method, issue_date, notes,
+			vnpay_tmn_code, vnpay_txn_ref,
+			buyer_name, buyer_tax_code, buyer_address, buyer_email, customer_id_bidx
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, ''),
+			NULLIF($17, ''), NULLIF($18, ''), NULLIF($19, ''), NULLIF($20, ''), $21
 		) RETURNING invoice_id, created_at, updated_at
 	`
 
@@ -41,6 +97,11 @@ func (r *InvoiceRepository) CreateInvoice(ctx context.Context, invoice model.Inv
 		invoice.InvoiceID = uuid.New()
 	}
 
+	// Invoices without a tenant belong to the default merchant
+	if invoice.TenantID == "" {
+		invoice.TenantID = model.DefaultTenantID
+	}
+
 	// Generate invoice number with current timestamp if empty
 	if invoice.InvoiceNumber == "" {
 		invoice.InvoiceNumber = fmt.Sprintf("INV-%s-%d",
@@ -48,96 +109,119 @@ func (r *InvoiceRepository) CreateInvoice(ctx context.Context, invoice model.Inv
 			time.Now().UnixNano()%1000000)
 	}
 
-	err := r.db.QueryRow(ctx, query,
-		invoice.InvoiceID, invoice.InvoiceNumber, invoice.InvoiceType, invoice.CustomerID,
-		invoice.TicketID, invoice.TotalAmount, invoice.DiscountAmount, invoice.TaxAmount,
-		invoice.FinalAmount, invoice.PaymentStatus, invoice.PaymentMethod, invoice.IssueDate,
-		invoice.Notes, invoice.VNPayTxnRef,
+	sealed, err := r.enc.sealInvoice(invoice)
+	if err != nil {
+		return model.Invoice{}, fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	err = r.db.QueryRow(ctx, query,
+		sealed.InvoiceID, sealed.TenantID, sealed.InvoiceNumber, sealed.InvoiceType, sealed.CustomerID,
+		sealed.TicketID, sealed.TotalAmount, sealed.DiscountAmount, sealed.TaxAmount,
+		sealed.FinalAmount, sealed.PaymentStatus, sealed.PaymentMethod, sealed.IssueDate,
+		sealed.Notes, sealed.VNPayTmnCode, sealed.VNPayTxnRef,
+		sealed.Buyer.Name, sealed.Buyer.TaxCode, sealed.Buyer.Address, sealed.Buyer.Email,
+		r.enc.blindIndex("customer_id", invoice.TenantID, invoice.CustomerID),
 	).Scan(&invoice.InvoiceID, &invoice.CreatedAt, &invoice.UpdatedAt)
 
 	if err != nil {
-		return model.Invoice{}, fmt.Errorf("failed to create invoice: %w", err)
+		return model.Invoice{}, fmt.Errorf("failed to create invoice: %w", translateError(err))
 	}
 
 	return invoice, nil
 }
 
-// GetInvoiceByID retrieves an invoice by ID
-func (r *InvoiceRepository) GetInvoiceByID(ctx context.Context, id uuid.UUID) (model.Invoice, error) {
-	query := `
-		SELECT 
-			invoice_id, invoice_number, invoice_type, customer_id, ticket_id,
-			total_amount, discount_amount, tax_amount, final_amount,
-			payment_status, payment_method, issue_date, notes, 
-			created_at, updated_at,
-			vnpay_txn_ref, vnpay_bank_code, vnpay_txn_no, vnpay_pay_date
-		FROM invoices 
-		WHERE invoice_id = $1
-	`
+// GetInvoiceByID retrieves a tenant's invoice by ID
+func (r *InvoiceRepository) GetInvoiceByID(ctx context.Context, tenantID string, id uuid.UUID) (model.Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE tenant_id = $1 AND invoice_id = $2`
 
-	var invoice model.Invoice
-	err := r.db.QueryRow(ctx, query, id).Scan(
-		&invoice.InvoiceID, &invoice.InvoiceNumber, &invoice.InvoiceType, &invoice.CustomerID,
-		&invoice.TicketID, &invoice.TotalAmount, &invoice.DiscountAmount, &invoice.TaxAmount,
-		&invoice.FinalAmount, &invoice.PaymentStatus, &invoice.PaymentMethod, &invoice.IssueDate,
-		&invoice.Notes, &invoice.CreatedAt, &invoice.UpdatedAt,
-		&invoice.VNPayTxnRef, &invoice.VNPayBankCode, &invoice.VNPayTxnNo, &invoice.VNPayPayDate,
-	)
+	invoice, err := r.scanInvoice(r.db.QueryRow(ctx, query, tenantID, id))
+	if err != nil {
+		return model.Invoice{}, fmt.Errorf("failed to get invoice: %w", translateError(err))
+	}
 
+	return invoice, nil
+}
+
+// GetInvoiceByIDForUpdate retrieves a tenant's invoice by ID and locks it
+// until the surrounding transaction ends
+func (r *InvoiceRepository) GetInvoiceByIDForUpdate(ctx context.Context, tenantID string, id uuid.UUID) (model.Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE tenant_id = $1 AND invoice_id = $2 FOR UPDATE`
+
+	invoice, err := r.scanInvoice(r.db.QueryRow(ctx, query, tenantID, id))
 	if err != nil {
-		return model.Invoice{}, fmt.Errorf("failed to get invoice: %w", err)
+		return model.Invoice{}, fmt.Errorf("failed to lock invoice: %w", translateError(err))
 	}
 
 	return invoice, nil
 }
 
-// GetInvoiceByVNPayTxnRef retrieves an invoice by VNPay transaction reference
-func (r *InvoiceRepository) GetInvoiceByVNPayTxnRef(ctx context.Context, txnRef string) (model.Invoice, error) {
-	query := `
-		SELECT 
-			invoice_id, invoice_number, invoice_type, customer_id, ticket_id,
-			total_amount, discount_amount, tax_amount, final_amount,
-			payment_status, payment_method, issue_date, notes, 
-			created_at, updated_at,
-			vnpay_txn_ref, vnpay_bank_code, vnpay_txn_no, vnpay_pay_date
-		FROM invoices 
-		WHERE vnpay_txn_ref = $1
-	`
+// GetInvoiceByVNPayTxnRefForUpdate retrieves a tenant's invoice by VNPay
+// transaction reference and locks it until the surrounding transaction ends
+func (r *InvoiceRepository) GetInvoiceByVNPayTxnRefForUpdate(ctx context.Context, tenantID string, txnRef string) (model.Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE tenant_id = $1 AND vnpay_txn_ref = $2 FOR UPDATE`
 
-	var invoice model.Invoice
-	err := r.db.QueryRow(ctx, query, txnRef).Scan(
-		&invoice.InvoiceID, &invoice.InvoiceNumber, &invoice.InvoiceType, &invoice.CustomerID,
-		&invoice.TicketID, &invoice.TotalAmount, &invoice.DiscountAmount, &invoice.TaxAmount,
-		&invoice.FinalAmount, &invoice.PaymentStatus, &invoice.PaymentMethod, &invoice.IssueDate,
-		&invoice.Notes, &invoice.CreatedAt, &invoice.UpdatedAt,
-		&invoice.VNPayTxnRef, &invoice.VNPayBankCode, &invoice.VNPayTxnNo, &invoice.VNPayPayDate,
-	)
+	invoice, err := r.scanInvoice(r.db.QueryRow(ctx, query, tenantID, txnRef))
+	if err != nil {
+		return model.Invoice{}, fmt.Errorf("failed to lock invoice by VNPay reference: %w", translateError(err))
+	}
+
+	return invoice, nil
+}
+
+// GetInvoiceByVNPayTxnRef retrieves a tenant's invoice by VNPay transaction reference
+func (r *InvoiceRepository) GetInvoiceByVNPayTxnRef(ctx context.Context, tenantID string, txnRef string) (model.Invoice, error) {
+	query := `SELECT ` + invoiceColumns + ` FROM invoices WHERE tenant_id = $1 AND vnpay_txn_ref = $2`
 
+	invoice, err := r.scanInvoice(r.db.QueryRow(ctx, query, tenantID, txnRef))
 	if err != nil {
-		return model.Invoice{}, fmt.Errorf("failed to get invoice by VNPay reference: %w", err)
+		return model.Invoice{}, fmt.Errorf("failed to get invoice by VNPay reference: %w", translateError(err))
 	}
 
 	return invoice, nil
 }
 
-// UpdateInvoicePaymentStatus updates an invoice's payment status and VNPay information
-func (r *InvoiceRepository) UpdateInvoicePaymentStatus(ctx context.Context, txnRef string, status model.PaymentStatus, vnpayData map[string]string) error {
+// UpdateInvoicePaymentStatus updates a tenant's invoice payment status and the
+// VNPay information given; fields missing from vnpayData are kept
+func (r *InvoiceRepository) UpdateInvoicePaymentStatus(ctx context.Context, tenantID string, txnRef string, status model.PaymentStatus, vnpayData map[string]string) error {
 	query := `
 		UPDATE invoices
-		SET 
+		SET
 			payment_status = $1,
-			vnpay_bank_code = $2,
-			vnpay_txn_no = $3,
-			vnpay_pay_date = $4,
+			vnpay_bank_code = COALESCE(NULLIF($2, ''), vnpay_bank_code),
+			vnpay_txn_no = COALESCE(NULLIF($3, ''), vnpay_txn_no),
+			vnpay_pay_date = COALESCE(NULLIF($4, ''), vnpay_pay_date),
+			vnpay_card_type = COALESCE(NULLIF($5, ''), vnpay_card_type),
+			vnpay_bank_code_bidx = COALESCE($6, vnpay_bank_code_bidx),
 			updated_at = NOW()
-		WHERE vnpay_txn_ref = $5
+		WHERE tenant_id = $7 AND vnpay_txn_ref = $8
 	`
 
-	_, err := r.db.Exec(ctx, query,
+	invoice := model.Invoice{
+		VNPayBankCode: vnpayData["bankCode"],
+		VNPayTxnNo:    vnpayData["transactionNo"],
+		VNPayPayDate:  vnpayData["payDate"],
+		VNPayCardType: vnpayData["cardType"],
+	}
+	if r.enc != nil {
+		// Encrypted values are bound to their invoice's ID
+		err := r.db.QueryRow(ctx, `SELECT invoice_id FROM invoices WHERE tenant_id = $1 AND vnpay_txn_ref = $2`, tenantID, txnRef).Scan(&invoice.InvoiceID)
+		if err != nil {
+			return fmt.Errorf("failed to update invoice payment status: %w", translateError(err))
+		}
+	}
+	sealed, err := r.enc.sealInvoice(invoice)
+	if err != nil {
+		return fmt.Errorf("failed to update invoice payment status: %w", err)
+	}
+
+	tag, err := r.db.Exec(ctx, query,
 		status,
-		vnpayData["bankCode"],
-		vnpayData["transactionNo"],
-		vnpayData["payDate"],
+		sealed.VNPayBankCode,
+		sealed.VNPayTxnNo,
+		sealed.VNPayPayDate,
+		sealed.VNPayCardType,
+		r.enc.blindIndex("vnpay_bank_code", tenantID, invoice.VNPayBankCode),
+		tenantID,
 		txnRef,
 	)
 
@@ -145,24 +229,78 @@ func (r *InvoiceRepository) UpdateInvoicePaymentStatus(ctx context.Context, txnR
 		return fmt.Errorf("failed to update invoice payment status: %w", err)
 	}
 
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update invoice payment status: %w", ErrNotFound)
+	}
+
 	return nil
 }
 
-// GetInvoicesByCustomerID retrieves all invoices for a customer
-func (r *InvoiceRepository) GetInvoicesByCustomerID(ctx context.Context, customerID string) ([]model.Invoice, error) {
+// SetInvoiceVNPayFee records the merchant fee VNPay charged on a tenant's invoice
+func (r *InvoiceRepository) SetInvoiceVNPayFee(ctx context.Context, tenantID string, id uuid.UUID, fee float64) error {
+	query := `UPDATE invoices SET vnpay_fee = $1, updated_at = NOW() WHERE tenant_id = $2 AND invoice_id = $3`
+
+	tag, err := r.db.Exec(ctx, query, fee, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to set invoice VNPay fee: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set invoice VNPay fee: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// SetInvoiceRefundedAmount records how much of a tenant's invoice has been refunded
+func (r *InvoiceRepository) SetInvoiceRefundedAmount(ctx context.Context, tenantID string, id uuid.UUID, amount float64) error {
+	query := `UPDATE invoices SET refunded_amount = $1, updated_at = NOW() WHERE tenant_id = $2 AND invoice_id = $3`
+
+	tag, err := r.db.Exec(ctx, query, amount, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to set invoice refunded amount: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set invoice refunded amount: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// CancelInvoice sets a tenant's invoice to CANCELLED or VOIDED, recording when and why
+func (r *InvoiceRepository) CancelInvoice(ctx context.Context, tenantID string, id uuid.UUID, status model.PaymentStatus, reason string, cancelledAt time.Time) error {
 	query := `
-		SELECT 
-			invoice_id, invoice_number, invoice_type, customer_id, ticket_id,
-			total_amount, discount_amount, tax_amount, final_amount,
-			payment_status, payment_method, issue_date, notes, 
-			created_at, updated_at,
-			vnpay_txn_ref, vnpay_bank_code, vnpay_txn_no, vnpay_pay_date
-		FROM invoices 
-		WHERE customer_id = $1
-		ORDER BY created_at DESC
+		UPDATE invoices
+		SET payment_status = $1, cancel_reason = $2, cancelled_at = $3, updated_at = NOW()
+		WHERE tenant_id = $4 AND invoice_id = $5
 	`
 
-	rows, err := r.db.Query(ctx, query, customerID)
+	tag, err := r.db.Exec(ctx, query, status, reason, cancelledAt.UTC(), tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel invoice: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to cancel invoice: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// GetInvoicesByCustomerID retrieves all of a tenant's invoices for a customer
+func (r *InvoiceRepository) GetInvoicesByCustomerID(ctx context.Context, tenantID string, customerID string) ([]model.Invoice, error) {
+	where := &conditions{}
+	where.add("tenant_id = %s", tenantID)
+	r.addEqualsCondition(where, "customer_id", tenantID, customerID)
+	query := `
+		SELECT ` + invoiceColumns + `
+		FROM invoices
+		WHERE ` + where.String() + `
+		ORDER BY created_at DESC, invoice_id DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, where.args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query invoices: %w", err)
 	}
@@ -170,14 +308,42 @@ func (r *InvoiceRepository) GetInvoicesByCustomerID(ctx context.Context, custome
 
 	var invoices []model.Invoice
 	for rows.Next() {
-		var invoice model.Invoice
-		err := rows.Scan(
-			&invoice.InvoiceID, &invoice.InvoiceNumber, &invoice.InvoiceType, &invoice.CustomerID,
-			&invoice.TicketID, &invoice.TotalAmount, &invoice.DiscountAmount, &invoice.TaxAmount,
-			&invoice.FinalAmount, &invoice.PaymentStatus, &invoice.PaymentMethod, &invoice.IssueDate,
-			&invoice.Notes, &invoice.CreatedAt, &invoice.UpdatedAt,
-			&invoice.VNPayTxnRef, &invoice.VNPayBankCode, &invoice.VNPayTxnNo, &invoice.VNPayPayDate,
-		)
+		invoice, err := r.scanInvoice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invoice: %w", err)
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over invoices: %w", err)
+	}
+
+	return invoices, nil
+}
+
+// GetExpiredPendingInvoices retrieves and locks up to limit pending invoices of
+// any tenant created before the given time, oldest first. Invoices already
+// locked by another transaction, such as an IPN in progress, are skipped.
+func (r *InvoiceRepository) GetExpiredPendingInvoices(ctx context.Context, createdBefore time.Time, limit int) ([]model.Invoice, error) {
+	query := `
+		SELECT ` + invoiceColumns + `
+		FROM invoices
+		WHERE payment_status = $1 AND created_at < $2 AND vnpay_txn_ref IS NOT NULL
+		ORDER BY created_at, invoice_id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := r.db.Query(ctx, query, model.PaymentStatusPending, createdBefore.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired invoices: %w", err)
+	}
+	defer rows.Close()
+
+	var invoices []model.Invoice
+	for rows.Next() {
+		invoice, err := r.scanInvoice(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan invoice: %w", err)
 		}
@@ -190,3 +356,43 @@ func (r *InvoiceRepository) GetInvoicesByCustomerID(ctx context.Context, custome
 
 	return invoices, nil
 }
+
+// NextEInvoiceNumber reserves the next e-invoice number of a tenant's series.
+// Run it in the transaction that assigns the number, so a rollback releases it
+// and the series stays free of gaps.
+func (r *InvoiceRepository) NextEInvoiceNumber(ctx context.Context, tenantID string, series string) (int, error) {
+	query := `
+		INSERT INTO einvoice_sequences (tenant_id, series, last_number)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (tenant_id, series) DO UPDATE SET last_number = einvoice_sequences.last_number + 1
+		RETURNING last_number
+	`
+
+	var number int
+	if err := r.db.QueryRow(ctx, query, tenantID, series).Scan(&number); err != nil {
+		return 0, fmt.Errorf("failed to reserve e-invoice number: %w", err)
+	}
+
+	return number, nil
+}
+
+// SetEInvoiceNumber records the e-invoice number issued for a tenant's
+// invoice. It fails with ErrNotFound if the invoice already has a number.
+func (r *InvoiceRepository) SetEInvoiceNumber(ctx context.Context, tenantID string, id uuid.UUID, series string, number int, issuedAt time.Time) error {
+	query := `
+		UPDATE invoices
+		SET einvoice_series = $1, einvoice_number = $2, einvoice_issued_at = $3, updated_at = NOW()
+		WHERE tenant_id = $4 AND invoice_id = $5 AND einvoice_number IS NULL
+	`
+
+	tag, err := r.db.Exec(ctx, query, series, number, issuedAt.UTC(), tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to set e-invoice number: %w", translateError(err))
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set e-invoice number: %w", ErrNotFound)
+	}
+
+	return nil
+}
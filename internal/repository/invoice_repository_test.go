@@ -0,0 +1,164 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"payment_service/domain/model"
+	"payment_service/internal/fieldcrypt"
+	"payment_service/internal/migration"
+	"payment_service/internal/repository"
+	"payment_service/internal/repository/storetest"
+)
+
+// connectTestDatabase connects to TEST_DATABASE_URL and migrates it, skipping
+// the test when no database is configured
+func connectTestDatabase(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set; skipping Postgres tests")
+	}
+
+	ctx := context.Background()
+	db, err := pgxpool.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	migrator, err := migration.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	return db
+}
+
+// truncateInvoices empties the invoice tables before a test
+func truncateInvoices(t *testing.T, db *pgxpool.Pool) {
+	t.Helper()
+	if _, err := db.Exec(context.Background(), `TRUNCATE invoices, einvoice_sequences CASCADE`); err != nil {
+		t.Fatalf("truncate invoices: %v", err)
+	}
+}
+
+func TestInvoiceRepository(t *testing.T) {
+	db := connectTestDatabase(t)
+
+	storetest.RunInvoiceStoreTests(t, func(t *testing.T) repository.InvoiceStore {
+		truncateInvoices(t, db)
+		return repository.NewInvoiceRepository(db, nil)
+	})
+}
+
+func TestPostgresStore(t *testing.T) {
+	db := connectTestDatabase(t)
+
+	storetest.RunStoreTests(t, func(t *testing.T) repository.Store {
+		truncateInvoices(t, db)
+		return repository.NewPostgresStore(db, nil)
+	})
+}
+
+// newTestFieldEncryption creates a field encryption of the default columns
+// whose current key is the given one of two keys
+func newTestFieldEncryption(t *testing.T, current string) *repository.FieldEncryption {
+	t.Helper()
+
+	keyring, err := fieldcrypt.NewKeyring(map[string][]byte{
+		"old": bytes.Repeat([]byte{1}, fieldcrypt.KeySize),
+		"new": bytes.Repeat([]byte{2}, fieldcrypt.KeySize),
+	}, current, bytes.Repeat([]byte{3}, fieldcrypt.KeySize))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	enc, err := repository.NewFieldEncryption(keyring, []string{"customer_id", "notes", "vnpay_bank_code", "vnpay_txn_no"})
+	if err != nil {
+		t.Fatalf("NewFieldEncryption: %v", err)
+	}
+	return enc
+}
+
+func TestEncryptedInvoiceRepository(t *testing.T) {
+	db := connectTestDatabase(t)
+
+	storetest.RunInvoiceStoreTests(t, func(t *testing.T) repository.InvoiceStore {
+		truncateInvoices(t, db)
+		return repository.NewInvoiceRepository(db, newTestFieldEncryption(t, "new"))
+	})
+}
+
+// reencryptTestInvoice builds a pending invoice of customer-1
+func reencryptTestInvoice(notes, txnRef string) model.Invoice {
+	return model.Invoice{
+		TenantID:      "tenant-a",
+		InvoiceType:   "TICKET",
+		CustomerID:    "customer-1",
+		TicketID:      "ticket-" + txnRef,
+		TotalAmount:   100000,
+		FinalAmount:   100000,
+		PaymentStatus: model.PaymentStatusPending,
+		PaymentMethod: model.PaymentMethodVNPay,
+		IssueDate:     time.Now().UTC().Truncate(time.Second),
+		Notes:         notes,
+		VNPayTxnRef:   txnRef,
+	}
+}
+
+func TestReencryptInvoices(t *testing.T) {
+	db := connectTestDatabase(t)
+	truncateInvoices(t, db)
+	ctx := context.Background()
+
+	// Invoices written before encryption was enabled, and under the old key
+	plain, err := repository.NewInvoiceRepository(db, nil).CreateInvoice(ctx, reencryptTestInvoice("plain", "4000001"))
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+	old, err := repository.NewInvoiceRepository(db, newTestFieldEncryption(t, "old")).CreateInvoice(ctx, reencryptTestInvoice("old", "4000002"))
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+
+	store := repository.NewPostgresStore(db, newTestFieldEncryption(t, "new"))
+	if err := store.ReencryptInvoices(ctx, 1, nil); err != nil {
+		t.Fatalf("ReencryptInvoices: %v", err)
+	}
+
+	for _, invoice := range []model.Invoice{plain, old} {
+		var customerID, notes string
+		var index *string
+		err := db.QueryRow(ctx, `SELECT customer_id, notes, customer_id_bidx FROM invoices WHERE invoice_id = $1`, invoice.InvoiceID).Scan(&customerID, &notes, &index)
+		if err != nil {
+			t.Fatalf("select invoice: %v", err)
+		}
+		for _, value := range []string{customerID, notes} {
+			if keyID, err := fieldcrypt.KeyID(value); err != nil || keyID != "new" {
+				t.Errorf("invoice %s stores %q, want it encrypted with the new key", invoice.Notes, value)
+			}
+		}
+		if strings.Contains(customerID, "customer-1") || index == nil {
+			t.Errorf("invoice %s: customer_id %q, blind index %v, want it encrypted and indexed", invoice.Notes, customerID, index)
+		}
+	}
+
+	// Both invoices are still found by customer once encrypted
+	invoices, err := store.Invoices().GetInvoicesByCustomerID(ctx, "tenant-a", "customer-1")
+	if err != nil {
+		t.Fatalf("GetInvoicesByCustomerID: %v", err)
+	}
+	if len(invoices) != 2 || invoices[0].CustomerID != "customer-1" {
+		t.Errorf("GetInvoicesByCustomerID = %+v, want both invoices decrypted", invoices)
+	}
+}
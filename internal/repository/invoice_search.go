@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"payment_service/domain/model"
+)
+
+// invoiceSortColumns maps sort fields onto their invoices columns
+var invoiceSortColumns = map[model.InvoiceSortField]string{
+	model.InvoiceSortCreatedAt:   "created_at",
+	model.InvoiceSortFinalAmount: "final_amount",
+}
+
+// SearchInvoices returns up to filter.Limit of a tenant's invoices matching
+// the filter, starting after filter.After, and the total number of matches
+func (r *InvoiceRepository) SearchInvoices(ctx context.Context, filter model.InvoiceFilter) ([]model.Invoice, int, error) {
+	sortColumn, ok := invoiceSortColumns[filter.SortBy]
+	if !ok {
+		return nil, 0, fmt.Errorf("failed to search invoices: unsupported sort field %q", filter.SortBy)
+	}
+
+	where := r.invoiceFilterConditions(filter)
+
+	// Count every match before narrowing to the page
+	var total int
+	countQuery := `SELECT COUNT(*) FROM invoices WHERE ` + where.String()
+	if err := r.db.QueryRow(ctx, countQuery, where.args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count invoices: %w", err)
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		var position interface{} = filter.After.CreatedAt
+		if filter.SortBy == model.InvoiceSortFinalAmount {
+			position = filter.After.FinalAmount
+		}
+		where.add("("+sortColumn+", invoice_id) "+comparison+" (%s, %s)", position, filter.After.InvoiceID)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM invoices
+		WHERE %s
+		ORDER BY %s %s, invoice_id %s
+		LIMIT %d
+	`, invoiceColumns, where.String(), sortColumn, direction, direction, filter.Limit)
+
+	rows, err := r.db.Query(ctx, query, where.args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search invoices: %w", err)
+	}
+	defer rows.Close()
+
+	invoices := make([]model.Invoice, 0, filter.Limit)
+	for rows.Next() {
+		invoice, err := r.scanInvoice(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan invoice: %w", err)
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over invoices: %w", err)
+	}
+
+	return invoices, total, nil
+}
+
+// StreamInvoices calls fn with each of a tenant's invoices matching the
+// filter, in the filter's order. filter.Limit and filter.After are ignored.
+// Rows are read from the database as fn consumes them, so fn should not block
+// for long while the query holds its connection.
+func (r *InvoiceRepository) StreamInvoices(ctx context.Context, filter model.InvoiceFilter, fn func(model.Invoice) error) error {
+	sortColumn, ok := invoiceSortColumns[filter.SortBy]
+	if !ok {
+		return fmt.Errorf("failed to stream invoices: unsupported sort field %q", filter.SortBy)
+	}
+
+	direction := "ASC"
+	if filter.SortDesc {
+		direction = "DESC"
+	}
+
+	where := r.invoiceFilterConditions(filter)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM invoices
+		WHERE %s
+		ORDER BY %s %s, invoice_id %s
+	`, invoiceColumns, where.String(), sortColumn, direction, direction)
+
+	rows, err := r.db.Query(ctx, query, where.args...)
+	if err != nil {
+		return fmt.Errorf("failed to stream invoices: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		invoice, err := r.scanInvoice(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan invoice: %w", err)
+		}
+		if err := fn(invoice); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over invoices: %w", err)
+	}
+
+	return nil
+}
+
+// conditions collects the clauses of a WHERE and their arguments
+type conditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+// add appends a clause whose %s verbs are replaced by placeholders for values
+func (c *conditions) add(condition string, values ...interface{}) {
+	// Number the placeholders after the arguments already collected
+	placeholders := make([]interface{}, len(values))
+	for i := range values {
+		placeholders[i] = fmt.Sprintf("$%d", len(c.args)+i+1)
+	}
+	c.clauses = append(c.clauses, fmt.Sprintf(condition, placeholders...))
+	c.args = append(c.args, values...)
+}
+
+// String joins the clauses with AND
+func (c *conditions) String() string {
+	return strings.Join(c.clauses, " AND ")
+}
+
+// addEqualsCondition adds a condition matching a tenant's invoices whose
+// column equals value. With field encryption the column's blind index is
+// matched too, finding both encrypted values and plaintext written before
+// encryption was enabled.
+func (r *InvoiceRepository) addEqualsCondition(where *conditions, column string, tenantID string, value string) {
+	index := r.enc.blindIndex(column, tenantID, value)
+	if index == nil {
+		where.add(column+" = %s", value)
+		return
+	}
+	where.add("("+column+"_bidx = %s OR "+column+" = %s)", *index, value)
+}
+
+// invoiceFilterConditions returns the conditions selecting a tenant's
+// invoices matching the filter, leaving out its cursor
+func (r *InvoiceRepository) invoiceFilterConditions(filter model.InvoiceFilter) *conditions {
+	where := &conditions{}
+
+	where.add("tenant_id = %s", filter.TenantID)
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		where.add("payment_status = ANY(%s)", statuses)
+	}
+	if filter.CustomerID != "" {
+		r.addEqualsCondition(where, "customer_id", filter.TenantID, filter.CustomerID)
+	}
+	if filter.TicketID != "" {
+		where.add("ticket_id = %s", filter.TicketID)
+	}
+	if filter.BankCode != "" {
+		r.addEqualsCondition(where, "vnpay_bank_code", filter.TenantID, filter.BankCode)
+	}
+	if filter.InvoiceType != "" {
+		where.add("invoice_type = %s", filter.InvoiceType)
+	}
+	// created_at is a TIMESTAMP in UTC, so compare against UTC wall-clock times
+	if filter.CreatedFrom != nil {
+		where.add("created_at >= %s", filter.CreatedFrom.UTC())
+	}
+	if filter.CreatedTo != nil {
+		where.add("created_at < %s", filter.CreatedTo.UTC())
+	}
+	if filter.MinAmount != nil {
+		where.add("final_amount >= %s", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		where.add("final_amount <= %s", *filter.MaxAmount)
+	}
+
+	return where
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"payment_service/domain/model"
+)
+
+// LedgerRepository handles database operations for the ledger
+type LedgerRepository struct {
+	db querier
+}
+
+// NewLedgerRepository creates a new ledger repository
+func NewLedgerRepository(db *pgxpool.Pool) *LedgerRepository {
+	return &LedgerRepository{
+		db: db,
+	}
+}
+
+// PostLedgerTransaction stores a transaction and its entries in one statement
+func (r *LedgerRepository) PostLedgerTransaction(ctx context.Context, txn model.LedgerTransaction) error {
+	query := `
+		WITH txn AS (
+			INSERT INTO ledger_transactions (
+				transaction_id, tenant_id, kind, reference, invoice_id, description, posted_at
+			) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+			RETURNING transaction_id, tenant_id, posted_at
+		)
+		INSERT INTO ledger_entries (transaction_id, tenant_id, account, debit, credit, posted_at)
+		SELECT txn.transaction_id, txn.tenant_id, e.account, e.debit, e.credit, txn.posted_at
+		FROM txn, unnest($8::text[], $9::float8[], $10::float8[]) AS e(account, debit, credit)
+	`
+
+	accounts := make([]string, len(txn.Entries))
+	debits := make([]float64, len(txn.Entries))
+	credits := make([]float64, len(txn.Entries))
+	for i, entry := range txn.Entries {
+		accounts[i] = string(entry.Account)
+		debits[i] = entry.Debit
+		credits[i] = entry.Credit
+	}
+
+	_, err := r.db.Exec(ctx, query,
+		txn.TransactionID, txn.TenantID, txn.Kind, txn.Reference, txn.InvoiceID, txn.Description,
+		txn.PostedAt.UTC(), accounts, debits, credits,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to post ledger transaction: %w", translateError(err))
+	}
+
+	return nil
+}
+
+// GetLedgerBalances totals a tenant's entries posted before the given time,
+// per account. Accounts without entries are left out.
+func (r *LedgerRepository) GetLedgerBalances(ctx context.Context, tenantID string, before time.Time) ([]model.LedgerBalance, error) {
+	query := `
+		SELECT account, SUM(debit)::float8, SUM(credit)::float8
+		FROM ledger_entries
+		WHERE tenant_id = $1 AND posted_at < $2
+		GROUP BY account
+		ORDER BY account
+	`
+
+	rows, err := r.db.Query(ctx, query, tenantID, before.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledger balances: %w", err)
+	}
+	defer rows.Close()
+
+	var balances []model.LedgerBalance
+	for rows.Next() {
+		var balance model.LedgerBalance
+		if err := rows.Scan(&balance.Account, &balance.Debit, &balance.Credit); err != nil {
+			return nil, fmt.Errorf("failed to scan ledger balance: %w", err)
+		}
+		balances = append(balances, balance)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over ledger balances: %w", err)
+	}
+
+	return balances, nil
+}
+
+// LedgerTransactionExists reports whether a tenant has posted a transaction
+// of a kind under a reference
+func (r *LedgerRepository) LedgerTransactionExists(ctx context.Context, tenantID string, kind model.LedgerTransactionKind, reference string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM ledger_transactions WHERE tenant_id = $1 AND kind = $2 AND reference = $3)`
+
+	var exists bool
+	if err := r.db.QueryRow(ctx, query, tenantID, kind, reference).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to look up ledger transaction: %w", err)
+	}
+
+	return exists, nil
+}
+
+// StreamLedgerTransactions calls fn with each of a tenant's ledger
+// transactions and its entries, oldest first, stopping at the first error fn returns
+func (r *LedgerRepository) StreamLedgerTransactions(ctx context.Context, tenantID string, fn func(model.LedgerTransaction) error) error {
+	query := `
+		SELECT t.transaction_id, t.tenant_id, t.kind, t.reference, t.invoice_id,
+			COALESCE(t.description, ''), t.posted_at, e.account, e.debit::float8, e.credit::float8
+		FROM ledger_transactions t
+		JOIN ledger_entries e ON e.transaction_id = t.transaction_id
+		WHERE t.tenant_id = $1
+		ORDER BY t.posted_at, t.transaction_id, e.entry_id
+	`
+
+	rows, err := r.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to query ledger transactions: %w", err)
+	}
+	defer rows.Close()
+
+	// Entries arrive grouped by transaction; each transaction is passed on
+	// once the first entry of the next one is read
+	var current model.LedgerTransaction
+	for rows.Next() {
+		var txn model.LedgerTransaction
+		var invoiceID *uuid.UUID
+		var entry model.LedgerEntry
+		err := rows.Scan(
+			&txn.TransactionID, &txn.TenantID, &txn.Kind, &txn.Reference, &invoiceID,
+			&txn.Description, &txn.PostedAt, &entry.Account, &entry.Debit, &entry.Credit,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan ledger entry: %w", err)
+		}
+		txn.InvoiceID = invoiceID
+
+		if txn.TransactionID != current.TransactionID {
+			if current.TransactionID != uuid.Nil {
+				if err := fn(current); err != nil {
+					return err
+				}
+			}
+			current = txn
+		}
+		current.Entries = append(current.Entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over ledger transactions: %w", err)
+	}
+
+	if current.TransactionID != uuid.Nil {
+		return fn(current)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+)
+
+// MemoryAPIKeyStore is an in-memory APIKeyStore for tests and local development
+type MemoryAPIKeyStore struct {
+	mu     sync.RWMutex
+	keys   map[uuid.UUID]model.APIKey
+	hashes map[string]uuid.UUID
+}
+
+// NewMemoryAPIKeyStore creates an empty in-memory API key store
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{
+		keys:   make(map[uuid.UUID]model.APIKey),
+		hashes: make(map[string]uuid.UUID),
+	}
+}
+
+// CreateAPIKey stores a new API key under the hash of the key
+func (s *MemoryAPIKeyStore) CreateAPIKey(ctx context.Context, key model.APIKey, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key.KeyID]; ok {
+		return fmt.Errorf("failed to create API key: %w: api_keys_pkey", ErrDuplicate)
+	}
+	if _, ok := s.hashes[keyHash]; ok {
+		return fmt.Errorf("failed to create API key: %w: api_keys_key_hash_key", ErrDuplicate)
+	}
+
+	s.keys[key.KeyID] = key
+	s.hashes[keyHash] = key.KeyID
+	return nil
+}
+
+// GetAPIKeyByHash retrieves the API key with the given hash
+func (s *MemoryAPIKeyStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (model.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.hashes[keyHash]
+	if !ok {
+		return model.APIKey{}, fmt.Errorf("failed to get API key: %w", ErrNotFound)
+	}
+	return s.keys[id], nil
+}
+
+// ListAPIKeys retrieves a tenant's API keys, oldest first
+func (s *MemoryAPIKeyStore) ListAPIKeys(ctx context.Context, tenantID string) ([]model.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []model.APIKey
+	for _, key := range s.keys {
+		if key.TenantID == tenantID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].KeyID.String() < keys[j].KeyID.String()
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key; revoking it again keeps the first revocation time
+func (s *MemoryAPIKeyStore) RevokeAPIKey(ctx context.Context, keyID uuid.UUID, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[keyID]
+	if !ok {
+		return fmt.Errorf("failed to revoke API key: %w", ErrNotFound)
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &revokedAt
+		s.keys[keyID] = key
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"payment_service/domain/model"
+)
+
+// PostLedgerTransaction stores a ledger transaction and its entries
+func (s *MemoryInvoiceStore) PostLedgerTransaction(ctx context.Context, txn model.LedgerTransaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if txn.InvoiceID != nil {
+		if _, ok := s.invoices[*txn.InvoiceID]; !ok {
+			return fmt.Errorf("failed to post ledger transaction: %w: ledger_transactions_invoice_id_fkey", ErrNotFound)
+		}
+	}
+	for _, existing := range s.ledger {
+		switch {
+		case existing.TransactionID == txn.TransactionID:
+			return fmt.Errorf("failed to post ledger transaction: %w: ledger_transactions_pkey", ErrDuplicate)
+		case existing.TenantID == txn.TenantID && existing.Kind == txn.Kind && existing.Reference == txn.Reference:
+			return fmt.Errorf("failed to post ledger transaction: %w: ledger_transactions_tenant_kind_reference_key", ErrDuplicate)
+		}
+	}
+
+	// Amounts are stored to the cent, like the database's DECIMAL(15, 2) columns
+	entries := make([]model.LedgerEntry, len(txn.Entries))
+	for i, entry := range txn.Entries {
+		entry.Debit = model.RoundAmount(entry.Debit)
+		entry.Credit = model.RoundAmount(entry.Credit)
+		if entry.Debit < 0 || entry.Credit < 0 || (entry.Debit > 0) == (entry.Credit > 0) {
+			return fmt.Errorf("failed to post ledger transaction: entry %d must either debit or credit a positive amount", i)
+		}
+		entries[i] = entry
+	}
+	txn.Entries = entries
+	if !txn.Balanced() {
+		return fmt.Errorf("failed to post ledger transaction: ledger transaction %s is not balanced", txn.TransactionID)
+	}
+
+	s.ledger = append(s.ledger, txn)
+	return nil
+}
+
+// GetLedgerBalances totals a tenant's entries posted before the given time, per account
+func (s *MemoryInvoiceStore) GetLedgerBalances(ctx context.Context, tenantID string, before time.Time) ([]model.LedgerBalance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	totals := make(map[model.LedgerAccount]*model.LedgerBalance)
+	for _, txn := range s.ledger {
+		if txn.TenantID != tenantID || !txn.PostedAt.Before(before) {
+			continue
+		}
+		for _, entry := range txn.Entries {
+			total, ok := totals[entry.Account]
+			if !ok {
+				total = &model.LedgerBalance{Account: entry.Account}
+				totals[entry.Account] = total
+			}
+			total.Debit = model.RoundAmount(total.Debit + entry.Debit)
+			total.Credit = model.RoundAmount(total.Credit + entry.Credit)
+		}
+	}
+
+	balances := make([]model.LedgerBalance, 0, len(totals))
+	for _, total := range totals {
+		balances = append(balances, *total)
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Account < balances[j].Account })
+	return balances, nil
+}
+
+// LedgerTransactionExists reports whether a tenant has posted a transaction
+// of a kind under a reference
+func (s *MemoryInvoiceStore) LedgerTransactionExists(ctx context.Context, tenantID string, kind model.LedgerTransactionKind, reference string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, txn := range s.ledger {
+		if txn.TenantID == tenantID && txn.Kind == kind && txn.Reference == reference {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// StreamLedgerTransactions calls fn with each of a tenant's ledger
+// transactions, oldest first, stopping at the first error fn returns
+func (s *MemoryInvoiceStore) StreamLedgerTransactions(ctx context.Context, tenantID string, fn func(model.LedgerTransaction) error) error {
+	s.mu.RLock()
+	var transactions []model.LedgerTransaction
+	for _, txn := range s.ledger {
+		if txn.TenantID == tenantID {
+			transactions = append(transactions, txn)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		if !transactions[i].PostedAt.Equal(transactions[j].PostedAt) {
+			return transactions[i].PostedAt.Before(transactions[j].PostedAt)
+		}
+		return compareUUID(transactions[i].TransactionID, transactions[j].TransactionID) < 0
+	})
+	for _, txn := range transactions {
+		if err := fn(txn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
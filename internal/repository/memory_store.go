@@ -0,0 +1,740 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+)
+
+// MemoryInvoiceStore is an in-memory InvoiceStore with the same semantics as
+// the Postgres repository. It is intended for tests and local development.
+// It also implements LedgerStore, so the ledger shares its transactions.
+type MemoryInvoiceStore struct {
+	mu       sync.RWMutex
+	invoices map[uuid.UUID]model.Invoice
+	items    map[uuid.UUID][]model.InvoiceItem
+	// sequences holds the last e-invoice number per tenant and series
+	sequences map[[2]string]int
+	// events is the outbox of invoice events
+	events []memoryInvoiceEvent
+	// history is the append-only status history, in insertion order
+	history       []model.InvoiceHistoryEntry
+	lastHistoryID int64
+	// ledger holds the posted ledger transactions, in posting order
+	ledger []model.LedgerTransaction
+	now    func() time.Time
+}
+
+// memoryInvoiceEvent is an invoice event in the in-memory outbox
+type memoryInvoiceEvent struct {
+	event     model.InvoiceEvent
+	published bool
+}
+
+// NewMemoryInvoiceStore creates an empty in-memory invoice store
+func NewMemoryInvoiceStore() *MemoryInvoiceStore {
+	return &MemoryInvoiceStore{
+		invoices:  make(map[uuid.UUID]model.Invoice),
+		items:     make(map[uuid.UUID][]model.InvoiceItem),
+		sequences: make(map[[2]string]int),
+		now:       time.Now,
+	}
+}
+
+// CreateInvoice stores a new invoice, enforcing the same uniqueness rules as the database
+func (s *MemoryInvoiceStore) CreateInvoice(ctx context.Context, invoice model.Invoice) (model.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if invoice.InvoiceID == uuid.Nil {
+		invoice.InvoiceID = uuid.New()
+	}
+	if invoice.TenantID == "" {
+		invoice.TenantID = model.DefaultTenantID
+	}
+	if invoice.InvoiceNumber == "" {
+		invoice.InvoiceNumber = fmt.Sprintf("INV-%s-%d",
+			time.Now().Format("20060102"),
+			time.Now().UnixNano()%1000000)
+	}
+
+	for _, existing := range s.invoices {
+		switch {
+		case existing.InvoiceID == invoice.InvoiceID:
+			return model.Invoice{}, fmt.Errorf("failed to create invoice: %w: invoices_pkey", ErrDuplicate)
+		case existing.InvoiceNumber == invoice.InvoiceNumber:
+			return model.Invoice{}, fmt.Errorf("failed to create invoice: %w: invoices_invoice_number_key", ErrDuplicate)
+		case invoice.VNPayTxnRef != "" && existing.TenantID == invoice.TenantID && existing.VNPayTxnRef == invoice.VNPayTxnRef:
+			return model.Invoice{}, fmt.Errorf("failed to create invoice: %w: idx_invoices_tenant_vnpay_txn_ref", ErrDuplicate)
+		}
+	}
+
+	now := s.now()
+	invoice.CreatedAt = now
+	invoice.UpdatedAt = now
+	s.invoices[invoice.InvoiceID] = invoice
+
+	return invoice, nil
+}
+
+// GetInvoiceByID retrieves a tenant's invoice by ID
+func (s *MemoryInvoiceStore) GetInvoiceByID(ctx context.Context, tenantID string, id uuid.UUID) (model.Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invoice, ok := s.invoices[id]
+	if !ok || invoice.TenantID != tenantID {
+		return model.Invoice{}, fmt.Errorf("failed to get invoice: %w", ErrNotFound)
+	}
+
+	return invoice, nil
+}
+
+// GetInvoiceByVNPayTxnRef retrieves a tenant's invoice by VNPay transaction reference
+func (s *MemoryInvoiceStore) GetInvoiceByVNPayTxnRef(ctx context.Context, tenantID string, txnRef string) (model.Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invoice, ok := s.findByTxnRef(tenantID, txnRef)
+	if !ok {
+		return model.Invoice{}, fmt.Errorf("failed to get invoice by VNPay reference: %w", ErrNotFound)
+	}
+
+	return invoice, nil
+}
+
+// GetInvoiceByIDForUpdate retrieves a tenant's invoice by ID. MemoryStore
+// transactions are serialized, so no row lock is needed.
+func (s *MemoryInvoiceStore) GetInvoiceByIDForUpdate(ctx context.Context, tenantID string, id uuid.UUID) (model.Invoice, error) {
+	return s.GetInvoiceByID(ctx, tenantID, id)
+}
+
+// GetInvoiceByVNPayTxnRefForUpdate retrieves a tenant's invoice by VNPay
+// transaction reference. MemoryStore transactions are serialized, so no row
+// lock is needed.
+func (s *MemoryInvoiceStore) GetInvoiceByVNPayTxnRefForUpdate(ctx context.Context, tenantID string, txnRef string) (model.Invoice, error) {
+	return s.GetInvoiceByVNPayTxnRef(ctx, tenantID, txnRef)
+}
+
+// UpdateInvoicePaymentStatus updates a tenant's invoice payment status and the
+// VNPay information given; fields missing from vnpayData are kept
+func (s *MemoryInvoiceStore) UpdateInvoicePaymentStatus(ctx context.Context, tenantID string, txnRef string, status model.PaymentStatus, vnpayData map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoice, ok := s.findByTxnRef(tenantID, txnRef)
+	if !ok {
+		return fmt.Errorf("failed to update invoice payment status: %w", ErrNotFound)
+	}
+
+	invoice.PaymentStatus = status
+	for key, field := range map[string]*string{
+		"bankCode":      &invoice.VNPayBankCode,
+		"transactionNo": &invoice.VNPayTxnNo,
+		"payDate":       &invoice.VNPayPayDate,
+		"cardType":      &invoice.VNPayCardType,
+	} {
+		if value := vnpayData[key]; value != "" {
+			*field = value
+		}
+	}
+	invoice.UpdatedAt = s.now()
+	s.invoices[invoice.InvoiceID] = invoice
+
+	return nil
+}
+
+// SetInvoiceVNPayFee records the merchant fee VNPay charged on a tenant's invoice
+func (s *MemoryInvoiceStore) SetInvoiceVNPayFee(ctx context.Context, tenantID string, id uuid.UUID, fee float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoice, ok := s.invoices[id]
+	if !ok || invoice.TenantID != tenantID {
+		return fmt.Errorf("failed to set invoice VNPay fee: %w", ErrNotFound)
+	}
+
+	invoice.VNPayFee = model.RoundAmount(fee)
+	invoice.UpdatedAt = s.now()
+	s.invoices[id] = invoice
+
+	return nil
+}
+
+// SetInvoiceRefundedAmount records how much of a tenant's invoice has been refunded
+func (s *MemoryInvoiceStore) SetInvoiceRefundedAmount(ctx context.Context, tenantID string, id uuid.UUID, amount float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoice, ok := s.invoices[id]
+	if !ok || invoice.TenantID != tenantID {
+		return fmt.Errorf("failed to set invoice refunded amount: %w", ErrNotFound)
+	}
+
+	invoice.RefundedAmount = model.RoundAmount(amount)
+	invoice.UpdatedAt = s.now()
+	s.invoices[id] = invoice
+
+	return nil
+}
+
+// CancelInvoice sets a tenant's invoice to CANCELLED or VOIDED, recording when and why
+func (s *MemoryInvoiceStore) CancelInvoice(ctx context.Context, tenantID string, id uuid.UUID, status model.PaymentStatus, reason string, cancelledAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoice, ok := s.invoices[id]
+	if !ok || invoice.TenantID != tenantID {
+		return fmt.Errorf("failed to cancel invoice: %w", ErrNotFound)
+	}
+
+	invoice.PaymentStatus = status
+	invoice.CancelReason = reason
+	invoice.CancelledAt = &cancelledAt
+	invoice.UpdatedAt = s.now()
+	s.invoices[id] = invoice
+
+	return nil
+}
+
+// GetInvoicesByCustomerID retrieves all of a tenant's invoices for a customer, newest first
+func (s *MemoryInvoiceStore) GetInvoicesByCustomerID(ctx context.Context, tenantID string, customerID string) ([]model.Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var invoices []model.Invoice
+	for _, invoice := range s.invoices {
+		if invoice.TenantID == tenantID && invoice.CustomerID == customerID {
+			invoices = append(invoices, invoice)
+		}
+	}
+
+	sort.Slice(invoices, func(i, j int) bool {
+		if !invoices[i].CreatedAt.Equal(invoices[j].CreatedAt) {
+			return invoices[i].CreatedAt.After(invoices[j].CreatedAt)
+		}
+		return compareUUID(invoices[i].InvoiceID, invoices[j].InvoiceID) > 0
+	})
+
+	return invoices, nil
+}
+
+// SearchInvoices returns up to filter.Limit of a tenant's invoices matching
+// the filter, starting after filter.After, and the total number of matches
+func (s *MemoryInvoiceStore) SearchInvoices(ctx context.Context, filter model.InvoiceFilter) ([]model.Invoice, int, error) {
+	if _, ok := invoiceSortColumns[filter.SortBy]; !ok {
+		return nil, 0, fmt.Errorf("failed to search invoices: unsupported sort field %q", filter.SortBy)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matches []model.Invoice
+	for _, invoice := range s.invoices {
+		if matchesFilter(invoice, filter) {
+			matches = append(matches, invoice)
+		}
+	}
+
+	// compare orders invoices by the sort field and then by ID, ascending
+	compare := func(a, b model.InvoiceCursor) int {
+		switch {
+		case filter.SortBy == model.InvoiceSortFinalAmount && a.FinalAmount != b.FinalAmount:
+			if a.FinalAmount < b.FinalAmount {
+				return -1
+			}
+			return 1
+		case filter.SortBy == model.InvoiceSortCreatedAt && !a.CreatedAt.Equal(b.CreatedAt):
+			if a.CreatedAt.Before(b.CreatedAt) {
+				return -1
+			}
+			return 1
+		}
+		return compareUUID(a.InvoiceID, b.InvoiceID)
+	}
+	if filter.SortDesc {
+		ascending := compare
+		compare = func(a, b model.InvoiceCursor) int { return -ascending(a, b) }
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return compare(filter.CursorFor(matches[i]), filter.CursorFor(matches[j])) < 0
+	})
+
+	invoices := make([]model.Invoice, 0, filter.Limit)
+	for _, invoice := range matches {
+		if len(invoices) == filter.Limit {
+			break
+		}
+		if filter.After != nil && compare(filter.CursorFor(invoice), *filter.After) <= 0 {
+			continue
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	return invoices, len(matches), nil
+}
+
+// StreamInvoices calls fn with each of a tenant's invoices matching the filter, in the filter's order
+func (s *MemoryInvoiceStore) StreamInvoices(ctx context.Context, filter model.InvoiceFilter, fn func(model.Invoice) error) error {
+	s.mu.RLock()
+	filter.Limit = len(s.invoices)
+	s.mu.RUnlock()
+	filter.After = nil
+
+	invoices, _, err := s.SearchInvoices(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to stream invoices: %w", err)
+	}
+
+	for _, invoice := range invoices {
+		if err := fn(invoice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchesFilter reports whether an invoice satisfies every condition of a search filter
+func matchesFilter(invoice model.Invoice, filter model.InvoiceFilter) bool {
+	if invoice.TenantID != filter.TenantID {
+		return false
+	}
+	if len(filter.Statuses) > 0 {
+		found := false
+		for _, status := range filter.Statuses {
+			if invoice.PaymentStatus == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch {
+	case filter.CustomerID != "" && invoice.CustomerID != filter.CustomerID,
+		filter.TicketID != "" && invoice.TicketID != filter.TicketID,
+		filter.BankCode != "" && invoice.VNPayBankCode != filter.BankCode,
+		filter.InvoiceType != "" && invoice.InvoiceType != filter.InvoiceType,
+		filter.CreatedFrom != nil && invoice.CreatedAt.Before(*filter.CreatedFrom),
+		filter.CreatedTo != nil && !invoice.CreatedAt.Before(*filter.CreatedTo),
+		filter.MinAmount != nil && invoice.FinalAmount < *filter.MinAmount,
+		filter.MaxAmount != nil && invoice.FinalAmount > *filter.MaxAmount:
+		return false
+	}
+	return true
+}
+
+// GetExpiredPendingInvoices retrieves up to limit pending invoices of any
+// tenant created before the given time, oldest first
+func (s *MemoryInvoiceStore) GetExpiredPendingInvoices(ctx context.Context, createdBefore time.Time, limit int) ([]model.Invoice, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var invoices []model.Invoice
+	for _, invoice := range s.invoices {
+		if invoice.PaymentStatus == model.PaymentStatusPending && invoice.CreatedAt.Before(createdBefore) && invoice.VNPayTxnRef != "" {
+			invoices = append(invoices, invoice)
+		}
+	}
+
+	sort.Slice(invoices, func(i, j int) bool {
+		if !invoices[i].CreatedAt.Equal(invoices[j].CreatedAt) {
+			return invoices[i].CreatedAt.Before(invoices[j].CreatedAt)
+		}
+		return compareUUID(invoices[i].InvoiceID, invoices[j].InvoiceID) < 0
+	})
+	if len(invoices) > limit {
+		invoices = invoices[:limit]
+	}
+
+	return invoices, nil
+}
+
+// CreateInvoiceItems stores the lines of an existing invoice
+func (s *MemoryInvoiceStore) CreateInvoiceItems(ctx context.Context, invoiceID uuid.UUID, items []model.InvoiceItem) ([]model.InvoiceItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.invoices[invoiceID]; !ok {
+		return nil, fmt.Errorf("failed to create invoice items: %w: invoice_items_invoice_id_fkey", ErrNotFound)
+	}
+
+	stored := append([]model.InvoiceItem(nil), s.items[invoiceID]...)
+	created := make([]model.InvoiceItem, 0, len(items))
+	for _, item := range items {
+		if item.ItemID == uuid.Nil {
+			item.ItemID = uuid.New()
+		}
+		item.InvoiceID = invoiceID
+
+		for _, existing := range stored {
+			if existing.LineNumber == item.LineNumber {
+				return nil, fmt.Errorf("failed to create invoice item %d: %w: invoice_items_invoice_id_line_number_key", item.LineNumber, ErrDuplicate)
+			}
+		}
+		stored = append(stored, item)
+		created = append(created, item)
+	}
+
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].LineNumber < stored[j].LineNumber
+	})
+	s.items[invoiceID] = stored
+
+	return created, nil
+}
+
+// GetInvoiceItems retrieves the lines of the given invoices, ordered by line number
+func (s *MemoryInvoiceStore) GetInvoiceItems(ctx context.Context, invoiceIDs []uuid.UUID) (map[uuid.UUID][]model.InvoiceItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := make(map[uuid.UUID][]model.InvoiceItem)
+	for _, id := range invoiceIDs {
+		if stored, ok := s.items[id]; ok {
+			items[id] = append([]model.InvoiceItem(nil), stored...)
+		}
+	}
+	return items, nil
+}
+
+// NextEInvoiceNumber reserves the next e-invoice number of a tenant's series
+func (s *MemoryInvoiceStore) NextEInvoiceNumber(ctx context.Context, tenantID string, series string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := [2]string{tenantID, series}
+	s.sequences[key]++
+	return s.sequences[key], nil
+}
+
+// SetEInvoiceNumber records the e-invoice number issued for a tenant's invoice
+func (s *MemoryInvoiceStore) SetEInvoiceNumber(ctx context.Context, tenantID string, id uuid.UUID, series string, number int, issuedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invoice, ok := s.invoices[id]
+	if !ok || invoice.TenantID != tenantID || invoice.EInvoiceNumber != 0 {
+		return fmt.Errorf("failed to set e-invoice number: %w", ErrNotFound)
+	}
+
+	for _, existing := range s.invoices {
+		if existing.TenantID == tenantID && existing.EInvoiceSeries == series && existing.EInvoiceNumber == number {
+			return fmt.Errorf("failed to set e-invoice number: %w: idx_invoices_tenant_einvoice_number", ErrDuplicate)
+		}
+	}
+
+	invoice.EInvoiceSeries = series
+	invoice.EInvoiceNumber = number
+	invoice.EInvoiceIssuedAt = &issuedAt
+	invoice.UpdatedAt = s.now()
+	s.invoices[id] = invoice
+
+	return nil
+}
+
+// CreateInvoiceEvent records an invoice event in the outbox
+func (s *MemoryInvoiceStore) CreateInvoiceEvent(ctx context.Context, event model.InvoiceEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.invoices[event.InvoiceID]; !ok {
+		return fmt.Errorf("failed to create invoice event: %w: invoice_outbox_invoice_id_fkey", ErrNotFound)
+	}
+	for _, existing := range s.events {
+		if existing.event.EventID == event.EventID {
+			return fmt.Errorf("failed to create invoice event: %w: invoice_outbox_pkey", ErrDuplicate)
+		}
+	}
+
+	s.events = append(s.events, memoryInvoiceEvent{event: event})
+	return nil
+}
+
+// GetUnpublishedInvoiceEvents retrieves up to limit events not yet published, oldest first
+func (s *MemoryInvoiceStore) GetUnpublishedInvoiceEvents(ctx context.Context, limit int) ([]model.InvoiceEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []model.InvoiceEvent
+	for _, stored := range s.events {
+		if !stored.published {
+			events = append(events, stored.event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].OccurredAt.Equal(events[j].OccurredAt) {
+			return events[i].OccurredAt.Before(events[j].OccurredAt)
+		}
+		return compareUUID(events[i].EventID, events[j].EventID) < 0
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// MarkInvoiceEventsPublished records that the events were published
+func (s *MemoryInvoiceStore) MarkInvoiceEventsPublished(ctx context.Context, ids []uuid.UUID, publishedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.events {
+		for _, id := range ids {
+			if s.events[i].event.EventID == id {
+				s.events[i].published = true
+			}
+		}
+	}
+	return nil
+}
+
+// AppendInvoiceHistory records a payment status change of an invoice
+func (s *MemoryInvoiceStore) AppendInvoiceHistory(ctx context.Context, entry model.InvoiceHistoryEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.invoices[entry.InvoiceID]; !ok {
+		return fmt.Errorf("failed to append invoice history: %w: invoice_events_invoice_id_fkey", ErrNotFound)
+	}
+
+	// Like a Postgres sequence, IDs are not reused after a rollback
+	s.lastHistoryID++
+	entry.EventID = s.lastHistoryID
+	s.history = append(s.history, entry)
+	return nil
+}
+
+// GetInvoiceHistory retrieves the status history of a tenant's invoice, oldest first
+func (s *MemoryInvoiceStore) GetInvoiceHistory(ctx context.Context, tenantID string, invoiceID uuid.UUID) ([]model.InvoiceHistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := []model.InvoiceHistoryEntry{}
+	for _, entry := range s.history {
+		if entry.TenantID == tenantID && entry.InvoiceID == invoiceID {
+			history = append(history, entry)
+		}
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		if !history[i].CreatedAt.Equal(history[j].CreatedAt) {
+			return history[i].CreatedAt.Before(history[j].CreatedAt)
+		}
+		return history[i].EventID < history[j].EventID
+	})
+	return history, nil
+}
+
+// findByTxnRef finds a tenant's invoice by VNPay reference; the caller must hold the lock
+func (s *MemoryInvoiceStore) findByTxnRef(tenantID string, txnRef string) (model.Invoice, bool) {
+	if txnRef == "" {
+		return model.Invoice{}, false
+	}
+	for _, invoice := range s.invoices {
+		if invoice.TenantID == tenantID && invoice.VNPayTxnRef == txnRef {
+			return invoice, true
+		}
+	}
+	return model.Invoice{}, false
+}
+
+// compareUUID orders UUIDs bytewise, matching Postgres' uuid ordering
+func compareUUID(a, b uuid.UUID) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// MemoryStore is an in-memory Store. Transactions run one at a time and
+// restore a snapshot of the invoices when they fail, which gives them the
+// isolation and atomicity of the Postgres store for tests.
+type MemoryStore struct {
+	txMu     sync.Mutex
+	invoices *MemoryInvoiceStore
+}
+
+// NewMemoryStore creates a store around an in-memory invoice store
+func NewMemoryStore(invoices *MemoryInvoiceStore) *MemoryStore {
+	return &MemoryStore{invoices: invoices}
+}
+
+// Invoices returns the in-memory invoice store
+func (s *MemoryStore) Invoices() InvoiceStore {
+	return s.invoices
+}
+
+// Ledger returns the in-memory ledger, kept by the invoice store
+func (s *MemoryStore) Ledger() LedgerStore {
+	return s.invoices
+}
+
+// WithTx runs fn while holding the transaction lock, rolling back its
+// changes when it returns an error
+func (s *MemoryStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	snapshot := s.invoices.snapshot()
+	if err := fn(memoryTxStore{s}); err != nil {
+		s.invoices.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+// memoryTxStore is the Store handed to a MemoryStore unit of work
+type memoryTxStore struct {
+	store *MemoryStore
+}
+
+// Invoices returns the in-memory invoice store
+func (s memoryTxStore) Invoices() InvoiceStore {
+	return s.store.invoices
+}
+
+// Ledger returns the in-memory ledger
+func (s memoryTxStore) Ledger() LedgerStore {
+	return s.store.invoices
+}
+
+// WithTx joins the surrounding transaction
+func (s memoryTxStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return fn(s)
+}
+
+// memorySnapshot is a copy of the contents of a MemoryInvoiceStore
+type memorySnapshot struct {
+	invoices  map[uuid.UUID]model.Invoice
+	items     map[uuid.UUID][]model.InvoiceItem
+	sequences map[[2]string]int
+	events    []memoryInvoiceEvent
+	history   []model.InvoiceHistoryEntry
+	ledger    []model.LedgerTransaction
+}
+
+// snapshot copies the stored invoices and items
+func (s *MemoryInvoiceStore) snapshot() memorySnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot := memorySnapshot{
+		invoices:  make(map[uuid.UUID]model.Invoice, len(s.invoices)),
+		items:     make(map[uuid.UUID][]model.InvoiceItem, len(s.items)),
+		sequences: make(map[[2]string]int, len(s.sequences)),
+		events:    append([]memoryInvoiceEvent(nil), s.events...),
+		history:   append([]model.InvoiceHistoryEntry(nil), s.history...),
+		ledger:    append([]model.LedgerTransaction(nil), s.ledger...),
+	}
+	for id, invoice := range s.invoices {
+		snapshot.invoices[id] = invoice
+	}
+	for id, items := range s.items {
+		snapshot.items[id] = items
+	}
+	for key, number := range s.sequences {
+		snapshot.sequences[key] = number
+	}
+	return snapshot
+}
+
+// restore replaces the stored invoices and items with a snapshot
+func (s *MemoryInvoiceStore) restore(snapshot memorySnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invoices = snapshot.invoices
+	s.items = snapshot.items
+	s.sequences = snapshot.sequences
+	s.events = snapshot.events
+	s.history = snapshot.history
+	s.ledger = snapshot.ledger
+}
+
+// MemoryMerchantStore is an in-memory MerchantStore for tests and local development
+type MemoryMerchantStore struct {
+	mu        sync.RWMutex
+	merchants map[string]model.Merchant
+	feeRules  []model.VNPayFeeRule
+}
+
+// NewMemoryMerchantStore creates an in-memory merchant store holding merchants
+func NewMemoryMerchantStore(merchants ...model.Merchant) *MemoryMerchantStore {
+	s := &MemoryMerchantStore{merchants: make(map[string]model.Merchant)}
+	for _, merchant := range merchants {
+		s.merchants[merchant.TenantID] = merchant
+	}
+	return s
+}
+
+// GetMerchantByTenantID retrieves the merchant registered for a tenant
+func (s *MemoryMerchantStore) GetMerchantByTenantID(ctx context.Context, tenantID string) (model.Merchant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	merchant, ok := s.merchants[tenantID]
+	if !ok {
+		return model.Merchant{}, fmt.Errorf("failed to get merchant for tenant %s: %w", tenantID, ErrNotFound)
+	}
+	return merchant, nil
+}
+
+// GetMerchantByTmnCode retrieves the merchant owning a VNPay terminal code
+func (s *MemoryMerchantStore) GetMerchantByTmnCode(ctx context.Context, tmnCode string) (model.Merchant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, merchant := range s.merchants {
+		if merchant.TmnCode == tmnCode {
+			return merchant, nil
+		}
+	}
+	return model.Merchant{}, fmt.Errorf("failed to get merchant for terminal %s: %w", tmnCode, ErrNotFound)
+}
+
+// AddVNPayFeeRules registers fee rules VNPay charges tenants
+func (s *MemoryMerchantStore) AddVNPayFeeRules(rules ...model.VNPayFeeRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.feeRules = append(s.feeRules, rules...)
+}
+
+// GetVNPayFeeRules retrieves the fee rules VNPay charges a tenant
+func (s *MemoryMerchantStore) GetVNPayFeeRules(ctx context.Context, tenantID string) ([]model.VNPayFeeRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rules []model.VNPayFeeRule
+	for _, rule := range s.feeRules {
+		if rule.TenantID == tenantID {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// Compile-time checks that the in-memory stores satisfy the store interfaces
+var (
+	_ InvoiceStore  = (*MemoryInvoiceStore)(nil)
+	_ LedgerStore   = (*MemoryInvoiceStore)(nil)
+	_ MerchantStore = (*MemoryMerchantStore)(nil)
+	_ APIKeyStore   = (*MemoryAPIKeyStore)(nil)
+	_ Store         = (*MemoryStore)(nil)
+	_ Store         = memoryTxStore{}
+)
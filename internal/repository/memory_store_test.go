@@ -0,0 +1,20 @@
+package repository_test
+
+import (
+	"testing"
+
+	"payment_service/internal/repository"
+	"payment_service/internal/repository/storetest"
+)
+
+func TestMemoryInvoiceStore(t *testing.T) {
+	storetest.RunInvoiceStoreTests(t, func(t *testing.T) repository.InvoiceStore {
+		return repository.NewMemoryInvoiceStore()
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	storetest.RunStoreTests(t, func(t *testing.T) repository.Store {
+		return repository.NewMemoryStore(repository.NewMemoryInvoiceStore())
+	})
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"payment_service/domain/model"
+)
+
+// MerchantRepository handles merchant database operations
+type MerchantRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewMerchantRepository creates a new merchant repository
+func NewMerchantRepository(db *pgxpool.Pool) *MerchantRepository {
+	return &MerchantRepository{
+		db: db,
+	}
+}
+
+const merchantColumns = `
+	tenant_id, name, tmn_code, hash_secret,
+	COALESCE(secondary_hash_secrets, '{}'), secondary_secrets_expire_at,
+	COALESCE(return_url, ''), active, created_at, updated_at,
+	COALESCE(legal_name, ''), COALESCE(tax_code, ''), COALESCE(address, ''),
+	COALESCE(phone, ''), COALESCE(email, ''),
+	COALESCE(einvoice_template, ''), COALESCE(einvoice_series, '')
+`
+
+// GetMerchantByTenantID retrieves the merchant registered for a tenant
+func (r *MerchantRepository) GetMerchantByTenantID(ctx context.Context, tenantID string) (model.Merchant, error) {
+	query := `SELECT ` + merchantColumns + ` FROM merchants WHERE tenant_id = $1`
+
+	merchant, err := scanMerchant(r.db.QueryRow(ctx, query, tenantID))
+	if err != nil {
+		return model.Merchant{}, fmt.Errorf("failed to get merchant for tenant %s: %w", tenantID, translateError(err))
+	}
+
+	return merchant, nil
+}
+
+// GetMerchantByTmnCode retrieves the merchant owning a VNPay terminal code
+func (r *MerchantRepository) GetMerchantByTmnCode(ctx context.Context, tmnCode string) (model.Merchant, error) {
+	query := `SELECT ` + merchantColumns + ` FROM merchants WHERE tmn_code = $1`
+
+	merchant, err := scanMerchant(r.db.QueryRow(ctx, query, tmnCode))
+	if err != nil {
+		return model.Merchant{}, fmt.Errorf("failed to get merchant for terminal %s: %w", tmnCode, translateError(err))
+	}
+
+	return merchant, nil
+}
+
+// scanMerchant scans a row selected with merchantColumns
+func scanMerchant(row rowScanner) (model.Merchant, error) {
+	var merchant model.Merchant
+	err := row.Scan(
+		&merchant.TenantID, &merchant.Name, &merchant.TmnCode, &merchant.HashSecret,
+		&merchant.SecondaryHashSecrets, &merchant.SecondarySecretsExpireAt, &merchant.ReturnURL, &merchant.Active, &merchant.CreatedAt, &merchant.UpdatedAt,
+		&merchant.Seller.LegalName, &merchant.Seller.TaxCode, &merchant.Seller.Address,
+		&merchant.Seller.Phone, &merchant.Seller.Email,
+		&merchant.Seller.EInvoiceTemplate, &merchant.Seller.EInvoiceSeries,
+	)
+	return merchant, err
+}
+
+// GetVNPayFeeRules retrieves the fee rules VNPay charges a tenant
+func (r *MerchantRepository) GetVNPayFeeRules(ctx context.Context, tenantID string) ([]model.VNPayFeeRule, error) {
+	query := `
+		SELECT tenant_id, COALESCE(bank_code, ''), COALESCE(card_type, ''),
+			rate_percent::float8, fixed_fee::float8, min_fee::float8
+		FROM vnpay_fee_rules
+		WHERE tenant_id = $1
+		ORDER BY rule_id
+	`
+
+	rows, err := r.db.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query VNPay fee rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []model.VNPayFeeRule
+	for rows.Next() {
+		var rule model.VNPayFeeRule
+		err := rows.Scan(&rule.TenantID, &rule.BankCode, &rule.CardType, &rule.RatePercent, &rule.FixedFee, &rule.MinFee)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan VNPay fee rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over VNPay fee rules: %w", err)
+	}
+
+	return rules, nil
+}
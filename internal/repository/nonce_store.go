@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"payment_service/pkg/utils"
+)
+
+// nonceKeyPrefix namespaces request nonces in Redis
+const nonceKeyPrefix = "payment_service:nonce:"
+
+// RedisNonceStore is a NonceStore shared by every instance of the service
+type RedisNonceStore struct {
+	client *redis.Client
+}
+
+// NewRedisNonceStore creates a new Redis nonce store
+func NewRedisNonceStore(client *redis.Client) *RedisNonceStore {
+	return &RedisNonceStore{
+		client: client,
+	}
+}
+
+// UseNonce records a nonce for ttl unless it is already recorded
+func (s *RedisNonceStore) UseNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	unused, err := s.client.SetNX(ctx, nonceKeyPrefix+nonce, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to record nonce: %w", err)
+	}
+	return unused, nil
+}
+
+// MemoryNonceStore is an in-memory NonceStore for tests and single instances
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	now    func() time.Time
+	pruned time.Time
+}
+
+// NewMemoryNonceStore creates an empty in-memory nonce store
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		nonces: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+// noncePruneInterval is how often expired nonces are dropped
+const noncePruneInterval = time.Minute
+
+// UseNonce records a nonce for ttl unless it is already recorded and unexpired
+func (s *MemoryNonceStore) UseNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.pruned) > noncePruneInterval {
+		for recorded, expiresAt := range s.nonces {
+			if !now.Before(expiresAt) {
+				delete(s.nonces, recorded)
+			}
+		}
+		s.pruned = now
+	}
+	if expiresAt, ok := s.nonces[nonce]; ok && now.Before(expiresAt) {
+		return false, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// nonceTimeout bounds how long a request waits on the primary nonce store
+// before falling back, so an unreachable Redis does not stall requests
+const nonceTimeout = 250 * time.Millisecond
+
+// FallbackNonceStore uses a primary nonce store, falling back to another
+// while the primary fails, so signed requests are still accepted and replays
+// to the same instance rejected when Redis is unavailable
+type FallbackNonceStore struct {
+	primary  NonceStore
+	fallback NonceStore
+	logger   utils.Logger
+	degraded atomic.Bool
+}
+
+// NewFallbackNonceStore creates a new nonce store using primary, or fallback
+// when primary fails
+func NewFallbackNonceStore(primary, fallback NonceStore, logger utils.Logger) *FallbackNonceStore {
+	return &FallbackNonceStore{
+		primary:  primary,
+		fallback: fallback,
+		logger:   logger,
+	}
+}
+
+// UseNonce records a nonce in the primary store, or the fallback if it fails
+func (s *FallbackNonceStore) UseNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	primaryCtx, cancel := context.WithTimeout(ctx, nonceTimeout)
+	defer cancel()
+
+	unused, err := s.primary.UseNonce(primaryCtx, nonce, ttl)
+	if err == nil {
+		if s.degraded.Swap(false) {
+			s.logger.Info("Replay protection recovered; nonces are shared again")
+		}
+		return unused, nil
+	}
+
+	if !s.degraded.Swap(true) {
+		s.logger.Error("Replay protection falls back to per-instance nonces: %v", err)
+	}
+	return s.fallback.UseNonce(ctx, nonce, ttl)
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"payment_service/pkg/utils"
+)
+
+func TestMemoryNonceStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryNonceStore()
+	store.now = func() time.Time { return now }
+
+	use := func(nonce string, want bool) {
+		t.Helper()
+		if unused, err := store.UseNonce(ctx, nonce, 30*time.Second); err != nil || unused != want {
+			t.Errorf("UseNonce(%s) = %t, %v, want %t", nonce, unused, err, want)
+		}
+	}
+
+	use("a", true)
+	use("a", false)
+	use("b", true)
+
+	// An expired nonce may be used again even before it is pruned
+	now = now.Add(30 * time.Second)
+	use("a", true)
+	if len(store.nonces) != 2 {
+		t.Errorf("store holds %d nonces, want 2 until the next prune", len(store.nonces))
+	}
+
+	// Expired nonces are dropped once the prune interval has passed
+	now = now.Add(noncePruneInterval + time.Second)
+	use("c", true)
+	if len(store.nonces) != 1 {
+		t.Errorf("store holds %d nonces after pruning, want 1", len(store.nonces))
+	}
+}
+
+// failingNonceStore is a nonce store whose backend is unreachable
+type failingNonceStore struct{}
+
+func (failingNonceStore) UseNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestFallbackNonceStore(t *testing.T) {
+	ctx := context.Background()
+	primary := NewMemoryNonceStore()
+	store := NewFallbackNonceStore(failingNonceStore{}, NewMemoryNonceStore(), utils.NewDefaultLogger())
+
+	// While the primary fails, the fallback still rejects replays
+	if unused, err := store.UseNonce(ctx, "a", time.Minute); err != nil || !unused {
+		t.Fatalf("UseNonce = %t, %v, want recorded by the fallback", unused, err)
+	}
+	if unused, err := store.UseNonce(ctx, "a", time.Minute); err != nil || unused {
+		t.Errorf("replayed UseNonce = %t, %v, want rejected by the fallback", unused, err)
+	}
+
+	// Once the primary answers, nonces are recorded there again
+	store.primary = primary
+	if unused, err := store.UseNonce(ctx, "b", time.Minute); err != nil || !unused {
+		t.Fatalf("UseNonce after recovery = %t, %v", unused, err)
+	}
+	if unused, _ := primary.UseNonce(ctx, "b", time.Minute); unused {
+		t.Error("nonce used after recovery was not recorded in the primary store")
+	}
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+
+	"payment_service/domain/model"
+)
+
+// Errors returned by every store implementation
+var (
+	// ErrNotFound is returned when no record matches the lookup or update
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate is returned when a record violates a uniqueness constraint
+	ErrDuplicate = errors.New("duplicate record")
+)
+
+// InvoiceStore persists invoices. Every lookup and update is scoped to a
+// tenant, except the expiry sweep which spans all tenants.
+//
+// Implementations must return ErrNotFound when no invoice matches, and
+// ErrDuplicate when an invoice ID, invoice number or (tenant, VNPay
+// transaction reference) pair already exists. Customer listings are ordered
+// newest first. Searches return at most filter.Limit invoices following
+// filter.After, together with the number of invoices matching the filter;
+// streams visit every match in the same order, ignoring Limit and After.
+// Invoice items must belong to an existing invoice (ErrNotFound otherwise)
+// and are returned in line number order. Payment status updates change only
+// the VNPay fields given a non-empty value. E-invoice numbers count up from 1
+// per tenant and series, and an invoice's number is set only once. Invoice
+// events must belong to an existing invoice and are returned oldest first
+// until marked published. History entries must belong to an existing invoice
+// (ErrNotFound otherwise) and are returned oldest first.
+// The ForUpdate lookups, GetExpiredPendingInvoices and
+// GetUnpublishedInvoiceEvents lock the rows they return until the
+// surrounding Store.WithTx transaction ends.
+type InvoiceStore interface {
+	CreateInvoice(ctx context.Context, invoice model.Invoice) (model.Invoice, error)
+	GetInvoiceByID(ctx context.Context, tenantID string, id uuid.UUID) (model.Invoice, error)
+	GetInvoiceByIDForUpdate(ctx context.Context, tenantID string, id uuid.UUID) (model.Invoice, error)
+	GetInvoiceByVNPayTxnRef(ctx context.Context, tenantID string, txnRef string) (model.Invoice, error)
+	GetInvoiceByVNPayTxnRefForUpdate(ctx context.Context, tenantID string, txnRef string) (model.Invoice, error)
+	UpdateInvoicePaymentStatus(ctx context.Context, tenantID string, txnRef string, status model.PaymentStatus, vnpayData map[string]string) error
+	SetInvoiceVNPayFee(ctx context.Context, tenantID string, id uuid.UUID, fee float64) error
+	SetInvoiceRefundedAmount(ctx context.Context, tenantID string, id uuid.UUID, amount float64) error
+	CancelInvoice(ctx context.Context, tenantID string, id uuid.UUID, status model.PaymentStatus, reason string, cancelledAt time.Time) error
+	GetInvoicesByCustomerID(ctx context.Context, tenantID string, customerID string) ([]model.Invoice, error)
+	SearchInvoices(ctx context.Context, filter model.InvoiceFilter) ([]model.Invoice, int, error)
+	GetExpiredPendingInvoices(ctx context.Context, createdBefore time.Time, limit int) ([]model.Invoice, error)
+	CreateInvoiceItems(ctx context.Context, invoiceID uuid.UUID, items []model.InvoiceItem) ([]model.InvoiceItem, error)
+	GetInvoiceItems(ctx context.Context, invoiceIDs []uuid.UUID) (map[uuid.UUID][]model.InvoiceItem, error)
+	StreamInvoices(ctx context.Context, filter model.InvoiceFilter, fn func(model.Invoice) error) error
+	NextEInvoiceNumber(ctx context.Context, tenantID string, series string) (int, error)
+	SetEInvoiceNumber(ctx context.Context, tenantID string, id uuid.UUID, series string, number int, issuedAt time.Time) error
+	CreateInvoiceEvent(ctx context.Context, event model.InvoiceEvent) error
+	GetUnpublishedInvoiceEvents(ctx context.Context, limit int) ([]model.InvoiceEvent, error)
+	MarkInvoiceEventsPublished(ctx context.Context, ids []uuid.UUID, publishedAt time.Time) error
+	AppendInvoiceHistory(ctx context.Context, entry model.InvoiceHistoryEntry) error
+	GetInvoiceHistory(ctx context.Context, tenantID string, invoiceID uuid.UUID) ([]model.InvoiceHistoryEntry, error)
+}
+
+// LedgerStore persists the double-entry ledger. Ledger transactions are
+// append-only and are posted together with their entries.
+//
+// Implementations must return ErrDuplicate when a tenant already has a
+// transaction of the same kind and reference, and ErrNotFound when a
+// transaction refers to a missing invoice. Streams visit a tenant's
+// transactions oldest first, with their entries in posting order.
+type LedgerStore interface {
+	PostLedgerTransaction(ctx context.Context, txn model.LedgerTransaction) error
+	GetLedgerBalances(ctx context.Context, tenantID string, before time.Time) ([]model.LedgerBalance, error)
+	StreamLedgerTransactions(ctx context.Context, tenantID string, fn func(model.LedgerTransaction) error) error
+	LedgerTransactionExists(ctx context.Context, tenantID string, kind model.LedgerTransactionKind, reference string) (bool, error)
+}
+
+// Store gives access to the stores sharing one database and runs units of
+// work across them in a transaction
+type Store interface {
+	Invoices() InvoiceStore
+	Ledger() LedgerStore
+
+	// WithTx runs fn in a transaction, committing when it returns nil and
+	// rolling back otherwise. Rows read with the ForUpdate lookups stay locked
+	// until the transaction ends. fn is retried from the start when the
+	// database aborts the transaction with a serialization failure or
+	// deadlock, so it must not have side effects outside tx. Calling WithTx on
+	// the tx store joins the surrounding transaction.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+// MerchantStore looks up the merchants registered for tenants and the fee
+// rules VNPay charges them
+type MerchantStore interface {
+	GetMerchantByTenantID(ctx context.Context, tenantID string) (model.Merchant, error)
+	GetMerchantByTmnCode(ctx context.Context, tmnCode string) (model.Merchant, error)
+	GetVNPayFeeRules(ctx context.Context, tenantID string) ([]model.VNPayFeeRule, error)
+}
+
+// APIKeyStore persists the API keys services authenticate with. Keys are
+// stored and looked up by the hash of the key.
+//
+// Implementations must return ErrDuplicate when a key ID or hash already
+// exists, and ErrNotFound when no key matches. Listings are ordered oldest first.
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key model.APIKey, keyHash string) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (model.APIKey, error)
+	ListAPIKeys(ctx context.Context, tenantID string) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, keyID uuid.UUID, revokedAt time.Time) error
+}
+
+// NonceStore remembers the nonces of signed requests so replays can be rejected
+type NonceStore interface {
+	// UseNonce records a nonce for ttl and reports whether it was unused
+	UseNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// Compile-time checks that the Postgres repositories satisfy the store interfaces
+var (
+	_ InvoiceStore  = (*InvoiceRepository)(nil)
+	_ LedgerStore   = (*LedgerRepository)(nil)
+	_ MerchantStore = (*MerchantRepository)(nil)
+	_ APIKeyStore   = (*APIKeyRepository)(nil)
+	_ NonceStore    = (*RedisNonceStore)(nil)
+)
+
+// translateError maps Postgres errors onto the store errors
+func translateError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505": // unique_violation
+			return fmt.Errorf("%w: %s", ErrDuplicate, pgErr.ConstraintName)
+		case "23503": // foreign_key_violation
+			return fmt.Errorf("%w: %s", ErrNotFound, pgErr.ConstraintName)
+		}
+	}
+
+	return err
+}
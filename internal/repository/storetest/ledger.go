@@ -0,0 +1,164 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+)
+
+// newPayment builds the ledger transaction of an invoice's payment
+func newPayment(invoice model.Invoice, postedAt time.Time) model.LedgerTransaction {
+	return model.LedgerTransaction{
+		TransactionID: uuid.New(),
+		TenantID:      invoice.TenantID,
+		Kind:          model.LedgerPayment,
+		Reference:     invoice.InvoiceID.String(),
+		InvoiceID:     &invoice.InvoiceID,
+		Description:   "Payment of " + invoice.InvoiceNumber,
+		PostedAt:      postedAt,
+		Entries: []model.LedgerEntry{
+			{Account: model.LedgerAccountVNPayClearing, Debit: invoice.FinalAmount},
+			{Account: model.LedgerAccountRevenue, Credit: invoice.FinalAmount},
+		},
+	}
+}
+
+func testLedger(t *testing.T, store repository.Store) {
+	ctx := context.Background()
+	ledger := store.Ledger()
+	invoice := mustCreate(t, store.Invoices(), newInvoice("tenant-a", "customer-1", "7000001"))
+
+	base := time.Now().UTC().Truncate(time.Second)
+	payment := newPayment(invoice, base)
+	if err := ledger.PostLedgerTransaction(ctx, payment); err != nil {
+		t.Fatalf("PostLedgerTransaction: %v", err)
+	}
+	settlement := model.LedgerTransaction{
+		TransactionID: uuid.New(),
+		TenantID:      "tenant-a",
+		Kind:          model.LedgerSettlement,
+		Reference:     "STL-001",
+		PostedAt:      base.Add(time.Hour),
+		Entries: []model.LedgerEntry{
+			{Account: model.LedgerAccountBank, Debit: 93100},
+			{Account: model.LedgerAccountFees, Debit: 1900},
+			{Account: model.LedgerAccountVNPayClearing, Credit: 95000},
+		},
+	}
+	if err := ledger.PostLedgerTransaction(ctx, settlement); err != nil {
+		t.Fatalf("PostLedgerTransaction: %v", err)
+	}
+
+	// A reference is posted once per kind
+	duplicate := newPayment(invoice, base)
+	if err := ledger.PostLedgerTransaction(ctx, duplicate); !errors.Is(err, repository.ErrDuplicate) {
+		t.Errorf("duplicate payment error = %v, want ErrDuplicate", err)
+	}
+	orphan := newPayment(newInvoice("tenant-a", "customer-1", "7000002"), base)
+	if err := ledger.PostLedgerTransaction(ctx, orphan); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("payment of a missing invoice error = %v, want ErrNotFound", err)
+	}
+
+	// Balances only count entries posted before the given time
+	balances, err := ledger.GetLedgerBalances(ctx, "tenant-a", base.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetLedgerBalances: %v", err)
+	}
+	if len(balances) != 2 || balances[0].Account != model.LedgerAccountRevenue || balances[0].Credit != 95000 ||
+		balances[1].Account != model.LedgerAccountVNPayClearing || balances[1].Debit != 95000 {
+		t.Errorf("balances before the settlement = %+v", balances)
+	}
+
+	balances, err = ledger.GetLedgerBalances(ctx, "tenant-a", base.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("GetLedgerBalances: %v", err)
+	}
+	got := make(map[model.LedgerAccount]model.LedgerBalance)
+	for _, balance := range balances {
+		got[balance.Account] = balance
+	}
+	if clearing := got[model.LedgerAccountVNPayClearing]; clearing.Debit != 95000 || clearing.Credit != 95000 {
+		t.Errorf("vnpay_clearing after the settlement = %+v, want settled", clearing)
+	}
+	if got[model.LedgerAccountBank].Debit != 93100 || got[model.LedgerAccountFees].Debit != 1900 {
+		t.Errorf("balances after the settlement = %+v", balances)
+	}
+
+	for _, tt := range []struct {
+		tenantID  string
+		kind      model.LedgerTransactionKind
+		reference string
+		want      bool
+	}{
+		{"tenant-a", model.LedgerPayment, invoice.InvoiceID.String(), true},
+		{"tenant-a", model.LedgerRefund, invoice.InvoiceID.String(), false},
+		{"tenant-b", model.LedgerPayment, invoice.InvoiceID.String(), false},
+	} {
+		if exists, err := ledger.LedgerTransactionExists(ctx, tt.tenantID, tt.kind, tt.reference); err != nil || exists != tt.want {
+			t.Errorf("LedgerTransactionExists(%s, %s) = %t, %v, want %t", tt.tenantID, tt.kind, exists, err, tt.want)
+		}
+	}
+
+	if balances, err := ledger.GetLedgerBalances(ctx, "tenant-b", base.Add(2*time.Hour)); err != nil || len(balances) != 0 {
+		t.Errorf("another tenant's balances = %v, %v, want none", balances, err)
+	}
+
+	var streamed []model.LedgerTransaction
+	err = ledger.StreamLedgerTransactions(ctx, "tenant-a", func(txn model.LedgerTransaction) error {
+		streamed = append(streamed, txn)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamLedgerTransactions: %v", err)
+	}
+	if len(streamed) != 2 || streamed[0].TransactionID != payment.TransactionID || streamed[1].TransactionID != settlement.TransactionID {
+		t.Fatalf("streamed %v, want the payment and the settlement", streamed)
+	}
+	if txn := streamed[0]; txn.InvoiceID == nil || *txn.InvoiceID != invoice.InvoiceID || txn.Description != payment.Description ||
+		!txn.PostedAt.Equal(base) || len(txn.Entries) != 2 || txn.Entries[0] != payment.Entries[0] {
+		t.Errorf("streamed payment = %+v, want %+v", txn, payment)
+	}
+	if txn := streamed[1]; txn.InvoiceID != nil || len(txn.Entries) != 3 || txn.Entries[2] != settlement.Entries[2] {
+		t.Errorf("streamed settlement = %+v, want %+v", txn, settlement)
+	}
+}
+
+func testLedgerRollback(t *testing.T, store repository.Store) {
+	ctx := context.Background()
+	invoice := mustCreate(t, store.Invoices(), newInvoice("tenant-a", "customer-1", "7000001"))
+	postedAt := time.Now().UTC().Truncate(time.Second)
+
+	err := store.WithTx(ctx, func(tx repository.Store) error {
+		if err := tx.Ledger().PostLedgerTransaction(ctx, newPayment(invoice, postedAt)); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx error = %v, want errAbort", err)
+	}
+
+	balances, err := store.Ledger().GetLedgerBalances(ctx, "tenant-a", postedAt.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetLedgerBalances: %v", err)
+	}
+	if len(balances) != 0 {
+		t.Errorf("balances after rollback = %v, want none", balances)
+	}
+
+	// An unbalanced transaction is rejected, at the latest when it commits
+	err = store.WithTx(ctx, func(tx repository.Store) error {
+		unbalanced := newPayment(invoice, postedAt)
+		unbalanced.Entries[1].Credit = 90000
+		return tx.Ledger().PostLedgerTransaction(ctx, unbalanced)
+	})
+	if err == nil {
+		t.Error("posting an unbalanced transaction succeeded")
+	}
+}
@@ -0,0 +1,815 @@
+// Package storetest provides a contract test suite shared by every
+// repository.InvoiceStore implementation, so the in-memory store used in
+// service tests is held to the same semantics as Postgres.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+)
+
+// NewInvoiceStore returns an empty store for a single test
+type NewInvoiceStore func(t *testing.T) repository.InvoiceStore
+
+// RunInvoiceStoreTests runs the InvoiceStore contract against stores created by newStore
+func RunInvoiceStoreTests(t *testing.T, newStore NewInvoiceStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store repository.InvoiceStore)
+	}{
+		{"CreateAndGet", testCreateAndGet},
+		{"CreateDefaults", testCreateDefaults},
+		{"NotFound", testNotFound},
+		{"DuplicateInvoiceNumber", testDuplicateInvoiceNumber},
+		{"DuplicateTxnRef", testDuplicateTxnRef},
+		{"UpdatePaymentStatus", testUpdatePaymentStatus},
+		{"TenantIsolation", testTenantIsolation},
+		{"CustomerInvoicesNewestFirst", testCustomerInvoicesNewestFirst},
+		{"SearchFilters", testSearchFilters},
+		{"SearchPagination", testSearchPagination},
+		{"StreamInvoices", testStreamInvoices},
+		{"InvoiceItems", testInvoiceItems},
+		{"InvoiceItemsRequireInvoice", testInvoiceItemsRequireInvoice},
+		{"EInvoiceNumbers", testEInvoiceNumbers},
+		{"CancelInvoice", testCancelInvoice},
+		{"InvoiceEvents", testInvoiceEvents},
+		{"InvoiceHistory", testInvoiceHistory},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// newInvoice builds a pending invoice with unique identifiers
+func newInvoice(tenantID, customerID, txnRef string) model.Invoice {
+	return model.Invoice{
+		InvoiceID:      uuid.New(),
+		TenantID:       tenantID,
+		InvoiceNumber:  "INV-TEST-" + uuid.NewString()[:8],
+		InvoiceType:    "TICKET",
+		CustomerID:     customerID,
+		TicketID:       "ticket-" + txnRef,
+		TotalAmount:    100000,
+		DiscountAmount: 10000,
+		TaxAmount:      5000,
+		FinalAmount:    95000,
+		PaymentStatus:  model.PaymentStatusPending,
+		PaymentMethod:  model.PaymentMethodVNPay,
+		IssueDate:      time.Now().UTC().Truncate(time.Second),
+		Notes:          "contract test",
+		VNPayTmnCode:   "TESTTMN1",
+		VNPayTxnRef:    txnRef,
+		Buyer: model.InvoiceBuyer{
+			Name:    "Buyer " + customerID,
+			TaxCode: "0100109106",
+			Address: "1 Trang Tien, Hoan Kiem, Ha Noi",
+			Email:   customerID + "@example.com",
+		},
+	}
+}
+
+// mustCreate creates an invoice or fails the test
+func mustCreate(t *testing.T, store repository.InvoiceStore, invoice model.Invoice) model.Invoice {
+	t.Helper()
+	created, err := store.CreateInvoice(context.Background(), invoice)
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+	return created
+}
+
+func testCreateAndGet(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+	want := newInvoice("tenant-a", "customer-1", "1000001")
+	created := mustCreate(t, store, want)
+
+	if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+		t.Errorf("CreateInvoice did not set timestamps: %+v", created)
+	}
+
+	for name, get := range map[string]func() (model.Invoice, error){
+		"by ID":      func() (model.Invoice, error) { return store.GetInvoiceByID(ctx, "tenant-a", want.InvoiceID) },
+		"by txn ref": func() (model.Invoice, error) { return store.GetInvoiceByVNPayTxnRef(ctx, "tenant-a", "1000001") },
+	} {
+		got, err := get()
+		if err != nil {
+			t.Fatalf("get %s: %v", name, err)
+		}
+		if err := sameInvoice(want, got); err != nil {
+			t.Errorf("get %s: %v", name, err)
+		}
+	}
+}
+
+func testCreateDefaults(t *testing.T, store repository.InvoiceStore) {
+	invoice := newInvoice("", "customer-1", "1000002")
+	invoice.InvoiceID = uuid.Nil
+	invoice.InvoiceNumber = ""
+
+	created := mustCreate(t, store, invoice)
+	if created.InvoiceID == uuid.Nil {
+		t.Error("CreateInvoice did not generate an invoice ID")
+	}
+	if created.InvoiceNumber == "" {
+		t.Error("CreateInvoice did not generate an invoice number")
+	}
+	if created.TenantID != model.DefaultTenantID {
+		t.Errorf("TenantID = %q, want %q", created.TenantID, model.DefaultTenantID)
+	}
+
+	if _, err := store.GetInvoiceByID(context.Background(), model.DefaultTenantID, created.InvoiceID); err != nil {
+		t.Errorf("GetInvoiceByID in default tenant: %v", err)
+	}
+}
+
+func testNotFound(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+
+	if _, err := store.GetInvoiceByID(ctx, "tenant-a", uuid.New()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetInvoiceByID error = %v, want ErrNotFound", err)
+	}
+	if _, err := store.GetInvoiceByVNPayTxnRef(ctx, "tenant-a", "missing"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetInvoiceByVNPayTxnRef error = %v, want ErrNotFound", err)
+	}
+	if err := store.UpdateInvoicePaymentStatus(ctx, "tenant-a", "missing", model.PaymentStatusCompleted, nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("UpdateInvoicePaymentStatus error = %v, want ErrNotFound", err)
+	}
+
+	invoices, err := store.GetInvoicesByCustomerID(ctx, "tenant-a", "nobody")
+	if err != nil {
+		t.Fatalf("GetInvoicesByCustomerID: %v", err)
+	}
+	if len(invoices) != 0 {
+		t.Errorf("GetInvoicesByCustomerID returned %d invoices, want 0", len(invoices))
+	}
+}
+
+func testDuplicateInvoiceNumber(t *testing.T, store repository.InvoiceStore) {
+	first := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "1000003"))
+
+	second := newInvoice("tenant-b", "customer-1", "1000004")
+	second.InvoiceNumber = first.InvoiceNumber
+	if _, err := store.CreateInvoice(context.Background(), second); !errors.Is(err, repository.ErrDuplicate) {
+		t.Errorf("CreateInvoice with duplicate number error = %v, want ErrDuplicate", err)
+	}
+
+	third := newInvoice("tenant-a", "customer-1", "1000005")
+	third.InvoiceID = first.InvoiceID
+	if _, err := store.CreateInvoice(context.Background(), third); !errors.Is(err, repository.ErrDuplicate) {
+		t.Errorf("CreateInvoice with duplicate ID error = %v, want ErrDuplicate", err)
+	}
+}
+
+func testDuplicateTxnRef(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+	mustCreate(t, store, newInvoice("tenant-a", "customer-1", "1000006"))
+
+	if _, err := store.CreateInvoice(ctx, newInvoice("tenant-a", "customer-2", "1000006")); !errors.Is(err, repository.ErrDuplicate) {
+		t.Errorf("CreateInvoice with duplicate txn ref error = %v, want ErrDuplicate", err)
+	}
+
+	// The same reference may be reused by another tenant's terminal
+	mustCreate(t, store, newInvoice("tenant-b", "customer-1", "1000006"))
+
+	// Invoices without a VNPay reference do not conflict with each other
+	mustCreate(t, store, newInvoice("tenant-a", "customer-1", ""))
+	mustCreate(t, store, newInvoice("tenant-a", "customer-1", ""))
+}
+
+func testUpdatePaymentStatus(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+	created := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "1000007"))
+
+	err := store.UpdateInvoicePaymentStatus(ctx, "tenant-a", "1000007", model.PaymentStatusCompleted, map[string]string{
+		"bankCode":      "NCB",
+		"transactionNo": "14000001",
+		"payDate":       "20260101120000",
+		"cardType":      "ATM",
+	})
+	if err != nil {
+		t.Fatalf("UpdateInvoicePaymentStatus: %v", err)
+	}
+	if err := store.SetInvoiceVNPayFee(ctx, "tenant-a", created.InvoiceID, 1650); err != nil {
+		t.Fatalf("SetInvoiceVNPayFee: %v", err)
+	}
+	if err := store.SetInvoiceVNPayFee(ctx, "tenant-b", created.InvoiceID, 1650); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("SetInvoiceVNPayFee of another tenant error = %v, want ErrNotFound", err)
+	}
+	if err := store.SetInvoiceRefundedAmount(ctx, "tenant-a", created.InvoiceID, 250.5); err != nil {
+		t.Fatalf("SetInvoiceRefundedAmount: %v", err)
+	}
+	if err := store.SetInvoiceRefundedAmount(ctx, "tenant-b", created.InvoiceID, 250.5); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("SetInvoiceRefundedAmount of another tenant error = %v, want ErrNotFound", err)
+	}
+
+	got, err := store.GetInvoiceByID(ctx, "tenant-a", created.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoiceByID: %v", err)
+	}
+	if got.PaymentStatus != model.PaymentStatusCompleted {
+		t.Errorf("PaymentStatus = %s, want %s", got.PaymentStatus, model.PaymentStatusCompleted)
+	}
+	if got.VNPayBankCode != "NCB" || got.VNPayTxnNo != "14000001" || got.VNPayPayDate != "20260101120000" || got.VNPayCardType != "ATM" {
+		t.Errorf("VNPay fields not updated: %+v", got)
+	}
+	if got.VNPayFee != 1650 {
+		t.Errorf("VNPayFee = %v, want 1650", got.VNPayFee)
+	}
+	if got.RefundedAmount != 250.5 {
+		t.Errorf("RefundedAmount = %v, want 250.5", got.RefundedAmount)
+	}
+	if got.UpdatedAt.Before(created.UpdatedAt) {
+		t.Errorf("UpdatedAt moved backwards: %v < %v", got.UpdatedAt, created.UpdatedAt)
+	}
+
+	// VNPay fields missing from a later update are kept
+	err = store.UpdateInvoicePaymentStatus(ctx, "tenant-a", "1000007", model.PaymentStatusRefunded, map[string]string{
+		"transactionNo": "14000002",
+		"payDate":       "",
+	})
+	if err != nil {
+		t.Fatalf("UpdateInvoicePaymentStatus without VNPay fields: %v", err)
+	}
+	got, err = store.GetInvoiceByID(ctx, "tenant-a", created.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoiceByID: %v", err)
+	}
+	if got.PaymentStatus != model.PaymentStatusRefunded {
+		t.Errorf("PaymentStatus = %s, want %s", got.PaymentStatus, model.PaymentStatusRefunded)
+	}
+	if got.VNPayBankCode != "NCB" || got.VNPayTxnNo != "14000002" || got.VNPayPayDate != "20260101120000" || got.VNPayCardType != "ATM" {
+		t.Errorf("VNPay fields after a partial update: %+v", got)
+	}
+}
+
+func testTenantIsolation(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+	created := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "1000008"))
+
+	if _, err := store.GetInvoiceByID(ctx, "tenant-b", created.InvoiceID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetInvoiceByID from another tenant error = %v, want ErrNotFound", err)
+	}
+	if _, err := store.GetInvoiceByVNPayTxnRef(ctx, "tenant-b", "1000008"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetInvoiceByVNPayTxnRef from another tenant error = %v, want ErrNotFound", err)
+	}
+	if err := store.UpdateInvoicePaymentStatus(ctx, "tenant-b", "1000008", model.PaymentStatusCompleted, nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("UpdateInvoicePaymentStatus from another tenant error = %v, want ErrNotFound", err)
+	}
+
+	invoices, err := store.GetInvoicesByCustomerID(ctx, "tenant-b", "customer-1")
+	if err != nil {
+		t.Fatalf("GetInvoicesByCustomerID: %v", err)
+	}
+	if len(invoices) != 0 {
+		t.Errorf("GetInvoicesByCustomerID from another tenant returned %d invoices", len(invoices))
+	}
+
+	got, err := store.GetInvoiceByID(ctx, "tenant-a", created.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoiceByID: %v", err)
+	}
+	if got.PaymentStatus != model.PaymentStatusPending {
+		t.Errorf("invoice modified through another tenant: status %s", got.PaymentStatus)
+	}
+}
+
+func testCustomerInvoicesNewestFirst(t *testing.T, store repository.InvoiceStore) {
+	var want []uuid.UUID
+	for i := 0; i < 3; i++ {
+		created := mustCreate(t, store, newInvoice("tenant-a", "customer-order", fmt.Sprintf("200000%d", i)))
+		want = append([]uuid.UUID{created.InvoiceID}, want...)
+		// Postgres timestamps have microsecond precision
+		time.Sleep(2 * time.Millisecond)
+	}
+	mustCreate(t, store, newInvoice("tenant-a", "someone-else", "2000009"))
+
+	invoices, err := store.GetInvoicesByCustomerID(context.Background(), "tenant-a", "customer-order")
+	if err != nil {
+		t.Fatalf("GetInvoicesByCustomerID: %v", err)
+	}
+	if len(invoices) != len(want) {
+		t.Fatalf("GetInvoicesByCustomerID returned %d invoices, want %d", len(invoices), len(want))
+	}
+	for i, invoice := range invoices {
+		if invoice.InvoiceID != want[i] {
+			t.Errorf("invoice %d = %s, want %s", i, invoice.InvoiceID, want[i])
+		}
+	}
+}
+
+func testSearchFilters(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+
+	cheap := newInvoice("tenant-a", "customer-1", "3000001")
+	cheap.FinalAmount = 50000
+	cheap.InvoiceType = "SUBSCRIPTION"
+	cheap = mustCreate(t, store, cheap)
+	time.Sleep(2 * time.Millisecond)
+
+	paid := mustCreate(t, store, newInvoice("tenant-a", "customer-2", "3000002"))
+	if err := store.UpdateInvoicePaymentStatus(ctx, "tenant-a", "3000002", model.PaymentStatusCompleted, map[string]string{"bankCode": "NCB"}); err != nil {
+		t.Fatalf("UpdateInvoicePaymentStatus: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+
+	expensive := newInvoice("tenant-a", "customer-1", "3000003")
+	expensive.FinalAmount = 500000
+	expensive = mustCreate(t, store, expensive)
+
+	mustCreate(t, store, newInvoice("tenant-b", "customer-1", "3000004"))
+
+	minAmount, maxAmount := 60000.0, 100000.0
+	createdTo := expensive.CreatedAt
+
+	tests := []struct {
+		name   string
+		filter model.InvoiceFilter
+		want   []model.Invoice
+	}{
+		{"tenant only", model.InvoiceFilter{}, []model.Invoice{cheap, paid, expensive}},
+		{"status", model.InvoiceFilter{Statuses: []model.PaymentStatus{model.PaymentStatusCompleted}}, []model.Invoice{paid}},
+		{"statuses", model.InvoiceFilter{Statuses: []model.PaymentStatus{model.PaymentStatusPending, model.PaymentStatusFailed}}, []model.Invoice{cheap, expensive}},
+		{"customer", model.InvoiceFilter{CustomerID: "customer-1"}, []model.Invoice{cheap, expensive}},
+		{"ticket", model.InvoiceFilter{TicketID: "ticket-3000003"}, []model.Invoice{expensive}},
+		{"bank code", model.InvoiceFilter{BankCode: "NCB"}, []model.Invoice{paid}},
+		{"invoice type", model.InvoiceFilter{InvoiceType: "SUBSCRIPTION"}, []model.Invoice{cheap}},
+		{"created range", model.InvoiceFilter{CreatedFrom: &paid.CreatedAt, CreatedTo: &createdTo}, []model.Invoice{paid}},
+		{"amount range", model.InvoiceFilter{MinAmount: &minAmount, MaxAmount: &maxAmount}, []model.Invoice{paid}},
+		{"no match", model.InvoiceFilter{CustomerID: "customer-1", BankCode: "NCB"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := tt.filter
+			filter.TenantID = "tenant-a"
+			filter.SortBy = model.InvoiceSortCreatedAt
+			filter.Limit = 10
+
+			invoices, total, err := store.SearchInvoices(ctx, filter)
+			if err != nil {
+				t.Fatalf("SearchInvoices: %v", err)
+			}
+			if total != len(tt.want) {
+				t.Errorf("total = %d, want %d", total, len(tt.want))
+			}
+			if err := sameIDs(tt.want, invoices); err != nil {
+				t.Error(err)
+			}
+
+			// Streams select the same invoices as searches
+			var streamed []model.Invoice
+			if err := store.StreamInvoices(ctx, filter, func(invoice model.Invoice) error {
+				streamed = append(streamed, invoice)
+				return nil
+			}); err != nil {
+				t.Fatalf("StreamInvoices: %v", err)
+			}
+			if err := sameIDs(tt.want, streamed); err != nil {
+				t.Errorf("streamed %v", err)
+			}
+		})
+	}
+}
+
+func testStreamInvoices(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+	var created []model.Invoice
+	for i, amount := range []float64{300000, 100000, 200000} {
+		invoice := newInvoice("tenant-a", "customer-1", fmt.Sprintf("600000%d", i))
+		invoice.FinalAmount = amount
+		created = append(created, mustCreate(t, store, invoice))
+	}
+
+	// Limit and After do not apply to streams
+	filter := model.InvoiceFilter{TenantID: "tenant-a", SortBy: model.InvoiceSortFinalAmount, SortDesc: true, Limit: 1}
+	after := filter.CursorFor(created[0])
+	filter.After = &after
+
+	var streamed []model.Invoice
+	if err := store.StreamInvoices(ctx, filter, func(invoice model.Invoice) error {
+		streamed = append(streamed, invoice)
+		return nil
+	}); err != nil {
+		t.Fatalf("StreamInvoices: %v", err)
+	}
+	if err := sameIDs([]model.Invoice{created[0], created[2], created[1]}, streamed); err != nil {
+		t.Error(err)
+	}
+
+	// An error from fn stops the stream and is returned
+	errStop := errors.New("stop")
+	calls := 0
+	err := store.StreamInvoices(ctx, filter, func(model.Invoice) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || calls != 1 {
+		t.Errorf("StreamInvoices error = %v after %d calls, want errStop after 1", err, calls)
+	}
+}
+
+func testSearchPagination(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+
+	// Equal amounts exercise the invoice ID tie-breaker
+	amounts := []float64{30000, 10000, 20000, 10000, 30000}
+	var created []model.Invoice
+	for i, amount := range amounts {
+		invoice := newInvoice("tenant-a", "customer-1", fmt.Sprintf("400000%d", i))
+		invoice.FinalAmount = amount
+		created = append(created, mustCreate(t, store, invoice))
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	for _, sortBy := range []model.InvoiceSortField{model.InvoiceSortCreatedAt, model.InvoiceSortFinalAmount} {
+		for _, desc := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s desc=%v", sortBy, desc), func(t *testing.T) {
+				filter := model.InvoiceFilter{TenantID: "tenant-a", SortBy: sortBy, SortDesc: desc, Limit: len(created)}
+
+				all, total, err := store.SearchInvoices(ctx, filter)
+				if err != nil {
+					t.Fatalf("SearchInvoices: %v", err)
+				}
+				if total != len(created) || len(all) != len(created) {
+					t.Fatalf("SearchInvoices returned %d of %d invoices, want %d", len(all), total, len(created))
+				}
+				for i := 1; i < len(all); i++ {
+					if !ordered(filter, all[i-1], all[i]) {
+						t.Errorf("invoices %d and %d out of order", i-1, i)
+					}
+				}
+
+				// Walking two invoices at a time visits the same ordering exactly once
+				var walked []model.Invoice
+				filter.Limit = 2
+				for page := 0; page <= len(created); page++ {
+					invoices, total, err := store.SearchInvoices(ctx, filter)
+					if err != nil {
+						t.Fatalf("SearchInvoices page %d: %v", page, err)
+					}
+					if total != len(created) {
+						t.Errorf("page %d total = %d, want %d", page, total, len(created))
+					}
+					if len(invoices) == 0 {
+						break
+					}
+					walked = append(walked, invoices...)
+					cursor := filter.CursorFor(invoices[len(invoices)-1])
+					filter.After = &cursor
+				}
+				if err := sameIDs(all, walked); err != nil {
+					t.Errorf("paged results differ from a single page: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func testInvoiceItems(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+	first := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "7000001"))
+	second := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "7000002"))
+	empty := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "7000003"))
+
+	// Items are returned by line number whatever order they were stored in
+	items := []model.InvoiceItem{
+		{LineNumber: 2, Description: "Child ticket", Quantity: 1, UnitPrice: 50000, VATRate: 10, Subtotal: 50000, TaxAmount: 5000, TotalAmount: 55000},
+		{LineNumber: 1, TicketID: "ticket-1", Description: "Adult ticket", Quantity: 2, UnitPrice: 100000, DiscountAmount: 10000, VATRate: 8, Subtotal: 190000, TaxAmount: 15200, TotalAmount: 205200},
+	}
+	created, err := store.CreateInvoiceItems(ctx, first.InvoiceID, items)
+	if err != nil {
+		t.Fatalf("CreateInvoiceItems: %v", err)
+	}
+	if len(created) != 2 || created[0].ItemID == uuid.Nil || created[0].InvoiceID != first.InvoiceID {
+		t.Fatalf("CreateInvoiceItems returned %+v", created)
+	}
+	if _, err := store.CreateInvoiceItems(ctx, second.InvoiceID, items[:1]); err != nil {
+		t.Fatalf("CreateInvoiceItems: %v", err)
+	}
+
+	got, err := store.GetInvoiceItems(ctx, []uuid.UUID{first.InvoiceID, second.InvoiceID, empty.InvoiceID})
+	if err != nil {
+		t.Fatalf("GetInvoiceItems: %v", err)
+	}
+	if len(got[first.InvoiceID]) != 2 || len(got[second.InvoiceID]) != 1 || len(got[empty.InvoiceID]) != 0 {
+		t.Fatalf("GetInvoiceItems returned %d/%d/%d items, want 2/1/0",
+			len(got[first.InvoiceID]), len(got[second.InvoiceID]), len(got[empty.InvoiceID]))
+	}
+
+	adult := got[first.InvoiceID][0]
+	if adult.LineNumber != 1 || adult.TicketID != "ticket-1" || adult.Description != "Adult ticket" ||
+		adult.Quantity != 2 || adult.UnitPrice != 100000 || adult.DiscountAmount != 10000 || adult.VATRate != 8 ||
+		adult.Subtotal != 190000 || adult.TaxAmount != 15200 || adult.TotalAmount != 205200 {
+		t.Errorf("first line = %+v", adult)
+	}
+	if got[first.InvoiceID][1].LineNumber != 2 {
+		t.Errorf("lines out of order: %+v", got[first.InvoiceID])
+	}
+
+	if _, err := store.CreateInvoiceItems(ctx, first.InvoiceID, items[:1]); !errors.Is(err, repository.ErrDuplicate) {
+		t.Errorf("CreateInvoiceItems with duplicate line number error = %v, want ErrDuplicate", err)
+	}
+}
+
+func testInvoiceItemsRequireInvoice(t *testing.T, store repository.InvoiceStore) {
+	items := []model.InvoiceItem{{LineNumber: 1, Description: "Ticket", Quantity: 1, UnitPrice: 1000, Subtotal: 1000, TotalAmount: 1000}}
+	if _, err := store.CreateInvoiceItems(context.Background(), uuid.New(), items); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("CreateInvoiceItems for a missing invoice error = %v, want ErrNotFound", err)
+	}
+}
+
+func testEInvoiceNumbers(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+	first := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "1000001"))
+	second := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "1000002"))
+	other := mustCreate(t, store, newInvoice("tenant-b", "customer-1", "1000003"))
+
+	// Numbers count up per tenant and series
+	next := func(tenantID, series string, want int) {
+		t.Helper()
+		got, err := store.NextEInvoiceNumber(ctx, tenantID, series)
+		if err != nil {
+			t.Fatalf("NextEInvoiceNumber(%s, %s): %v", tenantID, series, err)
+		}
+		if got != want {
+			t.Errorf("NextEInvoiceNumber(%s, %s) = %d, want %d", tenantID, series, got, want)
+		}
+	}
+	next("tenant-a", "C26TAA", 1)
+	next("tenant-a", "C26TAA", 2)
+	next("tenant-a", "C26TBB", 1)
+	next("tenant-b", "C26TAA", 1)
+
+	issuedAt := time.Now().UTC().Truncate(time.Second)
+	if err := store.SetEInvoiceNumber(ctx, "tenant-a", first.InvoiceID, "C26TAA", 1, issuedAt); err != nil {
+		t.Fatalf("SetEInvoiceNumber: %v", err)
+	}
+	got, err := store.GetInvoiceByID(ctx, "tenant-a", first.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoiceByID: %v", err)
+	}
+	if got.EInvoiceSeries != "C26TAA" || got.EInvoiceNumber != 1 || got.EInvoiceIssuedAt == nil || !got.EInvoiceIssuedAt.Equal(issuedAt) {
+		t.Errorf("e-invoice = %q/%d/%v, want C26TAA/1/%v", got.EInvoiceSeries, got.EInvoiceNumber, got.EInvoiceIssuedAt, issuedAt)
+	}
+
+	// An invoice is numbered once, and a number is used once per tenant and series
+	if err := store.SetEInvoiceNumber(ctx, "tenant-a", first.InvoiceID, "C26TAA", 2, issuedAt); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("renumbering an invoice error = %v, want ErrNotFound", err)
+	}
+	if err := store.SetEInvoiceNumber(ctx, "tenant-a", second.InvoiceID, "C26TAA", 1, issuedAt); !errors.Is(err, repository.ErrDuplicate) {
+		t.Errorf("reusing a number error = %v, want ErrDuplicate", err)
+	}
+	if err := store.SetEInvoiceNumber(ctx, "tenant-b", first.InvoiceID, "C26TAA", 2, issuedAt); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("numbering another tenant's invoice error = %v, want ErrNotFound", err)
+	}
+	if err := store.SetEInvoiceNumber(ctx, "tenant-b", other.InvoiceID, "C26TAA", 1, issuedAt); err != nil {
+		t.Errorf("same number in another tenant: %v", err)
+	}
+}
+
+func testCancelInvoice(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+	created := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "1000001"))
+
+	locked, err := store.GetInvoiceByIDForUpdate(ctx, "tenant-a", created.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoiceByIDForUpdate: %v", err)
+	}
+	if err := sameInvoice(created, locked); err != nil {
+		t.Error(err)
+	}
+	if _, err := store.GetInvoiceByIDForUpdate(ctx, "tenant-b", created.InvoiceID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("locking another tenant's invoice error = %v, want ErrNotFound", err)
+	}
+
+	cancelledAt := time.Now().UTC().Truncate(time.Second)
+	if err := store.CancelInvoice(ctx, "tenant-a", created.InvoiceID, model.PaymentStatusCancelled, "Customer changed seats", cancelledAt); err != nil {
+		t.Fatalf("CancelInvoice: %v", err)
+	}
+	got, err := store.GetInvoiceByID(ctx, "tenant-a", created.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoiceByID: %v", err)
+	}
+	if got.PaymentStatus != model.PaymentStatusCancelled || got.CancelReason != "Customer changed seats" ||
+		got.CancelledAt == nil || !got.CancelledAt.Equal(cancelledAt) {
+		t.Errorf("cancelled invoice = %s/%q/%v, want CANCELLED with reason and time %v", got.PaymentStatus, got.CancelReason, got.CancelledAt, cancelledAt)
+	}
+
+	if err := store.CancelInvoice(ctx, "tenant-b", created.InvoiceID, model.PaymentStatusVoided, "wrong tenant", cancelledAt); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("cancelling another tenant's invoice error = %v, want ErrNotFound", err)
+	}
+}
+
+func testInvoiceEvents(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+	invoice := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "1000001"))
+
+	base := time.Now().UTC().Truncate(time.Second)
+	events := make([]model.InvoiceEvent, 3)
+	for i := range events {
+		events[i] = model.InvoiceEvent{
+			EventID:        uuid.New(),
+			Type:           model.InvoiceEventCancelled,
+			TenantID:       "tenant-a",
+			InvoiceID:      invoice.InvoiceID,
+			InvoiceNumber:  invoice.InvoiceNumber,
+			CustomerID:     invoice.CustomerID,
+			TicketIDs:      []string{invoice.TicketID},
+			PreviousStatus: model.PaymentStatusPending,
+			PaymentStatus:  model.PaymentStatusCancelled,
+			Reason:         fmt.Sprintf("reason %d", i),
+			// Created out of order to check the outbox is read oldest first
+			OccurredAt: base.Add(time.Duration(2-i) * time.Minute),
+		}
+		if i == 2 {
+			events[i].TraceContext = map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+		}
+		if err := store.CreateInvoiceEvent(ctx, events[i]); err != nil {
+			t.Fatalf("CreateInvoiceEvent: %v", err)
+		}
+	}
+
+	if err := store.CreateInvoiceEvent(ctx, events[0]); !errors.Is(err, repository.ErrDuplicate) {
+		t.Errorf("duplicate event error = %v, want ErrDuplicate", err)
+	}
+	orphan := events[0]
+	orphan.EventID = uuid.New()
+	orphan.InvoiceID = uuid.New()
+	if err := store.CreateInvoiceEvent(ctx, orphan); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("event of a missing invoice error = %v, want ErrNotFound", err)
+	}
+
+	got, err := store.GetUnpublishedInvoiceEvents(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetUnpublishedInvoiceEvents: %v", err)
+	}
+	if len(got) != 2 || got[0].EventID != events[2].EventID || got[1].EventID != events[1].EventID {
+		t.Fatalf("unpublished events = %v, want the two oldest", got)
+	}
+	if got[0].Reason != "reason 2" || !got[0].OccurredAt.Equal(events[2].OccurredAt) || len(got[0].TicketIDs) != 1 || got[0].TicketIDs[0] != invoice.TicketID {
+		t.Errorf("event = %+v, want %+v", got[0], events[2])
+	}
+	if got[0].TraceContext["traceparent"] != events[2].TraceContext["traceparent"] || got[1].TraceContext != nil {
+		t.Errorf("trace contexts = %v, %v, want the one recorded with the event only", got[0].TraceContext, got[1].TraceContext)
+	}
+
+	if err := store.MarkInvoiceEventsPublished(ctx, []uuid.UUID{got[0].EventID, got[1].EventID}, time.Now()); err != nil {
+		t.Fatalf("MarkInvoiceEventsPublished: %v", err)
+	}
+	got, err = store.GetUnpublishedInvoiceEvents(ctx, 10)
+	if err != nil {
+		t.Fatalf("GetUnpublishedInvoiceEvents: %v", err)
+	}
+	if len(got) != 1 || got[0].EventID != events[0].EventID {
+		t.Errorf("unpublished events after publishing = %v, want only the newest", got)
+	}
+}
+
+func testInvoiceHistory(t *testing.T, store repository.InvoiceStore) {
+	ctx := context.Background()
+	invoice := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "1000001"))
+	other := mustCreate(t, store, newInvoice("tenant-a", "customer-1", "1000002"))
+
+	base := time.Now().UTC().Truncate(time.Second)
+	entries := []model.InvoiceHistoryEntry{
+		{NewStatus: model.PaymentStatusPending, Actor: model.InvoiceActorAPI, CreatedAt: base},
+		{OldStatus: model.PaymentStatusPending, NewStatus: model.PaymentStatusCompleted, Actor: model.InvoiceActorIPN, SourceID: "14000001", CreatedAt: base.Add(time.Minute)},
+		// Recorded in the same instant as the previous entry, so it is ordered by insertion
+		{OldStatus: model.PaymentStatusCompleted, NewStatus: model.PaymentStatusVoided, Actor: model.InvoiceActorAdmin, Reason: "wrong buyer", CreatedAt: base.Add(time.Minute)},
+	}
+	for _, entry := range entries {
+		entry.TenantID = "tenant-a"
+		entry.InvoiceID = invoice.InvoiceID
+		if err := store.AppendInvoiceHistory(ctx, entry); err != nil {
+			t.Fatalf("AppendInvoiceHistory: %v", err)
+		}
+	}
+	if err := store.AppendInvoiceHistory(ctx, model.InvoiceHistoryEntry{
+		TenantID:  "tenant-a",
+		InvoiceID: other.InvoiceID,
+		NewStatus: model.PaymentStatusPending,
+		Actor:     model.InvoiceActorAPI,
+		CreatedAt: base,
+	}); err != nil {
+		t.Fatalf("AppendInvoiceHistory: %v", err)
+	}
+
+	orphan := model.InvoiceHistoryEntry{TenantID: "tenant-a", InvoiceID: uuid.New(), NewStatus: model.PaymentStatusPending, Actor: model.InvoiceActorAPI, CreatedAt: base}
+	if err := store.AppendInvoiceHistory(ctx, orphan); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("history of a missing invoice error = %v, want ErrNotFound", err)
+	}
+
+	got, err := store.GetInvoiceHistory(ctx, "tenant-a", invoice.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoiceHistory: %v", err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("got %d history entries, want %d", len(got), len(entries))
+	}
+	for i, want := range entries {
+		entry := got[i]
+		if entry.EventID == 0 || entry.InvoiceID != invoice.InvoiceID || entry.OldStatus != want.OldStatus ||
+			entry.NewStatus != want.NewStatus || entry.Actor != want.Actor || entry.SourceID != want.SourceID ||
+			entry.Reason != want.Reason || !entry.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("history entry %d = %+v, want %+v", i, entry, want)
+		}
+	}
+	if got[1].EventID >= got[2].EventID {
+		t.Errorf("event IDs %d, %d are not increasing", got[1].EventID, got[2].EventID)
+	}
+
+	if got, err := store.GetInvoiceHistory(ctx, "tenant-b", invoice.InvoiceID); err != nil || len(got) != 0 {
+		t.Errorf("another tenant's history = %v, %v, want none", got, err)
+	}
+}
+
+// ordered reports whether a precedes b in the filter's ordering
+func ordered(filter model.InvoiceFilter, a, b model.Invoice) bool {
+	cmp := compareUUIDs(a.InvoiceID, b.InvoiceID)
+	switch {
+	case filter.SortBy == model.InvoiceSortFinalAmount && a.FinalAmount != b.FinalAmount:
+		cmp = -1
+		if a.FinalAmount > b.FinalAmount {
+			cmp = 1
+		}
+	case filter.SortBy == model.InvoiceSortCreatedAt && !a.CreatedAt.Equal(b.CreatedAt):
+		cmp = -1
+		if a.CreatedAt.After(b.CreatedAt) {
+			cmp = 1
+		}
+	}
+	if filter.SortDesc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+// compareUUIDs orders UUIDs bytewise, as Postgres does
+func compareUUIDs(a, b uuid.UUID) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// sameIDs checks that got holds the invoices in want, in the same order
+func sameIDs(want, got []model.Invoice) error {
+	ids := func(invoices []model.Invoice) []uuid.UUID {
+		out := make([]uuid.UUID, 0, len(invoices))
+		for _, invoice := range invoices {
+			out = append(out, invoice.InvoiceID)
+		}
+		return out
+	}
+	if fmt.Sprint(ids(want)) != fmt.Sprint(ids(got)) {
+		return fmt.Errorf("invoices = %v, want %v", ids(got), ids(want))
+	}
+	return nil
+}
+
+// sameInvoice compares the stored fields of two invoices, ignoring timestamps set by the store
+func sameInvoice(want, got model.Invoice) error {
+	switch {
+	case got.InvoiceID != want.InvoiceID:
+		return fmt.Errorf("InvoiceID = %s, want %s", got.InvoiceID, want.InvoiceID)
+	case got.TenantID != want.TenantID:
+		return fmt.Errorf("TenantID = %q, want %q", got.TenantID, want.TenantID)
+	case got.InvoiceNumber != want.InvoiceNumber:
+		return fmt.Errorf("InvoiceNumber = %q, want %q", got.InvoiceNumber, want.InvoiceNumber)
+	case got.InvoiceType != want.InvoiceType || got.CustomerID != want.CustomerID || got.TicketID != want.TicketID:
+		return fmt.Errorf("identity fields = %q/%q/%q, want %q/%q/%q",
+			got.InvoiceType, got.CustomerID, got.TicketID, want.InvoiceType, want.CustomerID, want.TicketID)
+	case got.TotalAmount != want.TotalAmount || got.DiscountAmount != want.DiscountAmount ||
+		got.TaxAmount != want.TaxAmount || got.FinalAmount != want.FinalAmount:
+		return fmt.Errorf("amounts = %v/%v/%v/%v, want %v/%v/%v/%v",
+			got.TotalAmount, got.DiscountAmount, got.TaxAmount, got.FinalAmount,
+			want.TotalAmount, want.DiscountAmount, want.TaxAmount, want.FinalAmount)
+	case got.PaymentStatus != want.PaymentStatus || got.PaymentMethod != want.PaymentMethod:
+		return fmt.Errorf("payment = %s/%s, want %s/%s", got.PaymentStatus, got.PaymentMethod, want.PaymentStatus, want.PaymentMethod)
+	case !got.IssueDate.Equal(want.IssueDate):
+		return fmt.Errorf("IssueDate = %v, want %v", got.IssueDate, want.IssueDate)
+	case got.Notes != want.Notes:
+		return fmt.Errorf("Notes = %q, want %q", got.Notes, want.Notes)
+	case got.VNPayTmnCode != want.VNPayTmnCode || got.VNPayTxnRef != want.VNPayTxnRef:
+		return fmt.Errorf("VNPay = %q/%q, want %q/%q", got.VNPayTmnCode, got.VNPayTxnRef, want.VNPayTmnCode, want.VNPayTxnRef)
+	case got.Buyer != want.Buyer:
+		return fmt.Errorf("Buyer = %+v, want %+v", got.Buyer, want.Buyer)
+	}
+	return nil
+}
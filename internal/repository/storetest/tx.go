@@ -0,0 +1,197 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+)
+
+// NewStore returns an empty store for a single test
+type NewStore func(t *testing.T) repository.Store
+
+// RunStoreTests runs the Store transaction contract against stores created by newStore
+func RunStoreTests(t *testing.T, newStore NewStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store repository.Store)
+	}{
+		{"Commit", testCommit},
+		{"Rollback", testRollback},
+		{"NestedJoinsTransaction", testNestedJoinsTransaction},
+		{"ForUpdateSerializesUpdates", testForUpdateSerializesUpdates},
+		{"ExpiredPendingInvoices", testExpiredPendingInvoices},
+		{"Ledger", testLedger},
+		{"LedgerRollback", testLedgerRollback},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// errAbort is returned by units of work that should roll back
+var errAbort = errors.New("abort")
+
+func testCommit(t *testing.T, store repository.Store) {
+	ctx := context.Background()
+	invoice := newInvoice("tenant-a", "customer-1", "5000001")
+
+	err := store.WithTx(ctx, func(tx repository.Store) error {
+		if _, err := tx.Invoices().CreateInvoice(ctx, invoice); err != nil {
+			return err
+		}
+		return tx.Invoices().UpdateInvoicePaymentStatus(ctx, "tenant-a", "5000001", model.PaymentStatusCompleted, nil)
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	got, err := store.Invoices().GetInvoiceByID(ctx, "tenant-a", invoice.InvoiceID)
+	if err != nil {
+		t.Fatalf("invoice not committed: %v", err)
+	}
+	if got.PaymentStatus != model.PaymentStatusCompleted {
+		t.Errorf("PaymentStatus = %s, want %s", got.PaymentStatus, model.PaymentStatusCompleted)
+	}
+}
+
+func testRollback(t *testing.T, store repository.Store) {
+	ctx := context.Background()
+	existing := mustCreate(t, store.Invoices(), newInvoice("tenant-a", "customer-1", "5000002"))
+	invoice := newInvoice("tenant-a", "customer-1", "5000003")
+
+	err := store.WithTx(ctx, func(tx repository.Store) error {
+		if _, err := tx.Invoices().CreateInvoice(ctx, invoice); err != nil {
+			return err
+		}
+		if err := tx.Invoices().UpdateInvoicePaymentStatus(ctx, "tenant-a", "5000002", model.PaymentStatusCompleted, nil); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx error = %v, want the unit of work's error", err)
+	}
+
+	if _, err := store.Invoices().GetInvoiceByID(ctx, "tenant-a", invoice.InvoiceID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("invoice created in a rolled back transaction: error = %v", err)
+	}
+	got, err := store.Invoices().GetInvoiceByID(ctx, "tenant-a", existing.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoiceByID: %v", err)
+	}
+	if got.PaymentStatus != model.PaymentStatusPending {
+		t.Errorf("update survived rollback: status %s", got.PaymentStatus)
+	}
+}
+
+func testNestedJoinsTransaction(t *testing.T, store repository.Store) {
+	ctx := context.Background()
+	invoice := newInvoice("tenant-a", "customer-1", "5000004")
+
+	err := store.WithTx(ctx, func(tx repository.Store) error {
+		if err := tx.WithTx(ctx, func(inner repository.Store) error {
+			_, err := inner.Invoices().CreateInvoice(ctx, invoice)
+			return err
+		}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithTx error = %v, want the unit of work's error", err)
+	}
+
+	if _, err := store.Invoices().GetInvoiceByID(ctx, "tenant-a", invoice.InvoiceID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("nested unit of work committed independently: error = %v", err)
+	}
+}
+
+func testForUpdateSerializesUpdates(t *testing.T, store repository.Store) {
+	ctx := context.Background()
+	mustCreate(t, store.Invoices(), newInvoice("tenant-a", "customer-1", "5000005"))
+
+	// Every worker completes the invoice only if it is still pending, as IPN
+	// processing does; exactly one of them may succeed
+	const workers = 8
+	var completed int32
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var won bool
+			err := store.WithTx(ctx, func(tx repository.Store) error {
+				won = false
+				invoice, err := tx.Invoices().GetInvoiceByVNPayTxnRefForUpdate(ctx, "tenant-a", "5000005")
+				if err != nil {
+					return err
+				}
+				if invoice.PaymentStatus != model.PaymentStatusPending {
+					return nil
+				}
+				won = true
+				return tx.Invoices().UpdateInvoicePaymentStatus(ctx, "tenant-a", "5000005", model.PaymentStatusCompleted, nil)
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if won {
+				atomic.AddInt32(&completed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("WithTx: %v", err)
+	}
+	if completed != 1 {
+		t.Errorf("%d workers completed the invoice, want exactly 1", completed)
+	}
+}
+
+func testExpiredPendingInvoices(t *testing.T, store repository.Store) {
+	ctx := context.Background()
+	invoices := store.Invoices()
+
+	var created []model.Invoice
+	for i := 0; i < 4; i++ {
+		created = append(created, mustCreate(t, invoices, newInvoice(fmt.Sprintf("tenant-%d", i%2), "customer-1", fmt.Sprintf("600000%d", i))))
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := invoices.UpdateInvoicePaymentStatus(ctx, "tenant-1", "6000001", model.PaymentStatusCompleted, nil); err != nil {
+		t.Fatalf("UpdateInvoicePaymentStatus: %v", err)
+	}
+
+	// Invoices 0 and 2 are pending and older than invoice 3
+	cutoff := created[3].CreatedAt
+	expired, err := invoices.GetExpiredPendingInvoices(ctx, cutoff, 10)
+	if err != nil {
+		t.Fatalf("GetExpiredPendingInvoices: %v", err)
+	}
+	if err := sameIDs([]model.Invoice{created[0], created[2]}, expired); err != nil {
+		t.Error(err)
+	}
+
+	expired, err = invoices.GetExpiredPendingInvoices(ctx, cutoff, 1)
+	if err != nil {
+		t.Fatalf("GetExpiredPendingInvoices: %v", err)
+	}
+	if err := sameIDs([]model.Invoice{created[0]}, expired); err != nil {
+		t.Errorf("limited: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"payment_service/internal/tracing"
+)
+
+// tracedQuerier runs each statement in a client span of its own. Statements
+// only hold placeholders, so their text is recorded but never their arguments.
+type tracedQuerier struct {
+	db querier
+}
+
+// Exec executes a statement in a span
+func (q tracedQuerier) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, span := startQuery(ctx, sql)
+	tag, err := q.db.Exec(ctx, sql, args...)
+	tracing.End(span, err)
+	return tag, err
+}
+
+// Query runs a query in a span ending once its rows are read or closed
+func (q tracedQuerier) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, span := startQuery(ctx, sql)
+	rows, err := q.db.Query(ctx, sql, args...)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+// QueryRow runs a query in a span ending once its row is scanned
+func (q tracedQuerier) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, span := startQuery(ctx, sql)
+	return &tracedRow{row: q.db.QueryRow(ctx, sql, args...), span: span}
+}
+
+// startQuery starts the span of a statement
+func startQuery(ctx context.Context, sql string) (context.Context, trace.Span) {
+	summary := querySummary(sql)
+	return tracing.Start(ctx, summary,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBQuerySummary(summary),
+			semconv.DBQueryText(strings.TrimSpace(sql)),
+		),
+	)
+}
+
+// tracedRows ends the span of a query when its rows are exhausted or closed
+type tracedRows struct {
+	pgx.Rows
+	span  trace.Span
+	ended bool
+}
+
+// Next advances to the next row, ending the span after the last one
+func (r *tracedRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.end()
+	return false
+}
+
+// Close closes the rows and ends the span
+func (r *tracedRows) Close() {
+	r.Rows.Close()
+	r.end()
+}
+
+// end ends the span once, with the error the rows were closed with
+func (r *tracedRows) end() {
+	if r.ended {
+		return
+	}
+	r.ended = true
+	tracing.End(r.span, r.Rows.Err())
+}
+
+// tracedRow ends the span of a query when its row is scanned
+type tracedRow struct {
+	row  pgx.Row
+	span trace.Span
+}
+
+// Scan reads the row and ends the span. A missing row is an answer rather
+// than a failure, so it does not mark the span failed.
+func (r *tracedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		tracing.End(r.span, nil)
+	} else {
+		tracing.End(r.span, err)
+	}
+	return err
+}
+
+// querySummary names a statement by its operation and the table it works on,
+// e.g. "SELECT invoices", which keeps span names few and free of values
+func querySummary(sql string) string {
+	words := strings.Fields(sql)
+	if len(words) == 0 {
+		return "query"
+	}
+	operation := strings.ToUpper(words[0])
+
+	// The table follows the first keyword naming it, depending on the operation
+	var keyword string
+	switch operation {
+	case "SELECT", "DELETE":
+		keyword = "FROM"
+	case "INSERT":
+		keyword = "INTO"
+	case "UPDATE":
+		keyword = "UPDATE"
+	default:
+		return operation
+	}
+	for i := 0; i < len(words)-1; i++ {
+		if strings.EqualFold(words[i], keyword) {
+			table := strings.TrimRight(strings.SplitN(words[i+1], "(", 2)[0], ",;")
+			return operation + " " + table
+		}
+	}
+	return operation
+}
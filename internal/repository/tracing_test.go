@@ -0,0 +1,20 @@
+package repository
+
+import "testing"
+
+func TestQuerySummary(t *testing.T) {
+	for sql, want := range map[string]string{
+		`SELECT ` + invoiceColumns + ` FROM invoices WHERE tenant_id = $1`:                    "SELECT invoices",
+		"\n\t\tINSERT INTO invoice_items (\n\t\t\tinvoice_id, item_id\n\t\t) VALUES ($1, $2)": "INSERT invoice_items",
+		`INSERT INTO einvoice_sequences(tenant_id) VALUES ($1) ON CONFLICT DO NOTHING`:        "INSERT einvoice_sequences",
+		`UPDATE invoice_outbox SET published_at = $1 WHERE event_id = ANY($2)`:                "UPDATE invoice_outbox",
+		`delete from invoice_items where invoice_id = $1`:                                     "DELETE invoice_items",
+		`SELECT 1`:                             "SELECT",
+		`WITH x AS (SELECT 1) SELECT * FROM x`: "WITH",
+		"":                                     "query",
+	} {
+		if got := querySummary(sql); got != want {
+			t.Errorf("querySummary(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// maxTxAttempts bounds how often a transaction is retried after serialization failures
+const maxTxAttempts = 5
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx, so repositories can
+// run their statements on the pool or inside a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// PostgresStore is the Store backed by a Postgres connection pool
+type PostgresStore struct {
+	db       *pgxpool.Pool
+	invoices *InvoiceRepository
+	ledger   *LedgerRepository
+}
+
+// NewPostgresStore creates a store running its statements on db, encrypting
+// sensitive invoice columns with enc unless it is nil
+func NewPostgresStore(db *pgxpool.Pool, enc *FieldEncryption) *PostgresStore {
+	return &PostgresStore{
+		db:       db,
+		invoices: NewInvoiceRepository(db, enc),
+		ledger:   NewLedgerRepository(db),
+	}
+}
+
+// Invoices returns the invoice store using the pool
+func (s *PostgresStore) Invoices() InvoiceStore {
+	return s.invoices
+}
+
+// Ledger returns the ledger store using the pool
+func (s *PostgresStore) Ledger() LedgerStore {
+	return s.ledger
+}
+
+// WithTx runs fn in a serializable transaction, retrying it on serialization
+// failures and deadlocks
+func (s *PostgresStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = s.runTx(ctx, fn)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+
+		// Back off briefly so the conflicting transaction can finish
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt*attempt) * 10 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("transaction failed after %d attempts: %w", maxTxAttempts, err)
+}
+
+// runTx runs one attempt of fn in a transaction
+func (s *PostgresStore) runTx(ctx context.Context, fn func(tx Store) error) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txStore := &postgresTxStore{
+		invoices: &InvoiceRepository{db: tracedQuerier{db: tx}, enc: s.invoices.enc},
+		ledger:   &LedgerRepository{db: tx},
+	}
+	if err := fn(txStore); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// postgresTxStore is the Store handed to a unit of work, bound to its transaction
+type postgresTxStore struct {
+	invoices *InvoiceRepository
+	ledger   *LedgerRepository
+}
+
+// Invoices returns the invoice store using the transaction
+func (s *postgresTxStore) Invoices() InvoiceStore {
+	return s.invoices
+}
+
+// Ledger returns the ledger store using the transaction
+func (s *postgresTxStore) Ledger() LedgerStore {
+	return s.ledger
+}
+
+// WithTx joins the surrounding transaction
+func (s *postgresTxStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return fn(s)
+}
+
+// isRetryable reports whether err aborted a transaction that can safely be
+// run again: a serialization failure or a deadlock
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	return false
+}
+
+// Compile-time checks that the Postgres stores satisfy the Store interface
+var (
+	_ Store = (*PostgresStore)(nil)
+	_ Store = (*postgresTxStore)(nil)
+)
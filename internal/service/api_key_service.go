@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+)
+
+var (
+	// ErrInvalidAPIKey is returned when an API key is unknown, revoked or expired
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrInvalidScope is returned when an API key is created with an unknown scope
+	ErrInvalidScope = errors.New("invalid API key scope")
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognise
+const apiKeyPrefix = "psk_"
+
+// apiKeyDisplayLength is how much of a key is kept to recognise it by
+const apiKeyDisplayLength = len(apiKeyPrefix) + 8
+
+// APIKeyService issues API keys and authenticates the services presenting them
+type APIKeyService struct {
+	repo repository.APIKeyStore
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(repo repository.APIKeyStore) *APIKeyService {
+	return &APIKeyService{
+		repo: repo,
+	}
+}
+
+// CreateAPIKey issues a key for a tenant with the given scopes, expiring at
+// expiresAt unless it is zero. It returns the key's details and the key
+// itself, which cannot be recovered later.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, tenantID string, name string, scopes []model.APIKeyScope, expiresAt time.Time) (model.APIKey, string, error) {
+	if len(scopes) == 0 {
+		return model.APIKey{}, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, scope := range scopes {
+		if !scope.Valid() {
+			return model.APIKey{}, "", fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return model.APIKey{}, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	rawKey := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := model.APIKey{
+		KeyID:     uuid.New(),
+		TenantID:  tenantID,
+		Name:      name,
+		Prefix:    rawKey[:apiKeyDisplayLength],
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if !expiresAt.IsZero() {
+		expiresAt = expiresAt.UTC()
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.CreateAPIKey(ctx, key, hashAPIKey(rawKey)); err != nil {
+		return model.APIKey{}, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+	return key, rawKey, nil
+}
+
+// Authenticate returns the active API key matching rawKey
+func (s *APIKeyService) Authenticate(ctx context.Context, rawKey string) (model.APIKey, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return model.APIKey{}, ErrInvalidAPIKey
+	}
+
+	key, err := s.repo.GetAPIKeyByHash(ctx, hashAPIKey(rawKey))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return model.APIKey{}, ErrInvalidAPIKey
+		}
+		return model.APIKey{}, fmt.Errorf("failed to authenticate API key: %w", err)
+	}
+	if !key.Active(time.Now()) {
+		return model.APIKey{}, fmt.Errorf("%w: key %s is revoked or expired", ErrInvalidAPIKey, key.Prefix)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns a tenant's API keys, oldest first
+func (s *APIKeyService) ListAPIKeys(ctx context.Context, tenantID string) ([]model.APIKey, error) {
+	keys, err := s.repo.ListAPIKeys(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key, which is rejected from then on
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, keyID uuid.UUID) error {
+	if err := s.repo.RevokeAPIKey(ctx, keyID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return nil
+}
+
+// hashAPIKey returns the hex SHA-256 hash an API key is stored under. Keys
+// are 256 random bits, so a fast unsalted hash cannot be brute-forced.
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAPIKeyService(repository.NewMemoryAPIKeyStore())
+
+	if _, _, err := svc.CreateAPIKey(ctx, "tenant-a", "booking", nil, time.Time{}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("CreateAPIKey without scopes error = %v, want ErrInvalidScope", err)
+	}
+	if _, _, err := svc.CreateAPIKey(ctx, "tenant-a", "booking", []model.APIKeyScope{"payments:delete"}, time.Time{}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("CreateAPIKey with an unknown scope error = %v, want ErrInvalidScope", err)
+	}
+
+	key, rawKey, err := svc.CreateAPIKey(ctx, "tenant-a", "booking", []model.APIKeyScope{model.ScopePaymentsCreate, model.ScopeInvoicesRead}, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(rawKey, key.Prefix) || len(rawKey) <= len(key.Prefix) {
+		t.Errorf("key %q does not start with its prefix %q", rawKey, key.Prefix)
+	}
+
+	got, err := svc.Authenticate(ctx, rawKey)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got.KeyID != key.KeyID || got.TenantID != "tenant-a" {
+		t.Errorf("Authenticate = %+v, want key %s of tenant-a", got, key.KeyID)
+	}
+	if !got.HasScope(model.ScopeInvoicesRead) || got.HasScope(model.ScopePaymentsRefund) {
+		t.Errorf("scopes = %v, want payments:create and invoices:read only", got.Scopes)
+	}
+
+	for _, wrong := range []string{"", "psk_", rawKey + "x", strings.TrimPrefix(rawKey, "psk_")} {
+		if _, err := svc.Authenticate(ctx, wrong); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("Authenticate(%q) error = %v, want ErrInvalidAPIKey", wrong, err)
+		}
+	}
+
+	// Admin keys grant every scope
+	admin, _, err := svc.CreateAPIKey(ctx, "tenant-a", "ops", []model.APIKeyScope{model.ScopeAdmin}, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	for _, scope := range model.APIKeyScopes {
+		if !admin.HasScope(scope) {
+			t.Errorf("admin key lacks %s", scope)
+		}
+	}
+
+	// Expired and revoked keys are rejected
+	_, expiredKey, err := svc.CreateAPIKey(ctx, "tenant-a", "old", []model.APIKeyScope{model.ScopeInvoicesRead}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, expiredKey); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate with an expired key error = %v, want ErrInvalidAPIKey", err)
+	}
+	if err := svc.RevokeAPIKey(ctx, key.KeyID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, rawKey); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate with a revoked key error = %v, want ErrInvalidAPIKey", err)
+	}
+
+	keys, err := svc.ListAPIKeys(ctx, "tenant-a")
+	if err != nil {
+		t.Fatalf("ListAPIKeys: %v", err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("ListAPIKeys returned %d keys, want 3", len(keys))
+	}
+	for _, listed := range keys {
+		if (listed.RevokedAt != nil) != (listed.KeyID == key.KeyID) {
+			t.Errorf("listed key %s revoked at %v, want only %s revoked", listed.KeyID, listed.RevokedAt, key.KeyID)
+		}
+	}
+	if keys, _ := svc.ListAPIKeys(ctx, "tenant-b"); len(keys) != 0 {
+		t.Errorf("ListAPIKeys of another tenant = %+v, want none", keys)
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/einvoice"
+)
+
+// E-invoice errors
+var (
+	// ErrInvoiceNotPaid is returned when exporting an e-invoice for an invoice that is not completed
+	ErrInvoiceNotPaid = errors.New("invoice is not paid")
+	// ErrEInvoiceNotIssued is returned when exporting an e-invoice that has not been issued yet
+	ErrEInvoiceNotIssued = errors.New("e-invoice is not issued")
+	// ErrSellerNotConfigured is returned when a tenant's merchant lacks the seller details e-invoices need
+	ErrSellerNotConfigured = errors.New("seller details are not configured")
+)
+
+// EInvoiceService issues and renders the e-invoices of paid invoices
+type EInvoiceService struct {
+	invoiceSvc  *InvoiceService
+	merchantSvc *MerchantService
+	now         func() time.Time
+}
+
+// NewEInvoiceService creates a new e-invoice service
+func NewEInvoiceService(invoiceSvc *InvoiceService, merchantSvc *MerchantService) *EInvoiceService {
+	return &EInvoiceService{
+		invoiceSvc:  invoiceSvc,
+		merchantSvc: merchantSvc,
+		now:         time.Now,
+	}
+}
+
+// Issue issues the e-invoice of a tenant's paid invoice, assigning it the
+// next number of the merchant's series. Issuing an invoice again returns the
+// number it already has.
+func (s *EInvoiceService) Issue(ctx context.Context, tenantID string, id uuid.UUID) (model.Invoice, error) {
+	merchant, err := s.sellerMerchant(ctx, tenantID)
+	if err != nil {
+		return model.Invoice{}, err
+	}
+	seller := merchant.Seller
+
+	var invoice model.Invoice
+	err = s.invoiceSvc.WithTx(ctx, func(tx *InvoiceService) error {
+		var err error
+		invoice, err = tx.GetInvoiceByIDForUpdate(ctx, merchant.TenantID, id)
+		if err != nil {
+			return err
+		}
+		if invoice.PaymentStatus != model.PaymentStatusCompleted {
+			return fmt.Errorf("%w: invoice %s is %s", ErrInvoiceNotPaid, id, invoice.PaymentStatus)
+		}
+		if invoice.EInvoiceNumber != 0 {
+			return nil
+		}
+
+		number, err := tx.repo.NextEInvoiceNumber(ctx, merchant.TenantID, seller.EInvoiceSeries)
+		if err != nil {
+			return err
+		}
+		issuedAt := s.now().UTC().Truncate(time.Second)
+		invoice.EInvoiceSeries = seller.EInvoiceSeries
+		invoice.EInvoiceNumber = number
+		invoice.EInvoiceIssuedAt = &issuedAt
+
+		// Validate before recording the number, so a rejected document does
+		// not leave a gap in the series
+		if _, err := render(invoice, seller); err != nil {
+			return err
+		}
+		return tx.repo.SetEInvoiceNumber(ctx, merchant.TenantID, id, invoice.EInvoiceSeries, invoice.EInvoiceNumber, issuedAt)
+	})
+	if err != nil {
+		return model.Invoice{}, fmt.Errorf("failed to issue e-invoice: %w", err)
+	}
+	return invoice, nil
+}
+
+// Export returns the e-invoice XML of a tenant's issued invoice. It never
+// issues the e-invoice itself.
+func (s *EInvoiceService) Export(ctx context.Context, tenantID string, id uuid.UUID) (model.Invoice, []byte, error) {
+	merchant, err := s.sellerMerchant(ctx, tenantID)
+	if err != nil {
+		return model.Invoice{}, nil, err
+	}
+
+	invoice, err := s.invoiceSvc.GetInvoiceByID(ctx, merchant.TenantID, id)
+	if err != nil {
+		return model.Invoice{}, nil, err
+	}
+	if invoice.PaymentStatus != model.PaymentStatusCompleted {
+		return model.Invoice{}, nil, fmt.Errorf("%w: invoice %s is %s", ErrInvoiceNotPaid, id, invoice.PaymentStatus)
+	}
+	if invoice.EInvoiceNumber == 0 {
+		return model.Invoice{}, nil, fmt.Errorf("%w: invoice %s", ErrEInvoiceNotIssued, id)
+	}
+
+	body, err := render(invoice, merchant.Seller)
+	if err != nil {
+		return model.Invoice{}, nil, fmt.Errorf("failed to export e-invoice: %w", err)
+	}
+	return invoice, body, nil
+}
+
+// sellerMerchant returns the tenant's merchant, which must have the seller
+// details e-invoices need
+func (s *EInvoiceService) sellerMerchant(ctx context.Context, tenantID string) (model.Merchant, error) {
+	merchant, err := s.merchantSvc.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		return model.Merchant{}, err
+	}
+
+	seller := merchant.Seller
+	if seller.LegalName == "" || seller.TaxCode == "" || seller.EInvoiceTemplate == "" || seller.EInvoiceSeries == "" {
+		return model.Merchant{}, fmt.Errorf("%w: tenant %s", ErrSellerNotConfigured, merchant.TenantID)
+	}
+	return merchant, nil
+}
+
+// render builds, validates and marshals the e-invoice of an invoice
+func render(invoice model.Invoice, seller model.Seller) ([]byte, error) {
+	doc, err := einvoice.New(invoice, seller)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	return doc.Marshal()
+}
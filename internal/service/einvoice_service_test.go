@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"payment_service/config"
+	"payment_service/domain/model"
+	"payment_service/internal/einvoice"
+	"payment_service/internal/repository"
+)
+
+func TestEInvoiceIssueAndExport(t *testing.T) {
+	ctx := context.Background()
+	seller := model.Seller{
+		LegalName:        "Cong ty TNHH Vi Du",
+		TaxCode:          "0100109106",
+		Address:          "1 Trang Tien, Ha Noi",
+		EInvoiceTemplate: "1",
+		EInvoiceSeries:   "C26TAA",
+	}
+	brokenSeller := seller
+	brokenSeller.TaxCode = "12345"
+	merchants := repository.NewMemoryMerchantStore(
+		model.Merchant{TenantID: "brand-a", TmnCode: "BRANDA01", HashSecret: "secret", Active: true, Seller: seller},
+		model.Merchant{TenantID: "brand-b", TmnCode: "BRANDB01", HashSecret: "secret", Active: true},
+		model.Merchant{TenantID: "brand-c", TmnCode: "BRANDC01", HashSecret: "secret", Active: true, Seller: brokenSeller},
+	)
+	invoices := repository.NewMemoryInvoiceStore()
+	invoiceSvc := NewInvoiceService(repository.NewMemoryStore(invoices))
+	svc := NewEInvoiceService(invoiceSvc, NewMerchantService(merchants, config.NewVNPayStore(config.VNPayConfig{}), model.Seller{}))
+	svc.now = func() time.Time { return time.Date(2026, 5, 4, 3, 0, 0, 0, time.UTC) }
+
+	create := func(tenantID, txnRef string, status model.PaymentStatus) model.Invoice {
+		t.Helper()
+		invoice, err := invoiceSvc.CreateInvoice(ctx, model.Merchant{TenantID: tenantID}, model.VNPayPaymentRequest{
+			CustomerID: "customer-1",
+			Items:      []model.InvoiceItemRequest{{Description: "Adult ticket", Quantity: 2, UnitPrice: 100000, VATRate: 8}},
+			Buyer:      model.InvoiceBuyer{Name: "Nguyen Van A"},
+		}, txnRef)
+		if err != nil {
+			t.Fatalf("CreateInvoice: %v", err)
+		}
+		if status != model.PaymentStatusPending {
+			if err := invoiceSvc.UpdateInvoicePaymentStatus(ctx, tenantID, txnRef, status, nil, model.InvoiceChange{Actor: model.InvoiceActorIPN}); err != nil {
+				t.Fatalf("UpdateInvoicePaymentStatus: %v", err)
+			}
+		}
+		return invoice
+	}
+
+	first := create("brand-a", "4001", model.PaymentStatusCompleted)
+	second := create("brand-a", "4002", model.PaymentStatusCompleted)
+
+	// Exporting never issues the e-invoice
+	if _, _, err := svc.Export(ctx, "brand-a", first.InvoiceID); !errors.Is(err, ErrEInvoiceNotIssued) {
+		t.Errorf("Export before issuing error = %v, want ErrEInvoiceNotIssued", err)
+	}
+
+	// Each paid invoice is numbered once, in issue order
+	for _, tt := range []struct {
+		invoice model.Invoice
+		number  int
+	}{{second, 1}, {first, 2}, {second, 1}} {
+		invoice, err := svc.Issue(ctx, "brand-a", tt.invoice.InvoiceID)
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		if invoice.EInvoiceSeries != "C26TAA" || invoice.EInvoiceNumber != tt.number {
+			t.Errorf("e-invoice = %s/%d, want C26TAA/%d", invoice.EInvoiceSeries, invoice.EInvoiceNumber, tt.number)
+		}
+	}
+
+	for _, tt := range []struct {
+		invoice model.Invoice
+		number  int
+	}{{second, 1}, {first, 2}} {
+		invoice, body, err := svc.Export(ctx, "brand-a", tt.invoice.InvoiceID)
+		if err != nil {
+			t.Fatalf("Export: %v", err)
+		}
+		if invoice.EInvoiceNumber != tt.number {
+			t.Errorf("exported e-invoice number = %d, want %d", invoice.EInvoiceNumber, tt.number)
+		}
+		for _, want := range []string{"<NLap>2026-05-04</NLap>", "<HVTNMHang>Nguyen Van A</HVTNMHang>", "<TgTTTBSo>216000</TgTTTBSo>"} {
+			if !strings.Contains(string(body), want) {
+				t.Errorf("e-invoice does not contain %s", want)
+			}
+		}
+	}
+
+	pending := create("brand-a", "4003", model.PaymentStatusPending)
+	if _, err := svc.Issue(ctx, "brand-a", pending.InvoiceID); !errors.Is(err, ErrInvoiceNotPaid) {
+		t.Errorf("Issue of a pending invoice error = %v, want ErrInvoiceNotPaid", err)
+	}
+	if _, _, err := svc.Export(ctx, "brand-a", pending.InvoiceID); !errors.Is(err, ErrInvoiceNotPaid) {
+		t.Errorf("Export of a pending invoice error = %v, want ErrInvoiceNotPaid", err)
+	}
+	if _, err := svc.Issue(ctx, "brand-b", first.InvoiceID); !errors.Is(err, ErrSellerNotConfigured) {
+		t.Errorf("Issue without seller details error = %v, want ErrSellerNotConfigured", err)
+	}
+
+	// A document failing validation does not use up a number
+	broken := create("brand-c", "4004", model.PaymentStatusCompleted)
+	var invalid *einvoice.ValidationError
+	if _, err := svc.Issue(ctx, "brand-c", broken.InvoiceID); !errors.As(err, &invalid) {
+		t.Fatalf("Issue with an invalid seller tax code error = %v, want a ValidationError", err)
+	}
+	if number, err := invoices.NextEInvoiceNumber(ctx, "brand-c", "C26TAA"); err != nil || number != 1 {
+		t.Errorf("NextEInvoiceNumber after a rejected export = %d, %v, want 1", number, err)
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/tracing"
+)
+
+var (
+	// ErrInvoicePaid is returned when cancelling an invoice the customer has paid
+	ErrInvoicePaid = errors.New("invoice is paid")
+	// ErrInvoiceClosed is returned when cancelling or voiding an invoice that
+	// is already cancelled or voided
+	ErrInvoiceClosed = errors.New("invoice is already cancelled or voided")
+)
+
+// CancelInvoice cancels a tenant's unpaid invoice, so its tickets can be
+// released. Paid invoices cannot be cancelled; refund or void them instead.
+func (s *InvoiceService) CancelInvoice(ctx context.Context, tenantID string, id uuid.UUID, reason string) (model.Invoice, error) {
+	return s.closeInvoice(ctx, tenantID, id, model.PaymentStatusCancelled, reason)
+}
+
+// VoidInvoice voids a tenant's erroneous invoice, paid or not. Voiding does
+// not refund a paid invoice; the refund is requested separately.
+func (s *InvoiceService) VoidInvoice(ctx context.Context, tenantID string, id uuid.UUID, reason string) (model.Invoice, error) {
+	return s.closeInvoice(ctx, tenantID, id, model.PaymentStatusVoided, reason)
+}
+
+// closeInvoice cancels or voids an invoice and records the change in its
+// history and the matching event in the same transaction, locking the invoice so a concurrent IPN cannot
+// complete it in between
+func (s *InvoiceService) closeInvoice(ctx context.Context, tenantID string, id uuid.UUID, status model.PaymentStatus, reason string) (model.Invoice, error) {
+	action, eventType := "cancel", model.InvoiceEventCancelled
+	if status == model.PaymentStatusVoided {
+		action, eventType = "void", model.InvoiceEventVoided
+	}
+
+	err := s.WithTx(ctx, func(tx *InvoiceService) error {
+		invoice, err := tx.repo.GetInvoiceByIDForUpdate(ctx, tenantID, id)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case invoice.PaymentStatus.Closed():
+			return fmt.Errorf("%w: invoice %s is %s", ErrInvoiceClosed, id, invoice.PaymentStatus)
+		case status == model.PaymentStatusCancelled && invoice.PaymentStatus.Paid():
+			return fmt.Errorf("%w: invoice %s is %s, refund or void it instead", ErrInvoicePaid, id, invoice.PaymentStatus)
+		}
+
+		now := time.Now().UTC()
+		if err := tx.repo.CancelInvoice(ctx, tenantID, id, status, reason, now); err != nil {
+			return err
+		}
+		change := model.InvoiceChange{Actor: model.InvoiceActorAdmin, Reason: reason}
+		if err := tx.recordStatusChange(ctx, invoice, status, change); err != nil {
+			return err
+		}
+
+		invoices := []model.Invoice{invoice}
+		if err := tx.attachItems(ctx, invoices); err != nil {
+			return err
+		}
+
+		return tx.repo.CreateInvoiceEvent(ctx, model.InvoiceEvent{
+			EventID:        uuid.New(),
+			Type:           eventType,
+			TenantID:       tenantID,
+			InvoiceID:      id,
+			InvoiceNumber:  invoice.InvoiceNumber,
+			CustomerID:     invoice.CustomerID,
+			TicketIDs:      ticketIDs(invoices[0]),
+			PreviousStatus: invoice.PaymentStatus,
+			PaymentStatus:  status,
+			Reason:         reason,
+			OccurredAt:     now,
+			TraceContext:   tracing.Inject(ctx),
+		})
+	})
+	if err != nil {
+		return model.Invoice{}, fmt.Errorf("failed to %s invoice: %w", action, err)
+	}
+
+	return s.GetInvoiceByID(ctx, tenantID, id)
+}
+
+// ticketIDs lists the distinct tickets of an invoice and its items
+func ticketIDs(invoice model.Invoice) []string {
+	seen := make(map[string]bool)
+	ids := []string{}
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	add(invoice.TicketID)
+	for _, item := range invoice.Items {
+		add(item.TicketID)
+	}
+	return ids
+}
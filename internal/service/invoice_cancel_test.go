@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+)
+
+// recordingPublisher records published events and the trace each was
+// published in, failing once failAfter events were published
+type recordingPublisher struct {
+	events    []model.InvoiceEvent
+	traces    []trace.SpanContext
+	failAfter int
+}
+
+func (p *recordingPublisher) PublishInvoiceEvent(ctx context.Context, event model.InvoiceEvent) error {
+	if p.failAfter > 0 && len(p.events) >= p.failAfter {
+		return errors.New("broker unavailable")
+	}
+	p.events = append(p.events, event)
+	p.traces = append(p.traces, trace.SpanContextFromContext(ctx))
+	return nil
+}
+
+func TestCancelAndVoidInvoice(t *testing.T) {
+	ctx := context.Background()
+	svc, invoices := newTestVNPayService(t)
+	invoiceSvc := svc.invoiceSvc
+
+	pending := createTestPayment(t, svc, model.DefaultTenantID)
+	paid := createTestPayment(t, svc, model.DefaultTenantID)
+	if resp, _ := svc.ProcessIPN(ctx, signedCallback(testHashSecret, ipnParams(paid, "00"))); resp.RspCode != "00" {
+		t.Fatalf("IPN RspCode = %s, want 00", resp.RspCode)
+	}
+	pendingInvoice, _ := invoices.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, pending.Get("vnp_TxnRef"))
+	paidInvoice, _ := invoices.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, paid.Get("vnp_TxnRef"))
+
+	// Paid invoices cannot be cancelled, but can be voided
+	if _, err := invoiceSvc.CancelInvoice(ctx, model.DefaultTenantID, paidInvoice.InvoiceID, "changed mind"); !errors.Is(err, ErrInvoicePaid) {
+		t.Errorf("cancelling a paid invoice error = %v, want ErrInvoicePaid", err)
+	}
+	voided, err := invoiceSvc.VoidInvoice(ctx, model.DefaultTenantID, paidInvoice.InvoiceID, "wrong buyer")
+	if err != nil {
+		t.Fatalf("VoidInvoice: %v", err)
+	}
+	if voided.PaymentStatus != model.PaymentStatusVoided || voided.CancelReason != "wrong buyer" || voided.CancelledAt == nil {
+		t.Errorf("voided invoice = %s/%q/%v", voided.PaymentStatus, voided.CancelReason, voided.CancelledAt)
+	}
+
+	cancelled, err := invoiceSvc.CancelInvoice(ctx, model.DefaultTenantID, pendingInvoice.InvoiceID, "seat released")
+	if err != nil {
+		t.Fatalf("CancelInvoice: %v", err)
+	}
+	if cancelled.PaymentStatus != model.PaymentStatusCancelled {
+		t.Errorf("PaymentStatus = %s, want CANCELLED", cancelled.PaymentStatus)
+	}
+
+	// Cancelling and voiding are final
+	if _, err := invoiceSvc.VoidInvoice(ctx, model.DefaultTenantID, pendingInvoice.InvoiceID, "again"); !errors.Is(err, ErrInvoiceClosed) {
+		t.Errorf("voiding a cancelled invoice error = %v, want ErrInvoiceClosed", err)
+	}
+	if _, err := invoiceSvc.CancelInvoice(ctx, "other", pendingInvoice.InvoiceID, "again"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("cancelling another tenant's invoice error = %v, want ErrNotFound", err)
+	}
+
+	// A late payment callback leaves a cancelled invoice cancelled
+	if resp, _ := svc.ProcessIPN(ctx, signedCallback(testHashSecret, ipnParams(pending, "00"))); resp.RspCode != "02" {
+		t.Errorf("IPN for a cancelled invoice RspCode = %s, want 02", resp.RspCode)
+	}
+	if _, err := svc.ProcessReturn(ctx, signedCallback(testHashSecret, ipnParams(pending, "00"))); err != nil {
+		t.Fatalf("ProcessReturn: %v", err)
+	}
+	if got, _ := invoices.GetInvoiceByID(ctx, model.DefaultTenantID, pendingInvoice.InvoiceID); got.PaymentStatus != model.PaymentStatusCancelled {
+		t.Errorf("PaymentStatus after late callbacks = %s, want CANCELLED", got.PaymentStatus)
+	}
+
+	// Both changes were recorded as events, which the relay publishes once
+	publisher := &recordingPublisher{}
+	relay := NewInvoiceEventRelay(invoiceSvc, publisher, nil, 0)
+	if n, err := relay.Relay(ctx); err != nil || n != 2 {
+		t.Fatalf("Relay = %d, %v, want 2 events", n, err)
+	}
+	if n, err := relay.Relay(ctx); err != nil || n != 0 {
+		t.Errorf("second Relay = %d, %v, want nothing left to publish", n, err)
+	}
+
+	wantTypes := []model.InvoiceEventType{model.InvoiceEventVoided, model.InvoiceEventCancelled}
+	for i, event := range publisher.events {
+		if event.Type != wantTypes[i] {
+			t.Errorf("event %d type = %s, want %s", i, event.Type, wantTypes[i])
+		}
+	}
+	event := publisher.events[1]
+	if event.InvoiceID != pendingInvoice.InvoiceID || event.PreviousStatus != model.PaymentStatusPending ||
+		event.Reason != "seat released" || len(event.TicketIDs) != 1 || event.TicketIDs[0] != "ticket-1" {
+		t.Errorf("cancelled event = %+v", event)
+	}
+}
+
+func TestInvoiceEventRelayContinuesTrace(t *testing.T) {
+	svc, invoices := newTestVNPayService(t)
+	payment := createTestPayment(t, svc, model.DefaultTenantID)
+	invoice, _ := invoices.GetInvoiceByVNPayTxnRef(context.Background(), model.DefaultTenantID, payment.Get("vnp_TxnRef"))
+
+	// The invoice is cancelled in a request's trace
+	request := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), request)
+	if _, err := svc.invoiceSvc.CancelInvoice(ctx, model.DefaultTenantID, invoice.InvoiceID, "seat released"); err != nil {
+		t.Fatalf("CancelInvoice: %v", err)
+	}
+
+	// The relay runs outside the request, yet publishes the event in its trace
+	publisher := &recordingPublisher{}
+	if _, err := NewInvoiceEventRelay(svc.invoiceSvc, publisher, nil, 0).Relay(context.Background()); err != nil {
+		t.Fatalf("Relay: %v", err)
+	}
+	if len(publisher.traces) != 1 || publisher.traces[0].TraceID() != request.TraceID() || publisher.traces[0].SpanID() != request.SpanID() {
+		t.Errorf("event published in %v, want the trace of the cancelling request %v", publisher.traces, request)
+	}
+}
+
+func TestInvoiceEventRelayStopsAtFailure(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestVNPayService(t)
+
+	for i := 0; i < 3; i++ {
+		payment := createTestPayment(t, svc, model.DefaultTenantID)
+		invoice, err := svc.invoiceSvc.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, payment.Get("vnp_TxnRef"))
+		if err != nil {
+			t.Fatalf("GetInvoiceByVNPayTxnRef: %v", err)
+		}
+		if _, err := svc.invoiceSvc.CancelInvoice(ctx, model.DefaultTenantID, invoice.InvoiceID, "timeout"); err != nil {
+			t.Fatalf("CancelInvoice: %v", err)
+		}
+	}
+
+	publisher := &recordingPublisher{failAfter: 2}
+	relay := NewInvoiceEventRelay(svc.invoiceSvc, publisher, nil, 0)
+	if n, err := relay.Relay(ctx); err == nil || n != 2 {
+		t.Fatalf("Relay = %d, %v, want 2 events and an error", n, err)
+	}
+
+	// The events published before the failure are not sent again
+	publisher.failAfter = 0
+	if n, err := relay.Relay(ctx); err != nil || n != 1 {
+		t.Errorf("Relay after recovery = %d, %v, want the remaining event", n, err)
+	}
+	if len(publisher.events) != 3 {
+		t.Errorf("published %d events, want 3", len(publisher.events))
+	}
+}
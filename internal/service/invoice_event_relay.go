@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/tracing"
+	"payment_service/pkg/utils"
+)
+
+// relayBatchSize bounds how many events are published in one transaction
+const relayBatchSize = 100
+
+// EventPublisher delivers invoice events to downstream services
+type EventPublisher interface {
+	// PublishInvoiceEvent returns once the event has been durably accepted
+	PublishInvoiceEvent(ctx context.Context, event model.InvoiceEvent) error
+}
+
+// PublishInvoiceEvents publishes up to limit unpublished invoice events,
+// oldest first, and marks them published. Publishing stops at the first
+// failure; the events published before it are still marked.
+//
+// An event can be published again if marking it fails or the transaction is
+// retried, so consumers must deduplicate by event ID. Each event is published
+// in the trace of the request that recorded it.
+func (s *InvoiceService) PublishInvoiceEvents(ctx context.Context, publisher EventPublisher, limit int) (int, error) {
+	var published int
+	var publishErr error
+	err := s.WithTx(ctx, func(tx *InvoiceService) error {
+		published, publishErr = 0, nil
+
+		events, err := tx.repo.GetUnpublishedInvoiceEvents(ctx, limit)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]uuid.UUID, 0, len(events))
+		for _, event := range events {
+			if err := publisher.PublishInvoiceEvent(tracing.Extract(ctx, event.TraceContext), event); err != nil {
+				publishErr = fmt.Errorf("failed to publish invoice event %s: %w", event.EventID, err)
+				break
+			}
+			ids = append(ids, event.EventID)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		published = len(ids)
+		return tx.repo.MarkInvoiceEventsPublished(ctx, ids, time.Now())
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish invoice events: %w", err)
+	}
+	return published, publishErr
+}
+
+// InvoiceEventRelay periodically publishes the invoice events recorded in the outbox
+type InvoiceEventRelay struct {
+	invoiceSvc *InvoiceService
+	publisher  EventPublisher
+	logger     utils.Logger
+	interval   time.Duration
+}
+
+// NewInvoiceEventRelay creates a relay publishing pending events every interval
+func NewInvoiceEventRelay(invoiceSvc *InvoiceService, publisher EventPublisher, logger utils.Logger, interval time.Duration) *InvoiceEventRelay {
+	return &InvoiceEventRelay{
+		invoiceSvc: invoiceSvc,
+		publisher:  publisher,
+		logger:     logger,
+		interval:   interval,
+	}
+}
+
+// Run relays events every interval until the context is cancelled
+func (r *InvoiceEventRelay) Run(ctx context.Context) {
+	if r.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Relay(ctx); err != nil && ctx.Err() == nil {
+				r.logger.Error("Failed to relay invoice events: %v", err)
+			}
+		}
+	}
+}
+
+// Relay publishes every pending event, one batch per transaction, and
+// returns how many were published
+func (r *InvoiceEventRelay) Relay(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		published, err := r.invoiceSvc.PublishInvoiceEvents(ctx, r.publisher, relayBatchSize)
+		total += published
+		if err != nil {
+			return total, err
+		}
+		if published < relayBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"payment_service/pkg/utils"
+)
+
+// expiryBatchSize bounds how many invoices are expired in one transaction
+const expiryBatchSize = 100
+
+// InvoiceExpirer periodically marks invoices that stayed pending past the
+// payment window as failed
+type InvoiceExpirer struct {
+	invoiceSvc *InvoiceService
+	logger     utils.Logger
+	timeout    time.Duration
+	interval   time.Duration
+}
+
+// NewInvoiceExpirer creates an expirer failing invoices pending for longer
+// than timeout, checked every interval
+func NewInvoiceExpirer(invoiceSvc *InvoiceService, logger utils.Logger, timeout, interval time.Duration) *InvoiceExpirer {
+	return &InvoiceExpirer{
+		invoiceSvc: invoiceSvc,
+		logger:     logger,
+		timeout:    timeout,
+		interval:   interval,
+	}
+}
+
+// Run expires pending invoices every interval until the context is cancelled
+func (e *InvoiceExpirer) Run(ctx context.Context) {
+	if e.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := e.Expire(ctx); err != nil && ctx.Err() == nil {
+				e.logger.Error("Failed to expire pending invoices: %v", err)
+			}
+		}
+	}
+}
+
+// Expire marks every invoice pending for longer than the timeout as failed,
+// one batch per transaction, and returns how many were expired
+func (e *InvoiceExpirer) Expire(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-e.timeout)
+
+	total := 0
+	for {
+		expired, err := e.invoiceSvc.ExpirePendingInvoices(ctx, cutoff, expiryBatchSize)
+		if err != nil {
+			return total, err
+		}
+
+		for _, invoice := range expired {
+			e.logger.Info("Expired invoice %s (tenant %s, txn ref %s) pending since %s",
+				invoice.InvoiceNumber, invoice.TenantID, invoice.VNPayTxnRef, invoice.CreatedAt.Format(time.RFC3339))
+		}
+
+		total += len(expired)
+		if len(expired) < expiryBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"payment_service/domain/model"
+	"payment_service/internal/export"
+)
+
+// ErrExportTooLarge is returned when more invoices match an export than its format can hold
+var ErrExportTooLarge = errors.New("too many invoices to export")
+
+// ExportInvoices writes every invoice matching the filter to w in the given
+// format, oldest first, and returns the number of invoices written. Invoices
+// are streamed from the store one row at a time. Nothing is written to w
+// until the first invoice has been read, so a failed query can still be
+// reported to the caller in place of the export.
+func (s *InvoiceService) ExportInvoices(ctx context.Context, filter model.InvoiceFilter, format export.Format, w io.Writer) (int, error) {
+	filter.SortBy = model.InvoiceSortCreatedAt
+	filter.SortDesc = false
+
+	if format == export.FormatXLSX {
+		filter.Limit = 1
+		_, total, err := s.repo.SearchInvoices(ctx, filter)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count invoices to export: %w", err)
+		}
+		if total > export.MaxXLSXRows {
+			return 0, fmt.Errorf("%w: %d invoices exceed the %d rows of an XLSX sheet, narrow the date range or export CSV", ErrExportTooLarge, total, export.MaxXLSXRows)
+		}
+	}
+
+	var out export.Writer
+	count := 0
+	err := s.repo.StreamInvoices(ctx, filter, func(invoice model.Invoice) error {
+		if out == nil {
+			var err error
+			if out, err = export.NewWriter(format, w); err != nil {
+				return err
+			}
+		}
+		count++
+		return out.WriteInvoice(invoice)
+	})
+	if err != nil {
+		return count, fmt.Errorf("failed to export invoices: %w", err)
+	}
+
+	// An export without invoices still has its header row
+	if out == nil {
+		if out, err = export.NewWriter(format, w); err != nil {
+			return 0, fmt.Errorf("failed to export invoices: %w", err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return count, fmt.Errorf("failed to export invoices: %w", err)
+	}
+	return count, nil
+}
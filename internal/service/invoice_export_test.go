@@ -0,0 +1,84 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"payment_service/domain/model"
+	"payment_service/internal/export"
+	"payment_service/internal/repository"
+)
+
+func TestExportInvoices(t *testing.T) {
+	ctx := context.Background()
+	svc := NewInvoiceService(repository.NewMemoryStore(repository.NewMemoryInvoiceStore()))
+
+	var numbers []string
+	for i := 1; i <= 3; i++ {
+		txnRef := fmt.Sprint(6000 + i)
+		invoice, err := svc.CreateInvoice(ctx, model.Merchant{TenantID: "brand-a"}, model.VNPayPaymentRequest{
+			CustomerID: "customer-1",
+			Amount:     float64(i) * 100000,
+		}, txnRef)
+		if err != nil {
+			t.Fatalf("CreateInvoice: %v", err)
+		}
+		if i != 2 {
+			if err := svc.UpdateInvoicePaymentStatus(ctx, "brand-a", txnRef, model.PaymentStatusCompleted, nil, model.InvoiceChange{Actor: model.InvoiceActorIPN}); err != nil {
+				t.Fatalf("UpdateInvoicePaymentStatus: %v", err)
+			}
+			numbers = append(numbers, invoice.InvoiceNumber)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	from := time.Now().Add(-time.Hour)
+	to := time.Now().Add(time.Hour)
+	filter := model.InvoiceFilter{
+		TenantID:    "brand-a",
+		Statuses:    []model.PaymentStatus{model.PaymentStatusCompleted},
+		CreatedFrom: &from,
+		CreatedTo:   &to,
+	}
+
+	var buf bytes.Buffer
+	count, err := svc.ExportInvoices(ctx, filter, export.FormatCSV, &buf)
+	if err != nil {
+		t.Fatalf("ExportInvoices: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("exported %d invoices, want 2", count)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want a header and 2 rows", len(records))
+	}
+	// Exports run oldest first
+	for i, number := range numbers {
+		if records[i+1][1] != number {
+			t.Errorf("row %d invoice_number = %q, want %q", i+1, records[i+1][1], number)
+		}
+	}
+	if records[2][13] != "300000" {
+		t.Errorf("final_amount = %q, want 300000", records[2][13])
+	}
+
+	// An export without matches still has its header row
+	buf.Reset()
+	filter.TenantID = "brand-b"
+	if count, err := svc.ExportInvoices(ctx, filter, export.FormatCSV, &buf); err != nil || count != 0 {
+		t.Fatalf("ExportInvoices of another tenant = %d, %v", count, err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 1 {
+		t.Errorf("empty export has %d lines, want only the header", lines)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"payment_service/domain/model"
+)
+
+// RecordVNPayFee records the merchant fee VNPay charged on a completed
+// invoice's payment and posts it to the ledger
+func (s *InvoiceService) RecordVNPayFee(ctx context.Context, invoice model.Invoice, fee float64) error {
+	fee = model.RoundAmount(fee)
+	err := s.WithTx(ctx, func(tx *InvoiceService) error {
+		if err := tx.repo.SetInvoiceVNPayFee(ctx, invoice.TenantID, invoice.InvoiceID, fee); err != nil {
+			return err
+		}
+		return postFee(ctx, tx.store.Ledger(), invoice, fee, time.Now().UTC())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record VNPay fee: %w", err)
+	}
+	return nil
+}
+
+// FeeReport totals the final amounts and VNPay fees of the paid invoices
+// matching the filter, per bank code and card type
+func (s *InvoiceService) FeeReport(ctx context.Context, filter model.InvoiceFilter) (model.FeeReport, error) {
+	filter.Statuses = []model.PaymentStatus{model.PaymentStatusCompleted, model.PaymentStatusRefunded}
+	filter.SortBy = model.InvoiceSortCreatedAt
+
+	type key struct{ bankCode, cardType string }
+	lines := make(map[key]*model.FeeReportLine)
+	report := model.FeeReport{Lines: []model.FeeReportLine{}}
+	err := s.repo.StreamInvoices(ctx, filter, func(invoice model.Invoice) error {
+		k := key{invoice.VNPayBankCode, invoice.VNPayCardType}
+		line, ok := lines[k]
+		if !ok {
+			line = &model.FeeReportLine{BankCode: k.bankCode, CardType: k.cardType}
+			lines[k] = line
+		}
+		for _, total := range []*model.FeeReportLine{line, &report.Total} {
+			total.InvoiceCount++
+			total.GrossAmount = model.RoundAmount(total.GrossAmount + invoice.FinalAmount)
+			total.FeeAmount = model.RoundAmount(total.FeeAmount + invoice.VNPayFee)
+			total.NetAmount = model.RoundAmount(total.NetAmount + invoice.NetAmount())
+		}
+		return nil
+	})
+	if err != nil {
+		return model.FeeReport{}, fmt.Errorf("failed to report VNPay fees: %w", err)
+	}
+
+	for _, line := range lines {
+		report.Lines = append(report.Lines, *line)
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		if report.Lines[i].BankCode != report.Lines[j].BankCode {
+			return report.Lines[i].BankCode < report.Lines[j].BankCode
+		}
+		return report.Lines[i].CardType < report.Lines[j].CardType
+	})
+	return report, nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+)
+
+func TestVNPayFees(t *testing.T) {
+	ctx := context.Background()
+	svc, invoices := newTestVNPayService(t)
+	ledgerSvc := NewLedgerService(svc.invoiceSvc.store)
+
+	cfg := *svc.config.Load()
+	cfg.FeeRatePercent = 2
+	svc.config.Store(cfg)
+	svc.merchantSvc.repo.(*repository.MemoryMerchantStore).AddVNPayFeeRules(
+		model.VNPayFeeRule{TenantID: model.DefaultTenantID, BankCode: "NCB", RatePercent: 1.1, FixedFee: 1650},
+		model.VNPayFeeRule{TenantID: model.DefaultTenantID, BankCode: "NCB", CardType: "ATM", RatePercent: 0.5, MinFee: 3000},
+		model.VNPayFeeRule{TenantID: model.DefaultTenantID, CardType: "INTCARD", RatePercent: 2.5, FixedFee: 2000},
+		model.VNPayFeeRule{TenantID: "tenant-b", RatePercent: 10},
+	)
+
+	// Each invoice's final amount is 95000
+	for _, tt := range []struct {
+		bankCode, cardType string
+		wantFee            float64
+	}{
+		{"NCB", "ATM", 3000},     // bank and card rule, raised to its minimum
+		{"NCB", "QRCODE", 2695},  // bank rule
+		{"VCB", "INTCARD", 4375}, // card rule
+		{"VCB", "ATM", 1900},     // configured fee
+		{"ncb", "atm", 3000},     // codes match case-insensitively
+	} {
+		payment := createTestPayment(t, svc, model.DefaultTenantID)
+		params := ipnParams(payment, "00")
+		params["vnp_BankCode"], params["vnp_CardType"] = tt.bankCode, tt.cardType
+		if resp, _ := svc.ProcessIPN(ctx, signedCallback(testHashSecret, params)); resp.RspCode != "00" {
+			t.Fatalf("IPN RspCode = %s, want 00", resp.RspCode)
+		}
+
+		invoice, err := invoices.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, payment.Get("vnp_TxnRef"))
+		if err != nil {
+			t.Fatalf("GetInvoiceByVNPayTxnRef: %v", err)
+		}
+		if invoice.VNPayCardType != tt.cardType || invoice.VNPayFee != tt.wantFee {
+			t.Errorf("%s %s: card type %q, fee %.2f, want %q, %.2f", tt.bankCode, tt.cardType, invoice.VNPayCardType, invoice.VNPayFee, tt.cardType, tt.wantFee)
+		}
+		if invoice.NetAmount() != 95000-tt.wantFee {
+			t.Errorf("%s %s: NetAmount = %.2f, want %.2f", tt.bankCode, tt.cardType, invoice.NetAmount(), 95000-tt.wantFee)
+		}
+	}
+
+	// A failed payment is charged nothing and left out of the report
+	failed := createTestPayment(t, svc, model.DefaultTenantID)
+	if resp, _ := svc.ProcessIPN(ctx, signedCallback(testHashSecret, ipnParams(failed, "24"))); resp.RspCode != "00" {
+		t.Fatalf("IPN RspCode = %s, want 00", resp.RspCode)
+	}
+
+	balances, err := ledgerSvc.GetBalances(ctx, model.DefaultTenantID, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("GetBalances: %v", err)
+	}
+	for _, balance := range balances.Accounts {
+		switch balance.Account {
+		case model.LedgerAccountFees:
+			if balance.Balance != 14970 {
+				t.Errorf("fees balance = %.2f, want 14970", balance.Balance)
+			}
+		case model.LedgerAccountVNPayClearing:
+			if balance.Balance != 5*95000-14970 {
+				t.Errorf("clearing balance = %.2f, want %d", balance.Balance, 5*95000-14970)
+			}
+		}
+	}
+	if problems, err := ledgerSvc.CheckLedger(ctx, model.DefaultTenantID); err != nil || len(problems) != 0 {
+		t.Fatalf("CheckLedger = %v, %v, want a consistent ledger", problems, err)
+	}
+
+	report, err := svc.invoiceSvc.FeeReport(ctx, model.InvoiceFilter{TenantID: model.DefaultTenantID})
+	if err != nil {
+		t.Fatalf("FeeReport: %v", err)
+	}
+	want := []model.FeeReportLine{
+		{BankCode: "NCB", CardType: "ATM", InvoiceCount: 1, GrossAmount: 95000, FeeAmount: 3000, NetAmount: 92000},
+		{BankCode: "NCB", CardType: "QRCODE", InvoiceCount: 1, GrossAmount: 95000, FeeAmount: 2695, NetAmount: 92305},
+		{BankCode: "VCB", CardType: "ATM", InvoiceCount: 1, GrossAmount: 95000, FeeAmount: 1900, NetAmount: 93100},
+		{BankCode: "VCB", CardType: "INTCARD", InvoiceCount: 1, GrossAmount: 95000, FeeAmount: 4375, NetAmount: 90625},
+		{BankCode: "ncb", CardType: "atm", InvoiceCount: 1, GrossAmount: 95000, FeeAmount: 3000, NetAmount: 92000},
+	}
+	if len(report.Lines) != len(want) {
+		t.Fatalf("got %d report lines, want %d: %+v", len(report.Lines), len(want), report.Lines)
+	}
+	for i := range want {
+		if report.Lines[i] != want[i] {
+			t.Errorf("report line %d = %+v, want %+v", i, report.Lines[i], want[i])
+		}
+	}
+	wantTotal := model.FeeReportLine{InvoiceCount: 5, GrossAmount: 475000, FeeAmount: 14970, NetAmount: 460030}
+	if report.Total != wantTotal {
+		t.Errorf("report total = %+v, want %+v", report.Total, wantTotal)
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/einvoice"
+)
+
+// FieldViolation describes why a single request field was rejected
+type FieldViolation struct {
+	Field   string
+	Message string
+}
+
+// InvoiceValidationError is returned when the amounts or items of an invoice
+// request are inconsistent
+type InvoiceValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *InvoiceValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.Field+" "+v.Message)
+	}
+	return "invalid invoice: " + strings.Join(msgs, "; ")
+}
+
+// invoiceAmounts are the totals of an invoice computed from its items
+type invoiceAmounts struct {
+	total    float64
+	discount float64
+	tax      float64
+}
+
+// buildInvoiceItems computes the lines of an invoice request and the invoice
+// totals, checking any totals the client sent against the computed ones
+func buildInvoiceItems(req model.VNPayPaymentRequest) ([]model.InvoiceItem, invoiceAmounts, error) {
+	var violations []FieldViolation
+	var amounts invoiceAmounts
+
+	items := make([]model.InvoiceItem, 0, len(req.Items))
+	for i, line := range req.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		item := model.InvoiceItem{
+			LineNumber:     i + 1,
+			TicketID:       strings.TrimSpace(line.TicketID),
+			Description:    strings.TrimSpace(line.Description),
+			Quantity:       line.Quantity,
+			UnitPrice:      model.RoundAmount(line.UnitPrice),
+			DiscountAmount: model.RoundAmount(line.DiscountAmount),
+			VATRate:        line.VATRate,
+		}
+
+		if item.Description == "" {
+			violations = append(violations, FieldViolation{field + ".description", "is required"})
+		}
+		if item.Quantity <= 0 {
+			violations = append(violations, FieldViolation{field + ".quantity", "must be greater than 0"})
+		}
+		if item.UnitPrice < 0 {
+			violations = append(violations, FieldViolation{field + ".unit_price", "must not be negative"})
+		}
+		if !validVATRate(item.VATRate) {
+			violations = append(violations, FieldViolation{field + ".vat_rate", "must be one of: " + vatRateList()})
+		}
+
+		gross := item.GrossAmount()
+		if item.DiscountAmount < 0 || item.DiscountAmount > gross {
+			violations = append(violations, FieldViolation{field + ".discount_amount", "must be between 0 and the line amount"})
+		}
+
+		// VAT is charged on the discounted line amount
+		item.Subtotal = model.RoundAmount(gross - item.DiscountAmount)
+		item.TaxAmount = model.RoundAmount(item.Subtotal * item.VATRate / 100)
+		item.TotalAmount = model.RoundAmount(item.Subtotal + item.TaxAmount)
+
+		amounts.total = model.RoundAmount(amounts.total + gross)
+		amounts.discount = model.RoundAmount(amounts.discount + item.DiscountAmount)
+		amounts.tax = model.RoundAmount(amounts.tax + item.TaxAmount)
+		items = append(items, item)
+	}
+
+	// Totals sent alongside items must agree with the computed totals
+	for _, check := range []struct {
+		field    string
+		sent     float64
+		computed float64
+	}{
+		{"amount", req.Amount, amounts.total},
+		{"discount_amount", req.DiscountAmount, amounts.discount},
+		{"tax_amount", req.TaxAmount, amounts.tax},
+	} {
+		if check.sent != 0 && math.Abs(check.sent-check.computed) >= 0.005 {
+			violations = append(violations, FieldViolation{check.field, fmt.Sprintf("does not match the items total of %.2f", check.computed)})
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, invoiceAmounts{}, &InvoiceValidationError{Violations: violations}
+	}
+	return items, amounts, nil
+}
+
+// buildInvoiceBuyer trims the buyer details of a request and checks that an
+// organization buyer's tax code is well formed
+func buildInvoiceBuyer(req model.InvoiceBuyer) (model.InvoiceBuyer, []FieldViolation) {
+	buyer := model.InvoiceBuyer{
+		Name:    strings.TrimSpace(req.Name),
+		TaxCode: strings.TrimSpace(req.TaxCode),
+		Address: strings.TrimSpace(req.Address),
+		Email:   strings.TrimSpace(req.Email),
+	}
+
+	var violations []FieldViolation
+	if buyer.TaxCode != "" {
+		if !einvoice.ValidTaxCode(buyer.TaxCode) {
+			violations = append(violations, FieldViolation{"buyer.tax_code", "must be 10 digits, or 10 digits, a hyphen and 3 digits"})
+		}
+		if buyer.Name == "" {
+			violations = append(violations, FieldViolation{"buyer.name", "is required with a tax code"})
+		}
+		if buyer.Address == "" {
+			violations = append(violations, FieldViolation{"buyer.address", "is required with a tax code"})
+		}
+	}
+	return buyer, violations
+}
+
+// validVATRate reports whether rate is one of the VAT rates items may carry
+func validVATRate(rate float64) bool {
+	for _, valid := range model.VATRates {
+		if rate == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// vatRateList returns the valid VAT rates as a comma-separated list
+func vatRateList() string {
+	rates := make([]string, len(model.VATRates))
+	for i, rate := range model.VATRates {
+		rates[i] = strconv.FormatFloat(rate, 'f', -1, 64)
+	}
+	return strings.Join(rates, ", ")
+}
+
+// attachItems loads the items of the given invoices and their tax breakdown
+func (s *InvoiceService) attachItems(ctx context.Context, invoices []model.Invoice) error {
+	if len(invoices) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(invoices))
+	for i, invoice := range invoices {
+		ids[i] = invoice.InvoiceID
+	}
+
+	items, err := s.repo.GetInvoiceItems(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("failed to get invoice items: %w", err)
+	}
+
+	for i := range invoices {
+		invoices[i].Items = items[invoices[i].InvoiceID]
+		if len(invoices[i].Items) > 0 {
+			invoices[i].TaxBreakdown = model.TaxBreakdown(invoices[i].Items)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"payment_service/domain/model"
+)
+
+// ErrInvalidRefundAmount is returned when a refund is not positive or exceeds what is left of the invoice's payment
+var ErrInvalidRefundAmount = errors.New("invalid refund amount")
+
+// RefundInvoice refunds part or all of a tenant's paid invoice, posting the
+// refund to the ledger in the same transaction. A completed invoice stays
+// COMPLETED until its refunds add up to its final amount, when it is marked
+// REFUNDED and the change recorded in its history. A voided invoice whose
+// payment was posted can be refunded too and stays VOIDED.
+func (s *InvoiceService) RefundInvoice(ctx context.Context, tenantID string, txnRef string, amount float64, change model.InvoiceChange) error {
+	amount = model.RoundAmount(amount)
+	err := s.WithTx(ctx, func(tx *InvoiceService) error {
+		invoice, err := tx.repo.GetInvoiceByVNPayTxnRefForUpdate(ctx, tenantID, txnRef)
+		if err != nil {
+			return err
+		}
+
+		paid := invoice.PaymentStatus.Paid()
+		if invoice.PaymentStatus == model.PaymentStatusVoided {
+			// Invoices may be voided before or after they were paid
+			paid, err = tx.store.Ledger().LedgerTransactionExists(ctx, tenantID, model.LedgerPayment, invoice.InvoiceID.String())
+			if err != nil {
+				return err
+			}
+		}
+		if !paid {
+			return fmt.Errorf("%w: invoice %s is %s", ErrInvoiceNotPaid, invoice.InvoiceID, invoice.PaymentStatus)
+		}
+
+		remaining := model.RoundAmount(invoice.FinalAmount - invoice.RefundedAmount)
+		if amount <= 0 || amount > remaining {
+			return fmt.Errorf("%w: %.2f must be positive and at most the %.2f left of invoice %s", ErrInvalidRefundAmount, amount, remaining, invoice.InvoiceID)
+		}
+
+		refunded := model.RoundAmount(invoice.RefundedAmount + amount)
+		if err := tx.repo.SetInvoiceRefundedAmount(ctx, tenantID, invoice.InvoiceID, refunded); err != nil {
+			return err
+		}
+		if invoice.PaymentStatus == model.PaymentStatusCompleted && refunded >= model.RoundAmount(invoice.FinalAmount) {
+			if err := tx.repo.UpdateInvoicePaymentStatus(ctx, tenantID, txnRef, model.PaymentStatusRefunded, nil); err != nil {
+				return err
+			}
+			if err := tx.recordStatusChange(ctx, invoice, model.PaymentStatusRefunded, change); err != nil {
+				return err
+			}
+		}
+		return postRefund(ctx, tx.store.Ledger(), invoice, amount, time.Now().UTC())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refund invoice: %w", err)
+	}
+	return nil
+}
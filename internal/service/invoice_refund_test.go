@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+)
+
+func TestRefundInvoiceInParts(t *testing.T) {
+	ctx := context.Background()
+	svc, invoices := newTestVNPayService(t)
+	invoiceSvc := svc.invoiceSvc
+	ledger := invoiceSvc.store.Ledger()
+
+	payment := createTestPayment(t, svc, model.DefaultTenantID)
+	if resp, _ := svc.ProcessIPN(ctx, signedCallback(testHashSecret, ipnParams(payment, "00"))); resp.RspCode != "00" {
+		t.Fatalf("IPN RspCode = %s, want 00", resp.RspCode)
+	}
+	txnRef := payment.Get("vnp_TxnRef")
+	change := model.InvoiceChange{Actor: model.InvoiceActorAdmin}
+
+	// A partial refund leaves the 95000 invoice completed
+	if err := invoiceSvc.RefundInvoice(ctx, model.DefaultTenantID, txnRef, 30000, change); err != nil {
+		t.Fatalf("first RefundInvoice: %v", err)
+	}
+	invoice, _ := invoices.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, txnRef)
+	if invoice.PaymentStatus != model.PaymentStatusCompleted || invoice.RefundedAmount != 30000 {
+		t.Errorf("after a partial refund invoice = %s refunded %.2f, want COMPLETED refunded 30000", invoice.PaymentStatus, invoice.RefundedAmount)
+	}
+
+	// Refunds never add up to more than the payment
+	if err := invoiceSvc.RefundInvoice(ctx, model.DefaultTenantID, txnRef, 65001, change); !errors.Is(err, ErrInvalidRefundAmount) {
+		t.Errorf("refund above the amount left error = %v, want ErrInvalidRefundAmount", err)
+	}
+
+	// Refunding the rest marks the invoice refunded
+	if err := invoiceSvc.RefundInvoice(ctx, model.DefaultTenantID, txnRef, 65000, change); err != nil {
+		t.Fatalf("second RefundInvoice: %v", err)
+	}
+	invoice, _ = invoices.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, txnRef)
+	if invoice.PaymentStatus != model.PaymentStatusRefunded || invoice.RefundedAmount != 95000 {
+		t.Errorf("after refunding the rest invoice = %s refunded %.2f, want REFUNDED refunded 95000", invoice.PaymentStatus, invoice.RefundedAmount)
+	}
+	if err := invoiceSvc.RefundInvoice(ctx, model.DefaultTenantID, txnRef, 1, change); !errors.Is(err, ErrInvalidRefundAmount) {
+		t.Errorf("refunding a refunded invoice error = %v, want ErrInvalidRefundAmount", err)
+	}
+
+	// Each refund is posted under its own reference
+	references := make(map[string]float64)
+	err := ledger.StreamLedgerTransactions(ctx, model.DefaultTenantID, func(txn model.LedgerTransaction) error {
+		if txn.Kind == model.LedgerRefund {
+			references[txn.Reference] = clearingAmount(txn)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamLedgerTransactions: %v", err)
+	}
+	if len(references) != 2 {
+		t.Errorf("refunds posted under %d references, want 2: %v", len(references), references)
+	}
+
+	if problems, err := NewLedgerService(invoiceSvc.store).CheckLedger(ctx, model.DefaultTenantID); err != nil || len(problems) != 0 {
+		t.Errorf("CheckLedger = %v, %v, want a consistent ledger", problems, err)
+	}
+}
+
+func TestRefundClosedInvoice(t *testing.T) {
+	ctx := context.Background()
+	svc, invoices := newTestVNPayService(t)
+	invoiceSvc := svc.invoiceSvc
+	change := model.InvoiceChange{Actor: model.InvoiceActorAdmin}
+
+	paid := createTestPayment(t, svc, model.DefaultTenantID)
+	if resp, _ := svc.ProcessIPN(ctx, signedCallback(testHashSecret, ipnParams(paid, "00"))); resp.RspCode != "00" {
+		t.Fatalf("IPN RspCode = %s, want 00", resp.RspCode)
+	}
+	unpaid := createTestPayment(t, svc, model.DefaultTenantID)
+	cancelled := createTestPayment(t, svc, model.DefaultTenantID)
+	for _, payment := range []struct {
+		txnRef string
+		close  func(context.Context, string, uuid.UUID, string) (model.Invoice, error)
+	}{
+		{paid.Get("vnp_TxnRef"), invoiceSvc.VoidInvoice},
+		{unpaid.Get("vnp_TxnRef"), invoiceSvc.VoidInvoice},
+		{cancelled.Get("vnp_TxnRef"), invoiceSvc.CancelInvoice},
+	} {
+		invoice, _ := invoices.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, payment.txnRef)
+		if _, err := payment.close(ctx, model.DefaultTenantID, invoice.InvoiceID, "wrong buyer"); err != nil {
+			t.Fatalf("closing invoice %s: %v", invoice.InvoiceNumber, err)
+		}
+	}
+
+	// Closed invoices that were never paid have nothing to refund
+	for _, txnRef := range []string{unpaid.Get("vnp_TxnRef"), cancelled.Get("vnp_TxnRef")} {
+		if err := invoiceSvc.RefundInvoice(ctx, model.DefaultTenantID, txnRef, 1000, change); !errors.Is(err, ErrInvoiceNotPaid) {
+			t.Errorf("refunding unpaid invoice %s error = %v, want ErrInvoiceNotPaid", txnRef, err)
+		}
+	}
+
+	// The payment of a voided invoice is refunded, and the invoice stays voided
+	txnRef := paid.Get("vnp_TxnRef")
+	if err := invoiceSvc.RefundInvoice(ctx, model.DefaultTenantID, txnRef, 95000, change); err != nil {
+		t.Fatalf("RefundInvoice: %v", err)
+	}
+	invoice, _ := invoices.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, txnRef)
+	if invoice.PaymentStatus != model.PaymentStatusVoided || invoice.RefundedAmount != 95000 {
+		t.Errorf("refunded voided invoice = %s refunded %.2f, want VOIDED refunded 95000", invoice.PaymentStatus, invoice.RefundedAmount)
+	}
+	if err := invoiceSvc.RefundInvoice(ctx, model.DefaultTenantID, txnRef, 1, change); !errors.Is(err, ErrInvalidRefundAmount) {
+		t.Errorf("refunding more than the payment error = %v, want ErrInvalidRefundAmount", err)
+	}
+
+	var refunds []model.LedgerTransaction
+	err := invoiceSvc.store.Ledger().StreamLedgerTransactions(ctx, model.DefaultTenantID, func(txn model.LedgerTransaction) error {
+		if txn.Kind == model.LedgerRefund {
+			refunds = append(refunds, txn)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamLedgerTransactions: %v", err)
+	}
+	if len(refunds) != 1 || *refunds[0].InvoiceID != invoice.InvoiceID || clearingAmount(refunds[0]) != 95000 {
+		t.Errorf("refunds posted = %+v, want one of 95000 for the voided invoice", refunds)
+	}
+
+	if problems, err := NewLedgerService(invoiceSvc.store).CheckLedger(ctx, model.DefaultTenantID); err != nil || len(problems) != 0 {
+		t.Errorf("CheckLedger = %v, %v, want a consistent ledger", problems, err)
+	}
+}
+
+func TestRefundTransactionAmount(t *testing.T) {
+	ctx := context.Background()
+	svc, invoices := newTestVNPayService(t)
+
+	payment := createTestPayment(t, svc, model.DefaultTenantID)
+	if resp, _ := svc.ProcessIPN(ctx, signedCallback(testHashSecret, ipnParams(payment, "00"))); resp.RspCode != "00" {
+		t.Fatalf("IPN RspCode = %s, want 00", resp.RspCode)
+	}
+
+	// VNPay is sent the amount posted, both rounded to the cent
+	txnRef := payment.Get("vnp_TxnRef")
+	refundRequest := model.VNPayRefundRequest{TxnRef: txnRef, Amount: 1000.2899, TransactionType: "03", TransactionDate: "20260101120000", CreateBy: "staff-1"}
+	refundData, err := svc.RefundTransaction(ctx, model.DefaultTenantID, refundRequest, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("RefundTransaction: %v", err)
+	}
+	if refundData["vnp_Amount"] != "100029" {
+		t.Errorf("vnp_Amount = %s, want 100029", refundData["vnp_Amount"])
+	}
+	invoice, _ := invoices.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, txnRef)
+	if invoice.RefundedAmount != 1000.29 {
+		t.Errorf("RefundedAmount = %v, want 1000.29", invoice.RefundedAmount)
+	}
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+)
+
+var (
+	// ErrSettlementExists is returned when a settlement reference was already posted
+	ErrSettlementExists = errors.New("settlement already posted")
+	// ErrInvalidSettlement is returned when a settlement's fee exceeds its amount
+	ErrInvalidSettlement = errors.New("invalid settlement")
+)
+
+// LedgerService posts settlements to the double-entry ledger and reports on
+// it. Payments and refunds are posted by the invoice service, in the
+// transaction that changes the invoice.
+type LedgerService struct {
+	ledger   repository.LedgerStore
+	invoices repository.InvoiceStore
+}
+
+// NewLedgerService creates a new ledger service
+func NewLedgerService(store repository.Store) *LedgerService {
+	return &LedgerService{
+		ledger:   store.Ledger(),
+		invoices: store.Invoices(),
+	}
+}
+
+// PostSettlement records VNPay paying amount, less its fee, into a tenant's
+// bank account. Each settlement reference is posted once.
+func (s *LedgerService) PostSettlement(ctx context.Context, tenantID string, reference string, amount float64, fee float64, settledAt time.Time) (model.LedgerTransaction, error) {
+	amount, fee = model.RoundAmount(amount), model.RoundAmount(fee)
+	if amount <= 0 || fee < 0 || fee > amount {
+		return model.LedgerTransaction{}, fmt.Errorf("%w: fee %.2f must be between 0 and the settled amount %.2f", ErrInvalidSettlement, fee, amount)
+	}
+
+	var entries []model.LedgerEntry
+	if net := model.RoundAmount(amount - fee); net > 0 {
+		entries = append(entries, model.LedgerEntry{Account: model.LedgerAccountBank, Debit: net})
+	}
+	if fee > 0 {
+		entries = append(entries, model.LedgerEntry{Account: model.LedgerAccountFees, Debit: fee})
+	}
+	entries = append(entries, model.LedgerEntry{Account: model.LedgerAccountVNPayClearing, Credit: amount})
+
+	txn := model.LedgerTransaction{
+		TransactionID: uuid.New(),
+		TenantID:      tenantID,
+		Kind:          model.LedgerSettlement,
+		Reference:     reference,
+		Description:   "VNPay settlement " + reference,
+		PostedAt:      settledAt.UTC(),
+		Entries:       entries,
+	}
+	if err := s.ledger.PostLedgerTransaction(ctx, txn); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			return model.LedgerTransaction{}, fmt.Errorf("%w: %s", ErrSettlementExists, reference)
+		}
+		return model.LedgerTransaction{}, fmt.Errorf("failed to post settlement: %w", err)
+	}
+	return txn, nil
+}
+
+// GetBalances returns the balance of every ledger account of a tenant from
+// the entries posted before asOf
+func (s *LedgerService) GetBalances(ctx context.Context, tenantID string, asOf time.Time) (model.LedgerBalances, error) {
+	totals, err := s.ledger.GetLedgerBalances(ctx, tenantID, asOf)
+	if err != nil {
+		return model.LedgerBalances{}, fmt.Errorf("failed to get ledger balances: %w", err)
+	}
+
+	byAccount := make(map[model.LedgerAccount]model.LedgerBalance, len(totals))
+	for _, total := range totals {
+		byAccount[total.Account] = total
+	}
+
+	balances := model.LedgerBalances{AsOf: asOf.UTC(), Accounts: make([]model.LedgerBalance, 0, len(model.LedgerAccounts))}
+	for _, account := range model.LedgerAccounts {
+		balance := byAccount[account]
+		balance.Account = account
+		if account.DebitNormal() {
+			balance.Balance = model.RoundAmount(balance.Debit - balance.Credit)
+		} else {
+			balance.Balance = model.RoundAmount(balance.Credit - balance.Debit)
+		}
+		balances.Accounts = append(balances.Accounts, balance)
+	}
+	return balances, nil
+}
+
+// CheckLedger verifies a tenant's ledger and returns the problems found:
+//   - every transaction has valid entries on known accounts and balances
+//   - every completed or refunded invoice has its payment posted for its
+//     final amount, every refunded invoice its refund, every invoice its
+//     refunded amount and every invoice charged a VNPay fee its fee
+//   - payments, refunds and fees belong to invoices that were paid, and
+//     refunds do not exceed the payment
+func (s *LedgerService) CheckLedger(ctx context.Context, tenantID string) ([]string, error) {
+	known := make(map[model.LedgerAccount]bool, len(model.LedgerAccounts))
+	for _, account := range model.LedgerAccounts {
+		known[account] = true
+	}
+
+	var problems []string
+	payments := make(map[uuid.UUID]float64)
+	refunds := make(map[uuid.UUID]float64)
+	fees := make(map[uuid.UUID]float64)
+	err := s.ledger.StreamLedgerTransactions(ctx, tenantID, func(txn model.LedgerTransaction) error {
+		for i, entry := range txn.Entries {
+			if !known[entry.Account] {
+				problems = append(problems, fmt.Sprintf("transaction %s entry %d: unknown account %q", txn.TransactionID, i, entry.Account))
+			}
+			if (entry.Debit > 0) == (entry.Credit > 0) || entry.Debit < 0 || entry.Credit < 0 {
+				problems = append(problems, fmt.Sprintf("transaction %s entry %d: must either debit or credit a positive amount", txn.TransactionID, i))
+			}
+		}
+		if !txn.Balanced() {
+			problems = append(problems, fmt.Sprintf("transaction %s (%s %s) is not balanced", txn.TransactionID, txn.Kind, txn.Reference))
+		}
+
+		switch txn.Kind {
+		case model.LedgerPayment, model.LedgerRefund, model.LedgerFee:
+			if txn.InvoiceID == nil {
+				problems = append(problems, fmt.Sprintf("%s %s has no invoice", txn.Kind, txn.TransactionID))
+				return nil
+			}
+			amounts := payments
+			switch txn.Kind {
+			case model.LedgerRefund:
+				amounts = refunds
+			case model.LedgerFee:
+				amounts = fees
+			}
+			amounts[*txn.InvoiceID] = model.RoundAmount(amounts[*txn.InvoiceID] + clearingAmount(txn))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger: %w", err)
+	}
+
+	paidStatuses := []model.PaymentStatus{model.PaymentStatusCompleted, model.PaymentStatusRefunded, model.PaymentStatusVoided}
+	paidInvoices := make(map[uuid.UUID]bool)
+	err = s.invoices.StreamInvoices(ctx, model.InvoiceFilter{TenantID: tenantID, Statuses: paidStatuses, SortBy: model.InvoiceSortCreatedAt}, func(invoice model.Invoice) error {
+		paidInvoices[invoice.InvoiceID] = true
+		paid, posted := payments[invoice.InvoiceID]
+		refunded, refundPosted := refunds[invoice.InvoiceID]
+
+		// A voided invoice may or may not have been paid before it was voided
+		if invoice.PaymentStatus.Paid() && invoice.FinalAmount > 0 {
+			switch {
+			case !posted:
+				problems = append(problems, fmt.Sprintf("invoice %s is %s but its payment is not posted", invoice.InvoiceNumber, invoice.PaymentStatus))
+			case paid != model.RoundAmount(invoice.FinalAmount):
+				problems = append(problems, fmt.Sprintf("invoice %s payment posted as %.2f, want %.2f", invoice.InvoiceNumber, paid, invoice.FinalAmount))
+			}
+		}
+		if invoice.PaymentStatus == model.PaymentStatusRefunded && invoice.FinalAmount > 0 && !refundPosted {
+			problems = append(problems, fmt.Sprintf("invoice %s is REFUNDED but its refund is not posted", invoice.InvoiceNumber))
+		}
+		if amount := model.RoundAmount(invoice.RefundedAmount); refunded != amount {
+			problems = append(problems, fmt.Sprintf("invoice %s refunds posted as %.2f, want %.2f", invoice.InvoiceNumber, refunded, amount))
+		}
+		if fee := model.RoundAmount(invoice.VNPayFee); fee > 0 && fees[invoice.InvoiceID] != fee {
+			problems = append(problems, fmt.Sprintf("invoice %s VNPay fee posted as %.2f, want %.2f", invoice.InvoiceNumber, fees[invoice.InvoiceID], fee))
+		}
+		if refundPosted && refunded > paid {
+			problems = append(problems, fmt.Sprintf("invoice %s refunds %.2f exceed its payment %.2f", invoice.InvoiceNumber, refunded, paid))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read invoices: %w", err)
+	}
+
+	for id := range payments {
+		if !paidInvoices[id] {
+			problems = append(problems, fmt.Sprintf("payment posted for invoice %s, which is not paid", id))
+		}
+	}
+	for id := range refunds {
+		if !paidInvoices[id] {
+			problems = append(problems, fmt.Sprintf("refund posted for invoice %s, which is not paid", id))
+		}
+	}
+	for id := range fees {
+		if !paidInvoices[id] {
+			problems = append(problems, fmt.Sprintf("VNPay fee posted for invoice %s, which is not paid", id))
+		}
+	}
+	return problems, nil
+}
+
+// clearingAmount returns how much a payment, refund or fee moved through VNPay clearing
+func clearingAmount(txn model.LedgerTransaction) float64 {
+	var amount float64
+	for _, entry := range txn.Entries {
+		if entry.Account == model.LedgerAccountVNPayClearing {
+			amount += entry.Debit + entry.Credit
+		}
+	}
+	return model.RoundAmount(amount)
+}
+
+// postPayment records a completed invoice's payment: the customer owed the
+// final amount as revenue, and VNPay collected it
+func postPayment(ctx context.Context, ledger repository.LedgerStore, invoice model.Invoice, postedAt time.Time) error {
+	amount := model.RoundAmount(invoice.FinalAmount)
+	if amount <= 0 {
+		return nil
+	}
+
+	return ledger.PostLedgerTransaction(ctx, model.LedgerTransaction{
+		TransactionID: uuid.New(),
+		TenantID:      invoice.TenantID,
+		Kind:          model.LedgerPayment,
+		Reference:     invoice.InvoiceID.String(),
+		InvoiceID:     &invoice.InvoiceID,
+		Description:   "Payment of " + invoice.InvoiceNumber,
+		PostedAt:      postedAt,
+		Entries: []model.LedgerEntry{
+			{Account: model.LedgerAccountReceivable, Debit: amount},
+			{Account: model.LedgerAccountRevenue, Credit: amount},
+			{Account: model.LedgerAccountVNPayClearing, Debit: amount},
+			{Account: model.LedgerAccountReceivable, Credit: amount},
+		},
+	})
+}
+
+// postRefund records a refund of a paid invoice: the revenue is owed back to
+// the customer, and VNPay pays it out of the money it holds for us
+func postRefund(ctx context.Context, ledger repository.LedgerStore, invoice model.Invoice, amount float64, postedAt time.Time) error {
+	amount = model.RoundAmount(amount)
+	if amount <= 0 {
+		return nil
+	}
+
+	// An invoice may be refunded in several parts, each posted separately
+	transactionID := uuid.New()
+	return ledger.PostLedgerTransaction(ctx, model.LedgerTransaction{
+		TransactionID: transactionID,
+		TenantID:      invoice.TenantID,
+		Kind:          model.LedgerRefund,
+		Reference:     invoice.InvoiceID.String() + "/" + transactionID.String(),
+		InvoiceID:     &invoice.InvoiceID,
+		Description:   "Refund of " + invoice.InvoiceNumber,
+		PostedAt:      postedAt,
+		Entries: []model.LedgerEntry{
+			{Account: model.LedgerAccountRevenue, Debit: amount},
+			{Account: model.LedgerAccountRefundsPayable, Credit: amount},
+			{Account: model.LedgerAccountRefundsPayable, Debit: amount},
+			{Account: model.LedgerAccountVNPayClearing, Credit: amount},
+		},
+	})
+}
+
+// postFee records the merchant fee VNPay charged on a payment, which it
+// keeps out of the money it collected for us
+func postFee(ctx context.Context, ledger repository.LedgerStore, invoice model.Invoice, fee float64, postedAt time.Time) error {
+	if fee <= 0 {
+		return nil
+	}
+
+	return ledger.PostLedgerTransaction(ctx, model.LedgerTransaction{
+		TransactionID: uuid.New(),
+		TenantID:      invoice.TenantID,
+		Kind:          model.LedgerFee,
+		Reference:     invoice.InvoiceID.String(),
+		InvoiceID:     &invoice.InvoiceID,
+		Description:   "VNPay fee on " + invoice.InvoiceNumber,
+		PostedAt:      postedAt,
+		Entries: []model.LedgerEntry{
+			{Account: model.LedgerAccountFees, Debit: fee},
+			{Account: model.LedgerAccountVNPayClearing, Credit: fee},
+		},
+	})
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"payment_service/domain/model"
+)
+
+func TestLedgerPostings(t *testing.T) {
+	ctx := context.Background()
+	svc, invoices := newTestVNPayService(t)
+	ledgerSvc := NewLedgerService(svc.invoiceSvc.store)
+	refundRequest := model.VNPayRefundRequest{TransactionType: "03", TransactionDate: "20260101120000", CreateBy: "staff-1"}
+
+	// Two invoices of 95000 are paid, and one of them is refunded in part
+	var txnRefs []string
+	for i := 0; i < 2; i++ {
+		payment := createTestPayment(t, svc, model.DefaultTenantID)
+		if resp, _ := svc.ProcessIPN(ctx, signedCallback(testHashSecret, ipnParams(payment, "00"))); resp.RspCode != "00" {
+			t.Fatalf("IPN RspCode = %s, want 00", resp.RspCode)
+		}
+		txnRefs = append(txnRefs, payment.Get("vnp_TxnRef"))
+	}
+	refundRequest.TxnRef, refundRequest.Amount = txnRefs[0], 100000
+	if _, err := svc.RefundTransaction(ctx, model.DefaultTenantID, refundRequest, "203.0.113.7"); !errors.Is(err, ErrInvalidRefundAmount) {
+		t.Errorf("refund above the final amount error = %v, want ErrInvalidRefundAmount", err)
+	}
+	refundRequest.Amount = 40000
+	if _, err := svc.RefundTransaction(ctx, model.DefaultTenantID, refundRequest, "203.0.113.7"); err != nil {
+		t.Fatalf("RefundTransaction: %v", err)
+	}
+	// Only what is left of the payment can be refunded
+	refundRequest.Amount = 60000
+	if _, err := svc.RefundTransaction(ctx, model.DefaultTenantID, refundRequest, "203.0.113.7"); !errors.Is(err, ErrInvalidRefundAmount) {
+		t.Errorf("refund above the amount left error = %v, want ErrInvalidRefundAmount", err)
+	}
+
+	// Unpaid invoices cannot be refunded
+	pending := createTestPayment(t, svc, model.DefaultTenantID)
+	refundRequest.TxnRef = pending.Get("vnp_TxnRef")
+	if _, err := svc.RefundTransaction(ctx, model.DefaultTenantID, refundRequest, "203.0.113.7"); !errors.Is(err, ErrInvoiceNotPaid) {
+		t.Errorf("refunding a pending invoice error = %v, want ErrInvoiceNotPaid", err)
+	}
+
+	beforeSettlement := time.Now()
+	settledAt := beforeSettlement.Add(time.Hour)
+	if _, err := ledgerSvc.PostSettlement(ctx, model.DefaultTenantID, "STL-001", 150000, 2000, settledAt); err != nil {
+		t.Fatalf("PostSettlement: %v", err)
+	}
+	if _, err := ledgerSvc.PostSettlement(ctx, model.DefaultTenantID, "STL-001", 150000, 2000, settledAt); !errors.Is(err, ErrSettlementExists) {
+		t.Errorf("posting a settlement twice error = %v, want ErrSettlementExists", err)
+	}
+	if _, err := ledgerSvc.PostSettlement(ctx, model.DefaultTenantID, "STL-002", 1000, 2000, settledAt); !errors.Is(err, ErrInvalidSettlement) {
+		t.Errorf("settlement with a fee above its amount error = %v, want ErrInvalidSettlement", err)
+	}
+
+	for _, tt := range []struct {
+		asOf time.Time
+		want map[model.LedgerAccount]float64
+	}{
+		{beforeSettlement, map[model.LedgerAccount]float64{
+			model.LedgerAccountVNPayClearing: 150000,
+			model.LedgerAccountRevenue:       150000,
+		}},
+		{settledAt.Add(time.Second), map[model.LedgerAccount]float64{
+			model.LedgerAccountBank:    148000,
+			model.LedgerAccountFees:    2000,
+			model.LedgerAccountRevenue: 150000,
+		}},
+	} {
+		balances, err := ledgerSvc.GetBalances(ctx, model.DefaultTenantID, tt.asOf)
+		if err != nil {
+			t.Fatalf("GetBalances: %v", err)
+		}
+		if len(balances.Accounts) != len(model.LedgerAccounts) {
+			t.Errorf("got %d accounts, want all %d", len(balances.Accounts), len(model.LedgerAccounts))
+		}
+		for _, balance := range balances.Accounts {
+			if balance.Balance != tt.want[balance.Account] {
+				t.Errorf("as of %v %s balance = %.2f, want %.2f", tt.asOf, balance.Account, balance.Balance, tt.want[balance.Account])
+			}
+		}
+	}
+
+	if problems, err := ledgerSvc.CheckLedger(ctx, model.DefaultTenantID); err != nil || len(problems) != 0 {
+		t.Fatalf("CheckLedger = %v, %v, want a consistent ledger", problems, err)
+	}
+
+	// An invoice completed without going through the service has no payment posted
+	if err := invoices.UpdateInvoicePaymentStatus(ctx, model.DefaultTenantID, pending.Get("vnp_TxnRef"), model.PaymentStatusCompleted, nil); err != nil {
+		t.Fatalf("UpdateInvoicePaymentStatus: %v", err)
+	}
+	problems, err := ledgerSvc.CheckLedger(ctx, model.DefaultTenantID)
+	if err != nil {
+		t.Fatalf("CheckLedger: %v", err)
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], "payment is not posted") {
+		t.Errorf("CheckLedger problems = %v, want the unposted payment", problems)
+	}
+}
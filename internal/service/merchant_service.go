@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"payment_service/config"
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+)
+
+// ErrUnknownMerchant is returned when no active merchant matches a tenant or terminal code
+var ErrUnknownMerchant = errors.New("unknown merchant")
+
+// MerchantService resolves the VNPay terminal used for each tenant
+type MerchantService struct {
+	repo   repository.MerchantStore
+	config *config.VNPayStore
+	seller model.Seller
+}
+
+// NewMerchantService creates a new merchant service. The terminal in cfg and
+// the seller are used as the merchant of the default tenant unless the
+// registry overrides it.
+func NewMerchantService(repo repository.MerchantStore, cfg *config.VNPayStore, seller model.Seller) *MerchantService {
+	return &MerchantService{
+		repo:   repo,
+		config: cfg,
+		seller: seller,
+	}
+}
+
+// GetByTenantID returns the active merchant for a tenant. Errors other than
+// the tenant having no merchant are returned as they are, so an outage is
+// not mistaken for an unknown tenant.
+func (s *MerchantService) GetByTenantID(ctx context.Context, tenantID string) (model.Merchant, error) {
+	if tenantID == "" {
+		tenantID = model.DefaultTenantID
+	}
+
+	merchant, err := s.repo.GetMerchantByTenantID(ctx, tenantID)
+	if errors.Is(err, repository.ErrNotFound) {
+		if tenantID == model.DefaultTenantID && s.config.Load().TmnCode != "" {
+			return s.defaultMerchant(), nil
+		}
+		return model.Merchant{}, fmt.Errorf("%w: tenant %s: %v", ErrUnknownMerchant, tenantID, err)
+	}
+	if err != nil {
+		return model.Merchant{}, err
+	}
+
+	if !merchant.Active {
+		return model.Merchant{}, fmt.Errorf("%w: tenant %s is inactive", ErrUnknownMerchant, tenantID)
+	}
+
+	return merchant, nil
+}
+
+// GetByTmnCode returns the active merchant owning a VNPay terminal code.
+// Errors other than no merchant owning the code are returned as they are.
+func (s *MerchantService) GetByTmnCode(ctx context.Context, tmnCode string) (model.Merchant, error) {
+	if tmnCode == "" {
+		return model.Merchant{}, fmt.Errorf("%w: missing terminal code", ErrUnknownMerchant)
+	}
+
+	merchant, err := s.repo.GetMerchantByTmnCode(ctx, tmnCode)
+	if errors.Is(err, repository.ErrNotFound) {
+		if tmnCode == s.config.Load().TmnCode {
+			return s.defaultMerchant(), nil
+		}
+		return model.Merchant{}, fmt.Errorf("%w: terminal %s: %v", ErrUnknownMerchant, tmnCode, err)
+	}
+	if err != nil {
+		return model.Merchant{}, err
+	}
+
+	if !merchant.Active {
+		return model.Merchant{}, fmt.Errorf("%w: terminal %s is inactive", ErrUnknownMerchant, tmnCode)
+	}
+
+	return merchant, nil
+}
+
+// defaultMerchant builds the default tenant's merchant from the environment configuration
+func (s *MerchantService) defaultMerchant() model.Merchant {
+	cfg := s.config.Load()
+	return model.Merchant{
+		TenantID:   model.DefaultTenantID,
+		Name:       "Default",
+		TmnCode:    cfg.TmnCode,
+		HashSecret: cfg.HashSecret,
+		ReturnURL:  cfg.ReturnURL,
+		Seller:     s.seller,
+		Active:     true,
+
+		SecondaryHashSecrets:     cfg.SecondaryHashSecrets,
+		SecondarySecretsExpireAt: expiry(cfg.SecondarySecretsExpireAt),
+	}
+}
+
+// FeeSchedule returns the fees VNPay charges a tenant: its registered fee
+// rules, falling back to the configured fee
+func (s *MerchantService) FeeSchedule(ctx context.Context, tenantID string) (model.VNPayFeeSchedule, error) {
+	rules, err := s.repo.GetVNPayFeeRules(ctx, tenantID)
+	if err != nil {
+		return model.VNPayFeeSchedule{}, fmt.Errorf("failed to get fee rules for tenant %s: %w", tenantID, err)
+	}
+
+	cfg := s.config.Load()
+	return model.VNPayFeeSchedule{
+		Rules: rules,
+		Default: model.VNPayFeeRule{
+			TenantID:    tenantID,
+			RatePercent: cfg.FeeRatePercent,
+			FixedFee:    cfg.FeeFixed,
+			MinFee:      cfg.FeeMin,
+		},
+	}, nil
+}
+
+// Signer returns the signer for a merchant's current and rotating secrets
+func (s *MerchantService) Signer(merchant model.Merchant) *Signer {
+	var expiresAt time.Time
+	if merchant.SecondarySecretsExpireAt != nil {
+		expiresAt = *merchant.SecondarySecretsExpireAt
+	}
+	return NewSigner(merchant.HashSecret, merchant.SecondaryHashSecrets, expiresAt)
+}
+
+// expiry converts a zero time into a nil expiry
+func expiry(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
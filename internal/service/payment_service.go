@@ -2,6 +2,9 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,42 +14,117 @@ import (
 	"payment_service/internal/repository"
 )
 
+// ErrInvalidCursor is returned when a search cursor is malformed or was issued for a different ordering
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 // InvoiceService handles business logic related to invoices
 type InvoiceService struct {
-	repo *repository.InvoiceRepository
+	store repository.Store
+	repo  repository.InvoiceStore
 }
 
 // NewInvoiceService creates a new invoice service
-func NewInvoiceService(repo *repository.InvoiceRepository) *InvoiceService {
+func NewInvoiceService(store repository.Store) *InvoiceService {
 	return &InvoiceService{
-		repo: repo,
+		store: store,
+		repo:  store.Invoices(),
 	}
 }
 
-// CreateInvoice creates a new invoice with the given details
-func (s *InvoiceService) CreateInvoice(ctx context.Context, req model.VNPayPaymentRequest, txnRef string) (model.Invoice, error) {
+// WithTx runs fn with an invoice service bound to a transaction. fn is
+// retried when the transaction hits a serialization failure, so it must not
+// have side effects other than through tx.
+func (s *InvoiceService) WithTx(ctx context.Context, fn func(tx *InvoiceService) error) error {
+	return s.store.WithTx(ctx, func(tx repository.Store) error {
+		return fn(&InvoiceService{store: tx, repo: tx.Invoices()})
+	})
+}
+
+// CreateInvoice creates a new invoice for the merchant with the given details.
+// When the request has items, the invoice amounts are computed from them.
+func (s *InvoiceService) CreateInvoice(ctx context.Context, merchant model.Merchant, req model.VNPayPaymentRequest, txnRef string) (model.Invoice, error) {
+	totalAmount, discountAmount, taxAmount := req.Amount, req.DiscountAmount, req.TaxAmount
+	ticketID := req.TicketID
+
+	buyer, violations := buildInvoiceBuyer(req.Buyer)
+
+	var items []model.InvoiceItem
+	if len(req.Items) > 0 {
+		var amounts invoiceAmounts
+		var err error
+		items, amounts, err = buildInvoiceItems(req)
+		if err != nil {
+			var invalid *InvoiceValidationError
+			if errors.As(err, &invalid) {
+				invalid.Violations = append(violations, invalid.Violations...)
+			}
+			return model.Invoice{}, err
+		}
+		totalAmount, discountAmount, taxAmount = amounts.total, amounts.discount, amounts.tax
+
+		// The invoice records the first ticket when the order has no ticket of its own
+		if ticketID == "" {
+			ticketID = items[0].TicketID
+		}
+	}
+
+	if len(violations) > 0 {
+		return model.Invoice{}, &InvoiceValidationError{Violations: violations}
+	}
+
 	// Calculate final amount
-	finalAmount := req.Amount - req.DiscountAmount + req.TaxAmount
+	finalAmount := model.RoundAmount(totalAmount - discountAmount + taxAmount)
 
 	// Create invoice object
 	invoice := model.Invoice{
 		InvoiceID:      uuid.New(),
+		TenantID:       merchant.TenantID,
 		InvoiceType:    req.InvoiceType,
 		CustomerID:     req.CustomerID,
-		TicketID:       req.TicketID,
-		TotalAmount:    req.Amount,
-		DiscountAmount: req.DiscountAmount,
-		TaxAmount:      req.TaxAmount,
+		TicketID:       ticketID,
+		TotalAmount:    totalAmount,
+		DiscountAmount: discountAmount,
+		TaxAmount:      taxAmount,
 		FinalAmount:    finalAmount,
 		PaymentStatus:  model.PaymentStatusPending,
 		PaymentMethod:  model.PaymentMethodVNPay,
 		IssueDate:      time.Now(),
 		Notes:          fmt.Sprintf("Payment via VNPay, TxnRef: %s", txnRef),
+		VNPayTmnCode:   merchant.TmnCode,
 		VNPayTxnRef:    txnRef,
+		Buyer:          buyer,
 	}
 
-	// Save invoice to database
-	createdInvoice, err := s.repo.CreateInvoice(ctx, invoice)
+	// Save the invoice and its items together
+	var createdInvoice model.Invoice
+	err := s.WithTx(ctx, func(tx *InvoiceService) error {
+		var err error
+		createdInvoice, err = tx.repo.CreateInvoice(ctx, invoice)
+		if err != nil {
+			return err
+		}
+		// The history starts with the invoice's creation, which has no previous status
+		err = tx.repo.AppendInvoiceHistory(ctx, model.InvoiceHistoryEntry{
+			TenantID:  createdInvoice.TenantID,
+			InvoiceID: createdInvoice.InvoiceID,
+			NewStatus: createdInvoice.PaymentStatus,
+			Actor:     model.InvoiceActorAPI,
+			CreatedAt: createdInvoice.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+
+		createdInvoice.Items, err = tx.repo.CreateInvoiceItems(ctx, createdInvoice.InvoiceID, items)
+		if err != nil {
+			return err
+		}
+		createdInvoice.TaxBreakdown = model.TaxBreakdown(createdInvoice.Items)
+		return nil
+	})
 	if err != nil {
 		return model.Invoice{}, fmt.Errorf("failed to create invoice: %w", err)
 	}
@@ -54,38 +132,215 @@ func (s *InvoiceService) CreateInvoice(ctx context.Context, req model.VNPayPayme
 	return createdInvoice, nil
 }
 
-// GetInvoiceByID retrieves an invoice by its ID
-func (s *InvoiceService) GetInvoiceByID(ctx context.Context, id uuid.UUID) (model.Invoice, error) {
-	invoice, err := s.repo.GetInvoiceByID(ctx, id)
+// GetInvoiceByID retrieves a tenant's invoice by its ID
+func (s *InvoiceService) GetInvoiceByID(ctx context.Context, tenantID string, id uuid.UUID) (model.Invoice, error) {
+	invoice, err := s.repo.GetInvoiceByID(ctx, tenantID, id)
 	if err != nil {
 		return model.Invoice{}, fmt.Errorf("failed to get invoice: %w", err)
 	}
-	return invoice, nil
+
+	invoices := []model.Invoice{invoice}
+	if err := s.attachItems(ctx, invoices); err != nil {
+		return model.Invoice{}, err
+	}
+	return invoices[0], nil
 }
 
-// GetInvoiceByVNPayTxnRef retrieves an invoice by its VNPay transaction reference
-func (s *InvoiceService) GetInvoiceByVNPayTxnRef(ctx context.Context, txnRef string) (model.Invoice, error) {
-	invoice, err := s.repo.GetInvoiceByVNPayTxnRef(ctx, txnRef)
+// GetInvoiceByIDForUpdate retrieves a tenant's invoice by its ID and locks it
+// for the rest of the transaction
+func (s *InvoiceService) GetInvoiceByIDForUpdate(ctx context.Context, tenantID string, id uuid.UUID) (model.Invoice, error) {
+	invoice, err := s.repo.GetInvoiceByIDForUpdate(ctx, tenantID, id)
+	if err != nil {
+		return model.Invoice{}, fmt.Errorf("failed to lock invoice: %w", err)
+	}
+
+	invoices := []model.Invoice{invoice}
+	if err := s.attachItems(ctx, invoices); err != nil {
+		return model.Invoice{}, err
+	}
+	return invoices[0], nil
+}
+
+// GetInvoiceByVNPayTxnRef retrieves a tenant's invoice by its VNPay transaction reference
+func (s *InvoiceService) GetInvoiceByVNPayTxnRef(ctx context.Context, tenantID string, txnRef string) (model.Invoice, error) {
+	invoice, err := s.repo.GetInvoiceByVNPayTxnRef(ctx, tenantID, txnRef)
 	if err != nil {
 		return model.Invoice{}, fmt.Errorf("failed to get invoice by VNPay reference: %w", err)
 	}
 	return invoice, nil
 }
 
-// UpdateInvoicePaymentStatus updates the payment status of an invoice
-func (s *InvoiceService) UpdateInvoicePaymentStatus(ctx context.Context, txnRef string, status model.PaymentStatus, vnpayData map[string]string) error {
-	err := s.repo.UpdateInvoicePaymentStatus(ctx, txnRef, status, vnpayData)
+// GetInvoiceByVNPayTxnRefForUpdate retrieves a tenant's invoice by its VNPay
+// transaction reference and locks it for the rest of the transaction
+func (s *InvoiceService) GetInvoiceByVNPayTxnRefForUpdate(ctx context.Context, tenantID string, txnRef string) (model.Invoice, error) {
+	invoice, err := s.repo.GetInvoiceByVNPayTxnRefForUpdate(ctx, tenantID, txnRef)
+	if err != nil {
+		return model.Invoice{}, fmt.Errorf("failed to lock invoice by VNPay reference: %w", err)
+	}
+	return invoice, nil
+}
+
+// UpdateInvoicePaymentStatus updates the payment status of a tenant's invoice
+// and records the change in its history in the same transaction. Completing
+// an unpaid invoice posts its payment to the ledger.
+func (s *InvoiceService) UpdateInvoicePaymentStatus(ctx context.Context, tenantID string, txnRef string, status model.PaymentStatus, vnpayData map[string]string, change model.InvoiceChange) error {
+	err := s.WithTx(ctx, func(tx *InvoiceService) error {
+		invoice, err := tx.repo.GetInvoiceByVNPayTxnRefForUpdate(ctx, tenantID, txnRef)
+		if err != nil {
+			return err
+		}
+		if err := tx.repo.UpdateInvoicePaymentStatus(ctx, tenantID, txnRef, status, vnpayData); err != nil {
+			return err
+		}
+		if err := tx.recordStatusChange(ctx, invoice, status, change); err != nil {
+			return err
+		}
+
+		if status == model.PaymentStatusCompleted && !invoice.PaymentStatus.Paid() {
+			return postPayment(ctx, tx.store.Ledger(), invoice, time.Now().UTC())
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to update invoice payment status: %w", err)
 	}
 	return nil
 }
 
-// GetInvoicesByCustomerID retrieves all invoices for a customer
-func (s *InvoiceService) GetInvoicesByCustomerID(ctx context.Context, customerID string) ([]model.Invoice, error) {
-	invoices, err := s.repo.GetInvoicesByCustomerID(ctx, customerID)
+// recordStatusChange appends a status change of an invoice to its history.
+// Updates that leave the status as it was are not recorded.
+func (s *InvoiceService) recordStatusChange(ctx context.Context, invoice model.Invoice, status model.PaymentStatus, change model.InvoiceChange) error {
+	if invoice.PaymentStatus == status {
+		return nil
+	}
+
+	return s.repo.AppendInvoiceHistory(ctx, model.InvoiceHistoryEntry{
+		TenantID:  invoice.TenantID,
+		InvoiceID: invoice.InvoiceID,
+		OldStatus: invoice.PaymentStatus,
+		NewStatus: status,
+		Actor:     change.Actor,
+		SourceID:  change.SourceID,
+		Reason:    change.Reason,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// GetInvoiceHistory retrieves the payment status history of a tenant's invoice, oldest first
+func (s *InvoiceService) GetInvoiceHistory(ctx context.Context, tenantID string, id uuid.UUID) ([]model.InvoiceHistoryEntry, error) {
+	if _, err := s.repo.GetInvoiceByID(ctx, tenantID, id); err != nil {
+		return nil, fmt.Errorf("failed to get invoice: %w", err)
+	}
+
+	history, err := s.repo.GetInvoiceHistory(ctx, tenantID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invoice history: %w", err)
+	}
+	return history, nil
+}
+
+// GetInvoicesByCustomerID retrieves all of a tenant's invoices for a customer
+func (s *InvoiceService) GetInvoicesByCustomerID(ctx context.Context, tenantID string, customerID string) ([]model.Invoice, error) {
+	invoices, err := s.repo.GetInvoicesByCustomerID(ctx, tenantID, customerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get invoices for customer: %w", err)
 	}
+
+	if err := s.attachItems(ctx, invoices); err != nil {
+		return nil, err
+	}
 	return invoices, nil
 }
+
+// ExpirePendingInvoices marks up to limit invoices still pending since before
+// createdBefore as failed and returns them
+func (s *InvoiceService) ExpirePendingInvoices(ctx context.Context, createdBefore time.Time, limit int) ([]model.Invoice, error) {
+	var expired []model.Invoice
+	err := s.WithTx(ctx, func(tx *InvoiceService) error {
+		invoices, err := tx.repo.GetExpiredPendingInvoices(ctx, createdBefore, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, invoice := range invoices {
+			if err := tx.repo.UpdateInvoicePaymentStatus(ctx, invoice.TenantID, invoice.VNPayTxnRef, model.PaymentStatusFailed, nil); err != nil {
+				return err
+			}
+			change := model.InvoiceChange{Actor: model.InvoiceActorReconciler, Reason: "payment window expired"}
+			if err := tx.recordStatusChange(ctx, invoice, model.PaymentStatusFailed, change); err != nil {
+				return err
+			}
+		}
+
+		expired = invoices
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire pending invoices: %w", err)
+	}
+	return expired, nil
+}
+
+// SearchInvoices returns a page of a tenant's invoices matching the filter.
+// cursor is the NextCursor of the previous page, or empty for the first page.
+func (s *InvoiceService) SearchInvoices(ctx context.Context, filter model.InvoiceFilter, cursor string) (model.InvoicePage, error) {
+	if filter.SortBy == "" {
+		filter.SortBy = model.InvoiceSortCreatedAt
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = model.DefaultInvoicePageSize
+	}
+	if filter.Limit > model.MaxInvoicePageSize {
+		filter.Limit = model.MaxInvoicePageSize
+	}
+
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return model.InvoicePage{}, err
+		}
+		if after.SortBy != filter.SortBy || after.SortDesc != filter.SortDesc {
+			return model.InvoicePage{}, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidCursor)
+		}
+		filter.After = &after
+	}
+
+	// Fetch one extra invoice to learn whether another page follows
+	pageSize := filter.Limit
+	filter.Limit++
+	invoices, total, err := s.repo.SearchInvoices(ctx, filter)
+	if err != nil {
+		return model.InvoicePage{}, fmt.Errorf("failed to search invoices: %w", err)
+	}
+
+	page := model.InvoicePage{Invoices: invoices, Total: total}
+	if len(invoices) > pageSize {
+		page.Invoices = invoices[:pageSize]
+		page.NextCursor = encodeCursor(filter.CursorFor(page.Invoices[pageSize-1]))
+	}
+
+	if err := s.attachItems(ctx, page.Invoices); err != nil {
+		return model.InvoicePage{}, err
+	}
+
+	return page, nil
+}
+
+// encodeCursor serializes a search position into an opaque URL-safe token
+func encodeCursor(cursor model.InvoiceCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a token produced by encodeCursor
+func decodeCursor(token string) (model.InvoiceCursor, error) {
+	var cursor model.InvoiceCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return cursor, nil
+}
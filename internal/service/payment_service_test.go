@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+	"payment_service/pkg/utils"
+)
+
+func TestSearchInvoicesPaging(t *testing.T) {
+	ctx := context.Background()
+	svc := NewInvoiceService(repository.NewMemoryStore(repository.NewMemoryInvoiceStore()))
+	merchant := model.Merchant{TenantID: "brand-a", TmnCode: "BRANDA01"}
+
+	for i := 0; i < 5; i++ {
+		req := model.VNPayPaymentRequest{CustomerID: "customer-1", TicketID: "ticket-1", Amount: 1000}
+		if _, err := svc.CreateInvoice(ctx, merchant, req, fmt.Sprintf("1000%d", i)); err != nil {
+			t.Fatalf("CreateInvoice: %v", err)
+		}
+	}
+
+	filter := model.InvoiceFilter{TenantID: "brand-a", SortDesc: true, Limit: 2}
+	var seen, pages int
+	cursor := ""
+	for {
+		page, err := svc.SearchInvoices(ctx, filter, cursor)
+		if err != nil {
+			t.Fatalf("SearchInvoices: %v", err)
+		}
+		if page.Total != 5 {
+			t.Errorf("Total = %d, want 5", page.Total)
+		}
+		seen += len(page.Invoices)
+		pages++
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if seen != 5 || pages != 3 {
+		t.Errorf("walked %d invoices in %d pages, want 5 in 3", seen, pages)
+	}
+
+	// A cursor cannot be replayed against a different ordering
+	page, err := svc.SearchInvoices(ctx, filter, "")
+	if err != nil {
+		t.Fatalf("SearchInvoices: %v", err)
+	}
+	filter.SortBy = model.InvoiceSortFinalAmount
+	if _, err := svc.SearchInvoices(ctx, filter, page.NextCursor); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("SearchInvoices with another sort error = %v, want ErrInvalidCursor", err)
+	}
+	if _, err := svc.SearchInvoices(ctx, filter, "not a cursor"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("SearchInvoices with garbage cursor error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestInvoiceExpirer(t *testing.T) {
+	ctx := context.Background()
+	svc := NewInvoiceService(repository.NewMemoryStore(repository.NewMemoryInvoiceStore()))
+	merchant := model.Merchant{TenantID: "brand-a", TmnCode: "BRANDA01"}
+	req := model.VNPayPaymentRequest{CustomerID: "customer-1", TicketID: "ticket-1", Amount: 1000}
+
+	stale, err := svc.CreateInvoice(ctx, merchant, req, "2001")
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+	paid, err := svc.CreateInvoice(ctx, merchant, req, "2002")
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+	if err := svc.UpdateInvoicePaymentStatus(ctx, "brand-a", "2002", model.PaymentStatusCompleted, nil, model.InvoiceChange{Actor: model.InvoiceActorIPN}); err != nil {
+		t.Fatalf("UpdateInvoicePaymentStatus: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	fresh, err := svc.CreateInvoice(ctx, merchant, req, "2003")
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+
+	expirer := NewInvoiceExpirer(svc, utils.NewDefaultLogger(), 10*time.Millisecond, time.Minute)
+	expired, err := expirer.Expire(ctx)
+	if err != nil {
+		t.Fatalf("Expire: %v", err)
+	}
+	if expired != 1 {
+		t.Errorf("expired %d invoices, want 1", expired)
+	}
+
+	for _, tt := range []struct {
+		invoice model.Invoice
+		want    model.PaymentStatus
+	}{
+		{stale, model.PaymentStatusFailed},
+		{paid, model.PaymentStatusCompleted},
+		{fresh, model.PaymentStatusPending},
+	} {
+		got, err := svc.GetInvoiceByID(ctx, "brand-a", tt.invoice.InvoiceID)
+		if err != nil {
+			t.Fatalf("GetInvoiceByID: %v", err)
+		}
+		if got.PaymentStatus != tt.want {
+			t.Errorf("invoice %s status = %s, want %s", got.VNPayTxnRef, got.PaymentStatus, tt.want)
+		}
+	}
+
+	// The expiry is recorded in the stale invoice's history
+	history, err := svc.GetInvoiceHistory(ctx, "brand-a", stale.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoiceHistory: %v", err)
+	}
+	if len(history) != 2 || history[1].OldStatus != model.PaymentStatusPending ||
+		history[1].NewStatus != model.PaymentStatusFailed || history[1].Actor != model.InvoiceActorReconciler {
+		t.Errorf("stale invoice history = %+v, want creation and expiry", history)
+	}
+}
+
+func TestCreateInvoiceWithItems(t *testing.T) {
+	ctx := context.Background()
+	merchant := model.Merchant{TenantID: "brand-a", TmnCode: "BRANDA01"}
+	items := []model.InvoiceItemRequest{
+		{TicketID: "ticket-1", Description: "Adult ticket", Quantity: 2, UnitPrice: 100000, DiscountAmount: 10000, VATRate: 8},
+		{TicketID: "ticket-2", Description: "Child ticket", Quantity: 1, UnitPrice: 50000, VATRate: 10},
+		{Description: "Booking fee", Quantity: 1, UnitPrice: 10000, VATRate: 10},
+	}
+
+	tests := []struct {
+		name           string
+		req            model.VNPayPaymentRequest
+		wantViolations []string
+	}{
+		{"computed totals", model.VNPayPaymentRequest{Items: items}, nil},
+		{"matching totals", model.VNPayPaymentRequest{Amount: 260000, DiscountAmount: 10000, TaxAmount: 21200, Items: items}, nil},
+		{"mismatched amount", model.VNPayPaymentRequest{Amount: 250000, Items: items}, []string{"amount"}},
+		{"mismatched tax", model.VNPayPaymentRequest{TaxAmount: 20000, Items: items}, []string{"tax_amount"}},
+		{"invalid lines", model.VNPayPaymentRequest{Items: []model.InvoiceItemRequest{
+			{Description: " ", Quantity: 1, UnitPrice: 1000},
+			{Description: "Ticket", Quantity: 1, UnitPrice: 1000, DiscountAmount: 2000, VATRate: 7},
+		}}, []string{"items[0].description", "items[1].vat_rate", "items[1].discount_amount"}},
+		{"invalid buyer", model.VNPayPaymentRequest{Items: items, Buyer: model.InvoiceBuyer{TaxCode: "0312"}},
+			[]string{"buyer.tax_code", "buyer.name", "buyer.address"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewInvoiceService(repository.NewMemoryStore(repository.NewMemoryInvoiceStore()))
+			tt.req.CustomerID = "customer-1"
+
+			invoice, err := svc.CreateInvoice(ctx, merchant, tt.req, "3001")
+			if len(tt.wantViolations) > 0 {
+				var invalid *InvoiceValidationError
+				if !errors.As(err, &invalid) {
+					t.Fatalf("CreateInvoice error = %v, want InvoiceValidationError", err)
+				}
+				var fields []string
+				for _, v := range invalid.Violations {
+					fields = append(fields, v.Field)
+				}
+				if fmt.Sprint(fields) != fmt.Sprint(tt.wantViolations) {
+					t.Errorf("violations = %v, want %v", fields, tt.wantViolations)
+				}
+				if _, err := svc.GetInvoiceByVNPayTxnRef(ctx, "brand-a", "3001"); err == nil {
+					t.Error("rejected invoice was stored")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateInvoice: %v", err)
+			}
+
+			// 200000 - 10000 at 8% plus 50000 and 10000 at 10%
+			if invoice.TotalAmount != 260000 || invoice.DiscountAmount != 10000 || invoice.TaxAmount != 21200 || invoice.FinalAmount != 271200 {
+				t.Errorf("amounts = %v/%v/%v/%v, want 260000/10000/21200/271200",
+					invoice.TotalAmount, invoice.DiscountAmount, invoice.TaxAmount, invoice.FinalAmount)
+			}
+			if invoice.TicketID != "ticket-1" {
+				t.Errorf("TicketID = %q, want the first item's ticket", invoice.TicketID)
+			}
+
+			got, err := svc.GetInvoiceByID(ctx, "brand-a", invoice.InvoiceID)
+			if err != nil {
+				t.Fatalf("GetInvoiceByID: %v", err)
+			}
+			if len(got.Items) != 3 || got.Items[0].Subtotal != 190000 || got.Items[0].TaxAmount != 15200 {
+				t.Errorf("items = %+v", got.Items)
+			}
+			want := []model.InvoiceTaxLine{
+				{VATRate: 8, TaxableAmount: 190000, TaxAmount: 15200},
+				{VATRate: 10, TaxableAmount: 60000, TaxAmount: 6000},
+			}
+			if fmt.Sprint(got.TaxBreakdown) != fmt.Sprint(want) {
+				t.Errorf("TaxBreakdown = %+v, want %+v", got.TaxBreakdown, want)
+			}
+		})
+	}
+}
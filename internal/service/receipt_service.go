@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"payment_service/domain/model"
+	"payment_service/internal/receipt"
+)
+
+// ReceiptService renders payment receipts for paid invoices
+type ReceiptService struct {
+	invoiceSvc  *InvoiceService
+	merchantSvc *MerchantService
+}
+
+// NewReceiptService creates a new receipt service
+func NewReceiptService(invoiceSvc *InvoiceService, merchantSvc *MerchantService) *ReceiptService {
+	return &ReceiptService{
+		invoiceSvc:  invoiceSvc,
+		merchantSvc: merchantSvc,
+	}
+}
+
+// Receipt is the receipt of a paid invoice, ready to render
+type Receipt struct {
+	Invoice model.Invoice
+	// ETag identifies the rendered receipt, so it can be checked without rendering
+	ETag  string
+	brand receipt.Brand
+}
+
+// GetReceipt returns the receipt of a tenant's paid invoice
+func (s *ReceiptService) GetReceipt(ctx context.Context, tenantID string, id uuid.UUID) (*Receipt, error) {
+	merchant, err := s.merchantSvc.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice, err := s.invoiceSvc.GetInvoiceByID(ctx, merchant.TenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.PaymentStatus != model.PaymentStatusCompleted {
+		return nil, fmt.Errorf("%w: invoice %s is %s", ErrInvoiceNotPaid, id, invoice.PaymentStatus)
+	}
+
+	brand := receipt.BrandFor(merchant)
+	return &Receipt{
+		Invoice: invoice,
+		ETag:    receipt.ETag(invoice, brand),
+		brand:   brand,
+	}, nil
+}
+
+// PDF renders the receipt as a PDF document
+func (r *Receipt) PDF() ([]byte, error) {
+	return receipt.Render(r.Invoice, r.brand)
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"payment_service/config"
+	"payment_service/domain/model"
+	"payment_service/internal/repository"
+)
+
+func TestGetReceipt(t *testing.T) {
+	ctx := context.Background()
+	merchants := repository.NewMemoryMerchantStore(model.Merchant{
+		TenantID: "brand-a", Name: "Brand A", TmnCode: "BRANDA01", HashSecret: "secret", Active: true,
+	})
+	invoiceSvc := NewInvoiceService(repository.NewMemoryStore(repository.NewMemoryInvoiceStore()))
+	svc := NewReceiptService(invoiceSvc, NewMerchantService(merchants, config.NewVNPayStore(config.VNPayConfig{}), model.Seller{}))
+
+	invoice, err := invoiceSvc.CreateInvoice(ctx, model.Merchant{TenantID: "brand-a"}, model.VNPayPaymentRequest{
+		CustomerID: "customer-1",
+		TicketID:   "ticket-1",
+		Amount:     100000,
+	}, "5001")
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+
+	if _, err := svc.GetReceipt(ctx, "brand-a", invoice.InvoiceID); !errors.Is(err, ErrInvoiceNotPaid) {
+		t.Errorf("GetReceipt of a pending invoice error = %v, want ErrInvoiceNotPaid", err)
+	}
+
+	vnpayData := map[string]string{"bankCode": "NCB", "transactionNo": "14123456", "payDate": "20260504095959"}
+	if err := invoiceSvc.UpdateInvoicePaymentStatus(ctx, "brand-a", "5001", model.PaymentStatusCompleted, vnpayData, model.InvoiceChange{Actor: model.InvoiceActorIPN}); err != nil {
+		t.Fatalf("UpdateInvoicePaymentStatus: %v", err)
+	}
+
+	receipt, err := svc.GetReceipt(ctx, "brand-a", invoice.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetReceipt: %v", err)
+	}
+	if receipt.ETag == "" {
+		t.Error("receipt has no ETag")
+	}
+	body, err := receipt.PDF()
+	if err != nil {
+		t.Fatalf("PDF: %v", err)
+	}
+	if !bytes.HasPrefix(body, []byte("%PDF-")) {
+		t.Errorf("PDF output is not a PDF: %q", body[:16])
+	}
+
+	if _, err := svc.GetReceipt(ctx, "other", invoice.InvoiceID); !errors.Is(err, ErrUnknownMerchant) {
+		t.Errorf("GetReceipt for another tenant error = %v, want ErrUnknownMerchant", err)
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// SigningKey is a VNPay hash secret together with an identifier that is safe to log
+type SigningKey struct {
+	ID        string
+	Secret    string
+	Primary   bool
+	ExpiresAt time.Time
+}
+
+// active reports whether the key may still verify signatures at the given time
+func (k SigningKey) active(now time.Time) bool {
+	return k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt)
+}
+
+// Signer signs requests with the primary secret and verifies callbacks against
+// every secret that is active, which allows rotating VNPay hash secrets without
+// rejecting payments signed with the previous one.
+type Signer struct {
+	keys []SigningKey
+	now  func() time.Time
+}
+
+// NewSigner creates a signer using primary for signing. Secondary secrets are
+// accepted for verification until secondaryExpiresAt; a zero time keeps them
+// active until they are removed from configuration.
+func NewSigner(primary string, secondary []string, secondaryExpiresAt time.Time) *Signer {
+	keys := []SigningKey{{ID: KeyID(primary), Secret: primary, Primary: true}}
+	for _, secret := range secondary {
+		if secret == "" || secret == primary {
+			continue
+		}
+		keys = append(keys, SigningKey{ID: KeyID(secret), Secret: secret, ExpiresAt: secondaryExpiresAt})
+	}
+
+	return &Signer{
+		keys: keys,
+		now:  time.Now,
+	}
+}
+
+// KeyID returns a short, non-reversible identifier for a secret
+func KeyID(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:4])
+}
+
+// Sign returns the HMAC-SHA512 of data using the primary secret
+func (s *Signer) Sign(data string) string {
+	return hmacSHA512(s.keys[0].Secret, data)
+}
+
+// Verify checks signature against every active secret and returns the key that matched
+func (s *Signer) Verify(data, signature string) (SigningKey, bool) {
+	now := s.now()
+	given := []byte(strings.ToLower(signature))
+	for _, key := range s.keys {
+		if !key.active(now) {
+			continue
+		}
+		if hmac.Equal([]byte(hmacSHA512(key.Secret, data)), given) {
+			return key, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// hmacSHA512 returns the hex-encoded HMAC-SHA512 of data
+func hmacSHA512(secret, data string) string {
+	hmacObj := hmac.New(sha512.New, []byte(secret))
+	hmacObj.Write([]byte(data))
+	return hex.EncodeToString(hmacObj.Sum(nil))
+}
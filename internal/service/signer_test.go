@@ -0,0 +1,80 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	const data = "vnp_Amount=9500000&vnp_TxnRef=123456789012"
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	signer := NewSigner("new-secret", []string{"old-secret", "new-secret", ""}, now.Add(time.Hour))
+	signer.now = func() time.Time { return now }
+
+	// Requests are signed with the primary secret only
+	signature := signer.Sign(data)
+	if signature != hmacSHA512("new-secret", data) {
+		t.Errorf("Sign did not use the primary secret")
+	}
+
+	tests := []struct {
+		name        string
+		signature   string
+		wantOK      bool
+		wantKey     string
+		wantPrimary bool
+	}{
+		{"primary", signature, true, KeyID("new-secret"), true},
+		{"primary in upper case", strings.ToUpper(signature), true, KeyID("new-secret"), true},
+		{"secondary", hmacSHA512("old-secret", data), true, KeyID("old-secret"), false},
+		{"unknown secret", hmacSHA512("other-secret", data), false, "", false},
+		{"tampered data", hmacSHA512("new-secret", data+"0"), false, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := signer.Verify(data, tt.signature)
+			if ok != tt.wantOK || key.ID != tt.wantKey || key.Primary != tt.wantPrimary {
+				t.Errorf("Verify = %+v, %t, want key %q (primary %t), %t", key, ok, tt.wantKey, tt.wantPrimary, tt.wantOK)
+			}
+		})
+	}
+
+	// The primary secret is not repeated as a secondary one, nor is an empty secret added
+	if len(signer.keys) != 2 {
+		t.Errorf("signer holds %d keys, want 2", len(signer.keys))
+	}
+}
+
+func TestSignerSecondaryExpiry(t *testing.T) {
+	const data = "vnp_TxnRef=123456789012"
+	expiresAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	secondary := hmacSHA512("old-secret", data)
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		now       time.Time
+		wantOK    bool
+	}{
+		{"before expiry", expiresAt, expiresAt.Add(-time.Second), true},
+		{"at expiry", expiresAt, expiresAt, false},
+		{"after expiry", expiresAt, expiresAt.Add(time.Hour), false},
+		{"without expiry", time.Time{}, expiresAt.Add(24 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := NewSigner("new-secret", []string{"old-secret"}, tt.expiresAt)
+			signer.now = func() time.Time { return tt.now }
+
+			if _, ok := signer.Verify(data, secondary); ok != tt.wantOK {
+				t.Errorf("Verify with the secondary secret = %t, want %t", ok, tt.wantOK)
+			}
+			// The primary secret never expires
+			if _, ok := signer.Verify(data, signer.Sign(data)); !ok {
+				t.Error("Verify rejected the primary secret")
+			}
+		})
+	}
+}
@@ -2,10 +2,12 @@ package service
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha512"
-	"encoding/hex"
+	crand "crypto/rand"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"math/big"
 	"math/rand"
 	"net/url"
 	"sort"
@@ -13,38 +15,79 @@ import (
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"payment_service/config"
 	"payment_service/domain/model"
+	"payment_service/internal/metrics"
+	"payment_service/internal/repository"
+	"payment_service/internal/tracing"
 )
 
 // VNPayService handles the VNPay payment integration
 type VNPayService struct {
-	config     *config.VNPayConfig
-	invoiceSvc *InvoiceService
+	config      *config.VNPayStore
+	invoiceSvc  *InvoiceService
+	merchantSvc *MerchantService
 }
 
 // NewVNPayService creates a new VNPay service
-func NewVNPayService(cfg *config.VNPayConfig, invoiceSvc *InvoiceService) *VNPayService {
+func NewVNPayService(cfg *config.VNPayStore, invoiceSvc *InvoiceService, merchantSvc *MerchantService) *VNPayService {
 	return &VNPayService{
-		config:     cfg,
-		invoiceSvc: invoiceSvc,
+		config:      cfg,
+		invoiceSvc:  invoiceSvc,
+		merchantSvc: merchantSvc,
 	}
 }
 
-// CreatePayment creates a new payment URL for VNPay
-func (s *VNPayService) CreatePayment(ctx context.Context, req model.VNPayPaymentRequest) (*model.VNPayPaymentResponse, error) {
-	// Initialize random seed
-	rand.Seed(time.Now().UnixNano())
+// txnRefAttempts is how many transaction references CreatePayment draws
+// before giving up on finding a free one
+const txnRefAttempts = 3
 
-	// Set transaction reference (order ID)
-	txnRef := strconv.Itoa(rand.Intn(9999999) + 1000000)
+// newTxnRef returns a random 12-digit transaction reference. References are
+// unique per tenant, and the space is large enough for collisions to be rare.
+func newTxnRef() (string, error) {
+	n, err := crand.Int(crand.Reader, big.NewInt(9e11))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate transaction reference: %w", err)
+	}
+	return strconv.FormatInt(n.Int64()+1e11, 10), nil
+}
 
-	// Create invoice in database
-	invoice, err := s.invoiceSvc.CreateInvoice(ctx, req, txnRef)
+// CreatePayment creates a new payment URL for VNPay using the tenant's merchant.
+// ipAddr is the customer's IP address, sent to VNPay as vnp_IpAddr.
+func (s *VNPayService) CreatePayment(ctx context.Context, tenantID string, req model.VNPayPaymentRequest, ipAddr string) (_ *model.VNPayPaymentResponse, err error) {
+	ctx, span := tracing.Start(ctx, "VNPayService.CreatePayment", trace.WithAttributes(attribute.String("tenant.id", tenantID)))
+	defer func() { tracing.End(span, err) }()
+
+	// Resolve the VNPay terminal for the tenant
+	merchant, err := s.merchantSvc.GetByTenantID(ctx, tenantID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create invoice: %w", err)
+		return nil, err
 	}
 
+	// Create invoice in database under a fresh transaction reference (order
+	// ID), drawing another one in the unlikely case it is already taken
+	var txnRef string
+	var invoice model.Invoice
+	for attempt := 1; ; attempt++ {
+		txnRef, err = newTxnRef()
+		if err != nil {
+			return nil, err
+		}
+		invoice, err = s.invoiceSvc.CreateInvoice(ctx, merchant, req, txnRef)
+		if errors.Is(err, repository.ErrDuplicate) && attempt < txnRefAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create invoice: %w", err)
+		}
+		break
+	}
+	span.SetAttributes(attribute.String("invoice.id", invoice.InvoiceID.String()), attribute.String("vnpay.txn_ref", txnRef))
+	metrics.PaymentsCreated.WithLabelValues(metrics.BankCode(req.BankCode)).Inc()
+
 	// Get current time for transaction
 	now := time.Now()
 	createDate := now.Format("20060102150405")
@@ -52,22 +95,38 @@ func (s *VNPayService) CreatePayment(ctx context.Context, req model.VNPayPayment
 	// Calculate expiry time (15 minutes from now)
 	expireTime := now.Add(15 * time.Minute).Format("20060102150405")
 
-	// Convert amount to VND cents (multiply by 100)
-	amountInCents := int(req.Amount * 100)
+	// Charge the invoice's final amount (after discount and tax), converted
+	// to VND cents (multiply by 100)
+	amountInCents := int(math.Round(invoice.FinalAmount * 100))
+
+	// Fall back to the generic category when no order type is given
+	orderType := req.OrderType
+	if orderType == "" {
+		orderType = model.DefaultVNPayOrderType
+	}
+
+	// Snapshot the VNPay settings so a concurrent reload cannot mix values
+	cfg := s.config.Load()
+
+	// Use the merchant's return URL when it has its own
+	returnURL := merchant.ReturnURL
+	if returnURL == "" {
+		returnURL = cfg.ReturnURL
+	}
 
 	// Create input data map
 	inputData := map[string]string{
 		"vnp_Version":    "2.1.0",
-		"vnp_TmnCode":    s.config.TmnCode,
+		"vnp_TmnCode":    merchant.TmnCode,
 		"vnp_Amount":     strconv.Itoa(amountInCents),
 		"vnp_Command":    "pay",
 		"vnp_CreateDate": createDate,
 		"vnp_CurrCode":   "VND",
-		"vnp_IpAddr":     "127.0.0.1", // This should be passed from the controller
+		"vnp_IpAddr":     ipAddr,
 		"vnp_Locale":     req.Language,
 		"vnp_OrderInfo":  fmt.Sprintf("Thanh toan cho don hang %s", invoice.InvoiceNumber),
-		"vnp_OrderType":  "other",
-		"vnp_ReturnUrl":  s.config.ReturnURL,
+		"vnp_OrderType":  orderType,
+		"vnp_ReturnUrl":  returnURL,
 		"vnp_TxnRef":     txnRef,
 		"vnp_ExpireDate": expireTime,
 	}
@@ -111,13 +170,11 @@ func (s *VNPayService) CreatePayment(ctx context.Context, req model.VNPayPayment
 	}
 
 	// Create the payment URL
-	vnpURL := s.config.VNPayURL + "?" + queryBuilder.String()
+	vnpURL := cfg.VNPayURL + "?" + queryBuilder.String()
 
 	// Calculate secure hash
 	hashData := hashDataBuilder.String()
-	hmacObj := hmac.New(sha512.New, []byte(s.config.HashSecret))
-	hmacObj.Write([]byte(hashData))
-	vnpSecureHash := hex.EncodeToString(hmacObj.Sum(nil))
+	vnpSecureHash := s.merchantSvc.Signer(merchant).Sign(hashData)
 
 	// Add secure hash to URL
 	vnpURL = vnpURL + "&vnp_SecureHash=" + vnpSecureHash
@@ -141,10 +198,19 @@ func (s *VNPayService) CreatePayment(ctx context.Context, req model.VNPayPayment
 }
 
 // ProcessReturn processes the return from VNPay payment gateway
-func (s *VNPayService) ProcessReturn(ctx context.Context, queryParams url.Values) (*model.VNPayReturnResponse, error) {
+func (s *VNPayService) ProcessReturn(ctx context.Context, queryParams url.Values) (_ *model.VNPayReturnResponse, err error) {
+	ctx, span := tracing.Start(ctx, "VNPayService.ProcessReturn", trace.WithAttributes(callbackAttributes(queryParams)...))
+	defer func() { tracing.End(span, err) }()
+
 	// Get the secure hash from the query
 	vnpSecureHash := queryParams.Get("vnp_SecureHash")
 
+	// Resolve the merchant (and its secret) from the terminal code
+	merchant, merchantErr := s.merchantSvc.GetByTmnCode(ctx, queryParams.Get("vnp_TmnCode"))
+	if merchantErr != nil && !errors.Is(merchantErr, ErrUnknownMerchant) {
+		return nil, fmt.Errorf("failed to resolve merchant: %w", merchantErr)
+	}
+
 	// Create a map to store all "vnp_" parameters
 	inputData := make(map[string]string)
 	for key, values := range queryParams {
@@ -171,14 +237,16 @@ func (s *VNPayService) ProcessReturn(ctx context.Context, queryParams url.Values
 		hashDataBuilder.WriteString(url.QueryEscape(inputData[k]))
 	}
 
-	// Calculate secure hash
+	// Verify the secure hash against the merchant's active secrets; an
+	// unknown terminal can never be valid
 	hashData := hashDataBuilder.String()
-	hmacObj := hmac.New(sha512.New, []byte(s.config.HashSecret))
-	hmacObj.Write([]byte(hashData))
-	secureHash := hex.EncodeToString(hmacObj.Sum(nil))
-
-	// Verify the secure hash
-	isValidSignature := secureHash == vnpSecureHash
+	isValidSignature := false
+	if merchantErr == nil {
+		isValidSignature = s.verifySignature("return", merchant, hashData, vnpSecureHash)
+	} else {
+		metrics.SignatureFailures.WithLabelValues("vnpay_return", "unknown_terminal").Inc()
+	}
+	span.SetAttributes(attribute.Bool("vnpay.signature_valid", isValidSignature))
 
 	// Get amount, convert to number
 	amountStr := queryParams.Get("vnp_Amount")
@@ -196,6 +264,7 @@ func (s *VNPayService) ProcessReturn(ctx context.Context, queryParams url.Values
 		"transactionNo": queryParams.Get("vnp_TransactionNo"),
 		"bankCode":      queryParams.Get("vnp_BankCode"),
 		"payDate":       queryParams.Get("vnp_PayDate"),
+		"cardType":      queryParams.Get("vnp_CardType"),
 	}
 
 	// Prepare result message
@@ -211,20 +280,30 @@ func (s *VNPayService) ProcessReturn(ctx context.Context, queryParams url.Values
 			paymentStatus = model.PaymentStatusFailed
 		}
 
-		// Update invoice payment status
-		err := s.invoiceSvc.UpdateInvoicePaymentStatus(ctx, txnRef, paymentStatus, vnpayData)
+		// Update a pending invoice charged the amount paid; the IPN may have
+		// confirmed the order already
+		change := model.InvoiceChange{Actor: model.InvoiceActorReturn, SourceID: vnpayData["transactionNo"]}
+		outcome, err := s.applyCallback(ctx, merchant.TenantID, queryParams, paymentStatus, vnpayData, change)
 		if err != nil {
 			return nil, fmt.Errorf("failed to update invoice: %w", err)
 		}
+		switch outcome {
+		case callbackApplied:
+			recordPaymentOutcome(paymentStatus, vnpayData["bankCode"])
+		case callbackInvalidAmount:
+			result = "Invalid amount"
+		}
 	} else {
 		result = "Invalid signature"
 	}
 
 	// Get invoice ID for the transaction
-	invoice, err := s.invoiceSvc.GetInvoiceByVNPayTxnRef(ctx, txnRef)
 	var invoiceID string
-	if err == nil {
-		invoiceID = invoice.InvoiceID.String()
+	if merchantErr == nil {
+		invoice, err := s.invoiceSvc.GetInvoiceByVNPayTxnRef(ctx, merchant.TenantID, txnRef)
+		if err == nil {
+			invoiceID = invoice.InvoiceID.String()
+		}
 	}
 
 	// Return payment result
@@ -242,11 +321,40 @@ func (s *VNPayService) ProcessReturn(ctx context.Context, queryParams url.Values
 	}, nil
 }
 
-// ProcessIPN processes the Instant Payment Notification from VNPay
+// ProcessIPN processes the Instant Payment Notification from VNPay and
+// records the RspCode it answers with
 func (s *VNPayService) ProcessIPN(ctx context.Context, queryParams url.Values) (*model.VNPayIPNResponse, error) {
+	ctx, span := tracing.Start(ctx, "VNPayService.ProcessIPN", trace.WithAttributes(callbackAttributes(queryParams)...))
+	response, err := s.processIPN(ctx, queryParams)
+	span.SetAttributes(attribute.String("vnpay.rsp_code", response.RspCode))
+	tracing.End(span, err)
+
+	metrics.IPNResponses.WithLabelValues(response.RspCode).Inc()
+	return response, err
+}
+
+// processIPN processes the Instant Payment Notification from VNPay
+func (s *VNPayService) processIPN(ctx context.Context, queryParams url.Values) (*model.VNPayIPNResponse, error) {
 	// Get the secure hash from the query
 	vnpSecureHash := queryParams.Get("vnp_SecureHash")
 
+	// Resolve the merchant (and its secret) from the terminal code
+	merchant, err := s.merchantSvc.GetByTmnCode(ctx, queryParams.Get("vnp_TmnCode"))
+	if errors.Is(err, ErrUnknownMerchant) {
+		metrics.SignatureFailures.WithLabelValues("vnpay_ipn", "unknown_terminal").Inc()
+		return &model.VNPayIPNResponse{
+			RspCode: "97",
+			Message: "Invalid signature",
+		}, nil
+	}
+	if err != nil {
+		// VNPay retries the IPN until it is confirmed
+		return &model.VNPayIPNResponse{
+			RspCode: "99",
+			Message: "Unknown error",
+		}, fmt.Errorf("failed to resolve merchant: %w", err)
+	}
+
 	// Create a map to store all "vnp_" parameters
 	inputData := make(map[string]string)
 	for key, values := range queryParams {
@@ -273,11 +381,7 @@ func (s *VNPayService) ProcessIPN(ctx context.Context, queryParams url.Values) (
 		hashDataBuilder.WriteString(url.QueryEscape(inputData[k]))
 	}
 
-	// Calculate secure hash
 	hashData := hashDataBuilder.String()
-	hmacObj := hmac.New(sha512.New, []byte(s.config.HashSecret))
-	hmacObj.Write([]byte(hashData))
-	secureHash := hex.EncodeToString(hmacObj.Sum(nil))
 
 	// Prepare return data
 	returnData := &model.VNPayIPNResponse{
@@ -286,9 +390,8 @@ func (s *VNPayService) ProcessIPN(ctx context.Context, queryParams url.Values) (
 	}
 
 	// Verify the secure hash
-	if secureHash == vnpSecureHash {
+	if s.verifySignature("ipn", merchant, hashData, vnpSecureHash) {
 		// Get transaction data
-		txnRef := queryParams.Get("vnp_TxnRef")
 		responseCode := queryParams.Get("vnp_ResponseCode")
 		transactionStatus := queryParams.Get("vnp_TransactionStatus")
 
@@ -297,53 +400,37 @@ func (s *VNPayService) ProcessIPN(ctx context.Context, queryParams url.Values) (
 			"transactionNo": queryParams.Get("vnp_TransactionNo"),
 			"bankCode":      queryParams.Get("vnp_BankCode"),
 			"payDate":       queryParams.Get("vnp_PayDate"),
-		}
-
-		// Try to get the invoice
-		invoice, err := s.invoiceSvc.GetInvoiceByVNPayTxnRef(ctx, txnRef)
-		if err != nil {
-			returnData.RspCode = "01"
-			returnData.Message = "Order not found"
-			return returnData, nil
-		}
-
-		// Verify amount
-		vnpAmount := queryParams.Get("vnp_Amount")
-		amount, _ := strconv.Atoi(vnpAmount)
-		amount = amount / 100 // Convert back from VND cents
-
-		expectedAmount := int(invoice.FinalAmount * 100)
-		if amount != expectedAmount {
-			returnData.RspCode = "04"
-			returnData.Message = "Invalid amount"
-			return returnData, nil
-		}
-
-		// Check if payment is already processed
-		if invoice.PaymentStatus != model.PaymentStatusPending {
-			returnData.RspCode = "02"
-			returnData.Message = "Order already confirmed"
-			return returnData, nil
+			"cardType":      queryParams.Get("vnp_CardType"),
 		}
 
 		// Update payment status based on VNPay response
-		var paymentStatus model.PaymentStatus
+		paymentStatus := model.PaymentStatusFailed
 		if responseCode == "00" && transactionStatus == "00" {
 			paymentStatus = model.PaymentStatusCompleted
-		} else {
-			paymentStatus = model.PaymentStatusFailed
 		}
 
-		// Update invoice payment status
-		err = s.invoiceSvc.UpdateInvoicePaymentStatus(ctx, txnRef, paymentStatus, vnpayData)
+		change := model.InvoiceChange{Actor: model.InvoiceActorIPN, SourceID: vnpayData["transactionNo"]}
+		outcome, err := s.applyCallback(ctx, merchant.TenantID, queryParams, paymentStatus, vnpayData, change)
 		if err != nil {
 			returnData.RspCode = "99"
 			returnData.Message = "Error updating payment status"
 			return returnData, err
 		}
-
-		returnData.RspCode = "00"
-		returnData.Message = "Confirm Success"
+		switch outcome {
+		case callbackOrderNotFound:
+			returnData.RspCode = "01"
+			returnData.Message = "Order not found"
+		case callbackInvalidAmount:
+			returnData.RspCode = "04"
+			returnData.Message = "Invalid amount"
+		case callbackAlreadyConfirmed:
+			returnData.RspCode = "02"
+			returnData.Message = "Order already confirmed"
+		default:
+			returnData.RspCode = "00"
+			returnData.Message = "Confirm Success"
+			recordPaymentOutcome(paymentStatus, vnpayData["bankCode"])
+		}
 	} else {
 		returnData.RspCode = "97"
 		returnData.Message = "Invalid signature"
@@ -352,8 +439,82 @@ func (s *VNPayService) ProcessIPN(ctx context.Context, queryParams url.Values) (
 	return returnData, nil
 }
 
-// QueryTransaction prepares data for querying a transaction
-func (s *VNPayService) QueryTransaction(ctx context.Context, req model.VNPayQueryRequest, ipAddr string) (map[string]string, error) {
+// callbackOutcome is what a VNPay callback did to its invoice
+type callbackOutcome int
+
+const (
+	callbackApplied callbackOutcome = iota
+	callbackOrderNotFound
+	callbackInvalidAmount
+	callbackAlreadyConfirmed
+)
+
+// applyCallback records a payment outcome reported by the return URL or the
+// IPN on its invoice, under a row lock so concurrent callbacks for the same
+// order cannot both see it pending. Only a pending invoice whose final amount
+// matches vnp_Amount is changed, and a completed one is charged its fee.
+func (s *VNPayService) applyCallback(ctx context.Context, tenantID string, queryParams url.Values, status model.PaymentStatus, vnpayData map[string]string, change model.InvoiceChange) (callbackOutcome, error) {
+	var outcome callbackOutcome
+	err := s.invoiceSvc.WithTx(ctx, func(tx *InvoiceService) error {
+		txnRef := queryParams.Get("vnp_TxnRef")
+		invoice, err := tx.GetInvoiceByVNPayTxnRefForUpdate(ctx, tenantID, txnRef)
+		if errors.Is(err, repository.ErrNotFound) {
+			outcome = callbackOrderNotFound
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Verify amount; both sides are in VND cents
+		amount, _ := strconv.Atoi(queryParams.Get("vnp_Amount"))
+		if amount != int(math.Round(invoice.FinalAmount*100)) {
+			outcome = callbackInvalidAmount
+			return nil
+		}
+
+		// Paid, failed, cancelled and voided invoices are left as they are
+		if invoice.PaymentStatus != model.PaymentStatusPending {
+			outcome = callbackAlreadyConfirmed
+			return nil
+		}
+
+		if err := tx.UpdateInvoicePaymentStatus(ctx, tenantID, txnRef, status, vnpayData, change); err != nil {
+			return err
+		}
+		outcome = callbackApplied
+		if status == model.PaymentStatusCompleted {
+			return s.chargeFee(ctx, tx, invoice, vnpayData)
+		}
+		return nil
+	})
+	return outcome, err
+}
+
+// chargeFee records the fee VNPay charges the tenant on a completed
+// invoice's payment, according to the bank and card type paid with
+func (s *VNPayService) chargeFee(ctx context.Context, tx *InvoiceService, invoice model.Invoice, vnpayData map[string]string) error {
+	schedule, err := s.merchantSvc.FeeSchedule(ctx, invoice.TenantID)
+	if err != nil {
+		return err
+	}
+	fee := schedule.Fee(vnpayData["bankCode"], vnpayData["cardType"], invoice.FinalAmount)
+	return tx.RecordVNPayFee(ctx, invoice, fee)
+}
+
+// QueryTransaction prepares data for querying a tenant's transaction
+func (s *VNPayService) QueryTransaction(ctx context.Context, tenantID string, req model.VNPayQueryRequest, ipAddr string) (_ map[string]string, err error) {
+	ctx, span := tracing.Start(ctx, "VNPayService.QueryTransaction", trace.WithAttributes(
+		attribute.String("tenant.id", tenantID), attribute.String("vnpay.txn_ref", req.TxnRef),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	// Resolve the VNPay terminal for the tenant
+	merchant, err := s.merchantSvc.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create a request ID
 	requestId := strconv.Itoa(rand.Intn(9999) + 1)
 
@@ -365,7 +526,7 @@ func (s *VNPayService) QueryTransaction(ctx context.Context, req model.VNPayQuer
 		"vnp_RequestId":       requestId,
 		"vnp_Version":         "2.1.0",
 		"vnp_Command":         "querydr",
-		"vnp_TmnCode":         s.config.TmnCode,
+		"vnp_TmnCode":         merchant.TmnCode,
 		"vnp_TxnRef":          req.TxnRef,
 		"vnp_OrderInfo":       "Query transaction",
 		"vnp_TransactionDate": req.TransactionDate,
@@ -391,9 +552,7 @@ func (s *VNPayService) QueryTransaction(ctx context.Context, req model.VNPayQuer
 	)
 
 	// Calculate checksum
-	hmacObj := hmac.New(sha512.New, []byte(s.config.HashSecret))
-	hmacObj.Write([]byte(hashData))
-	checksum := hex.EncodeToString(hmacObj.Sum(nil))
+	checksum := s.merchantSvc.Signer(merchant).Sign(hashData)
 
 	// Add checksum to request
 	dataRequest["vnp_SecureHash"] = checksum
@@ -401,23 +560,37 @@ func (s *VNPayService) QueryTransaction(ctx context.Context, req model.VNPayQuer
 	return dataRequest, nil
 }
 
-// RefundTransaction prepares data for refunding a transaction
-func (s *VNPayService) RefundTransaction(ctx context.Context, req model.VNPayRefundRequest, ipAddr string) (map[string]string, error) {
+// RefundTransaction prepares data for refunding a tenant's transaction
+func (s *VNPayService) RefundTransaction(ctx context.Context, tenantID string, req model.VNPayRefundRequest, ipAddr string) (_ map[string]string, err error) {
+	ctx, span := tracing.Start(ctx, "VNPayService.RefundTransaction", trace.WithAttributes(
+		attribute.String("tenant.id", tenantID), attribute.String("vnpay.txn_ref", req.TxnRef),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	// Resolve the VNPay terminal for the tenant
+	merchant, err := s.merchantSvc.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create a request ID
 	requestId := strconv.Itoa(rand.Intn(9999) + 1)
 
 	// Get current time for request
 	createDate := time.Now().Format("20060102150405")
 
+	// The refund is sent to VNPay and posted to the ledger to the cent
+	req.Amount = model.RoundAmount(req.Amount)
+
 	// Convert amount to VND cents (multiply by 100)
-	amountInCents := int(req.Amount * 100)
+	amountInCents := int(math.Round(req.Amount * 100))
 
 	// Build data request
 	refundData := map[string]string{
 		"vnp_RequestId":       requestId,
 		"vnp_Version":         "2.1.0",
 		"vnp_Command":         "refund",
-		"vnp_TmnCode":         s.config.TmnCode,
+		"vnp_TmnCode":         merchant.TmnCode,
 		"vnp_TransactionType": req.TransactionType, // 02: full refund, 03: partial refund
 		"vnp_TxnRef":          req.TxnRef,
 		"vnp_Amount":          strconv.Itoa(amountInCents),
@@ -451,22 +624,51 @@ func (s *VNPayService) RefundTransaction(ctx context.Context, req model.VNPayRef
 	)
 
 	// Calculate checksum
-	hmacObj := hmac.New(sha512.New, []byte(s.config.HashSecret))
-	hmacObj.Write([]byte(hashData))
-	checksum := hex.EncodeToString(hmacObj.Sum(nil))
+	checksum := s.merchantSvc.Signer(merchant).Sign(hashData)
 
 	// Add checksum to request
 	refundData["vnp_SecureHash"] = checksum
 
-	// If successful, update invoice status
-	_, err := s.invoiceSvc.GetInvoiceByVNPayTxnRef(ctx, req.TxnRef)
-	if err == nil {
-		vnpayData := map[string]string{}
-		err = s.invoiceSvc.UpdateInvoicePaymentStatus(ctx, req.TxnRef, model.PaymentStatusRefunded, vnpayData)
-		if err != nil {
-			return refundData, fmt.Errorf("failed to update invoice status: %w", err)
-		}
+	// Record the refund on the invoice and post it to the ledger. A voided
+	// invoice stays voided when the payment is refunded.
+	change := model.InvoiceChange{Actor: model.InvoiceActorAdmin, SourceID: requestId}
+	err = s.invoiceSvc.RefundInvoice(ctx, merchant.TenantID, req.TxnRef, req.Amount, change)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return refundData, fmt.Errorf("failed to update invoice status: %w", err)
 	}
 
 	return refundData, nil
 }
+
+// callbackAttributes returns the span attributes identifying the payment a
+// VNPay callback is about; the rest of the callback stays out of traces
+func callbackAttributes(queryParams url.Values) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("vnpay.tmn_code", queryParams.Get("vnp_TmnCode")),
+		attribute.String("vnpay.txn_ref", queryParams.Get("vnp_TxnRef")),
+	}
+}
+
+// recordPaymentOutcome counts a payment a callback marked completed or failed
+func recordPaymentOutcome(status model.PaymentStatus, bankCode string) {
+	switch status {
+	case model.PaymentStatusCompleted:
+		metrics.PaymentsCompleted.WithLabelValues(metrics.BankCode(bankCode)).Inc()
+	case model.PaymentStatusFailed:
+		metrics.PaymentsFailed.WithLabelValues(metrics.BankCode(bankCode)).Inc()
+	}
+}
+
+// verifySignature checks a callback signature against the merchant's active
+// secrets and records which key verified it
+func (s *VNPayService) verifySignature(callback string, merchant model.Merchant, hashData, signature string) bool {
+	key, ok := s.merchantSvc.Signer(merchant).Verify(hashData, signature)
+	if !ok {
+		metrics.SignatureFailures.WithLabelValues("vnpay_"+callback, "invalid").Inc()
+		log.Printf("VNPay %s callback for terminal %s failed signature verification", callback, merchant.TmnCode)
+		return false
+	}
+
+	metrics.SignatureVerifications.WithLabelValues(merchant.TmnCode, key.ID).Inc()
+	return true
+}
@@ -0,0 +1,522 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"payment_service/config"
+	"payment_service/domain/model"
+	"payment_service/internal/metrics"
+	"payment_service/internal/repository"
+)
+
+const (
+	testTmnCode    = "DEFAULT1"
+	testHashSecret = "default-secret"
+)
+
+// newTestVNPayService wires the VNPay service to in-memory stores
+func newTestVNPayService(t *testing.T, merchants ...model.Merchant) (*VNPayService, repository.InvoiceStore) {
+	t.Helper()
+
+	cfg := config.NewVNPayStore(config.VNPayConfig{
+		TmnCode:    testTmnCode,
+		HashSecret: testHashSecret,
+		VNPayURL:   "https://sandbox.vnpayment.vn/paymentv2/vpcpay.html",
+		ReturnURL:  "http://localhost:8080/api/vnpay/return",
+	})
+	invoices := repository.NewMemoryInvoiceStore()
+	invoiceSvc := NewInvoiceService(repository.NewMemoryStore(invoices))
+	merchantSvc := NewMerchantService(repository.NewMemoryMerchantStore(merchants...), cfg, model.Seller{})
+
+	return NewVNPayService(cfg, invoiceSvc, merchantSvc), invoices
+}
+
+// createTestPayment creates a payment and returns the query parameters of its URL
+func createTestPayment(t *testing.T, svc *VNPayService, tenantID string) url.Values {
+	t.Helper()
+
+	resp, err := svc.CreatePayment(context.Background(), tenantID, model.VNPayPaymentRequest{
+		CustomerID:     "customer-1",
+		TicketID:       "ticket-1",
+		Amount:         100000,
+		Language:       "vn",
+		DiscountAmount: 10000,
+		TaxAmount:      5000,
+	}, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+
+	paymentURL, err := url.Parse(resp.Data.PaymentURL)
+	if err != nil {
+		t.Fatalf("parse payment URL: %v", err)
+	}
+	return paymentURL.Query()
+}
+
+// signedCallback builds VNPay callback parameters signed with secret
+func signedCallback(secret string, params map[string]string) url.Values {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	values := url.Values{}
+	for _, k := range keys {
+		parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(params[k]))
+		values.Set(k, params[k])
+	}
+	values.Set("vnp_SecureHash", hmacSHA512(secret, strings.Join(parts, "&")))
+	return values
+}
+
+// ipnParams returns the callback parameters VNPay sends for a payment
+func ipnParams(payment url.Values, responseCode string) map[string]string {
+	return map[string]string{
+		"vnp_Amount":            payment.Get("vnp_Amount"),
+		"vnp_BankCode":          "NCB",
+		"vnp_OrderInfo":         payment.Get("vnp_OrderInfo"),
+		"vnp_PayDate":           "20260101120000",
+		"vnp_ResponseCode":      responseCode,
+		"vnp_TmnCode":           payment.Get("vnp_TmnCode"),
+		"vnp_TransactionNo":     "14000001",
+		"vnp_TransactionStatus": responseCode,
+		"vnp_TxnRef":            payment.Get("vnp_TxnRef"),
+	}
+}
+
+func TestCreatePayment(t *testing.T) {
+	svc, invoices := newTestVNPayService(t)
+	payment := createTestPayment(t, svc, model.DefaultTenantID)
+
+	if got := payment.Get("vnp_Amount"); got != "9500000" {
+		t.Errorf("vnp_Amount = %s, want final amount 95000 in cents", got)
+	}
+	if got := payment.Get("vnp_IpAddr"); got != "203.0.113.7" {
+		t.Errorf("vnp_IpAddr = %s, want the client IP", got)
+	}
+	if got := payment.Get("vnp_OrderType"); got != model.DefaultVNPayOrderType {
+		t.Errorf("vnp_OrderType = %s, want %s", got, model.DefaultVNPayOrderType)
+	}
+
+	signature := payment.Get("vnp_SecureHash")
+	payment.Del("vnp_SecureHash")
+	params := make(map[string]string)
+	for k := range payment {
+		params[k] = payment.Get(k)
+	}
+	if want := signedCallback(testHashSecret, params).Get("vnp_SecureHash"); signature != want {
+		t.Errorf("payment URL signature does not verify with the merchant secret")
+	}
+
+	invoice, err := invoices.GetInvoiceByVNPayTxnRef(context.Background(), model.DefaultTenantID, payment.Get("vnp_TxnRef"))
+	if err != nil {
+		t.Fatalf("invoice not stored: %v", err)
+	}
+	if invoice.VNPayTmnCode != testTmnCode || invoice.PaymentStatus != model.PaymentStatusPending {
+		t.Errorf("stored invoice = %+v", invoice)
+	}
+}
+
+// collidingStore reports the first invoices created as taken, as when a
+// transaction reference drawn for a payment is already in use
+type collidingStore struct {
+	repository.Store
+	collisions *int
+}
+
+func (s collidingStore) Invoices() repository.InvoiceStore {
+	return collidingInvoices{InvoiceStore: s.Store.Invoices(), collisions: s.collisions}
+}
+
+func (s collidingStore) WithTx(ctx context.Context, fn func(tx repository.Store) error) error {
+	return s.Store.WithTx(ctx, func(tx repository.Store) error {
+		return fn(collidingStore{Store: tx, collisions: s.collisions})
+	})
+}
+
+type collidingInvoices struct {
+	repository.InvoiceStore
+	collisions *int
+}
+
+func (s collidingInvoices) CreateInvoice(ctx context.Context, invoice model.Invoice) (model.Invoice, error) {
+	if *s.collisions > 0 {
+		*s.collisions--
+		return model.Invoice{}, repository.ErrDuplicate
+	}
+	return s.InvoiceStore.CreateInvoice(ctx, invoice)
+}
+
+func TestCreatePaymentTxnRef(t *testing.T) {
+	for _, tt := range []struct {
+		collisions int
+		wantErr    bool
+	}{
+		{0, false},
+		{txnRefAttempts - 1, false},
+		{txnRefAttempts, true},
+	} {
+		cfg := config.NewVNPayStore(config.VNPayConfig{TmnCode: testTmnCode, HashSecret: testHashSecret})
+		collisions := tt.collisions
+		store := collidingStore{Store: repository.NewMemoryStore(repository.NewMemoryInvoiceStore()), collisions: &collisions}
+		svc := NewVNPayService(cfg, NewInvoiceService(store), NewMerchantService(repository.NewMemoryMerchantStore(), cfg, model.Seller{}))
+
+		resp, err := svc.CreatePayment(context.Background(), model.DefaultTenantID, model.VNPayPaymentRequest{Amount: 100000}, "203.0.113.7")
+		if tt.wantErr {
+			if !errors.Is(err, repository.ErrDuplicate) {
+				t.Errorf("%d collisions: err = %v, want ErrDuplicate", tt.collisions, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d collisions: CreatePayment: %v", tt.collisions, err)
+		}
+		if got := strconv.Itoa(resp.Data.TxnRef); len(got) != 12 {
+			t.Errorf("%d collisions: txn_ref = %s, want 12 digits", tt.collisions, got)
+		}
+	}
+}
+
+func TestProcessIPN(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		mutate     func(params map[string]string)
+		wantCode   string
+		wantStatus model.PaymentStatus
+	}{
+		{"success", testHashSecret, nil, "00", model.PaymentStatusCompleted},
+		{"payment failed", testHashSecret, func(p map[string]string) {
+			p["vnp_ResponseCode"], p["vnp_TransactionStatus"] = "24", "02"
+		}, "00", model.PaymentStatusFailed},
+		{"invalid signature", "wrong-secret", nil, "97", model.PaymentStatusPending},
+		{"unknown terminal", testHashSecret, func(p map[string]string) { p["vnp_TmnCode"] = "UNKNOWN1" }, "97", model.PaymentStatusPending},
+		{"unknown order", testHashSecret, func(p map[string]string) { p["vnp_TxnRef"] = "1" }, "01", model.PaymentStatusPending},
+		{"wrong amount", testHashSecret, func(p map[string]string) { p["vnp_Amount"] = "100" }, "04", model.PaymentStatusPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, invoices := newTestVNPayService(t)
+			payment := createTestPayment(t, svc, model.DefaultTenantID)
+
+			params := ipnParams(payment, "00")
+			if tt.mutate != nil {
+				tt.mutate(params)
+			}
+
+			resp, err := svc.ProcessIPN(context.Background(), signedCallback(tt.secret, params))
+			if err != nil {
+				t.Fatalf("ProcessIPN: %v", err)
+			}
+			if resp.RspCode != tt.wantCode {
+				t.Errorf("RspCode = %s (%s), want %s", resp.RspCode, resp.Message, tt.wantCode)
+			}
+
+			invoice, err := invoices.GetInvoiceByVNPayTxnRef(context.Background(), model.DefaultTenantID, payment.Get("vnp_TxnRef"))
+			if err != nil {
+				t.Fatalf("GetInvoiceByVNPayTxnRef: %v", err)
+			}
+			if invoice.PaymentStatus != tt.wantStatus {
+				t.Errorf("PaymentStatus = %s, want %s", invoice.PaymentStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestProcessIPNAlreadyConfirmed(t *testing.T) {
+	svc, _ := newTestVNPayService(t)
+	payment := createTestPayment(t, svc, model.DefaultTenantID)
+	callback := signedCallback(testHashSecret, ipnParams(payment, "00"))
+
+	if resp, _ := svc.ProcessIPN(context.Background(), callback); resp.RspCode != "00" {
+		t.Fatalf("first IPN RspCode = %s, want 00", resp.RspCode)
+	}
+	if resp, _ := svc.ProcessIPN(context.Background(), callback); resp.RspCode != "02" {
+		t.Errorf("repeated IPN RspCode = %s, want 02", resp.RspCode)
+	}
+}
+
+func TestProcessIPNConcurrentDelivery(t *testing.T) {
+	svc, invoices := newTestVNPayService(t)
+	payment := createTestPayment(t, svc, model.DefaultTenantID)
+	callback := signedCallback(testHashSecret, ipnParams(payment, "00"))
+
+	// VNPay retries IPNs, so the same notification can arrive concurrently
+	const deliveries = 10
+	codes := make(chan string, deliveries)
+	var wg sync.WaitGroup
+	for i := 0; i < deliveries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := svc.ProcessIPN(context.Background(), callback)
+			if err != nil {
+				t.Errorf("ProcessIPN: %v", err)
+				return
+			}
+			codes <- resp.RspCode
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[string]int)
+	for code := range codes {
+		counts[code]++
+	}
+	if counts["00"] != 1 || counts["02"] != deliveries-1 {
+		t.Errorf("response codes = %v, want one 00 and %d 02", counts, deliveries-1)
+	}
+
+	invoice, err := invoices.GetInvoiceByVNPayTxnRef(context.Background(), model.DefaultTenantID, payment.Get("vnp_TxnRef"))
+	if err != nil {
+		t.Fatalf("GetInvoiceByVNPayTxnRef: %v", err)
+	}
+	if invoice.PaymentStatus != model.PaymentStatusCompleted {
+		t.Errorf("PaymentStatus = %s, want %s", invoice.PaymentStatus, model.PaymentStatusCompleted)
+	}
+}
+
+func TestProcessIPNSecretRotation(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	active := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		wantCode  string
+	}{
+		{"secondary secret within window", &active, "00"},
+		{"secondary secret without expiry", nil, "00"},
+		{"secondary secret expired", &expired, "97"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newTestVNPayService(t, model.Merchant{
+				TenantID:                 "brand-a",
+				TmnCode:                  "BRANDA01",
+				HashSecret:               "new-secret",
+				SecondaryHashSecrets:     []string{"old-secret"},
+				SecondarySecretsExpireAt: tt.expiresAt,
+				Active:                   true,
+			})
+			payment := createTestPayment(t, svc, "brand-a")
+
+			resp, err := svc.ProcessIPN(context.Background(), signedCallback("old-secret", ipnParams(payment, "00")))
+			if err != nil {
+				t.Fatalf("ProcessIPN: %v", err)
+			}
+			if resp.RspCode != tt.wantCode {
+				t.Errorf("RspCode = %s (%s), want %s", resp.RspCode, resp.Message, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestProcessIPNTenantIsolation(t *testing.T) {
+	svc, _ := newTestVNPayService(t,
+		model.Merchant{TenantID: "brand-a", TmnCode: "BRANDA01", HashSecret: "secret-a", Active: true},
+		model.Merchant{TenantID: "brand-b", TmnCode: "BRANDB01", HashSecret: "secret-b", Active: true},
+	)
+	payment := createTestPayment(t, svc, "brand-b")
+
+	// A correctly signed callback from brand A's terminal cannot settle brand B's order
+	params := ipnParams(payment, "00")
+	params["vnp_TmnCode"] = "BRANDA01"
+	resp, err := svc.ProcessIPN(context.Background(), signedCallback("secret-a", params))
+	if err != nil {
+		t.Fatalf("ProcessIPN: %v", err)
+	}
+	if resp.RspCode != "01" {
+		t.Errorf("RspCode = %s (%s), want 01", resp.RspCode, resp.Message)
+	}
+}
+
+// unavailableMerchantStore fails lookups by terminal, as during a database outage
+type unavailableMerchantStore struct {
+	repository.MerchantStore
+}
+
+func (unavailableMerchantStore) GetMerchantByTmnCode(context.Context, string) (model.Merchant, error) {
+	return model.Merchant{}, errors.New("connection refused")
+}
+
+func TestProcessIPNMerchantLookupFailure(t *testing.T) {
+	merchant := model.Merchant{TenantID: "brand-a", TmnCode: "BRANDA01", HashSecret: "secret-a", Active: true}
+	cfg := config.NewVNPayStore(config.VNPayConfig{TmnCode: testTmnCode, HashSecret: testHashSecret})
+	invoiceSvc := NewInvoiceService(repository.NewMemoryStore(repository.NewMemoryInvoiceStore()))
+	merchants := unavailableMerchantStore{repository.NewMemoryMerchantStore(merchant)}
+	svc := NewVNPayService(cfg, invoiceSvc, NewMerchantService(merchants, cfg, model.Seller{}))
+	payment := createTestPayment(t, svc, "brand-a")
+
+	// An outage is not a bad signature: VNPay must retry the callback later
+	resp, err := svc.ProcessIPN(context.Background(), signedCallback("secret-a", ipnParams(payment, "00")))
+	if err == nil {
+		t.Error("ProcessIPN hid the merchant lookup failure")
+	}
+	if resp == nil || resp.RspCode != "99" {
+		t.Errorf("resp = %+v, want RspCode 99", resp)
+	}
+
+	if _, err := svc.ProcessReturn(context.Background(), signedCallback("secret-a", ipnParams(payment, "00"))); err == nil {
+		t.Error("ProcessReturn hid the merchant lookup failure")
+	}
+}
+
+func TestProcessReturn(t *testing.T) {
+	ctx := context.Background()
+	svc, invoices := newTestVNPayService(t)
+	status := func(payment url.Values) model.PaymentStatus {
+		t.Helper()
+		invoice, err := invoices.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, payment.Get("vnp_TxnRef"))
+		if err != nil {
+			t.Fatalf("GetInvoiceByVNPayTxnRef: %v", err)
+		}
+		return invoice.PaymentStatus
+	}
+
+	// A return for an unknown order changes nothing
+	unknown := ipnParams(createTestPayment(t, svc, model.DefaultTenantID), "00")
+	unknown["vnp_TxnRef"] = "999999999999"
+	if _, err := svc.ProcessReturn(ctx, signedCallback(testHashSecret, unknown)); err != nil {
+		t.Errorf("ProcessReturn for an unknown order: %v", err)
+	}
+
+	// A return reporting another amount leaves the invoice to the IPN, which
+	// checks the amount as well
+	payment := createTestPayment(t, svc, model.DefaultTenantID)
+	params := ipnParams(payment, "00")
+	params["vnp_Amount"] = "100"
+	resp, err := svc.ProcessReturn(ctx, signedCallback(testHashSecret, params))
+	if err != nil {
+		t.Fatalf("ProcessReturn: %v", err)
+	}
+	if resp.Result != "Invalid amount" || status(payment) != model.PaymentStatusPending {
+		t.Errorf("return with another amount = %q, invoice %s, want Invalid amount and PENDING", resp.Result, status(payment))
+	}
+	if ipn, _ := svc.ProcessIPN(ctx, signedCallback(testHashSecret, params)); ipn.RspCode != "04" {
+		t.Errorf("IPN with another amount RspCode = %s, want 04", ipn.RspCode)
+	}
+
+	// Only pending invoices are changed: a failed payment stays failed
+	if _, err := svc.ProcessReturn(ctx, signedCallback(testHashSecret, ipnParams(payment, "24"))); err != nil {
+		t.Fatalf("ProcessReturn: %v", err)
+	}
+	if _, err := svc.ProcessReturn(ctx, signedCallback(testHashSecret, ipnParams(payment, "00"))); err != nil {
+		t.Fatalf("ProcessReturn: %v", err)
+	}
+	if got := status(payment); got != model.PaymentStatusFailed {
+		t.Errorf("PaymentStatus after a later successful return = %s, want FAILED", got)
+	}
+}
+
+func TestInvoiceHistory(t *testing.T) {
+	ctx := context.Background()
+	svc, invoices := newTestVNPayService(t)
+	payment := createTestPayment(t, svc, model.DefaultTenantID)
+	txnRef := payment.Get("vnp_TxnRef")
+
+	// The return confirms the payment; the IPN arriving after it changes nothing
+	if _, err := svc.ProcessReturn(ctx, signedCallback(testHashSecret, ipnParams(payment, "00"))); err != nil {
+		t.Fatalf("ProcessReturn: %v", err)
+	}
+	if resp, _ := svc.ProcessIPN(ctx, signedCallback(testHashSecret, ipnParams(payment, "00"))); resp.RspCode != "02" {
+		t.Fatalf("IPN RspCode = %s, want 02", resp.RspCode)
+	}
+	refund, err := svc.RefundTransaction(ctx, model.DefaultTenantID, model.VNPayRefundRequest{
+		TxnRef:          txnRef,
+		TransactionType: "02",
+		Amount:          95000,
+		TransactionDate: "20260101120000",
+		CreateBy:        "staff-1",
+	}, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("RefundTransaction: %v", err)
+	}
+	invoice, _ := invoices.GetInvoiceByVNPayTxnRef(ctx, model.DefaultTenantID, txnRef)
+	if _, err := svc.invoiceSvc.VoidInvoice(ctx, model.DefaultTenantID, invoice.InvoiceID, "duplicate order"); err != nil {
+		t.Fatalf("VoidInvoice: %v", err)
+	}
+
+	history, err := svc.invoiceSvc.GetInvoiceHistory(ctx, model.DefaultTenantID, invoice.InvoiceID)
+	if err != nil {
+		t.Fatalf("GetInvoiceHistory: %v", err)
+	}
+	want := []model.InvoiceHistoryEntry{
+		{NewStatus: model.PaymentStatusPending, Actor: model.InvoiceActorAPI},
+		{OldStatus: model.PaymentStatusPending, NewStatus: model.PaymentStatusCompleted, Actor: model.InvoiceActorReturn, SourceID: "14000001"},
+		{OldStatus: model.PaymentStatusCompleted, NewStatus: model.PaymentStatusRefunded, Actor: model.InvoiceActorAdmin, SourceID: refund["vnp_RequestId"]},
+		{OldStatus: model.PaymentStatusRefunded, NewStatus: model.PaymentStatusVoided, Actor: model.InvoiceActorAdmin, Reason: "duplicate order"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("got %d history entries, want %d: %+v", len(history), len(want), history)
+	}
+	for i, entry := range history {
+		if entry.OldStatus != want[i].OldStatus || entry.NewStatus != want[i].NewStatus || entry.Actor != want[i].Actor ||
+			entry.SourceID != want[i].SourceID || entry.Reason != want[i].Reason {
+			t.Errorf("history entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+
+	if _, err := svc.invoiceSvc.GetInvoiceHistory(ctx, "other", invoice.InvoiceID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("another tenant's history error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPaymentMetrics(t *testing.T) {
+	svc, _ := newTestVNPayService(t)
+	counter := func(c prometheus.Collector) float64 { return testutil.ToFloat64(c) }
+
+	created := counter(metrics.PaymentsCreated.WithLabelValues("NONE"))
+	completed := counter(metrics.PaymentsCompleted.WithLabelValues("NCB"))
+	confirmed := counter(metrics.IPNResponses.WithLabelValues("00"))
+	alreadyConfirmed := counter(metrics.IPNResponses.WithLabelValues("02"))
+	invalid := counter(metrics.SignatureFailures.WithLabelValues("vnpay_ipn", "invalid"))
+	verified := counter(metrics.SignatureVerifications.WithLabelValues(testTmnCode, KeyID(testHashSecret)))
+
+	callback := signedCallback(testHashSecret, ipnParams(createTestPayment(t, svc, model.DefaultTenantID), "00"))
+	for i := 0; i < 2; i++ {
+		if _, err := svc.ProcessIPN(context.Background(), callback); err != nil {
+			t.Fatalf("ProcessIPN: %v", err)
+		}
+	}
+	callback.Set("vnp_SecureHash", "forged")
+	if _, err := svc.ProcessIPN(context.Background(), callback); err != nil {
+		t.Fatalf("ProcessIPN: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		metric prometheus.Collector
+		before float64
+		want   float64
+	}{
+		{"payments created", metrics.PaymentsCreated.WithLabelValues("NONE"), created, 1},
+		// A repeated IPN does not complete the payment again
+		{"payments completed", metrics.PaymentsCompleted.WithLabelValues("NCB"), completed, 1},
+		{"IPN RspCode 00", metrics.IPNResponses.WithLabelValues("00"), confirmed, 1},
+		{"IPN RspCode 02", metrics.IPNResponses.WithLabelValues("02"), alreadyConfirmed, 1},
+		{"IPN signature failures", metrics.SignatureFailures.WithLabelValues("vnpay_ipn", "invalid"), invalid, 1},
+		{"signature verifications", metrics.SignatureVerifications.WithLabelValues(testTmnCode, KeyID(testHashSecret)), verified, 2},
+	} {
+		if got := counter(tt.metric) - tt.before; got != tt.want {
+			t.Errorf("%s increased by %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package token verifies the HS256 JSON Web Tokens end users present to read
+// their own invoices. Tokens are issued by the customer-facing login service,
+// which shares the signing secret.
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned when a token is malformed, badly signed or expired
+var ErrInvalidToken = errors.New("invalid access token")
+
+// ScopeAdmin in a token's scope marks a staff member, who may read every customer's invoices
+const ScopeAdmin = "admin"
+
+// Claims are the claims of an end-user access token
+type Claims struct {
+	// Subject is the customer ID of the end user
+	Subject string `json:"sub"`
+	// TenantID is the tenant the user belongs to; empty means the default tenant
+	TenantID string `json:"tenant,omitempty"`
+	// Scope is a space-separated list of scopes
+	Scope     string `json:"scope,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// Admin reports whether the token's scope includes admin
+func (c Claims) Admin() bool {
+	for _, scope := range strings.Fields(c.Scope) {
+		if scope == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// header is the only JOSE header accepted
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Sign returns an HS256 token carrying the claims
+func Sign(secret []byte, claims Claims) (string, error) {
+	headerJSON, err := json.Marshal(header{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token header: %w", err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token claims: %w", err)
+	}
+
+	signingInput := encode(headerJSON) + "." + encode(claimsJSON)
+	return signingInput + "." + encode(sign(secret, signingInput)), nil
+}
+
+// Verify checks a token's HS256 signature and expiry and returns its claims.
+// Tokens without a subject or an expiry are rejected.
+func Verify(secret []byte, token string, now time.Time) (Claims, error) {
+	if len(secret) == 0 {
+		return Claims{}, fmt.Errorf("%w: no signing secret is configured", ErrInvalidToken)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil || h.Alg != "HS256" {
+		return Claims{}, fmt.Errorf("%w: unsupported token header", ErrInvalidToken)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(secret, parts[0]+"."+parts[1])) {
+		return Claims{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims Claims
+	if err := decodeJSON(parts[1], &claims); err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	if claims.Subject == "" || claims.ExpiresAt == 0 {
+		return Claims{}, fmt.Errorf("%w: subject and expiry are required", ErrInvalidToken)
+	}
+	if !now.Before(time.Unix(claims.ExpiresAt, 0)) {
+		return Claims{}, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// sign returns the HMAC-SHA256 of the signing input
+func sign(secret []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// encode returns the unpadded base64url encoding of data
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeJSON decodes a base64url-encoded JSON segment
+func decodeJSON(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,61 @@
+package token
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("test-secret-of-at-least-32-bytes!")
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	claims := Claims{Subject: "customer-1", TenantID: "brand-a", ExpiresAt: now.Add(time.Hour).Unix()}
+
+	token, err := Sign(secret, claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	got, err := Verify(secret, token, now)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got != claims {
+		t.Errorf("Verify = %+v, want %+v", got, claims)
+	}
+	if got.Admin() {
+		t.Error("token without the admin scope is an admin token")
+	}
+
+	expired, _ := Sign(secret, Claims{Subject: "customer-1", ExpiresAt: now.Unix()})
+	noExpiry, _ := Sign(secret, Claims{Subject: "customer-1"})
+	noSubject, _ := Sign(secret, Claims{ExpiresAt: now.Add(time.Hour).Unix()})
+	otherSecret, _ := Sign([]byte("another-secret"), claims)
+	parts := strings.Split(token, ".")
+	forged, _ := Sign(secret, Claims{Subject: "customer-2", ExpiresAt: claims.ExpiresAt})
+	swapped := parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+
+	for name, bad := range map[string]string{
+		"expired":      expired,
+		"no expiry":    noExpiry,
+		"no subject":   noSubject,
+		"other secret": otherSecret,
+		"swapped":      swapped,
+		"alg none":     unsigned,
+		"malformed":    "not-a-token",
+	} {
+		if _, err := Verify(secret, bad, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: Verify error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+	if _, err := Verify(nil, token, now); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify without a secret error = %v, want ErrInvalidToken", err)
+	}
+
+	admin, _ := Sign(secret, Claims{Subject: "staff-1", Scope: "invoices:read admin", ExpiresAt: claims.ExpiresAt})
+	if got, err := Verify(secret, admin, now); err != nil || !got.Admin() {
+		t.Errorf("Verify admin token = %+v, %v, want an admin token", got, err)
+	}
+}
@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"payment_service/config"
+)
+
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+
+	shutdown, err := Setup(ctx, config.TracingConfig{Exporter: "none"})
+	if err != nil {
+		t.Fatalf("Setup(none): %v", err)
+	}
+	if err := shutdown(ctx); err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+
+	if _, err := Setup(ctx, config.TracingConfig{Exporter: "jaeger"}); err == nil {
+		t.Error("Setup accepted an unknown exporter")
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+
+	// A trace stored as text continues later, e.g. when an outbox event is published
+	stored := Inject(ctx)
+	if stored["traceparent"] == "" {
+		t.Fatalf("Inject = %v, want a traceparent", stored)
+	}
+	_, child := provider.Tracer("test").Start(Extract(context.Background(), stored), "publish")
+	child.End()
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Parent().SpanID() != parent.SpanContext().SpanID() || spans[0].SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Errorf("publish span does not continue the request's trace")
+	}
+
+	// Without a trace there is nothing to store, and nothing to continue
+	if got := Inject(context.Background()); got != nil {
+		t.Errorf("Inject without a trace = %v, want nil", got)
+	}
+	if got := trace.SpanContextFromContext(Extract(context.Background(), nil)); got.IsValid() {
+		t.Errorf("Extract(nil) = %v, want no trace", got)
+	}
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	_, ok := provider.Tracer("test").Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := provider.Tracer("test").Start(context.Background(), "failed")
+	End(failed, errors.New("connection refused"))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans ended, want 2", len(spans))
+	}
+	if spans[0].Status().Code != codes.Unset {
+		t.Errorf("successful span status = %v, want unset", spans[0].Status())
+	}
+	if spans[1].Status().Code != codes.Error || spans[1].Status().Description != "connection refused" || len(spans[1].Events()) != 1 {
+		t.Errorf("failed span status = %v with %d events, want the error recorded", spans[1].Status(), len(spans[1].Events()))
+	}
+}
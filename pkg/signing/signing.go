@@ -0,0 +1,216 @@
+// Package signing signs HTTP requests between services with HMAC-SHA256 and
+// verifies them. A signature covers the method, the path and query, a
+// timestamp, a nonce and a digest of the body, so a signed request cannot be
+// altered in transit, and replays can be rejected by remembering nonces.
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers carrying a request's signature
+const (
+	HeaderKeyID     = "X-Signature-Key-Id"
+	HeaderTimestamp = "X-Signature-Timestamp"
+	HeaderNonce     = "X-Signature-Nonce"
+	HeaderDigest    = "X-Content-SHA256"
+	HeaderSignature = "X-Signature"
+)
+
+// MaxBodySize is the largest request body that is signed or verified
+const MaxBodySize = 1 << 20
+
+// ErrInvalidSignature is returned when a signature is missing, malformed,
+// stale or does not match the request
+var ErrInvalidSignature = errors.New("invalid request signature")
+
+// Signer signs requests with a secret shared with the receiving service
+type Signer struct {
+	KeyID  string
+	Secret []byte
+	// Now returns the current time; it defaults to time.Now
+	Now func() time.Time
+}
+
+// NewSigner creates a new signer for a key ID and its secret
+func NewSigner(keyID, secret string) *Signer {
+	return &Signer{
+		KeyID:  keyID,
+		Secret: []byte(secret),
+		Now:    time.Now,
+	}
+}
+
+// Sign adds the signature headers to req, reading its body and replacing it
+// so the request can still be sent
+func (s *Signer) Sign(req *http.Request) error {
+	body, err := ReadBody(req)
+	if err != nil {
+		return err
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+
+	timestamp := strconv.FormatInt(now().Unix(), 10)
+	nonce := hex.EncodeToString(random)
+	digest := BodyDigest(body)
+	req.Header.Set(HeaderKeyID, s.KeyID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderDigest, digest)
+	req.Header.Set(HeaderSignature, Signature(s.Secret, StringToSign(req.Method, req.URL.RequestURI(), timestamp, nonce, digest)))
+	return nil
+}
+
+// Transport is an http.RoundTripper signing every request it sends
+type Transport struct {
+	Signer *Signer
+	// Base sends the signed requests; it defaults to http.DefaultTransport
+	Base http.RoundTripper
+}
+
+// RoundTrip signs a copy of req and sends it
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	signed := req.Clone(req.Context())
+	if err := t.Signer.Sign(signed); err != nil {
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(signed)
+}
+
+// Signed describes a request whose signature was verified
+type Signed struct {
+	KeyID     string
+	Nonce     string
+	Timestamp time.Time
+}
+
+// Verifier checks the signatures of requests against a set of keys
+type Verifier struct {
+	keys    map[string][]byte
+	maxSkew time.Duration
+}
+
+// NewVerifier creates a verifier accepting the given key IDs and secrets and
+// timestamps at most maxSkew from the current time
+func NewVerifier(keys map[string]string, maxSkew time.Duration) *Verifier {
+	secrets := make(map[string][]byte, len(keys))
+	for keyID, secret := range keys {
+		secrets[keyID] = []byte(secret)
+	}
+	return &Verifier{
+		keys:    secrets,
+		maxSkew: maxSkew,
+	}
+}
+
+// MaxSkew returns how far a request's timestamp may be from the current
+// time; nonces must be remembered for twice as long to reject every replay
+func (v *Verifier) MaxSkew() time.Duration {
+	return v.maxSkew
+}
+
+// IsSigned reports whether a request carries a signature, valid or not
+func IsSigned(req *http.Request) bool {
+	return req.Header.Get(HeaderKeyID) != "" || req.Header.Get(HeaderSignature) != ""
+}
+
+// Verify checks the signature of req, whose body has already been read into
+// body with ReadBody
+func (v *Verifier) Verify(req *http.Request, body []byte, now time.Time) (Signed, error) {
+	keyID := req.Header.Get(HeaderKeyID)
+	signature := req.Header.Get(HeaderSignature)
+	secret, ok := v.keys[keyID]
+	if !ok {
+		return Signed{}, fmt.Errorf("%w: unknown key %q", ErrInvalidSignature, keyID)
+	}
+
+	timestamp := req.Header.Get(HeaderTimestamp)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Signed{}, fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+	signedAt := time.Unix(seconds, 0)
+	if skew := now.Sub(signedAt); skew > v.maxSkew || skew < -v.maxSkew {
+		return Signed{}, fmt.Errorf("%w: timestamp is %s from the server's clock", ErrInvalidSignature, skew.Round(time.Second))
+	}
+
+	nonce := req.Header.Get(HeaderNonce)
+	if nonce == "" {
+		return Signed{}, fmt.Errorf("%w: missing nonce", ErrInvalidSignature)
+	}
+
+	digest := req.Header.Get(HeaderDigest)
+	if !hmac.Equal([]byte(digest), []byte(BodyDigest(body))) {
+		return Signed{}, fmt.Errorf("%w: body does not match its digest", ErrInvalidSignature)
+	}
+
+	want := Signature(secret, StringToSign(req.Method, req.URL.RequestURI(), timestamp, nonce, digest))
+	if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(want)) {
+		return Signed{}, fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+	}
+	return Signed{KeyID: keyID, Nonce: nonce, Timestamp: signedAt}, nil
+}
+
+// StringToSign returns the string a request's signature is computed over
+func StringToSign(method, requestURI, timestamp, nonce, digest string) string {
+	return strings.Join([]string{strings.ToUpper(method), requestURI, timestamp, nonce, digest}, "\n")
+}
+
+// Signature returns the hex HMAC-SHA256 of stringToSign
+func Signature(secret []byte, stringToSign string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BodyDigest returns the hex SHA-256 of a request body
+func BodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadBody reads the body of a request and replaces it, so it can still be
+// sent or handled. Bodies over MaxBodySize are rejected.
+func ReadBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, MaxBodySize+1))
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(body) > MaxBodySize {
+		return nil, fmt.Errorf("request body exceeds %d bytes", MaxBodySize)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
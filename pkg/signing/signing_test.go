@@ -0,0 +1,144 @@
+package signing
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "booking-service-signing-secret-0123456789"
+
+// newSignedRequest returns a request signed by booking at now
+func newSignedRequest(t *testing.T, body string, now time.Time) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/vnpay/create-payment?lang=vn", strings.NewReader(body))
+	signer := NewSigner("booking", testSecret)
+	signer.Now = func() time.Time { return now }
+	if err := signer.Sign(req); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return req
+}
+
+// verify reads the body of req and verifies its signature at now
+func verify(t *testing.T, req *http.Request, now time.Time) (Signed, error) {
+	t.Helper()
+	body, err := ReadBody(req)
+	if err != nil {
+		t.Fatalf("ReadBody: %v", err)
+	}
+	verifier := NewVerifier(map[string]string{"booking": testSecret}, 5*time.Minute)
+	return verifier.Verify(req, body, now)
+}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	req := newSignedRequest(t, `{"amount":100000}`, now)
+
+	// Signing leaves the body to be sent
+	if body, _ := io.ReadAll(req.Body); string(body) != `{"amount":100000}` {
+		t.Fatalf("body after signing = %q", body)
+	}
+	req.Body = io.NopCloser(strings.NewReader(`{"amount":100000}`))
+
+	signed, err := verify(t, req, now)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if signed.KeyID != "booking" || signed.Nonce != req.Header.Get(HeaderNonce) || !signed.Timestamp.Equal(now) {
+		t.Errorf("Signed = %+v", signed)
+	}
+	if !IsSigned(req) {
+		t.Error("IsSigned = false for a signed request")
+	}
+
+	// Every request gets its own nonce
+	if other := newSignedRequest(t, `{"amount":100000}`, now); other.Header.Get(HeaderNonce) == signed.Nonce {
+		t.Error("two requests were signed with the same nonce")
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		signAt time.Time
+		modify func(req *http.Request)
+	}{
+		{"timestamp too old", now.Add(-5*time.Minute - time.Second), nil},
+		{"timestamp too far ahead", now.Add(5*time.Minute + time.Second), nil},
+		{"body changed", now, func(req *http.Request) {
+			req.Body = io.NopCloser(strings.NewReader(`{"amount":1}`))
+		}},
+		{"body and digest changed", now, func(req *http.Request) {
+			req.Body = io.NopCloser(strings.NewReader(`{"amount":1}`))
+			req.Header.Set(HeaderDigest, BodyDigest([]byte(`{"amount":1}`)))
+		}},
+		{"query changed", now, func(req *http.Request) { req.URL.RawQuery = "lang=en" }},
+		{"method changed", now, func(req *http.Request) { req.Method = http.MethodPut }},
+		{"unknown key", now, func(req *http.Request) { req.Header.Set(HeaderKeyID, "other") }},
+		{"malformed timestamp", now, func(req *http.Request) { req.Header.Set(HeaderTimestamp, "yesterday") }},
+		{"missing nonce", now, func(req *http.Request) { req.Header.Del(HeaderNonce) }},
+		{"nonce changed", now, func(req *http.Request) { req.Header.Set(HeaderNonce, "0123") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newSignedRequest(t, `{"amount":100000}`, tt.signAt)
+			if tt.modify != nil {
+				tt.modify(req)
+			}
+			if _, err := verify(t, req, now); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Verify error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+
+	// Timestamps within the allowed skew are accepted
+	for _, skew := range []time.Duration{-5 * time.Minute, 5 * time.Minute} {
+		if _, err := verify(t, newSignedRequest(t, "", now.Add(skew)), now); err != nil {
+			t.Errorf("Verify with a skew of %v: %v", skew, err)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	verifier := NewVerifier(map[string]string{"booking": testSecret}, time.Minute)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ReadBody(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := verifier.Verify(r, body, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{Signer: NewSigner("booking", testSecret)}}
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/vnpay/create-payment?lang=vn", strings.NewReader(`{"amount":100000}`))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != `{"amount":100000}` {
+		t.Errorf("response = %d %q, want the body echoed", resp.StatusCode, body)
+	}
+
+	// The caller's request is left unsigned
+	if IsSigned(req) {
+		t.Error("Transport signed the caller's request")
+	}
+}